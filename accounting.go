@@ -0,0 +1,108 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// AllocCounts are the numbers of live C objects owned by Go values of the
+// package, which are freed by finalizers.
+type AllocCounts struct {
+	SSL     int64 // of connections
+	SSLCtx  int64
+	X509    int64 // of certificates
+	EVPPKey int64 // of keys
+	BIO     int64 // of connections
+}
+
+var (
+	allocTracking int32
+	liveAllocs    AllocCounts
+)
+
+// SetAllocTracking enables or disables counting the live C objects of the
+// package, to detect finalizer leaks in long-running servers. Only the
+// objects created while it is enabled are counted, until they are freed.
+func SetAllocTracking(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&allocTracking, v)
+}
+
+// LiveAllocs returns the numbers of live C objects counted since
+// SetAllocTracking. A number that keeps growing in a steady state points to
+// values kept reachable, so that their finalizers never run. Run
+// runtime.GC first for an accurate snapshot.
+func LiveAllocs() AllocCounts {
+	return AllocCounts{
+		SSL:     atomic.LoadInt64(&liveAllocs.SSL),
+		SSLCtx:  atomic.LoadInt64(&liveAllocs.SSLCtx),
+		X509:    atomic.LoadInt64(&liveAllocs.X509),
+		EVPPKey: atomic.LoadInt64(&liveAllocs.EVPPKey),
+		BIO:     atomic.LoadInt64(&liveAllocs.BIO),
+	}
+}
+
+// trackAlloc counts an allocation if the tracking is enabled and reports
+// whether it did.
+func trackAlloc(count *int64) bool {
+	if atomic.LoadInt32(&allocTracking) == 0 {
+		return false
+	}
+	atomic.AddInt64(count, 1)
+	return true
+}
+
+// untrackAlloc counts the release of an allocation that was tracked.
+func untrackAlloc(count *int64, tracked bool) {
+	trackAllocs(count, -1, tracked)
+}
+
+func trackAllocs(count *int64, delta int64, tracked bool) {
+	if tracked {
+		atomic.AddInt64(count, delta)
+	}
+}
+
+func setCertificateFinalizer(cert *Certificate) {
+	cert.tracked = trackAlloc(&liveAllocs.X509)
+	runtime.SetFinalizer(cert, func(cert *Certificate) {
+		C.X509_free(cert.x)
+		untrackAlloc(&liveAllocs.X509, cert.tracked)
+	})
+}
+
+// clearCertificateFinalizer is called when OpenSSL takes the ownership of
+// the certificate.
+func clearCertificateFinalizer(cert *Certificate) {
+	runtime.SetFinalizer(cert, nil)
+	untrackAlloc(&liveAllocs.X509, cert.tracked)
+	cert.tracked = false
+}
+
+func setPKeyFinalizer(key *pKey) {
+	key.tracked = trackAlloc(&liveAllocs.EVPPKey)
+	runtime.SetFinalizer(key, func(key *pKey) {
+		C.X_EVP_PKEY_free(key.key)
+		untrackAlloc(&liveAllocs.EVPPKey, key.tracked)
+	})
+}
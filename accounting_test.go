@@ -0,0 +1,71 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAllocTracking(t *testing.T) {
+	SetAllocTracking(true)
+	defer SetAllocTracking(false)
+
+	before := LiveAllocs()
+	func() {
+		cert, err := LoadCertificateFromPEM(certBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := LoadPrivateKeyFromPEM(keyBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, err := NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		serverConn, clientConn := NetPipe(t)
+		defer serverConn.Close()
+		conn, err := Client(clientConn, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		live := LiveAllocs()
+		if live.X509-before.X509 != 1 || live.EVPPKey-before.EVPPKey != 1 ||
+			live.SSLCtx-before.SSLCtx != 1 || live.SSL-before.SSL != 1 ||
+			live.BIO-before.BIO != 2 {
+			t.Fatalf("unexpected live allocations %+v before %+v", live,
+				before)
+		}
+		runtime.KeepAlive(cert)
+		runtime.KeepAlive(key)
+		runtime.KeepAlive(conn)
+	}()
+
+	// contexts stay registered for callbacks, so only the other objects
+	// are expected to be freed
+	before.SSLCtx++
+	for i := 0; i < 50; i++ {
+		runtime.GC()
+		if LiveAllocs() == before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("unexpected live allocations %+v before %+v", LiveAllocs(),
+		before)
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// aead implements cipher.AEAD with an EVP AEAD cipher. Every operation
+// uses its own cipher context, so it is safe for concurrent use.
+type aead struct {
+	cipher    *C.EVP_CIPHER
+	key       []byte
+	nonceSize int
+	tagSize   int
+}
+
+// NewAESGCM returns AES-GCM with the key, AES-128, AES-192 or AES-256
+// depending on its size, as a cipher.AEAD with the standard nonce and tag
+// sizes.
+func NewAESGCM(key []byte) (cipher.AEAD, error) {
+	c, err := getGCMCipher(len(key) * 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AES key size %d", len(key))
+	}
+	return newAEAD(c.ptr, key, 12, GCM_TAG_MAXLEN), nil
+}
+
+// NewChaCha20Poly1305 returns ChaCha20-Poly1305 (RFC 8439) with the
+// 32-byte key as a cipher.AEAD. It requires OpenSSL 1.1.0 or newer.
+// OpenSSL has no XChaCha20-Poly1305.
+func NewChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid ChaCha20-Poly1305 key size %d",
+			len(key))
+	}
+	c := C.X_EVP_chacha20_poly1305()
+	if c == nil {
+		return nil, errors.New("ChaCha20-Poly1305 is not supported")
+	}
+	return newAEAD(c, key, 12, 16), nil
+}
+
+func newAEAD(c *C.EVP_CIPHER, key []byte, nonceSize, tagSize int) *aead {
+	return &aead{
+		cipher:    c,
+		key:       append([]byte{}, key...),
+		nonceSize: nonceSize,
+		tagSize:   tagSize,
+	}
+}
+
+func (a *aead) NonceSize() int {
+	return a.nonceSize
+}
+
+func (a *aead) Overhead() int {
+	return a.tagSize
+}
+
+func (a *aead) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != a.nonceSize {
+		panic("openssl: incorrect nonce length given to AEAD")
+	}
+	ret, out := sliceForAppend(dst, len(plaintext)+a.tagSize)
+	if C.X_EVP_AEAD_seal(a.cipher, (*C.uchar)(unsafe.Pointer(&a.key[0])),
+		(*C.uchar)(unsafe.Pointer(&nonce[0])), C.int(len(nonce)),
+		bytesPtr(additionalData), C.int(len(additionalData)),
+		bytesPtr(plaintext), C.int(len(plaintext)),
+		(*C.uchar)(unsafe.Pointer(&out[0])),
+		(*C.uchar)(unsafe.Pointer(&out[len(plaintext)])),
+		C.int(a.tagSize)) != 1 {
+		panic("openssl: AEAD encryption failed")
+	}
+	return ret
+}
+
+func (a *aead) Open(dst, nonce, ciphertext, additionalData []byte) (
+	[]byte, error) {
+	if len(nonce) != a.nonceSize {
+		panic("openssl: incorrect nonce length given to AEAD")
+	}
+	if len(ciphertext) < a.tagSize {
+		return nil, errors.New("openssl: message authentication failed")
+	}
+	tag := ciphertext[len(ciphertext)-a.tagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-a.tagSize]
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	if C.X_EVP_AEAD_open(a.cipher, (*C.uchar)(unsafe.Pointer(&a.key[0])),
+		(*C.uchar)(unsafe.Pointer(&nonce[0])), C.int(len(nonce)),
+		bytesPtr(additionalData), C.int(len(additionalData)),
+		bytesPtr(ciphertext), C.int(len(ciphertext)),
+		(*C.uchar)(unsafe.Pointer(&tag[0])), C.int(a.tagSize),
+		bytesPtr(out)) != 1 {
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, errors.New("openssl: message authentication failed")
+	}
+	return ret, nil
+}
+
+// sliceForAppend extends in by n bytes and returns the whole slice and
+// the extension, like in crypto/cipher.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
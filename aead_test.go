@@ -0,0 +1,142 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+)
+
+func testAEAD(t *testing.T, a, reference cipher.AEAD) {
+	if a.NonceSize() != reference.NonceSize() ||
+		a.Overhead() != reference.Overhead() {
+		t.Fatal("unexpected nonce or tag size")
+	}
+	nonce := make([]byte, a.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, 16, 100, 4096} {
+		plaintext := make([]byte, size)
+		aad := make([]byte, size/2)
+		rand.Read(plaintext)
+		rand.Read(aad)
+
+		prefix := []byte("prefix")
+		sealed := a.Seal(append([]byte{}, prefix...), nonce, plaintext, aad)
+		if !bytes.HasPrefix(sealed, prefix) {
+			t.Fatal("Seal did not append to dst")
+		}
+		sealed = sealed[len(prefix):]
+		want := reference.Seal(nil, nonce, plaintext, aad)
+		if !bytes.Equal(sealed, want) {
+			t.Fatalf("size %d: unexpected ciphertext", size)
+		}
+
+		opened, err := a.Open(nil, nonce, sealed, aad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(opened, plaintext) {
+			t.Fatalf("size %d: unexpected plaintext", size)
+		}
+
+		sealed[0] ^= 1
+		if _, err := a.Open(nil, nonce, sealed, aad); err == nil {
+			t.Fatalf("size %d: opened a forged message", size)
+		}
+		sealed[0] ^= 1
+		if _, err := a.Open(nil, nonce, sealed,
+			append(aad, 0)); err == nil {
+			t.Fatalf("size %d: opened with wrong additional data", size)
+		}
+	}
+	if _, err := a.Open(nil, nonce, make([]byte, a.Overhead()-1),
+		nil); err == nil {
+		t.Fatal("opened a message shorter than the tag")
+	}
+}
+
+func TestAESGCM(t *testing.T) {
+	for _, size := range []int{16, 24, 32} {
+		key := make([]byte, size)
+		rand.Read(key)
+		a, err := NewAESGCM(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reference, err := cipher.NewGCM(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testAEAD(t, a, reference)
+	}
+	if _, err := NewAESGCM(make([]byte, 20)); err == nil {
+		t.Fatal("created AES-GCM with a 20-byte key")
+	}
+}
+
+func TestChaCha20Poly1305(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+
+	// RFC 8439, section 2.8.2
+	key := mustDecodeHex(t, "808182838485868788898a8b8c8d8e8f"+
+		"909192939495969798999a9b9c9d9e9f")
+	nonce := mustDecodeHex(t, "070000004041424344454647")
+	aad := mustDecodeHex(t, "50515253c0c1c2c3c4c5c6c7")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: " +
+		"If I could offer you only one tip for the future, sunscreen " +
+		"would be it.")
+	want := mustDecodeHex(t, "d31a8d34648e60db7b86afbc53ef7ec2"+
+		"a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b"+
+		"1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58"+
+		"fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b"+
+		"6116"+
+		// the tag
+		"1ae10b594f09e26a7e902ecbd0600691")
+
+	a, err := NewChaCha20Poly1305(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := a.Seal(nil, nonce, plaintext, aad)
+	if !bytes.Equal(sealed, want) {
+		t.Fatalf("unexpected ciphertext %x", sealed)
+	}
+	opened, err := a.Open(nil, nonce, sealed, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Fatalf("unexpected plaintext %q", opened)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := a.Open(nil, nonce, sealed, aad); err == nil {
+		t.Fatal("opened a forged message")
+	}
+
+	if _, err := NewChaCha20Poly1305(key[:16]); err == nil {
+		t.Fatal("created ChaCha20-Poly1305 with a 16-byte key")
+	}
+}
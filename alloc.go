@@ -3,11 +3,7 @@ package openssl
 // #include "shim.h"
 import "C"
 
-import (
-	"unsafe"
-
-	"github.com/mattn/go-pointer"
-)
+import "unsafe"
 
 //export go_ssl_crypto_ex_free
 func go_ssl_crypto_ex_free(
@@ -15,5 +11,5 @@ func go_ssl_crypto_ex_free(
 	cryptoData *C.CRYPTO_EX_DATA, idx C.int,
 	argl C.long, argp unsafe.Pointer,
 ) {
-	pointer.Unref(ptr)
+	pointers.Unref(ptr)
 }
@@ -0,0 +1,230 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+	"unsafe"
+)
+
+// GeneralNameType is the kind of a GeneralName, see RFC 5280, section
+// 4.2.1.6.
+type GeneralNameType int
+
+const (
+	GeneralNameOther        GeneralNameType = C.GEN_OTHERNAME
+	GeneralNameEmail        GeneralNameType = C.GEN_EMAIL
+	GeneralNameDNS          GeneralNameType = C.GEN_DNS
+	GeneralNameX400         GeneralNameType = C.GEN_X400
+	GeneralNameDirectory    GeneralNameType = C.GEN_DIRNAME
+	GeneralNameEDIParty     GeneralNameType = C.GEN_EDIPARTY
+	GeneralNameURI          GeneralNameType = C.GEN_URI
+	GeneralNameIP           GeneralNameType = C.GEN_IPADD
+	GeneralNameRegisteredID GeneralNameType = C.GEN_RID
+)
+
+// GeneralName is a name as found in the subject and issuer alternative name
+// extensions. Value is the address of email, DNS and URI names, the textual
+// form of IP addresses, the one-line form of directory names, and the dotted
+// OID of registered IDs and of the type of other names. It is empty for X.400
+// and EDI party names.
+type GeneralName struct {
+	Type  GeneralNameType
+	Value string
+}
+
+// ParseASN1Time parses a DER-encoded UTCTime or GeneralizedTime.
+func ParseASN1Time(der []byte) (time.Time, error) {
+	var t time.Time
+	err := withDER(der, func(p **C.uchar, n C.long) error {
+		tm := C.d2i_ASN1_TIME(nil, p, n)
+		if tm == nil {
+			return fmt.Errorf("failed to parse time: %w",
+				errorFromErrorQueue())
+		}
+		defer C.ASN1_TIME_free(tm)
+		var err error
+		t, err = asn1TimeToTime(tm)
+		return err
+	})
+	return t, err
+}
+
+// ParseASN1Integer parses a DER-encoded INTEGER.
+func ParseASN1Integer(der []byte) (*big.Int, error) {
+	var x *big.Int
+	err := withDER(der, func(p **C.uchar, n C.long) error {
+		i := C.d2i_ASN1_INTEGER(nil, p, n)
+		if i == nil {
+			return fmt.Errorf("failed to parse integer: %w",
+				errorFromErrorQueue())
+		}
+		defer C.ASN1_INTEGER_free(i)
+		var err error
+		x, err = asn1IntegerToBig(i)
+		return err
+	})
+	return x, err
+}
+
+// ParseASN1String parses a DER-encoded character string, such as an
+// UTF8String, PrintableString, IA5String or BMPString, and returns it as
+// UTF-8.
+func ParseASN1String(der []byte) (string, error) {
+	var s string
+	err := withDER(der, func(p **C.uchar, n C.long) error {
+		var out *C.uchar
+		size := C.X_d2i_ASN1_TYPE_utf8(*p, n, &out)
+		switch {
+		case size == -1:
+			return fmt.Errorf("failed to parse string: %w",
+				errorFromErrorQueue())
+		case size < 0:
+			C.ERR_clear_error()
+			return errors.New("value is not a string")
+		}
+		defer C.X_OPENSSL_free(unsafe.Pointer(out))
+		s = C.GoStringN((*C.char)(unsafe.Pointer(out)), size)
+		return nil
+	})
+	return s, err
+}
+
+// ParseGeneralNames parses a DER-encoded sequence of general names, e.g. the
+// value of a subject alternative name extension as returned by
+// Certificate.GetExtensionValue.
+func ParseGeneralNames(der []byte) ([]GeneralName, error) {
+	var names []GeneralName
+	err := withDER(der, func(p **C.uchar, n C.long) error {
+		sk := C.d2i_GENERAL_NAMES(nil, p, n)
+		if sk == nil {
+			return fmt.Errorf("failed to parse general names: %w",
+				errorFromErrorQueue())
+		}
+		defer C.GENERAL_NAMES_free(sk)
+		var err error
+		names, err = generalNamesToGo(sk)
+		return err
+	})
+	return names, err
+}
+
+// withDER calls fn with a copy of der in C memory, since d2i functions
+// advance the pointer they are given.
+func withDER(der []byte, fn func(p **C.uchar, n C.long) error) error {
+	if len(der) == 0 {
+		return errors.New("empty DER input")
+	}
+	buf := C.CBytes(der)
+	defer C.free(buf)
+	p := (*C.uchar)(buf)
+	return fn(&p, C.long(len(der)))
+}
+
+// asn1TimeToTime converts an ASN1_TIME to a UTC time.Time.
+func asn1TimeToTime(tm *C.ASN1_TIME) (time.Time, error) {
+	var sec C.int64_t
+	if tm == nil || C.X_ASN1_TIME_to_unix(tm, &sec) != 1 {
+		C.ERR_clear_error()
+		return time.Time{}, errors.New("failed to convert time")
+	}
+	return time.Unix(int64(sec), 0).UTC(), nil
+}
+
+// asn1IntegerToBig converts an ASN1_INTEGER to a big.Int.
+func asn1IntegerToBig(i *C.ASN1_INTEGER) (*big.Int, error) {
+	bn := C.ASN1_INTEGER_to_BN(i, nil)
+	if bn == nil {
+		return nil, errors.New("failed to convert integer")
+	}
+	n := &BigNum{bn: bn}
+	defer n.Close()
+	return n.Int(), nil
+}
+
+// asn1StringToString converts an ASN1_STRING of any character string type
+// to UTF-8.
+func asn1StringToString(str *C.ASN1_STRING) (string, error) {
+	var out *C.uchar
+	n := C.ASN1_STRING_to_UTF8(&out, str)
+	if n < 0 {
+		C.ERR_clear_error()
+		return "", errors.New("failed to convert string")
+	}
+	defer C.X_OPENSSL_free(unsafe.Pointer(out))
+	return C.GoStringN((*C.char)(unsafe.Pointer(out)), n), nil
+}
+
+// asn1ObjectToText returns the dotted form of obj.
+func asn1ObjectToText(obj *C.ASN1_OBJECT) string {
+	var buf [128]C.char
+	size := C.OBJ_obj2txt(&buf[0], C.int(len(buf)), obj, 1)
+	if size <= 0 || int(size) >= len(buf) {
+		return ""
+	}
+	return C.GoString(&buf[0])
+}
+
+// generalNamesToGo converts a GENERAL_NAMES stack, which stays owned by the
+// caller.
+func generalNamesToGo(sk *C.GENERAL_NAMES) ([]GeneralName, error) {
+	names := make([]GeneralName, 0, int(C.X_sk_GENERAL_NAME_num(sk)))
+	for i := 0; i < cap(names); i++ {
+		name, err := generalNameToGo(C.X_sk_GENERAL_NAME_value(sk, C.int(i)))
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// generalNameToGo converts a single GENERAL_NAME.
+func generalNameToGo(gn *C.GENERAL_NAME) (GeneralName, error) {
+	name := GeneralName{Type: GeneralNameType(C.X_GENERAL_NAME_type(gn))}
+	switch name.Type {
+	case GeneralNameEmail, GeneralNameDNS, GeneralNameURI:
+		s, err := asn1StringToString(C.X_GENERAL_NAME_get0_string(gn))
+		if err != nil {
+			return name, err
+		}
+		name.Value = s
+	case GeneralNameIP:
+		str := C.X_GENERAL_NAME_get0_string(gn)
+		ip := net.IP(C.GoBytes(unsafe.Pointer(C.X_ASN1_STRING_get0_data(str)),
+			C.ASN1_STRING_length(str)))
+		if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+			return name, fmt.Errorf("invalid IP address length %d", len(ip))
+		}
+		name.Value = ip.String()
+	case GeneralNameDirectory:
+		p := C.X509_NAME_oneline(C.X_GENERAL_NAME_get0_dirn(gn), nil, 0)
+		if p == nil {
+			return name, errors.New("failed to convert directory name")
+		}
+		name.Value = C.GoString(p)
+		C.X_OPENSSL_free(unsafe.Pointer(p))
+	case GeneralNameRegisteredID, GeneralNameOther:
+		name.Value = asn1ObjectToText(C.X_GENERAL_NAME_get0_oid(gn))
+	}
+	return name, nil
+}
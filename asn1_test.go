@@ -0,0 +1,146 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseASN1Time(t *testing.T) {
+	want := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tag := range []string{"utc", "generalized"} {
+		der, err := asn1.MarshalWithParams(want, tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseASN1Time(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("%s: got %v, want %v", tag, got, want)
+		}
+	}
+	if _, err := ParseASN1Time([]byte{0x05, 0x00}); err == nil {
+		t.Fatal("expected an error for a NULL")
+	}
+}
+
+func TestParseASN1Integer(t *testing.T) {
+	big1, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	for _, want := range []*big.Int{big.NewInt(0), big.NewInt(-42), big1} {
+		der, err := asn1.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseASN1Integer(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Cmp(want) != 0 {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestParseASN1String(t *testing.T) {
+	for _, tag := range []string{"utf8", "printable", "ia5"} {
+		der, err := asn1.MarshalWithParams("Test 1", tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseASN1String(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "Test 1" {
+			t.Fatalf("%s: got %q", tag, got)
+		}
+	}
+	der, _ := asn1.Marshal(42)
+	if _, err := ParseASN1String(der); err == nil {
+		t.Fatal("expected an error for an integer")
+	}
+}
+
+func TestParseGeneralNames(t *testing.T) {
+	oid, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 3, 4})
+	name := func(tag int, b []byte) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag,
+			Bytes: b}
+	}
+	der, err := asn1.Marshal([]asn1.RawValue{
+		name(1, []byte("user@example.com")),
+		name(2, []byte("example.com")),
+		name(6, []byte("https://example.com/")),
+		name(7, []byte{127, 0, 0, 1}),
+		name(8, oid[2:]),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseGeneralNames(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GeneralName{
+		{GeneralNameEmail, "user@example.com"},
+		{GeneralNameDNS, "example.com"},
+		{GeneralNameURI, "https://example.com/"},
+		{GeneralNameIP, "127.0.0.1"},
+		{GeneralNameRegisteredID, "1.2.3.4"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestCertificateASN1Accessors(t *testing.T) {
+	cert := newTestCertificate(t, "example.com", false, nil).cert
+	notBefore, err := cert.GetNotBefore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter, err := cert.GetNotAfter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := notAfter.Sub(notBefore) - 24*time.Hour; d < 0 || d > time.Second {
+		t.Fatalf("unexpected validity %v - %v", notBefore, notAfter)
+	}
+	if d := time.Since(notBefore); d < 0 || d > time.Minute {
+		t.Fatalf("unexpected not before %v", notBefore)
+	}
+
+	names, err := cert.GetSubjectAltNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GeneralName{{GeneralNameDNS, "example.com"}}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+	raw, err := ParseGeneralNames(cert.GetExtensionValue(NID_subject_alt_name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(raw, want) {
+		t.Fatalf("got %v, want %v", raw, want)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"math/big"
+	"runtime"
+	"unsafe"
+)
+
+// BigNum is an OpenSSL BIGNUM, for arithmetic with the constant-time
+// implementations of OpenSSL.
+type BigNum struct {
+	bn *C.BIGNUM
+}
+
+// NewBigNum returns a BigNum holding x.
+func NewBigNum(x *big.Int) (*BigNum, error) {
+	if x == nil {
+		return nil, errors.New("integer is nil")
+	}
+	n, err := newBigNum()
+	if err != nil {
+		return nil, err
+	}
+	b := x.Bytes()
+	if len(b) > 0 && C.BN_bin2bn((*C.uchar)(unsafe.Pointer(&b[0])),
+		C.int(len(b)), n.bn) == nil {
+		return nil, errors.New("failed to convert integer")
+	}
+	if x.Sign() < 0 {
+		C.BN_set_negative(n.bn, 1)
+	}
+	return n, nil
+}
+
+func newBigNum() (*BigNum, error) {
+	bn := C.BN_new()
+	if bn == nil {
+		return nil, errors.New("failed to allocate BIGNUM")
+	}
+	n := &BigNum{bn: bn}
+	runtime.SetFinalizer(n, func(n *BigNum) { n.Close() })
+	return n, nil
+}
+
+// Close clears and frees the BigNum. It must not be used afterwards.
+func (n *BigNum) Close() {
+	if n.bn != nil {
+		C.BN_clear_free(n.bn)
+		n.bn = nil
+	}
+}
+
+// Int returns the value of the BigNum.
+func (n *BigNum) Int() *big.Int {
+	b := make([]byte, (C.BN_num_bits(n.bn)+7)/8)
+	if len(b) > 0 {
+		C.BN_bn2bin(n.bn, (*C.uchar)(unsafe.Pointer(&b[0])))
+	}
+	x := new(big.Int).SetBytes(b)
+	if C.X_BN_is_negative(n.bn) != 0 {
+		x.Neg(x)
+	}
+	runtime.KeepAlive(n)
+	return x
+}
+
+// BitLen returns the length of the absolute value in bits.
+func (n *BigNum) BitLen() int {
+	return int(C.BN_num_bits(n.bn))
+}
+
+// ModExpConstTime returns base**exp mod m, computed in time independent of
+// the values of base and exp with BN_mod_exp_mont_consttime. The modulus
+// must be odd and the exponent non-negative.
+func ModExpConstTime(base, exp, m *BigNum) (*BigNum, error) {
+	if C.X_BN_is_odd(m.bn) == 0 || C.X_BN_is_negative(m.bn) != 0 {
+		return nil, errors.New("modulus must be odd and positive")
+	}
+	if C.X_BN_is_negative(exp.bn) != 0 {
+		return nil, errors.New("exponent must not be negative")
+	}
+	ctx := C.BN_CTX_new()
+	if ctx == nil {
+		return nil, errors.New("failed to allocate BN_CTX")
+	}
+	defer C.BN_CTX_free(ctx)
+	r, err := newBigNum()
+	if err != nil {
+		return nil, err
+	}
+	C.X_BN_set_flags(exp.bn, C.BN_FLG_CONSTTIME)
+	C.X_BN_set_flags(base.bn, C.BN_FLG_CONSTTIME)
+	if C.BN_mod_exp_mont_consttime(r.bn, base.bn, exp.bn, m.bn, ctx,
+		nil) != 1 {
+		return nil, errors.New("failed to compute modular exponentiation")
+	}
+	runtime.KeepAlive(base)
+	runtime.KeepAlive(exp)
+	runtime.KeepAlive(m)
+	return r, nil
+}
+
+// BigModExpConstTime is ModExpConstTime for math/big integers. The values
+// are still converted in variable time.
+func BigModExpConstTime(base, exp, m *big.Int) (*big.Int, error) {
+	nums := make([]*BigNum, 3)
+	for i, x := range []*big.Int{base, exp, m} {
+		n, err := NewBigNum(x)
+		if err != nil {
+			return nil, err
+		}
+		defer n.Close()
+		nums[i] = n
+	}
+	r, err := ModExpConstTime(nums[0], nums[1], nums[2])
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return r.Int(), nil
+}
@@ -0,0 +1,65 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func TestBigNum(t *testing.T) {
+	for _, s := range []string{"0", "1", "-1", "255", "256",
+		"-123456789012345678901234567890"} {
+		x, _ := new(big.Int).SetString(s, 10)
+		n, err := NewBigNum(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Int().Cmp(x) != 0 {
+			t.Fatalf("got %s, want %s", n.Int(), x)
+		}
+		if n.BitLen() != x.BitLen() {
+			t.Fatalf("%s: got %d bits, want %d", x, n.BitLen(), x.BitLen())
+		}
+		n.Close()
+	}
+}
+
+func TestModExpConstTime(t *testing.T) {
+	m, err := rand.Prime(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		base, _ := rand.Int(rand.Reader, m)
+		exp, _ := rand.Int(rand.Reader, m)
+		got, err := BigModExpConstTime(base, exp, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := new(big.Int).Exp(base, exp, m); got.Cmp(want) != 0 {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+	if _, err := BigModExpConstTime(big.NewInt(2), big.NewInt(3),
+		big.NewInt(10)); err == nil {
+		t.Fatal("accepted an even modulus")
+	}
+	if _, err := BigModExpConstTime(big.NewInt(2), big.NewInt(-3),
+		big.NewInt(11)); err == nil {
+		t.Fatal("accepted a negative exponent")
+	}
+}
@@ -44,6 +44,33 @@ func nonCopyCString(data *C.char, size C.int) []byte {
 
 var writeBioMapping = newMapping()
 
+// writeBioBufferSize fits a full record with its header and the overhead of
+// the cipher.
+const writeBioBufferSize = SSLRecordSize + 1024
+
+// writeBioPool holds the output buffers of the connections that are closed
+// or have released them, so that new connections don't allocate their own.
+var writeBioPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, writeBioBufferSize)
+		return &b
+	},
+}
+
+// releaseBuf returns the empty output buffer to writeBioPool. It must be
+// called with data_mtx held.
+func (wb *writeBio) releaseBuf() {
+	if len(wb.buf) != 0 {
+		return
+	}
+	// the buffers grown by a larger write size are left to the GC
+	if cap(wb.buf) == writeBioBufferSize {
+		buf := wb.buf
+		writeBioPool.Put(&buf)
+	}
+	wb.buf = nil
+}
+
 type writeBio struct {
 	data_mtx        sync.Mutex
 	op_mtx          sync.Mutex
@@ -79,6 +106,9 @@ func go_write_bio_write(b *C.BIO, data *C.char, size C.int) (rc C.int) {
 	ptr.data_mtx.Lock()
 	defer ptr.data_mtx.Unlock()
 	bioClearRetryFlags(b)
+	if ptr.buf == nil {
+		ptr.buf = *writeBioPool.Get().(*[]byte)
+	}
 	ptr.buf = append(ptr.buf, nonCopyCString(data, size)...)
 	return size
 }
@@ -112,6 +142,22 @@ func writeBioPending(b *C.BIO) C.long {
 	return C.long(len(ptr.buf))
 }
 
+// pending returns the number of bytes waiting to be written to the network.
+func (wb *writeBio) pending() int {
+	wb.data_mtx.Lock()
+	defer wb.data_mtx.Unlock()
+	return len(wb.buf)
+}
+
+func (wb *writeBio) setReleaseBuffers(release bool) {
+	wb.data_mtx.Lock()
+	defer wb.data_mtx.Unlock()
+	wb.release_buffers = release
+	if release {
+		wb.releaseBuf()
+	}
+}
+
 func (wb *writeBio) WriteTo(w io.Writer) (rv int64, err error) {
 	wb.op_mtx.Lock()
 	defer wb.op_mtx.Unlock()
@@ -129,8 +175,8 @@ func (wb *writeBio) WriteTo(w io.Writer) (rv int64, err error) {
 	// subtract however much data we wrote from the buffer
 	wb.data_mtx.Lock()
 	wb.buf = wb.buf[:copy(wb.buf, wb.buf[n:])]
-	if wb.release_buffers && len(wb.buf) == 0 {
-		wb.buf = nil
+	if wb.release_buffers {
+		wb.releaseBuf()
 	}
 	wb.data_mtx.Unlock()
 
@@ -142,6 +188,9 @@ func (wb *writeBio) Disconnect(b *C.BIO) {
 		writeBioMapping.Del(token(C.X_BIO_get_data(b)))
 		C.X_BIO_set_data(b, nil)
 	}
+	wb.data_mtx.Lock()
+	wb.releaseBuf()
+	wb.data_mtx.Unlock()
 }
 
 func (wb *writeBio) MakeCBIO() *C.BIO {
@@ -159,6 +208,7 @@ type readBio struct {
 	buf             []byte
 	eof             bool
 	release_buffers bool
+	read_size       int
 }
 
 func loadReadPtr(b *C.BIO) *readBio {
@@ -234,8 +284,8 @@ func (rb *readBio) ReadFromOnce(r io.Reader) (n int, err error) {
 
 	// make sure we have a destination that fits at least one SSL record
 	rb.data_mtx.Lock()
-	if cap(rb.buf) < len(rb.buf)+SSLRecordSize {
-		new_buf := make([]byte, len(rb.buf), len(rb.buf)+SSLRecordSize)
+	if cap(rb.buf) < len(rb.buf)+rb.read_size {
+		new_buf := make([]byte, len(rb.buf), len(rb.buf)+rb.read_size)
 		copy(new_buf, rb.buf)
 		rb.buf = new_buf
 	}
@@ -247,6 +297,11 @@ func (rb *readBio) ReadFromOnce(r io.Reader) (n int, err error) {
 	rb.data_mtx.Lock()
 	defer rb.data_mtx.Unlock()
 	if n > 0 {
+		if cap(rb.buf) < len(rb.buf)+n {
+			// the buffer was released while we were reading
+			rb.buf = append(rb.buf, dst[:n]...)
+			return n, err
+		}
 		if len(dst_slice) != len(rb.buf) {
 			// someone shrunk the buffer, so we read in too far ahead and we
 			// need to slide backwards
@@ -257,6 +312,15 @@ func (rb *readBio) ReadFromOnce(r io.Reader) (n int, err error) {
 	return n, err
 }
 
+func (rb *readBio) setReleaseBuffers(release bool) {
+	rb.data_mtx.Lock()
+	defer rb.data_mtx.Unlock()
+	rb.release_buffers = release
+	if release && len(rb.buf) == 0 {
+		rb.buf = nil
+	}
+}
+
 func (rb *readBio) MakeCBIO() *C.BIO {
 	rv := C.X_BIO_new_read_bio()
 	token := readBioMapping.Add(unsafe.Pointer(rb))
@@ -0,0 +1,54 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import "errors"
+
+const (
+	// DefaultReadBufferSize is the default amount of data a connection
+	// reads from the network at once.
+	DefaultReadBufferSize = SSLRecordSize
+	// DefaultWriteBufferSize is the default largest part of a Conn.Write
+	// passed to OpenSSL at once.
+	DefaultWriteBufferSize = 4 * SSLRecordSize
+)
+
+// SetBufferSizes sets the buffer sizes of the connections created from the
+// context afterwards. read is the amount of data a connection reads from the
+// network at once, and write is the largest part of a Conn.Write passed to
+// OpenSSL at once. Larger sizes let a single cgo call move several records
+// and reduce the overhead of small messages, smaller ones bound the memory
+// of a connection and the time a Write keeps a concurrent Read waiting. Zero
+// restores the default size. It must not be called concurrently with the
+// creation of connections.
+func (c *Ctx) SetBufferSizes(read, write int) error {
+	if read < 0 || write < 0 {
+		return errors.New("negative buffer size")
+	}
+	if read == 0 {
+		read = DefaultReadBufferSize
+	}
+	if write == 0 {
+		write = DefaultWriteBufferSize
+	}
+	c.read_buffer_size = read
+	c.write_buffer_size = write
+	return nil
+}
+
+// BufferSizes returns the buffer sizes set with SetBufferSizes.
+func (c *Ctx) BufferSizes() (read, write int) {
+	return c.read_buffer_size, c.write_buffer_size
+}
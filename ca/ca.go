@@ -0,0 +1,479 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ca implements a small certificate authority: it creates root and
+// intermediate CAs, issues leaf certificates from certificate requests and
+// tracks revocations to generate CRLs.
+//
+// Certificates get the extensions expected from a well-behaved CA: basic
+// constraints with a path length, key usages and subject and authority key
+// identifiers.
+package ca
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tarantool/go-openssl"
+)
+
+const (
+	DefaultRootValidity         = 10 * 365 * 24 * time.Hour
+	DefaultIntermediateValidity = 5 * 365 * 24 * time.Hour
+	DefaultLeafValidity         = 90 * 24 * time.Hour
+	DefaultCRLValidity          = 7 * 24 * time.Hour
+
+	// backdate is subtracted from the issue date of certificates to
+	// tolerate clock skew between the CA and the relying parties.
+	backdate = 5 * time.Minute
+)
+
+// Subject is the subject name of a certificate. Empty fields are omitted,
+// except CommonName which is required.
+type Subject struct {
+	Country            string
+	Organization       string
+	OrganizationalUnit string
+	CommonName         string
+}
+
+func (s Subject) name() (*openssl.Name, error) {
+	if s.CommonName == "" {
+		return nil, errors.New("common name is required")
+	}
+	name, err := openssl.NewName()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range []struct{ field, value string }{
+		{"C", s.Country},
+		{"O", s.Organization},
+		{"OU", s.OrganizationalUnit},
+		{"CN", s.CommonName},
+	} {
+		if e.value == "" {
+			continue
+		}
+		if err := name.AddTextEntry(e.field, e.value); err != nil {
+			return nil, err
+		}
+	}
+	return name, nil
+}
+
+// Options configure a new CA.
+type Options struct {
+	// Key is the key of the CA. If nil, a P-256 EC key is generated.
+	Key openssl.PrivateKey
+	// Validity defaults to DefaultRootValidity or
+	// DefaultIntermediateValidity.
+	Validity time.Duration
+	// MaxPathLen limits the number of intermediate CAs allowed below the CA.
+	// MaxPathLenZero sets a limit of zero. If neither is set, roots have no
+	// limit and intermediates have a limit of zero, so they can only issue
+	// leaf certificates.
+	MaxPathLen     int
+	MaxPathLenZero bool
+	// SignOptions are used for everything the CA signs. A zero Digest means
+	// EVP_SHA256.
+	SignOptions openssl.SignOptions
+}
+
+// LeafOptions configure a leaf certificate.
+type LeafOptions struct {
+	// Validity defaults to DefaultLeafValidity.
+	Validity time.Duration
+	// DNSNames, IPAddresses and EmailAddresses form the subject alternative
+	// name. If all of them are empty, the common name of the request is used
+	// as the DNS name.
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	// ServerAuth and ClientAuth select the extended key usages. If neither
+	// is set, both are.
+	ServerAuth bool
+	ClientAuth bool
+}
+
+// Revocation is a revoked certificate.
+type Revocation struct {
+	Serial    *big.Int
+	RevokedAt time.Time
+}
+
+// Authority is a CA: a CA certificate with its key.
+type Authority struct {
+	Certificate *openssl.Certificate
+	Key         openssl.PrivateKey
+	// Chain holds the certificates from Certificate up to the root,
+	// excluding the root. Serve it after the leaf certificate.
+	Chain       []*openssl.Certificate
+	SignOptions openssl.SignOptions
+
+	mu        sync.Mutex
+	revoked   map[string]Revocation
+	crlNumber *big.Int
+	// crlMu serializes the CRLs, so that their numbers increase
+	crlMu sync.Mutex
+}
+
+// New returns an Authority for an existing CA certificate and its key. chain
+// is the Chain of the Authority, see its description.
+func New(cert *openssl.Certificate, key openssl.PrivateKey,
+	chain []*openssl.Certificate, opts openssl.SignOptions) (*Authority,
+	error) {
+	pub, err := cert.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !pub.Equal(key) {
+		return nil, errors.New("key doesn't match the certificate")
+	}
+	return newAuthority(cert, key, chain, opts), nil
+}
+
+func newAuthority(cert *openssl.Certificate, key openssl.PrivateKey,
+	chain []*openssl.Certificate, opts openssl.SignOptions) *Authority {
+	if opts.Digest == openssl.EVP_NULL {
+		opts.Digest = openssl.EVP_SHA256
+	}
+	return &Authority{
+		Certificate: cert,
+		Key:         key,
+		Chain:       chain,
+		SignOptions: opts,
+		revoked:     make(map[string]Revocation),
+		crlNumber:   big.NewInt(0),
+	}
+}
+
+// NewRoot creates a self-signed root CA.
+func NewRoot(subject Subject, opts Options) (*Authority, error) {
+	if opts.Validity == 0 {
+		opts.Validity = DefaultRootValidity
+	}
+	cert, key, err := newCACertificate(subject, opts, nil, -1)
+	if err != nil {
+		return nil, err
+	}
+	return newAuthority(cert, key, nil, opts.SignOptions), nil
+}
+
+// NewIntermediate creates an intermediate CA issued by a.
+func (a *Authority) NewIntermediate(subject Subject,
+	opts Options) (*Authority, error) {
+	if opts.Validity == 0 {
+		opts.Validity = DefaultIntermediateValidity
+	}
+	cert, key, err := newCACertificate(subject, opts, a, 0)
+	if err != nil {
+		return nil, err
+	}
+	chain := append([]*openssl.Certificate{cert}, a.Chain...)
+	return newAuthority(cert, key, chain, opts.SignOptions), nil
+}
+
+// newCACertificate creates a CA certificate issued by issuer, or self-signed
+// if issuer is nil. defaultPathLen is used if opts sets no path length, -1
+// means no limit.
+func newCACertificate(subject Subject, opts Options, issuer *Authority,
+	defaultPathLen int) (*openssl.Certificate, openssl.PrivateKey, error) {
+	key := opts.Key
+	if key == nil {
+		var err error
+		if key, err = openssl.GenerateECKey(openssl.Prime256v1); err != nil {
+			return nil, nil, err
+		}
+	}
+	name, err := subject.name()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pathLen := defaultPathLen
+	if opts.MaxPathLen > 0 {
+		pathLen = opts.MaxPathLen
+	} else if opts.MaxPathLenZero {
+		pathLen = 0
+	}
+	constraints := "critical,CA:TRUE"
+	if pathLen >= 0 {
+		constraints += ",pathlen:" + strconv.Itoa(pathLen)
+	}
+
+	cert, err := newCertificate(name, key, opts.Validity)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, signOpts := key, opts.SignOptions
+	if signOpts.Digest == openssl.EVP_NULL {
+		signOpts.Digest = openssl.EVP_SHA256
+	}
+	if issuer != nil {
+		if err := cert.SetIssuer(issuer.Certificate); err != nil {
+			return nil, nil, err
+		}
+		signer, signOpts = issuer.Key, issuer.SignOptions
+	}
+	err = addExtensions(cert, []extension{
+		{openssl.NID_basic_constraints, constraints},
+		{openssl.NID_key_usage, "critical,keyCertSign,cRLSign"},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cert.SignWithOptions(signer, signOpts); err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// IssueFromRequest issues a leaf certificate for the subject and the key of
+// req. The request signature is checked first. The DNS names, including the
+// common name used when opts has no names, and the email addresses must be
+// plain names: ones with separators, e.g. commas, or control characters are
+// rejected.
+func (a *Authority) IssueFromRequest(req *openssl.CertificateRequest,
+	opts LeafOptions) (*openssl.Certificate, error) {
+	if err := req.Verify(); err != nil {
+		return nil, err
+	}
+	name, err := req.GetSubjectName()
+	if err != nil {
+		return nil, err
+	}
+	key, err := req.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Validity == 0 {
+		opts.Validity = DefaultLeafValidity
+	}
+
+	var san []string
+	for _, dns := range opts.DNSNames {
+		if err := checkSANValue(dns, false); err != nil {
+			return nil, err
+		}
+		san = append(san, "DNS:"+dns)
+	}
+	for _, ip := range opts.IPAddresses {
+		san = append(san, "IP:"+ip.String())
+	}
+	for _, email := range opts.EmailAddresses {
+		if err := checkSANValue(email, true); err != nil {
+			return nil, err
+		}
+		san = append(san, "email:"+email)
+	}
+	if len(san) == 0 {
+		cn, ok := name.GetEntry(openssl.NID_commonName)
+		if !ok {
+			return nil, errors.New("no subject alternative name and no " +
+				"common name in the request")
+		}
+		if err := checkSANValue(cn, false); err != nil {
+			return nil, err
+		}
+		san = append(san, "DNS:"+cn)
+	}
+
+	var eku []string
+	if opts.ServerAuth || !opts.ClientAuth {
+		eku = append(eku, "serverAuth")
+	}
+	if opts.ClientAuth || !opts.ServerAuth {
+		eku = append(eku, "clientAuth")
+	}
+	usage := "critical,digitalSignature"
+	if key.KeyType() == openssl.KeyTypeRSA {
+		usage += ",keyEncipherment"
+	}
+
+	cert, err := newCertificate(name, key, opts.Validity)
+	if err != nil {
+		return nil, err
+	}
+	if err := cert.SetIssuer(a.Certificate); err != nil {
+		return nil, err
+	}
+	err = addExtensions(cert, []extension{
+		{openssl.NID_basic_constraints, "critical,CA:FALSE"},
+		{openssl.NID_key_usage, usage},
+		{openssl.NID_ext_key_usage, strings.Join(eku, ",")},
+		{openssl.NID_subject_alt_name, strings.Join(san, ",")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := cert.SignWithOptions(a.Key, a.SignOptions); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// checkSANValue rejects the names that would change the meaning of the
+// subjectAltName configuration string they are put in, e.g. a common name of
+// the request adding names with "victim.example,DNS:bank.example".
+func checkSANValue(name string, email bool) error {
+	if name == "" {
+		return errors.New("empty subject alternative name")
+	}
+	for i, r := range name {
+		if r <= ' ' || r >= 0x7f || r == ',' || r == ':' ||
+			(r == '@' && (!email || i == 0)) {
+			return fmt.Errorf("invalid subject alternative name %q", name)
+		}
+	}
+	if email && strings.Count(name, "@") != 1 {
+		return fmt.Errorf("invalid email address %q", name)
+	}
+	return nil
+}
+
+func newCertificate(name *openssl.Name, key openssl.PublicKey,
+	validity time.Duration) (*openssl.Certificate, error) {
+	cert, err := openssl.NewCertificateWithSubject(name,
+		&openssl.CertificateInfo{
+			Issued:  -backdate,
+			Expires: validity,
+		}, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := cert.SetVersion(openssl.X509_V3); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+type extension struct {
+	nid   openssl.NID
+	value string
+}
+
+// addExtensions adds the extensions in order, followed by the subject and
+// authority key identifiers.
+func addExtensions(cert *openssl.Certificate, extensions []extension) error {
+	for _, ext := range extensions {
+		if err := cert.AddExtension(ext.nid, ext.value); err != nil {
+			return err
+		}
+	}
+	return cert.AddKeyIdentifiers()
+}
+
+// Revoke records the certificate with the given serial number as revoked at
+// revokedAt. It is listed in the CRLs generated afterwards.
+func (a *Authority) Revoke(serial *big.Int, revokedAt time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.revoked[serial.String()] = Revocation{
+		Serial:    new(big.Int).Set(serial),
+		RevokedAt: revokedAt,
+	}
+}
+
+// IsRevoked reports whether the certificate with the given serial number is
+// revoked.
+func (a *Authority) IsRevoked(serial *big.Int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.revoked[serial.String()]
+	return ok
+}
+
+// Revoked returns the revoked certificates ordered by serial number, e.g. to
+// persist them. They can be restored with Revoke.
+func (a *Authority) Revoked() []Revocation {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rv := make([]Revocation, 0, len(a.revoked))
+	for _, r := range a.revoked {
+		rv = append(rv, r)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Serial.Cmp(rv[j].Serial) < 0
+	})
+	return rv
+}
+
+// CRLNumber returns the number of the last CRL generated, zero if none, e.g.
+// to persist it. It can be restored with SetCRLNumber.
+func (a *Authority) CRLNumber() *big.Int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return new(big.Int).Set(a.crlNumber)
+}
+
+// SetCRLNumber sets the number of the last CRL generated, so that the next
+// CRL gets the number following it. CRL numbers must increase across the
+// restarts of a CA, so it should be restored from where CRLNumber was
+// persisted.
+func (a *Authority) SetCRLNumber(number *big.Int) error {
+	if number == nil || number.Sign() < 0 {
+		return errors.New("CRL number must not be negative")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.crlNumber = new(big.Int).Set(number)
+	return nil
+}
+
+// CRL generates a CRL of the certificates revoked so far, valid for validity
+// (DefaultCRLValidity if zero). Every CRL gets the number following
+// CRLNumber, which is only advanced when the CRL is generated successfully.
+func (a *Authority) CRL(validity time.Duration) (*openssl.CRL, error) {
+	if validity == 0 {
+		validity = DefaultCRLValidity
+	}
+	a.crlMu.Lock()
+	defer a.crlMu.Unlock()
+	revoked := a.Revoked()
+	number := new(big.Int).Add(a.CRLNumber(), big.NewInt(1))
+
+	now := time.Now()
+	crl, err := openssl.NewCRL(a.Certificate, now.Add(-backdate),
+		now.Add(validity))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range revoked {
+		if err := crl.AddRevoked(r.Serial, r.RevokedAt); err != nil {
+			return nil, err
+		}
+	}
+	if err := crl.SetNumber(number); err != nil {
+		return nil, err
+	}
+	err = crl.AddExtension(openssl.NID_authority_key_identifier,
+		"keyid:always")
+	if err != nil {
+		return nil, err
+	}
+	if err := crl.Sign(a.Key, a.SignOptions); err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.crlNumber = number
+	a.mu.Unlock()
+	return crl, nil
+}
@@ -0,0 +1,235 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tarantool/go-openssl"
+)
+
+func newRequest(t *testing.T, cn string) *openssl.CertificateRequest {
+	key, err := openssl.GenerateECKey(openssl.Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := openssl.NewName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := name.AddTextEntry("CN", cn); err != nil {
+		t.Fatal(err)
+	}
+	req, err := openssl.NewCertificateRequest(name, key,
+		openssl.SignOptions{Digest: openssl.EVP_SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// round trip through PEM, as if the request came from elsewhere
+	pem, err := req.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = openssl.LoadCertificateRequestFromPEM(pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestAuthority(t *testing.T) {
+	root, err := NewRoot(Subject{Organization: "Test", CommonName: "root"},
+		Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := openssl.GenerateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, err := root.NewIntermediate(
+		Subject{Organization: "Test", CommonName: "intermediate"},
+		Options{
+			Key: rsaKey,
+			SignOptions: openssl.SignOptions{
+				Digest: openssl.EVP_SHA384,
+				PSS:    true,
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := intermediate.IssueFromRequest(newRequest(t, "localhost"),
+		LeafOptions{IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+			DNSNames: []string{"localhost"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := leaf.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"CA:FALSE",
+		"DNS:localhost, IP Address:127.0.0.1",
+		"TLS Web Server Authentication, TLS Web Client Authentication",
+		"X509v3 Authority Key Identifier",
+		"Signature Algorithm: rsassaPss",
+	} {
+		if !strings.Contains(text, s) {
+			t.Fatalf("%q not found in:\n%s", s, text)
+		}
+	}
+
+	roots, err := openssl.NewCertificateStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := roots.AddCertificate(root.Certificate); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := openssl.BuildCertificateChain(leaf, intermediate.Chain, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("expected 2 certificates, got %d", len(chain))
+	}
+
+	// The intermediate can't issue CAs by default.
+	sub, err := intermediate.NewIntermediate(Subject{CommonName: "sub"},
+		Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subLeaf, err := sub.IssueFromRequest(newRequest(t, "sub.localhost"),
+		LeafOptions{ClientAuth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openssl.BuildCertificateChain(subLeaf, sub.Chain,
+		roots); err == nil {
+		t.Fatal("expected a path length error")
+	}
+}
+
+func TestAuthorityHostileNames(t *testing.T) {
+	root, err := NewRoot(Subject{CommonName: "root"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostile := "victim.example,DNS:bank.example,IP:10.0.0.1"
+	if _, err := root.IssueFromRequest(newRequest(t, hostile),
+		LeafOptions{}); err == nil {
+		t.Fatal("issued for a hostile common name")
+	}
+	for _, opts := range []LeafOptions{
+		{DNSNames: []string{hostile}},
+		{DNSNames: []string{"victim.example\nDNS:bank.example"}},
+		{EmailAddresses: []string{"a@victim.example,DNS:bank.example"}},
+		{EmailAddresses: []string{"copy"}},
+	} {
+		if _, err := root.IssueFromRequest(newRequest(t, "victim.example"),
+			opts); err == nil {
+			t.Fatalf("issued for hostile names %+v", opts)
+		}
+	}
+
+	leaf, err := root.IssueFromRequest(newRequest(t, "victim.example"),
+		LeafOptions{DNSNames: []string{"*.victim.example"},
+			EmailAddresses: []string{"admin@victim.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("www.victim.example"); err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("bank.example"); err == nil {
+		t.Fatal("certificate is valid for bank.example")
+	}
+}
+
+func TestAuthorityCRL(t *testing.T) {
+	root, err := NewRoot(Subject{CommonName: "root"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := root.IssueFromRequest(newRequest(t, "localhost"),
+		LeafOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial := leaf.GetSerialNumber()
+	root.Revoke(serial, time.Now())
+	if !root.IsRevoked(serial) || len(root.Revoked()) != 1 {
+		t.Fatal("expected the certificate to be revoked")
+	}
+
+	crl, err := root.CRL(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem, err := crl.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err = openssl.LoadCRLFromPEM(pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.Verify(root.Certificate); err != nil {
+		t.Fatal(err)
+	}
+	if !crl.IsRevoked(serial) {
+		t.Fatal("expected the certificate in the CRL")
+	}
+	if crl.IsRevoked(root.Certificate.GetSerialNumber()) {
+		t.Fatal("unexpected certificate in the CRL")
+	}
+	if n := root.CRLNumber(); n.Int64() != 1 {
+		t.Fatalf("unexpected CRL number %v", n)
+	}
+
+	// a failed CRL doesn't use up a number, PSS requires an RSA key
+	opts := root.SignOptions
+	root.SignOptions.PSS = true
+	if _, err := root.CRL(0); err == nil {
+		t.Fatal("expected a signing error")
+	}
+	root.SignOptions = opts
+	if n := root.CRLNumber(); n.Int64() != 1 {
+		t.Fatalf("unexpected CRL number %v after a failure", n)
+	}
+
+	// a restored number is continued
+	if err := root.SetCRLNumber(big.NewInt(41)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.CRL(0); err != nil {
+		t.Fatal(err)
+	}
+	if n := root.CRLNumber(); n.Int64() != 42 {
+		t.Fatalf("unexpected CRL number %v", n)
+	}
+	if err := root.SetCRLNumber(big.NewInt(-1)); err == nil {
+		t.Fatal("expected an error for a negative CRL number")
+	}
+}
@@ -18,6 +18,7 @@ package openssl
 import "C"
 
 import (
+	"crypto/rand"
 	"errors"
 	"io/ioutil"
 	"math/big"
@@ -42,6 +43,14 @@ const (
 	EVP_SHA256    EVP_MD = iota
 	EVP_SHA384    EVP_MD = iota
 	EVP_SHA512    EVP_MD = iota
+	// The SHA-3, BLAKE2 and SHA-512/256 digests require OpenSSL 1.1.1 or newer.
+	EVP_SHA3_224   EVP_MD = iota
+	EVP_SHA3_256   EVP_MD = iota
+	EVP_SHA3_384   EVP_MD = iota
+	EVP_SHA3_512   EVP_MD = iota
+	EVP_BLAKE2B512 EVP_MD = iota
+	EVP_BLAKE2S256 EVP_MD = iota
+	EVP_SHA512_256 EVP_MD = iota
 )
 
 // X509_Version represents a version on an x509 certificate.
@@ -55,13 +64,16 @@ const (
 )
 
 type Certificate struct {
-	x      *C.X509
-	Issuer *Certificate
-	ref    interface{}
-	pubKey PublicKey
+	x       *C.X509
+	Issuer  *Certificate
+	ref     interface{}
+	pubKey  PublicKey
+	tracked bool
 }
 
 type CertificateInfo struct {
+	// Serial is the certificate serial number. If nil, a random 128-bit
+	// serial is generated with NewSerialNumber.
 	Serial       *big.Int
 	Issued       time.Duration
 	Expires      time.Duration
@@ -127,12 +139,7 @@ func (n *Name) GetEntry(nid NID) (entry string, ok bool) {
 // NewCertificate generates a basic certificate based
 // on the provided CertificateInfo struct
 func NewCertificate(info *CertificateInfo, key PublicKey) (*Certificate, error) {
-	c := &Certificate{x: C.X509_new()}
-	runtime.SetFinalizer(c, func(c *Certificate) {
-		C.X509_free(c.x)
-	})
-
-	name, err := c.GetSubjectName()
+	name, err := NewName()
 	if err != nil {
 		return nil, err
 	}
@@ -144,11 +151,31 @@ func NewCertificate(info *CertificateInfo, key PublicKey) (*Certificate, error)
 	if err != nil {
 		return nil, err
 	}
+	return NewCertificateWithSubject(name, info, key)
+}
+
+// NewCertificateWithSubject acts like NewCertificate, but uses subject as
+// the subject name instead of the name fields of info.
+func NewCertificateWithSubject(subject *Name, info *CertificateInfo,
+	key PublicKey) (*Certificate, error) {
+	c := &Certificate{x: C.X509_new()}
+	setCertificateFinalizer(c)
+
+	if err := c.SetSubjectName(subject); err != nil {
+		return nil, err
+	}
 	// self-issue for now
-	if err := c.SetIssuerName(name); err != nil {
+	if err := c.SetIssuerName(subject); err != nil {
 		return nil, err
 	}
-	if err := c.SetSerial(info.Serial); err != nil {
+	serial := info.Serial
+	if serial == nil {
+		var err error
+		if serial, err = NewSerialNumber(); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.SetSerial(serial); err != nil {
 		return nil, err
 	}
 	if err := c.SetIssueDate(info.Issued); err != nil {
@@ -210,26 +237,57 @@ func (c *Certificate) SetIssuerName(name *Name) error {
 	return nil
 }
 
+// serialNumberBits is the size of serial numbers generated by
+// NewSerialNumber. CA/Browser Forum rules require at least 64 bits of output
+// from a CSPRNG.
+const serialNumberBits = 128
+
+// NewSerialNumber returns a positive random serial number of 128 bits
+// generated with a CSPRNG.
+func NewSerialNumber() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), serialNumberBits)
+	for {
+		serial, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return nil, err
+		}
+		if serial.Sign() > 0 {
+			return serial, nil
+		}
+	}
+}
+
 // SetSerial sets the serial of a certificate.
 func (c *Certificate) SetSerial(serial *big.Int) error {
-	sno := C.ASN1_INTEGER_new()
-	defer C.ASN1_INTEGER_free(sno)
-	bn := C.BN_new()
-	defer C.BN_free(bn)
-
-	serialBytes := serial.Bytes()
-	if bn = C.BN_bin2bn((*C.uchar)(unsafe.Pointer(&serialBytes[0])), C.int(len(serialBytes)), bn); bn == nil {
-		return errors.New("failed to set serial")
+	if serial == nil {
+		return errors.New("serial is nil")
 	}
-	if sno = C.BN_to_ASN1_INTEGER(bn, sno); sno == nil {
+	sno, err := newASN1Integer(serial)
+	if err != nil {
 		return errors.New("failed to set serial")
 	}
+	defer C.ASN1_INTEGER_free(sno)
 	if C.X509_set_serialNumber(c.x, sno) != 1 {
 		return errors.New("failed to set serial")
 	}
 	return nil
 }
 
+// newASN1Integer converts v to an ASN1_INTEGER, which the caller must free.
+func newASN1Integer(v *big.Int) (*C.ASN1_INTEGER, error) {
+	bn, err := NewBigNum(v)
+	if err != nil {
+		return nil, err
+	}
+	defer bn.Close()
+
+	i := C.BN_to_ASN1_INTEGER(bn.bn, nil)
+	if i == nil {
+		return nil, errors.New("failed to convert integer")
+	}
+	return i, nil
+}
+
 // SetIssueDate sets the certificate issue date relative to the current time.
 func (c *Certificate) SetIssueDate(when time.Duration) error {
 	offset := C.long(when / time.Second)
@@ -260,8 +318,32 @@ func (c *Certificate) SetPubKey(pubKey PublicKey) error {
 }
 
 // Sign a certificate using a private key and a digest name.
-// Accepted digest names are 'sha256', 'sha384', and 'sha512'.
+// Accepted digest names are 'sha256', 'sha384', and 'sha512'. The digest is
+// ignored for Ed25519 and Ed448 keys.
 func (c *Certificate) Sign(privKey PrivateKey, digest EVP_MD) error {
+	md, err := signDigest(privKey, digest)
+	if err != nil {
+		return err
+	}
+	if C.X509_sign(c.x, privKey.evpPKey(), md) <= 0 {
+		return errors.New("failed to sign certificate")
+	}
+	return nil
+}
+
+// signDigest checks the digest to sign with privKey and returns it. EdDSA
+// keys hash the data themselves, so the digest is ignored for them.
+func signDigest(privKey PrivateKey, digest EVP_MD) (*C.EVP_MD, error) {
+	if isEdDSA(privKey.KeyType()) {
+		return nil, nil
+	}
+	if err := checkSignDigest(digest); err != nil {
+		return nil, err
+	}
+	return getDigestFunction(digest), nil
+}
+
+func checkSignDigest(digest EVP_MD) error {
 	switch digest {
 	case EVP_SHA256:
 	case EVP_SHA384:
@@ -270,13 +352,45 @@ func (c *Certificate) Sign(privKey PrivateKey, digest EVP_MD) error {
 		return errors.New("unsupported digest; " +
 			"you're probably looking for 'EVP_SHA256' or 'EVP_SHA512'")
 	}
-	return c.insecureSign(privKey, digest)
+	return nil
+}
+
+// SignOptions selects how a certificate is signed.
+type SignOptions struct {
+	// Digest is the signing digest, one of EVP_SHA256, EVP_SHA384 and
+	// EVP_SHA512.
+	Digest EVP_MD
+	// PSS selects RSA-PSS padding, with the salt as long as the digest,
+	// instead of PKCS #1 v1.5. It requires an RSA key. RSA-PSS keys always
+	// sign with RSA-PSS padding.
+	PSS bool
+}
+
+// SignWithOptions signs the certificate using the private key, like Sign,
+// with the digest and padding selected by opts.
+func (c *Certificate) SignWithOptions(privKey PrivateKey,
+	opts SignOptions) error {
+	if !opts.PSS {
+		return c.Sign(privKey, opts.Digest)
+	}
+	return signPSS(privKey, opts.Digest, "certificate",
+		func(pkey *C.EVP_PKEY, md *C.EVP_MD) C.int {
+			return C.X_X509_sign_pss(c.x, pkey, md)
+		})
 }
 
-func (c *Certificate) insecureSign(privKey PrivateKey, digest EVP_MD) error {
-	var md *C.EVP_MD = getDigestFunction(digest)
-	if C.X509_sign(c.x, privKey.evpPKey(), md) <= 0 {
-		return errors.New("failed to sign certificate")
+// signPSS checks the key and the digest and calls sign to sign the object
+// described by what with RSA-PSS padding.
+func signPSS(privKey PrivateKey, digest EVP_MD, what string,
+	sign func(pkey *C.EVP_PKEY, md *C.EVP_MD) C.int) error {
+	if err := checkSignDigest(digest); err != nil {
+		return err
+	}
+	if !isRSA(privKey.KeyType()) {
+		return errors.New("RSA-PSS requires an RSA key")
+	}
+	if sign(privKey.evpPKey(), getDigestFunction(digest)) <= 0 {
+		return errors.New("failed to sign " + what)
 	}
 	return nil
 }
@@ -307,6 +421,20 @@ func getDigestFunction(digest EVP_MD) (md *C.EVP_MD) {
 		md = C.X_EVP_sha384()
 	case EVP_SHA512:
 		md = C.X_EVP_sha512()
+	case EVP_SHA3_224:
+		md = C.X_EVP_sha3_224()
+	case EVP_SHA3_256:
+		md = C.X_EVP_sha3_256()
+	case EVP_SHA3_384:
+		md = C.X_EVP_sha3_384()
+	case EVP_SHA3_512:
+		md = C.X_EVP_sha3_512()
+	case EVP_BLAKE2B512:
+		md = C.X_EVP_blake2b512()
+	case EVP_BLAKE2S256:
+		md = C.X_EVP_blake2s256()
+	case EVP_SHA512_256:
+		md = C.X_EVP_sha512_256()
 	}
 	return md
 }
@@ -319,7 +447,7 @@ func (c *Certificate) AddExtension(nid NID, value string) error {
 		issuer = c.Issuer
 	}
 	var ctx C.X509V3_CTX
-	C.X509V3_set_ctx(&ctx, c.x, issuer.x, nil, nil, 0)
+	C.X509V3_set_ctx(&ctx, issuer.x, c.x, nil, nil, 0)
 	ex := C.X509V3_EXT_conf_nid(nil, &ctx, C.int(nid), C.CString(value))
 	if ex == nil {
 		return errors.New("failed to create x509v3 extension")
@@ -331,6 +459,41 @@ func (c *Certificate) AddExtension(nid NID, value string) error {
 	return nil
 }
 
+// AddSubjectKeyIdentifier adds the subject key identifier extension, the
+// SHA-1 hash of the public key as described in RFC 5280. The public key has
+// to be set. An existing subject key identifier is replaced.
+func (c *Certificate) AddSubjectKeyIdentifier() error {
+	if C.X_X509_add_subject_key_id(c.x) != 1 {
+		return errors.New("failed to add subject key identifier")
+	}
+	return nil
+}
+
+// AddAuthorityKeyIdentifier adds the authority key identifier extension. It
+// is the subject key identifier of the issuer set with SetIssuer, or the
+// SHA-1 hash of the issuer public key if the issuer has none. A certificate
+// without an issuer is its own issuer. An existing authority key identifier
+// is replaced.
+func (c *Certificate) AddAuthorityKeyIdentifier() error {
+	issuer := c
+	if c.Issuer != nil {
+		issuer = c.Issuer
+	}
+	if C.X_X509_add_authority_key_id(c.x, issuer.x) != 1 {
+		return errors.New("failed to add authority key identifier")
+	}
+	return nil
+}
+
+// AddKeyIdentifiers adds the subject and authority key identifier
+// extensions, see AddSubjectKeyIdentifier and AddAuthorityKeyIdentifier.
+func (c *Certificate) AddKeyIdentifiers() error {
+	if err := c.AddSubjectKeyIdentifier(); err != nil {
+		return err
+	}
+	return c.AddAuthorityKeyIdentifier()
+}
+
 // AddCustomExtension add custom extenstion to the certificate.
 func (c *Certificate) AddCustomExtension(nid NID, value []byte) error {
 	val := (*C.char)(C.CBytes(value))
@@ -367,9 +530,7 @@ func LoadCertificateFromPEM(pem_block []byte) (*Certificate, error) {
 		return nil, errorFromErrorQueue()
 	}
 	x := &Certificate{x: cert}
-	runtime.SetFinalizer(x, func(x *Certificate) {
-		C.X509_free(x.x)
-	})
+	setCertificateFinalizer(x)
 	return x, nil
 }
 
@@ -386,6 +547,23 @@ func (c *Certificate) MarshalPEM() (pem_block []byte, err error) {
 	return ioutil.ReadAll(asAnyBio(bio))
 }
 
+// Text returns a human-readable dump of the certificate in the format of
+// `openssl x509 -text`.
+// See https://www.openssl.org/docs/man1.1.1/man3/X509_print_ex.html
+func (c *Certificate) Text() (string, error) {
+	bio := C.BIO_new(C.BIO_s_mem())
+	if bio == nil {
+		return "", errors.New("failed to allocate memory BIO")
+	}
+	defer C.BIO_free(bio)
+	// the default -nameopt of the command, e.g. "C = US, O = Example"
+	if int(C.X509_print_ex(bio, c.x, C.XN_FLAG_ONELINE, 0)) != 1 {
+		return "", errors.New("failed printing certificate")
+	}
+	text, err := ioutil.ReadAll(asAnyBio(bio))
+	return string(text), err
+}
+
 // PublicKey returns the public key embedded in the X509 certificate.
 func (c *Certificate) PublicKey() (PublicKey, error) {
 	pkey := C.X509_get_pubkey(c.x)
@@ -393,12 +571,16 @@ func (c *Certificate) PublicKey() (PublicKey, error) {
 		return nil, errors.New("no public key found")
 	}
 	key := &pKey{key: pkey}
-	runtime.SetFinalizer(key, func(key *pKey) {
-		C.EVP_PKEY_free(key.key)
-	})
+	setPKeyFinalizer(key)
 	return key, nil
 }
 
+// GetSerialNumber returns the certificate's serial number.
+func (c *Certificate) GetSerialNumber() *big.Int {
+	serial, _ := asn1IntegerToBig(C.X509_get_serialNumber(c.x))
+	return serial
+}
+
 // GetSerialNumberHex returns the certificate's serial number in hex format
 func (c *Certificate) GetSerialNumberHex() (serial string) {
 	asn1_i := C.X509_get_serialNumber(c.x)
@@ -424,6 +606,29 @@ func (c *Certificate) SetVersion(version X509_Version) error {
 	return nil
 }
 
+// GetNotBefore returns the start of the certificate's validity period.
+func (c *Certificate) GetNotBefore() (time.Time, error) {
+	return asn1TimeToTime(C.X_X509_get0_notBefore(c.x))
+}
+
+// GetNotAfter returns the end of the certificate's validity period.
+func (c *Certificate) GetNotAfter() (time.Time, error) {
+	return asn1TimeToTime(C.X_X509_get0_notAfter(c.x))
+}
+
+// GetSubjectAltNames returns the names of the subject alternative name
+// extension, or nil if the certificate has none.
+func (c *Certificate) GetSubjectAltNames() ([]GeneralName, error) {
+	sk := (*C.GENERAL_NAMES)(C.X509_get_ext_d2i(c.x, C.NID_subject_alt_name,
+		nil, nil))
+	if sk == nil {
+		C.ERR_clear_error()
+		return nil, nil
+	}
+	defer C.GENERAL_NAMES_free(sk)
+	return generalNamesToGo(sk)
+}
+
 // GetExtensionValue returns the value of the given NID's extension.
 func (c *Certificate) GetExtensionValue(nid NID) []byte {
 	dataLength := C.int(0)
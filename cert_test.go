@@ -15,8 +15,14 @@
 package openssl
 
 import (
+	"bytes"
 	"encoding/hex"
+	"io/ioutil"
 	"math/big"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -186,3 +192,356 @@ func TestVerifyCertErrorString(t *testing.T) {
 		t.Fatalf("Wrong cert error string returned, expected %q, got %q", expected, result)
 	}
 }
+
+func TestCertSerial(t *testing.T) {
+	key, err := GenerateRSAKey(768)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &CertificateInfo{
+		Issued:       0,
+		Expires:      24 * time.Hour,
+		Country:      "US",
+		Organization: "Test",
+		CommonName:   "localhost",
+	}
+	cert, err := NewCertificate(info, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := cert.GetSerialNumber()
+	if generated == nil || generated.Sign() <= 0 {
+		t.Fatalf("unexpected generated serial %v", generated)
+	}
+	if generated.BitLen() > 128 {
+		t.Fatalf("generated serial is too long: %d bits", generated.BitLen())
+	}
+
+	serial, ok := new(big.Int).SetString("7fffffffffffffffffffffffffffffff", 16)
+	if !ok {
+		t.Fatal("failed to parse serial")
+	}
+	for _, expected := range []*big.Int{serial, big.NewInt(0), big.NewInt(-5)} {
+		if err := cert.SetSerial(expected); err != nil {
+			t.Fatal(err)
+		}
+		if actual := cert.GetSerialNumber(); actual.Cmp(expected) != 0 {
+			t.Fatalf("expected serial %v, got %v", expected, actual)
+		}
+	}
+	if err := cert.SetSerial(nil); err == nil {
+		t.Fatal("expected an error for a nil serial")
+	}
+}
+
+func TestCertText(t *testing.T) {
+	cert, err := LoadCertificateFromPEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := cert.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"Certificate:",
+		"Serial Number:",
+		"61:80:bc:12:c8:54:b0:15:1e:53:a2:06:d8:5c:ab:d4:da:fb:28:6d",
+		"Subject: C = US, ST = Utah, L = Midvale, O = Space Monkey",
+		"Signature Algorithm: sha256WithRSAEncryption",
+	} {
+		if !strings.Contains(text, s) {
+			t.Fatalf("%q not found in:\n%s", s, text)
+		}
+	}
+}
+
+func TestCertTextMatchesCLI(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("the openssl command is needed to compare the output")
+	}
+	key, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := NewCertificate(&CertificateInfo{
+		Serial:       big.NewInt(1),
+		Issued:       0,
+		Expires:      24 * time.Hour,
+		Country:      "US",
+		Organization: "T\u00e9st, Inc",
+		CommonName:   "h\u00e9llo",
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Sign(key, EVP_SHA256); err != nil {
+		t.Fatal(err)
+	}
+	pem, err := cert.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	if err := ioutil.WriteFile(path, pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	want, err := exec.Command("openssl", "x509", "-noout", "-text", "-in",
+		path).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := cert.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != string(want) {
+		t.Fatalf("got:\n%s\nwant:\n%s", text, want)
+	}
+}
+
+func TestCertSignWithOptions(t *testing.T) {
+	key, err := GenerateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &CertificateInfo{
+		Issued:       0,
+		Expires:      24 * time.Hour,
+		Country:      "US",
+		Organization: "Test",
+		CommonName:   "test",
+	}
+	cert, err := NewCertificate(info, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cert.SignWithOptions(key, SignOptions{Digest: EVP_SHA384, PSS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := cert.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"Signature Algorithm: rsassaPss",
+		"Hash Algorithm: sha384",
+	} {
+		if !strings.Contains(text, s) {
+			t.Fatalf("%q not found in:\n%s", s, text)
+		}
+	}
+
+	err = cert.SignWithOptions(key, SignOptions{Digest: EVP_SHA1, PSS: true})
+	if err == nil {
+		t.Fatal("expected an error for an unsupported digest")
+	}
+	ecKey, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cert.SignWithOptions(ecKey, SignOptions{Digest: EVP_SHA384, PSS: true})
+	if err == nil {
+		t.Fatal("expected an error for a non-RSA key")
+	}
+}
+
+func TestRequestAndCRLSignWithOptions(t *testing.T) {
+	key, err := GenerateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := SignOptions{Digest: EVP_SHA384, PSS: true}
+	name, err := NewName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := name.AddTextEntry("CN", "test"); err != nil {
+		t.Fatal(err)
+	}
+	req, err := NewCertificateRequest(name, key, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	issuer, err := NewCertificate(&CertificateInfo{
+		Issued:       0,
+		Expires:      24 * time.Hour,
+		Country:      "US",
+		Organization: "Test",
+		CommonName:   "test",
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := issuer.SignWithOptions(key, opts); err != nil {
+		t.Fatal(err)
+	}
+	crl, err := NewCRL(issuer, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.Sign(key, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.Verify(issuer); err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCertificateRequest(name, ecKey, opts); err == nil {
+		t.Fatal("expected an error for a non-RSA key")
+	}
+	if err := crl.Sign(ecKey, opts); err == nil {
+		t.Fatal("expected an error for a non-RSA key")
+	}
+}
+
+func TestCertCheckHostMatch(t *testing.T) {
+	key, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &CertificateInfo{
+		Issued:       0,
+		Expires:      24 * time.Hour,
+		Country:      "US",
+		Organization: "Test",
+		CommonName:   "test",
+	}
+	cert, err := NewCertificate(info, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cert.AddExtension(NID_subject_alt_name,
+		"DNS:*.example.com,IP:127.0.0.1,email:admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Sign(key, EVP_SHA256); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := cert.CheckHostMatch("www.example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "*.example.com" {
+		t.Fatalf("unexpected matched name %q", name)
+	}
+	if _, err := cert.CheckHostMatch("www.example.org", 0); err != ValidationError {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if err := cert.CheckHost("www.example.com", NoWildcards); err != ValidationError {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if err := cert.CheckIP(net.ParseIP("127.0.0.1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckIP(net.ParseIP("127.0.0.2"), 0); err != ValidationError {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if err := cert.CheckEmail("admin@example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckEmail("root@example.com", 0); err != ValidationError {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+}
+
+func TestCertKeyIdentifiers(t *testing.T) {
+	newCert := func(cn string) (*Certificate, PrivateKey) {
+		key, err := GenerateECKey(Prime256v1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := NewCertificate(&CertificateInfo{
+			Issued:       0,
+			Expires:      24 * time.Hour,
+			Country:      "US",
+			Organization: "Test",
+			CommonName:   cn,
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key
+	}
+	keyID := func(cert *Certificate, nid NID) []byte {
+		value := cert.GetExtensionValue(nid)
+		if len(value) < 20 {
+			t.Fatalf("unexpected extension value %x", value)
+		}
+		return value[len(value)-20:]
+	}
+
+	root, rootKey := newCert("root")
+	if err := root.AddKeyIdentifiers(); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Sign(rootKey, EVP_SHA256); err != nil {
+		t.Fatal(err)
+	}
+	skid := keyID(root, NID_subject_key_identifier)
+	if !bytes.Equal(keyID(root, NID_authority_key_identifier), skid) {
+		t.Fatal("self-signed authority key identifier mismatch")
+	}
+
+	leaf, _ := newCert("leaf")
+	if err := leaf.SetIssuer(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.AddKeyIdentifiers(); err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.Sign(rootKey, EVP_SHA256); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keyID(leaf, NID_authority_key_identifier), skid) {
+		t.Fatal("authority key identifier mismatch")
+	}
+	if bytes.Equal(keyID(leaf, NID_subject_key_identifier), skid) {
+		t.Fatal("subject key identifier of the issuer")
+	}
+
+	// Without a subject key identifier the issuer key is hashed.
+	bare, bareKey := newCert("bare")
+	if err := bare.Sign(bareKey, EVP_SHA256); err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ = newCert("leaf")
+	if err := leaf.SetIssuer(bare); err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.AddAuthorityKeyIdentifier(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bare.AddSubjectKeyIdentifier(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keyID(leaf, NID_authority_key_identifier),
+		keyID(bare, NID_subject_key_identifier)) {
+		t.Fatal("computed authority key identifier mismatch")
+	}
+
+	// AddExtension takes the key identifier from the issuer too
+	leaf, _ = newCert("leaf")
+	if err := leaf.SetIssuer(root); err != nil {
+		t.Fatal(err)
+	}
+	err := leaf.AddExtension(NID_authority_key_identifier, "keyid:always")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keyID(leaf, NID_authority_key_identifier), skid) {
+		t.Fatal("authority key identifier of AddExtension mismatch")
+	}
+}
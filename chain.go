@@ -0,0 +1,192 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// BuildCertificateChain orders a pile of intermediate certificates into the
+// chain for leaf, leaf first. Certificates from the pile that are not part
+// of the chain are dropped.
+//
+// If roots is not nil, the chain is verified against it and the trust anchor
+// is not included in the result, so the chain is suitable for
+// Ctx.UseCertificateChain. If roots is nil, the chain is only built, not
+// verified, and ends with the last certificate whose issuer is found in the
+// pile (a self-signed root in the pile is dropped as well).
+// See https://www.openssl.org/docs/man1.1.1/man3/X509_STORE_CTX_get1_chain.html
+func BuildCertificateChain(leaf *Certificate, pile []*Certificate,
+	roots *CertificateStore) ([]*Certificate, error) {
+	if leaf == nil {
+		return nil, errors.New("no leaf certificate provided")
+	}
+	verify := roots != nil
+	if !verify {
+		var err error
+		roots, err = NewCertificateStore()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	untrusted := C.X_sk_X509_new_null()
+	if untrusted == nil {
+		return nil, errors.New("failed to allocate certificate stack")
+	}
+	defer C.X_sk_X509_free(untrusted)
+	for _, cert := range pile {
+		if C.X_sk_X509_push(untrusted, cert.x) <= 0 {
+			return nil, errors.New("failed to push certificate to stack")
+		}
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	ctx := C.X509_STORE_CTX_new()
+	if ctx == nil {
+		return nil, errors.New("failed to allocate X509_STORE_CTX")
+	}
+	defer C.X509_STORE_CTX_free(ctx)
+	if C.X509_STORE_CTX_init(ctx, roots.store, leaf.x, untrusted) != 1 {
+		return nil, errorFromErrorQueue()
+	}
+	if !verify {
+		// Nothing to verify against, so just build the chain.
+		C.X509_STORE_CTX_set_verify_cb(ctx,
+			(*[0]byte)(C.X_X509_verify_cb_accept_all))
+	}
+	rc := C.X509_verify_cert(ctx)
+	var sk *C.struct_stack_st_X509
+	if rc == 1 {
+		sk = C.X509_STORE_CTX_get1_chain(ctx)
+	}
+	// the context uses the raw certificates and store of the wrappers
+	runtime.KeepAlive(leaf)
+	runtime.KeepAlive(pile)
+	runtime.KeepAlive(roots)
+	if rc != 1 {
+		code := C.X509_STORE_CTX_get_error(ctx)
+		return nil, fmt.Errorf("failed to build certificate chain: %s",
+			VerifyCertErrorString(VerifyResult(code)))
+	}
+	if sk == nil {
+		return nil, errors.New("failed to get certificate chain")
+	}
+	defer C.X_sk_X509_free(sk)
+
+	chain := certificatesFromChain(sk)
+
+	// Peers do not need the trust anchor, drop it.
+	if last := chain[len(chain)-1]; len(chain) > 1 &&
+		C.X_X509_check_issued(last.x, last.x) == C.X509_V_OK {
+		chain = chain[:len(chain)-1]
+	}
+	return chain, nil
+}
+
+// certificatesFromChain wraps the certificates of a stack returned by
+// X509_STORE_CTX_get1_chain, which has taken a reference for every
+// certificate.
+func certificatesFromChain(sk *C.struct_stack_st_X509) []*Certificate {
+	num := int(C.X_sk_X509_num(sk))
+	chain := make([]*Certificate, 0, num)
+	for i := 0; i < num; i++ {
+		cert := &Certificate{x: C.X_sk_X509_value(sk, C.int(i))}
+		setCertificateFinalizer(cert)
+		chain = append(chain, cert)
+	}
+	return chain
+}
+
+// FixChainOrder checks that the chain certificates added with
+// AddChainCertificate are in order, each one issuing the previous one
+// starting from the certificate set with UseCertificate, and reorders them if
+// not. It reports whether the chain has been reordered. An error is returned
+// if the chain contains certificates that don't belong to it, the chain is
+// left as is then.
+//
+// AddChainCertificate and UseCertificateChain call it, so it only has to be
+// called explicitly to report problems. Like them, it must not be called
+// once connections are created from the context.
+func (c *Ctx) FixChainOrder() (bool, error) {
+	if c.cert == nil || len(c.chain) == 0 {
+		return false, nil
+	}
+
+	ordered := make([]*Certificate, 0, len(c.chain))
+	rest := append([]*Certificate(nil), c.chain...)
+	last := c.cert
+	for len(rest) > 0 {
+		found := -1
+		for i, cert := range rest {
+			if C.X_X509_check_issued(cert.x, last.x) == C.X509_V_OK {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			break
+		}
+		last = rest[found]
+		ordered = append(ordered, last)
+		rest = append(rest[:found], rest[found+1:]...)
+	}
+	if len(rest) > 0 {
+		return false, fmt.Errorf("certificate chain contains %d certificates "+
+			"not issuing the chain", len(rest))
+	}
+
+	reordered := false
+	for i := range ordered {
+		if ordered[i] != c.chain[i] {
+			reordered = true
+			break
+		}
+	}
+	if !reordered {
+		return false, nil
+	}
+
+	// Clearing the chain frees the certificates, keep them alive. The
+	// references are handed over to the context again below.
+	for i, cert := range c.chain {
+		if C.X_X509_add_ref(cert.x) != 1 {
+			for _, taken := range c.chain[:i] {
+				C.X509_free(taken.x)
+			}
+			return false, errors.New("failed to reference certificate")
+		}
+	}
+	C.X_SSL_CTX_clear_extra_chain_certs(c.ctx)
+	for i, cert := range ordered {
+		if C.X_SSL_CTX_add_extra_chain_cert(c.ctx, cert.x) != 1 {
+			// the certificates that are not added keep their references
+			for _, rest := range ordered[i:] {
+				setCertificateFinalizer(rest)
+			}
+			c.chain = ordered[:i]
+			return false, errors.New("failed to add chain certificate")
+		}
+	}
+	c.chain = ordered
+	return true, nil
+}
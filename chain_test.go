@@ -0,0 +1,379 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"testing"
+	"time"
+)
+
+type testCertificate struct {
+	cert *Certificate
+	key  PrivateKey
+}
+
+// newTestCertificate issues a certificate for cn signed by issuer. If issuer
+// is nil, the certificate is self-signed.
+func newTestCertificate(t testing.TB, cn string, ca bool,
+	issuer *testCertificate) *testCertificate {
+	key, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &CertificateInfo{
+		Issued:       0,
+		Expires:      24 * time.Hour,
+		Country:      "US",
+		Organization: "Test",
+		CommonName:   cn,
+	}
+	cert, err := NewCertificate(info, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.SetVersion(X509_V3); err != nil {
+		t.Fatal(err)
+	}
+	signer := key
+	if issuer != nil {
+		if err := cert.SetIssuer(issuer.cert); err != nil {
+			t.Fatal(err)
+		}
+		signer = issuer.key
+	}
+	extensions := map[NID]string{
+		NID_basic_constraints: "critical,CA:FALSE",
+		NID_key_usage:         "digitalSignature,keyEncipherment",
+		NID_ext_key_usage:     "serverAuth,clientAuth",
+		NID_subject_alt_name:  "DNS:" + cn,
+	}
+	if ca {
+		extensions = map[NID]string{
+			NID_basic_constraints: "critical,CA:TRUE",
+			NID_key_usage:         "critical,keyCertSign,cRLSign",
+		}
+	}
+	if err := cert.AddExtensions(extensions); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Sign(signer, EVP_SHA256); err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{cert: cert, key: key}
+}
+
+func TestBuildCertificateChain(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	intermediate1 := newTestCertificate(t, "intermediate1", true, root)
+	intermediate2 := newTestCertificate(t, "intermediate2", true, intermediate1)
+	leaf := newTestCertificate(t, "localhost", false, intermediate2)
+	unrelated := newTestCertificate(t, "unrelated", true, nil)
+
+	pile := []*Certificate{
+		unrelated.cert, intermediate1.cert, root.cert, intermediate2.cert,
+	}
+	expected := []*Certificate{leaf.cert, intermediate2.cert, intermediate1.cert}
+
+	roots, err := NewCertificateStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := roots.AddCertificate(root.cert); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, store := range []*CertificateStore{nil, roots} {
+		chain, err := BuildCertificateChain(leaf.cert, pile, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chain) != len(expected) {
+			t.Fatalf("expected %d certificates, got %d", len(expected), len(chain))
+		}
+		for i := range chain {
+			if chain[i].GetSerialNumberHex() != expected[i].GetSerialNumberHex() {
+				t.Fatalf("unexpected certificate at position %d", i)
+			}
+		}
+	}
+
+	// The chain can't be verified without the intermediates.
+	if _, err := BuildCertificateChain(leaf.cert, nil, roots); err == nil {
+		t.Fatal("expected a verification error")
+	}
+
+	ctx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := BuildCertificateChain(leaf.cert, pile, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.UseCertificateChain(chain); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateStoreIssuerLookup(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	intermediate := newTestCertificate(t, "intermediate", true, root)
+	leaf := newTestCertificate(t, "localhost", false, intermediate)
+
+	roots, err := NewCertificateStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := roots.AddCertificate(root.cert); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := BuildCertificateChain(leaf.cert, nil, roots); err == nil {
+		t.Fatal("expected a verification error")
+	}
+
+	var lookups int
+	err = roots.SetIssuerLookupCallback(func(cert *Certificate) *Certificate {
+		lookups++
+		if cert.GetSerialNumberHex() == leaf.cert.GetSerialNumberHex() {
+			return intermediate.cert
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := BuildCertificateChain(leaf.cert, nil, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 ||
+		chain[1].GetSerialNumberHex() != intermediate.cert.GetSerialNumberHex() {
+		t.Fatal("expected the intermediate to be fetched by the callback")
+	}
+	if lookups == 0 {
+		t.Fatal("expected the callback to be called")
+	}
+
+	if err := roots.SetIssuerLookupCallback(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildCertificateChain(leaf.cert, nil, roots); err == nil {
+		t.Fatal("expected a verification error")
+	}
+
+	// the fetched certificates are not trusted, the chain must end in the
+	// store
+	otherRoot := newTestCertificate(t, "root", true, nil)
+	otherIntermediate := newTestCertificate(t, "intermediate", true, otherRoot)
+	otherLeaf := newTestCertificate(t, "localhost", false, otherIntermediate)
+	err = roots.SetIssuerLookupCallback(func(cert *Certificate) *Certificate {
+		switch cert.GetSerialNumberHex() {
+		case otherLeaf.cert.GetSerialNumberHex():
+			return otherIntermediate.cert
+		case otherIntermediate.cert.GetSerialNumberHex():
+			return otherRoot.cert
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildCertificateChain(otherIntermediate.cert, nil,
+		roots); err == nil {
+		t.Fatal("expected a fetched self-signed root to be rejected")
+	}
+	if _, err := BuildCertificateChain(otherLeaf.cert, nil, roots); err == nil {
+		t.Fatal("expected a fetched chain to be rejected")
+	}
+}
+
+func TestCtxFixChainOrder(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	intermediate1 := newTestCertificate(t, "intermediate1", true, root)
+	intermediate2 := newTestCertificate(t, "intermediate2", true, intermediate1)
+	leaf := newTestCertificate(t, "localhost", false, intermediate2)
+	expected := []*Certificate{leaf.cert, intermediate2.cert, intermediate1.cert}
+
+	ctx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ctx.UseCertificateChain(
+		[]*Certificate{leaf.cert, intermediate1.cert, intermediate2.cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+
+	// UseCertificateChain reorders the chain, before any connection.
+	for i := range ctx.chain {
+		if ctx.chain[i] != expected[i+1] {
+			t.Fatalf("unexpected chain certificate at position %d", i)
+		}
+	}
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	doHandshake(t, server, client)
+
+	chain, err := client.PeerCertificateChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != len(expected) {
+		t.Fatalf("expected %d certificates, got %d", len(expected), len(chain))
+	}
+	for i := range chain {
+		if chain[i].GetSerialNumberHex() != expected[i].GetSerialNumberHex() {
+			t.Fatalf("unexpected certificate at position %d", i)
+		}
+	}
+
+	if reordered, err := ctx.FixChainOrder(); err != nil || reordered {
+		t.Fatalf("unexpected result %v: %v", reordered, err)
+	}
+
+	unrelated := newTestCertificate(t, "unrelated", true, nil)
+	if err := ctx.AddChainCertificate(unrelated.cert); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.FixChainOrder(); err == nil {
+		t.Fatal("expected an error for an unrelated certificate")
+	}
+	if err := ctx.UseCertificateChain([]*Certificate{leaf.cert,
+		intermediate2.cert, unrelated.cert}); err == nil {
+		t.Fatal("expected an error for an unrelated certificate")
+	}
+
+	// AddChainCertificate reorders the chain once it is complete, the
+	// context owns the chain certificates so they are not shared
+	intermediate1 = newTestCertificate(t, "intermediate1", true, root)
+	intermediate2 = newTestCertificate(t, "intermediate2", true, intermediate1)
+	leaf = newTestCertificate(t, "localhost", false, intermediate2)
+	ctx, err = NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.UseCertificate(leaf.cert); err != nil {
+		t.Fatal(err)
+	}
+	for _, cert := range []*Certificate{intermediate1.cert,
+		intermediate2.cert} {
+		if err := ctx.AddChainCertificate(cert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ctx.chain) != 2 || ctx.chain[0] != intermediate2.cert ||
+		ctx.chain[1] != intermediate1.cert {
+		t.Fatal("chain is not reordered")
+	}
+}
+
+func TestCtxUseCertificateChainFromPEM(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	intermediate := newTestCertificate(t, "intermediate", true, root)
+	leaf := newTestCertificate(t, "localhost", false, intermediate)
+
+	var blob []byte
+	for _, cert := range []*Certificate{leaf.cert, intermediate.cert} {
+		pem, err := cert.MarshalPEM()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blob = append(blob, pem...)
+	}
+	keyPEM, err := leaf.key.MarshalPKCS1PrivateKeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob = append(blob, keyPEM...)
+
+	ctx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.UseCertificateChainFromPEM(blob); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+	if len(ctx.chain) != 1 ||
+		ctx.cert.GetSerialNumberHex() != leaf.cert.GetSerialNumberHex() ||
+		ctx.chain[0].GetSerialNumberHex() !=
+			intermediate.cert.GetSerialNumberHex() {
+		t.Fatal("unexpected certificate chain")
+	}
+
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	doHandshake(t, server, client)
+	chain, err := client.PeerCertificateChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("expected 2 certificates, got %d", len(chain))
+	}
+
+	// The chain is replaced, the previous certificates stay usable.
+	previous := ctx.chain[0]
+	pem, err := leaf.cert.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.UseCertificateChainFromPEM(pem); err != nil {
+		t.Fatal(err)
+	}
+	if len(ctx.chain) != 0 {
+		t.Fatal("chain is not replaced")
+	}
+	if _, err := previous.MarshalPEM(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.UseCertificateChainFromPEM(keyPEM); err == nil {
+		t.Fatal("expected an error without certificates")
+	}
+}
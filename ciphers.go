@@ -55,6 +55,11 @@ func (c *Cipher) KeySize() int {
 	return int(C.X_EVP_CIPHER_key_length(c.ptr))
 }
 
+// isAEAD reports whether the cipher is authenticated, like GCM.
+func (c *Cipher) isAEAD() bool {
+	return C.X_EVP_CIPHER_is_aead(c.ptr) == 1
+}
+
 func (c *Cipher) IVSize() int {
 	return int(C.X_EVP_CIPHER_iv_length(c.ptr))
 }
@@ -246,6 +251,8 @@ func newEncryptionCipherCtx(c *Cipher, e *Engine, key, iv []byte) (
 	if C.EVP_EncryptInit_ex(ctx.ctx, c.ptr, eptr, nil, nil) != 1 {
 		return nil, errors.New("failed to initialize cipher context")
 	}
+	// the context holds its own reference to a fetched cipher
+	runtime.KeepAlive(c)
 	err = ctx.applyKeyAndIV(key, iv)
 	if err != nil {
 		return nil, err
@@ -269,6 +276,8 @@ func newDecryptionCipherCtx(c *Cipher, e *Engine, key, iv []byte) (
 	if C.EVP_DecryptInit_ex(ctx.ctx, c.ptr, eptr, nil, nil) != 1 {
 		return nil, errors.New("failed to initialize cipher context")
 	}
+	// the context holds its own reference to a fetched cipher
+	runtime.KeepAlive(c)
 	err = ctx.applyKeyAndIV(key, iv)
 	if err != nil {
 		return nil, err
@@ -326,10 +335,16 @@ func (ctx *encryptionCipherCtx) EncryptFinal() ([]byte, error) {
 func (ctx *decryptionCipherCtx) DecryptFinal() ([]byte, error) {
 	outbuf := make([]byte, ctx.BlockSize())
 	var outlen C.int
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	if C.EVP_DecryptFinal_ex(ctx.ctx, (*C.uchar)(&outbuf[0]), &outlen) != 1 {
 		// this may mean the tag failed to verify- all previous plaintext
 		// returned must be considered faked and invalid
-		return nil, errors.New("decryption failed")
+		if C.ERR_peek_error() == 0 {
+			return nil, errors.New("decryption failed")
+		}
+		return nil, fmt.Errorf("decryption failed: %w",
+			errorFromErrorQueue())
 	}
 	return outbuf[:outlen], nil
 }
@@ -0,0 +1,229 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// update runs the cipher over src into dst, which must have room for
+// len(src) plus a block, and returns the number of bytes written.
+func (ctx *cipherCtx) update(dst, src []byte) (int, error) {
+	if len(src) == 0 {
+		return 0, nil
+	}
+	outlen := C.int(len(dst))
+	if C.EVP_CipherUpdate(ctx.ctx, (*C.uchar)(&dst[0]), &outlen,
+		(*C.uchar)(&src[0]), C.int(len(src))) != 1 {
+		return 0, errors.New("cipher update failed")
+	}
+	return int(outlen), nil
+}
+
+type cipherStream struct {
+	*cipherCtx
+}
+
+// NewCipherStream returns a cipher.Stream over a cipher working on single
+// bytes, such as AES-CTR, AES-CFB, AES-OFB or ChaCha20. The direction only
+// matters for CFB modes.
+func NewCipherStream(c *Cipher, key, iv []byte, encrypt bool) (
+	cipher.Stream, error) {
+	if c.BlockSize() != 1 {
+		return nil, fmt.Errorf("cipher with block size %d is not a stream "+
+			"cipher", c.BlockSize())
+	}
+	ctx, err := newCipherCtxFor(c, key, iv, encrypt)
+	if err != nil {
+		return nil, err
+	}
+	return &cipherStream{cipherCtx: ctx}, nil
+}
+
+func (s *cipherStream) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("openssl: output smaller than input")
+	}
+	if _, err := s.update(dst, src); err != nil {
+		panic("openssl: " + err.Error())
+	}
+}
+
+type blockMode struct {
+	*cipherCtx
+}
+
+// NewBlockModeEncrypter returns a cipher.BlockMode that encrypts with a
+// block cipher mode such as AES-CBC. Padding is disabled, the input must
+// be made of whole blocks.
+func NewBlockModeEncrypter(c *Cipher, key, iv []byte) (cipher.BlockMode,
+	error) {
+	return newBlockMode(c, key, iv, true)
+}
+
+// NewBlockModeDecrypter returns a cipher.BlockMode that decrypts with a
+// block cipher mode such as AES-CBC. Padding is disabled, the input must
+// be made of whole blocks.
+func NewBlockModeDecrypter(c *Cipher, key, iv []byte) (cipher.BlockMode,
+	error) {
+	return newBlockMode(c, key, iv, false)
+}
+
+func newBlockMode(c *Cipher, key, iv []byte, encrypt bool) (
+	cipher.BlockMode, error) {
+	ctx, err := newCipherCtxFor(c, key, iv, encrypt)
+	if err != nil {
+		return nil, err
+	}
+	ctx.SetPadding(false)
+	return &blockMode{cipherCtx: ctx}, nil
+}
+
+func (m *blockMode) CryptBlocks(dst, src []byte) {
+	if len(src)%m.BlockSize() != 0 {
+		panic("openssl: input not full blocks")
+	}
+	if len(dst) < len(src) {
+		panic("openssl: output smaller than input")
+	}
+	if _, err := m.update(dst, src); err != nil {
+		panic("openssl: " + err.Error())
+	}
+}
+
+func newCipherCtxFor(c *Cipher, key, iv []byte, encrypt bool) (*cipherCtx,
+	error) {
+	if encrypt {
+		ctx, err := newEncryptionCipherCtx(c, nil, key, iv)
+		if err != nil {
+			return nil, err
+		}
+		return ctx.cipherCtx, nil
+	}
+	ctx, err := newDecryptionCipherCtx(c, nil, key, iv)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.cipherCtx, nil
+}
+
+// cipherPipe is the common part of the EncryptionCipherCtx and
+// DecryptionCipherCtx.
+type cipherPipe struct {
+	update func([]byte) ([]byte, error)
+	final  func() ([]byte, error)
+}
+
+func encryptionPipe(ctx EncryptionCipherCtx) cipherPipe {
+	return cipherPipe{update: ctx.EncryptUpdate, final: ctx.EncryptFinal}
+}
+
+func decryptionPipe(ctx DecryptionCipherCtx) cipherPipe {
+	return cipherPipe{update: ctx.DecryptUpdate, final: ctx.DecryptFinal}
+}
+
+type cipherWriter struct {
+	w    io.Writer
+	pipe cipherPipe
+}
+
+// NewEncryptWriter returns a writer that encrypts the data written to it
+// with the context and writes the result to w. Close finishes the
+// encryption, it doesn't close w.
+func NewEncryptWriter(w io.Writer, ctx EncryptionCipherCtx) io.WriteCloser {
+	return &cipherWriter{w: w, pipe: encryptionPipe(ctx)}
+}
+
+// NewDecryptWriter returns a writer that decrypts the data written to it
+// with the context and writes the result to w. Close finishes the
+// decryption, it doesn't close w.
+func NewDecryptWriter(w io.Writer, ctx DecryptionCipherCtx) io.WriteCloser {
+	return &cipherWriter{w: w, pipe: decryptionPipe(ctx)}
+}
+
+func (cw *cipherWriter) Write(p []byte) (int, error) {
+	out, err := cw.pipe.update(p)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := cw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (cw *cipherWriter) Close() error {
+	out, err := cw.pipe.final()
+	if err != nil {
+		return err
+	}
+	_, err = cw.w.Write(out)
+	return err
+}
+
+type cipherReader struct {
+	r       io.Reader
+	pipe    cipherPipe
+	buf     []byte
+	pending []byte
+	err     error
+}
+
+// NewEncryptReader returns a reader of the data read from r encrypted with
+// the context.
+func NewEncryptReader(r io.Reader, ctx EncryptionCipherCtx) io.Reader {
+	return &cipherReader{r: r, pipe: encryptionPipe(ctx)}
+}
+
+// NewDecryptReader returns a reader of the data read from r decrypted with
+// the context. The decryption is only finished, and the last data
+// authenticated or unpadded, when r reaches EOF.
+func NewDecryptReader(r io.Reader, ctx DecryptionCipherCtx) io.Reader {
+	return &cipherReader{r: r, pipe: decryptionPipe(ctx)}
+}
+
+func (cr *cipherReader) Read(p []byte) (int, error) {
+	for len(cr.pending) == 0 && cr.err == nil {
+		if cr.buf == nil {
+			cr.buf = make([]byte, 32*1024)
+		}
+		n, err := cr.r.Read(cr.buf)
+		if n > 0 {
+			cr.pending, cr.err = cr.pipe.update(cr.buf[:n])
+		}
+		if err == io.EOF && cr.err == nil {
+			var out []byte
+			out, cr.err = cr.pipe.final()
+			cr.pending = append(cr.pending, out...)
+			if cr.err == nil {
+				cr.err = io.EOF
+			}
+		} else if err != nil && cr.err == nil {
+			cr.err = err
+		}
+	}
+	n := copy(p, cr.pending)
+	cr.pending = cr.pending[n:]
+	if len(cr.pending) == 0 {
+		return n, cr.err
+	}
+	return n, nil
+}
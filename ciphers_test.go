@@ -16,7 +16,12 @@ package openssl
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"strings"
 	"testing"
 )
@@ -300,3 +305,181 @@ func TestNonAuthenticatedEncryption(t *testing.T) {
 
 	checkEqual(t, []byte(plainOutput), plaintext1+plaintext2)
 }
+
+func TestCipherStream(t *testing.T) {
+	key := make([]byte, 32)
+	iv := make([]byte, 16)
+	rand.Read(key)
+	rand.Read(iv)
+	plaintext := make([]byte, 1000)
+	rand.Read(plaintext)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctr, err := GetCipherByName("aes-256-ctr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := NewCipherStream(ctr, key, iv, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(plaintext))
+	// the key stream continues over calls
+	stream.XORKeyStream(got[:100], plaintext[:100])
+	stream.XORKeyStream(got[100:], plaintext[100:])
+	want := make([]byte, len(plaintext))
+	cipher.NewCTR(block, iv).XORKeyStream(want, plaintext)
+	checkEqual(t, got, string(want))
+
+	cbc, err := GetCipherByName("aes-256-cbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCipherStream(cbc, key, iv, true); err == nil {
+		t.Fatal("created a stream over CBC")
+	}
+	encrypter, err := NewBlockModeEncrypter(cbc, key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = make([]byte, 992)
+	encrypter.CryptBlocks(got[:160], plaintext[:160])
+	encrypter.CryptBlocks(got[160:], plaintext[160:992])
+	want = make([]byte, 992)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(want, plaintext[:992])
+	checkEqual(t, got, string(want))
+
+	decrypter, err := NewBlockModeDecrypter(cbc, key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypter.CryptBlocks(got, got)
+	checkEqual(t, got, string(plaintext[:992]))
+}
+
+func TestCipherPipeline(t *testing.T) {
+	key := make([]byte, 32)
+	iv := make([]byte, 16)
+	rand.Read(key)
+	rand.Read(iv)
+	plaintext := make([]byte, 100*1024+7)
+	rand.Read(plaintext)
+	cbc, err := GetCipherByName("aes-256-cbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encCtx, err := NewEncryptionCipherCtx(cbc, nil, key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ciphertext bytes.Buffer
+	w := NewEncryptWriter(&ciphertext, encCtx)
+	if _, err := io.Copy(w, bytes.NewReader(plaintext)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	encCtx, err = NewEncryptionCipherCtx(cbc, nil, key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ioutil.ReadAll(NewEncryptReader(bytes.NewReader(plaintext),
+		encCtx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, read, ciphertext.String())
+
+	decCtx, err := NewDecryptionCipherCtx(cbc, nil, key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err = ioutil.ReadAll(NewDecryptReader(
+		bytes.NewReader(ciphertext.Bytes()), decCtx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, read, string(plaintext))
+
+	decCtx, err = NewDecryptionCipherCtx(cbc, nil, key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decrypted bytes.Buffer
+	w = NewDecryptWriter(&decrypted, decCtx)
+	if _, err := w.Write(ciphertext.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decrypted.Bytes(), string(plaintext))
+
+	// a truncated ciphertext fails when finishing
+	decCtx, err = NewDecryptionCipherCtx(cbc, nil, key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(NewDecryptReader(
+		bytes.NewReader(ciphertext.Bytes()[:ciphertext.Len()-1]), decCtx))
+	if err == nil {
+		t.Fatal("decrypted a truncated ciphertext")
+	}
+}
+
+func TestAESKeyWrap(t *testing.T) {
+	// RFC 3394, section 4.1
+	kek := mustDecodeHex(t, "000102030405060708090a0b0c0d0e0f")
+	key := mustDecodeHex(t, "00112233445566778899aabbccddeeff")
+	want := mustDecodeHex(t, "1fa68b0a8112b447aef34bd8fb5a7b82"+
+		"9d3e862371d2cfe5")
+	wrapped, err := AESKeyWrap(kek, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, wrapped, string(want))
+	unwrapped, err := AESKeyUnwrap(kek, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, unwrapped, string(key))
+	wrapped[0] ^= 1
+	if _, err := AESKeyUnwrap(kek, wrapped); err == nil {
+		t.Fatal("unwrapped a forged key")
+	}
+
+	// RFC 5649, section 6
+	kek = mustDecodeHex(t, "5840df6e29b02af1ab493b705bf16ea1"+
+		"ae8338f4dcc176a8")
+	for _, test := range []struct{ key, wrapped string }{
+		{"c37b7e6492584340bed12207808941155068f738",
+			"138bdeaa9b8fa7fc61f97742e72248ee" +
+				"5ae6ae5360d1ae6a5f54f373fa543b6a"},
+		{"466f7250617369", "afbeb0f07dfbf5419200f2ccb50bb24f"},
+	} {
+		key := mustDecodeHex(t, test.key)
+		wrapped, err := AESKeyWrapPad(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, wrapped, string(mustDecodeHex(t, test.wrapped)))
+		unwrapped, err := AESKeyUnwrapPad(kek, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, unwrapped, string(key))
+	}
+
+	if _, err := AESKeyWrap(kek[:20], key); err == nil {
+		t.Fatal("wrapped with a 20-byte key encryption key")
+	}
+	if _, err := AESKeyWrap(kek, key[:12]); err == nil {
+		t.Fatal("wrapped a 12-byte key without padding")
+	}
+}
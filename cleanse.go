@@ -0,0 +1,50 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"unsafe"
+)
+
+// ConstantTimeCompare returns 1 if a and b are equal and 0 otherwise, with
+// CRYPTO_memcmp, in time depending only on their lengths. Like
+// crypto/subtle.ConstantTimeCompare, it returns 0 at once for different
+// lengths.
+func ConstantTimeCompare(a, b []byte) int {
+	if len(a) != len(b) {
+		return 0
+	}
+	if len(a) == 0 {
+		return 1
+	}
+	if C.CRYPTO_memcmp(unsafe.Pointer(&a[0]), unsafe.Pointer(&b[0]),
+		C.size_t(len(a))) != 0 {
+		return 0
+	}
+	return 1
+}
+
+// Cleanse overwrites b with zeros with OPENSSL_cleanse, which the compiler
+// cannot optimize away. Use it to wipe secrets once they are not needed;
+// copies made by the Go runtime, e.g. when growing a slice, are not wiped.
+func Cleanse(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	C.OPENSSL_cleanse(unsafe.Pointer(&b[0]), C.size_t(len(b)))
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestConstantTimeCompare(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 1},
+		{"secret", "secret", 1},
+		{"secret", "secreT", 0},
+		{"secret", "secrets", 0},
+		{"", "x", 0},
+	} {
+		if got := ConstantTimeCompare([]byte(test.a),
+			[]byte(test.b)); got != test.want {
+			t.Fatalf("%q and %q: got %d, want %d", test.a, test.b, got,
+				test.want)
+		}
+	}
+}
+
+func TestCleanse(t *testing.T) {
+	secret := []byte("the quick brown fox")
+	Cleanse(secret[4:])
+	if !bytes.Equal(secret, append([]byte("the "), make([]byte, 15)...)) {
+		t.Fatalf("unexpected cleansed buffer %q", secret)
+	}
+	Cleanse(nil)
+}
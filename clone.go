@@ -0,0 +1,158 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"runtime"
+)
+
+// Clone returns a new context with the configuration of c: the protocol
+// method, options and modes, versions, cipher lists, certificates, keys and
+// chains, verification settings and callbacks, session settings and the
+// callbacks and settings of this package, such as the OCSP staple policy,
+// the ticket store, the client session cache and the identity of
+// ReloadCertificate. The result is independent of c except for the trust
+// store, which is shared, and the callbacks, stores and caches, which are
+// the same values. It is meant to derive e.g. per virtual host contexts from
+// a base one, before they are used.
+//
+// Clone must not be called concurrently with the modification of c.
+func (c *Ctx) Clone() (*Ctx, error) {
+	clone, err := newCtx(C.SSL_CTX_get_ssl_method(c.ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	runtime.LockOSThread()
+	if C.X_SSL_CTX_copy(clone.ctx, c.ctx) != 1 {
+		err := errorFromErrorQueue()
+		runtime.UnlockOSThread()
+		return nil, err
+	}
+	runtime.UnlockOSThread()
+
+	// the extra chain certificates are referenced by the clone
+	clone.cert = c.cert
+	clone.key = c.key
+	for _, cert := range c.chain {
+		clone.chain = append(clone.chain, &Certificate{x: cert.x})
+	}
+
+	clone.verify_cb = c.verify_cb
+	clone.verify_time = c.verify_time
+	clone.verify_skew = c.verify_skew
+	clone.read_buffer_size = c.read_buffer_size
+	clone.write_buffer_size = c.write_buffer_size
+	clone.io_counts = c.io_counts
+	clone.server_name = c.server_name
+	clone.server_verify_mode = c.server_verify_mode
+	if c.verify_host {
+		clone.verify_host = true
+		clone.verify_config_once.Do(func() {
+			C.X_SSL_CTX_enable_cert_verify_cb(clone.ctx)
+		})
+	}
+	clone.session_cache = c.session_cache
+	clone.store_id = c.store_id
+
+	if c.sni_cb != nil {
+		clone.SetTLSExtServernameCallback(c.sni_cb)
+	}
+	if err := clone.SetNextProtos(c.alpn_protos); err != nil {
+		return nil, err
+	}
+	clone.SetOCSPStaplePolicy(c.ocsp_policy)
+	c.ticket_store_mu.Lock()
+	store := c.ticket_store
+	c.ticket_store_mu.Unlock()
+	if store != nil {
+		clone.SetTicketStore(store)
+	}
+	if c.stats != nil {
+		clone.SetStats(c.stats)
+	}
+	c.handshake_msg_mu.RLock()
+	for typ, cb := range c.handshake_msg_cbs {
+		clone.SetHandshakeMessageCallback(typ, cb)
+	}
+	c.handshake_msg_mu.RUnlock()
+	c.identity_mu.RLock()
+	id := c.identity
+	c.identity_mu.RUnlock()
+	if id != nil {
+		clone.identity_once.Do(func() {
+			C.X_SSL_CTX_enable_cert_cb(clone.ctx)
+		})
+		clone.identity = id
+	}
+
+	if config := c.verify_config; config != nil {
+		if config.roots != nil && C.X_SSL_CTX_set1_verify_cert_store(
+			clone.ctx, config.roots.store) != 1 {
+			return nil, errors.New("failed to set the verification store")
+		}
+		clone.verify_config = config
+		clone.verify_config_once.Do(func() {
+			C.X_SSL_CTX_enable_cert_verify_cb(clone.ctx)
+		})
+	}
+	if c.session_id != nil {
+		if err := clone.SetSessionId(c.session_id); err != nil {
+			return nil, err
+		}
+	}
+	if c.curve != 0 {
+		if err := clone.SetEllipticCurve(c.curve); err != nil {
+			return nil, err
+		}
+	}
+	if c.groups != nil {
+		if err := clone.SetGroups(c.groups...); err != nil {
+			return nil, err
+		}
+	}
+	if c.dh != nil {
+		if err := clone.SetDHParameters(c.dh); err != nil {
+			return nil, err
+		}
+	}
+	if c.dh_auto != nil {
+		if err := clone.SetDHAuto(*c.dh_auto); err != nil {
+			return nil, err
+		}
+	}
+	if c.dane {
+		if err := clone.DaneEnable(); err != nil {
+			return nil, err
+		}
+		clone.DaneSetFlags(c.DaneSetFlags(0))
+	}
+	if err := clone.SetSRTPProfiles(c.srtp); err != nil {
+		return nil, err
+	}
+	for i, types := range c.cert_types {
+		if types != nil {
+			if err := clone.setCertificateTypes(i == 1,
+				types); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return clone, nil
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestCtxClone(t *testing.T) {
+	ca := newTestCertificate(t, "Test CA", true, nil)
+	intermediate := newTestCertificate(t, "Test Intermediate", true, ca)
+	leaf := newTestCertificate(t, "localhost", false, intermediate)
+
+	base := GetCtx(t)
+	if err := base.AddKeyPair([]*Certificate{leaf.cert, intermediate.cert},
+		leaf.key); err != nil {
+		t.Fatal(err)
+	}
+	base.SetOptions(NoTicket)
+	base.SetMaxProtoVersion(TLS1_2_VERSION)
+	base.SetVerifyDepth(3)
+	if err := base.SetCipherList("ECDHE-ECDSA-AES128-GCM-SHA256:" +
+		"ECDHE-RSA-AES128-GCM-SHA256"); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.SetNextProtos([]string{"h2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := base.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.GetOptions() != base.GetOptions() {
+		t.Fatalf("options %x, want %x", clone.GetOptions(),
+			base.GetOptions())
+	}
+	if clone.GetVerifyDepth() != 3 {
+		t.Fatalf("unexpected verify depth %d", clone.GetVerifyDepth())
+	}
+	// the clone is independent
+	clone.SetVerifyDepth(5)
+	if base.GetVerifyDepth() != 3 {
+		t.Fatal("base context is modified")
+	}
+	// the clone holds its own references
+	base = nil
+	runtime.GC()
+	runtime.GC()
+
+	// both identities, the cipher list and ALPN are copied
+	for cipher, cn := range map[string]string{
+		"ECDHE-ECDSA-AES128-GCM-SHA256": "localhost",
+		"ECDHE-RSA-AES128-GCM-SHA256":   "",
+	} {
+		clientCtx, err := NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := clientCtx.SetCipherList(cipher); err != nil {
+			t.Fatal(err)
+		}
+		if err := clientCtx.SetNextProtos([]string{"h2"}); err != nil {
+			t.Fatal(err)
+		}
+		serverConn, clientConn := NetPipe(t)
+		server, err := Server(serverConn, clone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doHandshake(t, server, client)
+		params := client.NegotiatedParameters()
+		if params.Cipher != cipher || params.ALPN != "h2" {
+			t.Fatalf("unexpected parameters %+v", params)
+		}
+		if params.Version != "TLSv1.2" {
+			t.Fatalf("unexpected version %s", params.Version)
+		}
+		chain, err := client.PeerCertificateChain()
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, err := chain[0].GetSubjectName()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := name.GetEntry(NID_commonName)
+		if cn != "" && (got != cn || len(chain) != 2) {
+			t.Fatalf("unexpected chain of %q with %d certificates", got,
+				len(chain))
+		}
+		if cn == "" && got == "localhost" {
+			t.Fatal("ECDSA certificate used for RSA")
+		}
+		close_both(server, client)
+	}
+}
+
+func TestCtxCloneCertificateTypes(t *testing.T) {
+	if !rpk_support {
+		t.Skip("raw public keys need OpenSSL 3.2 or newer")
+	}
+	serverKey, err := LoadPrivateKeyFromPEM(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := GetCtx(t)
+	if err := base.SetServerCertificateTypes(
+		CertificateTypeRawPublicKey); err != nil {
+		t.Fatal(err)
+	}
+	serverCtx, err := base.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientBase, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clientBase.DaneEnable(); err != nil {
+		t.Fatal(err)
+	}
+	if err := clientBase.SetServerCertificateTypes(
+		CertificateTypeRawPublicKey); err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := clientBase.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, serverCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddExpectedRawPublicKey(serverKey); err != nil {
+		t.Fatal(err)
+	}
+	doHandshake(t, server, client)
+	defer close_both(server, client)
+	if typ := client.ServerCertificateType(); typ != CertificateTypeRawPublicKey {
+		t.Fatalf("negotiated server certificate type %d", typ)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+/*
+#include "openssl/conf.h"
+#include "shim.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// LoadOpenSSLConfig loads the configuration modules, such as engines,
+// providers and system-wide algorithm policies, of the section appName of
+// the openssl.cnf at path, so that the binary controls its configuration
+// instead of depending on the ambient OPENSSL_CONF. An empty appName takes
+// the openssl_conf section. Unknown modules and missing files are errors.
+func LoadOpenSSLConfig(path, appName string) error {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	var cname *C.char
+	if appName != "" {
+		cname = C.CString(appName)
+		defer C.free(unsafe.Pointer(cname))
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.CONF_modules_load_file(cpath, cname, 0) <= 0 {
+		return fmt.Errorf("failed loading OpenSSL config %s: %w", path,
+			errorFromErrorQueue())
+	}
+	return nil
+}
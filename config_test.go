@@ -0,0 +1,56 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOpenSSLConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "openssl.cnf")
+	err = ioutil.WriteFile(path, []byte(`
+myapp = myapp_sect
+broken = broken_sect
+
+[myapp_sect]
+
+[broken_sect]
+no_such_module = no_such_sect
+
+[no_such_sect]
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadOpenSSLConfig(path, "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadOpenSSLConfig(path, "broken"); err == nil {
+		t.Fatal("loaded an unknown module")
+	}
+	if err := LoadOpenSSLConfig(filepath.Join(dir, "missing.cnf"),
+		""); err == nil {
+		t.Fatal("loaded a missing config")
+	}
+}
@@ -27,7 +27,6 @@ import (
 	"time"
 	"unsafe"
 
-	"github.com/mattn/go-pointer"
 	"github.com/tarantool/go-openssl/utils"
 )
 
@@ -41,13 +40,25 @@ var (
 type Conn struct {
 	*SSL
 
-	conn             net.Conn
-	ctx              *Ctx // for gc
-	into_ssl         *readBio
-	from_ssl         *writeBio
-	is_shutdown      bool
-	mtx              sync.Mutex
-	want_read_future *utils.Future
+	conn         net.Conn
+	raw          net.Conn // conn or counts, if the context counts traffic
+	counts       *countingConn
+	ctx          *Ctx // for gc
+	into_ssl     *readBio
+	from_ssl     *writeBio
+	is_shutdown  bool
+	mtx          sync.Mutex // held only while OpenSSL runs, not during I/O
+	write_mtx    sync.Mutex // keeps concurrent Writes from interleaving
+	write_size   int
+	read_errcb   errorHandler
+	read_last    C.int // the result of the last SSL_read of a batch
+	fill         *inputFill
+	created_at   time.Time
+	handshake_at time.Time
+
+	stats_started    sync.Once
+	stats_finished   sync.Once
+	stats_started_at time.Time
 }
 
 type VerifyResult int
@@ -100,6 +111,12 @@ const (
 	ApplicationVerification       VerifyResult = C.X509_V_ERR_APPLICATION_VERIFICATION
 )
 
+// String returns the description of the result, see
+// VerifyCertErrorString.
+func (r VerifyResult) String() string {
+	return VerifyCertErrorString(r)
+}
+
 func newSSL(ctx *C.SSL_CTX) (*C.SSL, error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
@@ -116,7 +133,7 @@ func newConn(conn net.Conn, ctx *Ctx) (*Conn, error) {
 		return nil, err
 	}
 
-	into_ssl := &readBio{}
+	into_ssl := &readBio{read_size: ctx.read_buffer_size}
 	from_ssl := &writeBio{}
 
 	if ctx.GetMode()&ReleaseBuffers > 0 {
@@ -136,21 +153,35 @@ func newConn(conn net.Conn, ctx *Ctx) (*Conn, error) {
 
 	// the ssl object takes ownership of these objects now
 	C.SSL_set_bio(ssl, into_ssl_cbio, from_ssl_cbio)
+	// let OpenSSL take all the buffered records from the BIO at once
+	C.SSL_set_read_ahead(ssl, 1)
 
-	s := &SSL{ssl: ssl}
-	C.SSL_set_ex_data(s.ssl, get_ssl_idx(), pointer.Save(s))
+	s := &SSL{ssl: ssl, stats: ctx.stats}
+	C.SSL_set_ex_data(s.ssl, get_ssl_idx(), pointers.Save(s))
 
 	c := &Conn{
 		SSL: s,
 
-		conn:     conn,
-		ctx:      ctx,
-		into_ssl: into_ssl,
-		from_ssl: from_ssl}
+		conn:       conn,
+		raw:        conn,
+		ctx:        ctx,
+		into_ssl:   into_ssl,
+		from_ssl:   from_ssl,
+		created_at: time.Now(),
+		fill:       newInputFill(),
+		write_size: ctx.write_buffer_size}
+	if ctx.io_counts {
+		c.counts = newCountingConn(conn, C.X_SSL_is_dtls(ssl) == 1)
+		c.raw = c.counts
+	}
+	tracked := trackAlloc(&liveAllocs.SSL)
+	trackAllocs(&liveAllocs.BIO, 2, tracked)
 	runtime.SetFinalizer(c, func(c *Conn) {
 		c.into_ssl.Disconnect(into_ssl_cbio)
 		c.from_ssl.Disconnect(from_ssl_cbio)
 		C.SSL_free(c.ssl)
+		untrackAlloc(&liveAllocs.SSL, tracked)
+		trackAllocs(&liveAllocs.BIO, -2, tracked)
 	})
 	return c, nil
 }
@@ -174,6 +205,14 @@ func Client(conn net.Conn, ctx *Ctx) (*Conn, error) {
 		return nil, err
 	}
 	C.SSL_set_connect_state(c.ssl)
+	if ctx.server_name != "" {
+		if err := c.SetTlsExtHostName(ctx.server_name); err != nil {
+			return nil, err
+		}
+	}
+	if ctx.ocsp_policy.Mode != OCSPStapleIgnore {
+		c.SetOCSPStaplePolicy(ctx.ocsp_policy)
+	}
 	return c, nil
 }
 
@@ -185,11 +224,46 @@ func Server(conn net.Conn, ctx *Ctx) (*Conn, error) {
 		return nil, err
 	}
 	C.SSL_set_accept_state(c.ssl)
+	if mode := ctx.server_verify_mode; mode != nil {
+		// the verify mode of the context is the one of the clients
+		C.SSL_set_verify(c.ssl, C.int(*mode),
+			(*[0]byte)(C.X_SSL_CTX_verify_cb))
+	}
 	return c, nil
 }
 
 func (c *Conn) GetCtx() *Ctx { return c.ctx }
 
+// Ctx returns the context the connection was created with, e.g. the one of
+// the listener that accepted it, even if an SNI callback switched the
+// connection to another one with SSL.SetSSLCtx. It is the same as GetCtx.
+func (c *Conn) Ctx() *Ctx { return c.ctx }
+
+// SetMode sets the modes of the connection, see SSL.SetMode. With
+// ReleaseBuffers the connection also frees its Go buffers once they are
+// empty, including the ones that are empty already.
+func (c *Conn) SetMode(modes Modes) Modes {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	rv := c.SSL.SetMode(modes)
+	c.setReleaseBuffers(rv&ReleaseBuffers != 0)
+	return rv
+}
+
+// ClearMode clears the modes of the connection, see SSL.ClearMode.
+func (c *Conn) ClearMode(modes Modes) Modes {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	rv := c.SSL.ClearMode(modes)
+	c.setReleaseBuffers(rv&ReleaseBuffers != 0)
+	return rv
+}
+
+func (c *Conn) setReleaseBuffers(release bool) {
+	c.into_ssl.setReleaseBuffers(release)
+	c.from_ssl.setReleaseBuffers(release)
+}
+
 func (c *Conn) CurrentCipher() (string, error) {
 	p := C.X_SSL_get_cipher_name(c.ssl)
 	if p == nil {
@@ -201,7 +275,7 @@ func (c *Conn) CurrentCipher() (string, error) {
 
 func (c *Conn) fillInputBuffer() error {
 	for {
-		n, err := c.into_ssl.ReadFromOnce(c.conn)
+		n, err := c.into_ssl.ReadFromOnce(c.raw)
 		if n == 0 && err == nil {
 			continue
 		}
@@ -213,45 +287,106 @@ func (c *Conn) fillInputBuffer() error {
 	}
 }
 
+// inputFill lets a single goroutine fill the input buffer while the others
+// wait for its result. It doesn't point back to the Conn, so the Conn
+// finalizer still runs.
+type inputFill struct {
+	mtx     sync.Mutex
+	cond    sync.Cond
+	filling bool
+	gen     uint64
+	err     error
+}
+
+func newInputFill() *inputFill {
+	f := &inputFill{}
+	f.cond.L = &f.mtx
+	return f
+}
+
+// start marks the beginning of a fill. It returns false and the generation
+// to wait for if another goroutine is already filling.
+func (f *inputFill) start() (bool, uint64) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.filling {
+		return false, f.gen
+	}
+	f.filling = true
+	return true, f.gen
+}
+
+func (f *inputFill) finish(err error) {
+	f.mtx.Lock()
+	f.filling = false
+	f.gen++
+	f.err = err
+	f.cond.Broadcast()
+	f.mtx.Unlock()
+}
+
+// wait waits for the fill with the generation gen and returns its result.
+func (f *inputFill) wait(gen uint64) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for f.gen == gen {
+		f.cond.Wait()
+	}
+	if f.gen == gen+1 {
+		return f.err
+	}
+	return errTryAgain
+}
+
+// fillInputBufferShared fills the input buffer for the goroutines waiting
+// in inputFill.wait too. It is a method expression rather than a closure,
+// so that reading a record does not allocate.
+func (c *Conn) fillInputBufferShared() error {
+	err := c.fillInputBuffer()
+	if err == nil {
+		err = errTryAgain
+	}
+	c.fill.finish(err)
+	return err
+}
+
+// flushOutputBufferAsync flushes the output buffer in the background if it
+// has data.
+func (c *Conn) flushOutputBufferAsync() {
+	if c.from_ssl.pending() > 0 {
+		go c.flushOutputBuffer()
+	}
+}
+
 func (c *Conn) flushOutputBuffer() error {
-	_, err := c.from_ssl.WriteTo(c.conn)
+	_, err := c.from_ssl.WriteTo(c.raw)
 	return err
 }
 
-func (c *Conn) getErrorHandler(rv C.int, errno error) func() error {
+// errorHandler completes an I/O operation that OpenSSL couldn't finish, for
+// example by filling the input buffer. It returns errTryAgain if the operation
+// should be retried.
+type errorHandler func(c *Conn) error
+
+func (c *Conn) getErrorHandler(rv C.int, errno error) errorHandler {
 	errcode := C.SSL_get_error(c.ssl, rv)
 	switch errcode {
 	case C.SSL_ERROR_ZERO_RETURN:
-		return func() error {
+		return func(c *Conn) error {
 			c.Close()
 			return io.ErrUnexpectedEOF
 		}
 	case C.SSL_ERROR_WANT_READ:
-		go c.flushOutputBuffer()
-		if c.want_read_future != nil {
-			want_read_future := c.want_read_future
-			return func() error {
-				_, err := want_read_future.Get()
-				return err
-			}
-		}
-		c.want_read_future = utils.NewFuture()
-		want_read_future := c.want_read_future
-		return func() (err error) {
-			defer func() {
-				c.mtx.Lock()
-				c.want_read_future = nil
-				c.mtx.Unlock()
-				want_read_future.Set(nil, err)
-			}()
-			err = c.fillInputBuffer()
-			if err != nil {
-				return err
-			}
-			return errTryAgain
+		c.flushOutputBufferAsync()
+		ok, gen := c.fill.start()
+		if !ok {
+			// another goroutine is reading, wait for it
+			fill := c.fill
+			return func(*Conn) error { return fill.wait(gen) }
 		}
+		return (*Conn).fillInputBufferShared
 	case C.SSL_ERROR_WANT_WRITE:
-		return func() error {
+		return func(c *Conn) error {
 			err := c.flushOutputBuffer()
 			if err != nil {
 				return err
@@ -272,44 +407,73 @@ func (c *Conn) getErrorHandler(rv C.int, errno error) func() error {
 		} else {
 			err = errorFromErrorQueue()
 		}
-		return func() error { return err }
+		return func(*Conn) error { return err }
 	default:
 		err := errorFromErrorQueue()
-		return func() error { return err }
+		return func(*Conn) error { return err }
+	}
+}
+
+// annotateError includes the correlation ID of the connection, if any, into
+// err. Sentinel errors such as io.EOF and the network errors of the
+// underlying connection, e.g. timeouts, are returned as is so that callers
+// can compare them directly and assert net.Error.
+func (c *Conn) annotateError(err error) error {
+	if err == nil || c.correlation_id == "" {
+		return err
+	}
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF, io.ErrShortWrite, io.ErrClosedPipe:
+		return err
+	}
+	if _, ok := err.(net.Error); ok {
+		return err
 	}
+	return fmt.Errorf("%w (correlation id %q)", err, c.correlation_id)
 }
 
-func (c *Conn) handleError(errcb func() error) error {
+func (c *Conn) handleError(errcb errorHandler) error {
 	if errcb != nil {
-		return errcb()
+		return errcb(c)
 	}
 	return nil
 }
 
-func (c *Conn) handshake() func() error {
+func (c *Conn) handshake() errorHandler {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 	if c.is_shutdown {
-		return func() error { return io.ErrUnexpectedEOF }
+		return func(*Conn) error { return io.ErrUnexpectedEOF }
 	}
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 	rv, errno := C.SSL_do_handshake(c.ssl)
 	if rv > 0 {
+		c.markHandshake()
 		return nil
 	}
 	return c.getErrorHandler(rv, errno)
 }
 
+// markHandshake records the time of the handshake completion. It must be
+// called with c.mtx held.
+func (c *Conn) markHandshake() {
+	if c.handshake_at.IsZero() {
+		c.handshake_at = time.Now()
+	}
+}
+
 // Handshake performs an SSL handshake. If a handshake is not manually
 // triggered, it will run before the first I/O on the encrypted stream.
 func (c *Conn) Handshake() error {
+	c.statsHandshakeStarted()
 	err := errTryAgain
 	for err == errTryAgain {
 		err = c.handleError(c.handshake())
 	}
-	go c.flushOutputBuffer()
-	return err
+	c.statsHandshakeFinished(err)
+	c.flushOutputBufferAsync()
+	return c.annotateError(err)
 }
 
 // PeerCertificate returns the Certificate of the peer with which you're
@@ -325,9 +489,7 @@ func (c *Conn) PeerCertificate() (*Certificate, error) {
 		return nil, errors.New("no peer certificate found")
 	}
 	cert := &Certificate{x: x}
-	runtime.SetFinalizer(cert, func(cert *Certificate) {
-		C.X509_free(cert.x)
-	})
+	setCertificateFinalizer(cert)
 	return cert, nil
 }
 
@@ -364,22 +526,79 @@ func (c *Conn) PeerCertificateChain() (rv []*Certificate, err error) {
 	return c.loadCertificateStack(sk), nil
 }
 
+// VerifiedChain returns the certificate chain built by the verification of
+// the peer certificate, starting with it. It is only available if the peer
+// certificate was verified and requires OpenSSL 1.1.0 or newer.
+func (c *Conn) VerifiedChain() ([]*Certificate, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.is_shutdown {
+		return nil, errors.New("connection closed")
+	}
+	// the chain is built even if the verification fails or is disabled
+	if C.SSL_get_verify_result(c.ssl) != C.X509_V_OK {
+		return nil, errors.New("peer certificate was not verified")
+	}
+	sk := C.X_SSL_get0_verified_chain(c.ssl)
+	if sk == nil {
+		return nil, errors.New("no verified certificate chain")
+	}
+	return c.loadCertificateStack(sk), nil
+}
+
+// ExportKeyingMaterial derives length bytes of keying material from the
+// session with the exporter of RFC 5705 (TLS 1.2) or RFC 8446 (TLS 1.3),
+// bound to the label and, if not nil, the context. Only valid after a
+// handshake.
+func (c *Conn) ExportKeyingMaterial(label string, context []byte,
+	length int) ([]byte, error) {
+	if length <= 0 {
+		return nil, errors.New("keying material length must be positive")
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.is_shutdown {
+		return nil, errors.New("connection closed")
+	}
+	out := make([]byte, length)
+	var useContext C.int
+	if context != nil {
+		useContext = 1
+	}
+	clabel := C.CString(label)
+	defer C.free(unsafe.Pointer(clabel))
+	if C.SSL_export_keying_material(c.ssl,
+		(*C.uchar)(unsafe.Pointer(&out[0])), C.size_t(length), clabel,
+		C.size_t(len(label)), bytesPtr(context), C.size_t(len(context)),
+		useContext) != 1 {
+		return nil, errors.New("failed to export keying material")
+	}
+	return out, nil
+}
+
 type ConnectionState struct {
 	Certificate           *Certificate
 	CertificateError      error
 	CertificateChain      []*Certificate
 	CertificateChainError error
 	SessionReused         bool
+	// OCSPStaple is the outcome of the OCSP staple validation and
+	// OCSPStapleError the reason it failed, if it did.
+	OCSPStaple      OCSPStapleStatus
+	OCSPStapleError error
 }
 
 func (c *Conn) ConnectionState() (rv ConnectionState) {
 	rv.Certificate, rv.CertificateError = c.PeerCertificate()
 	rv.CertificateChain, rv.CertificateChainError = c.PeerCertificateChain()
 	rv.SessionReused = c.SessionReused()
+	c.mtx.Lock()
+	rv.OCSPStaple, rv.OCSPStapleError = c.ocsp_status, c.ocsp_err
+	c.mtx.Unlock()
 	return
 }
 
-func (c *Conn) shutdown() func() error {
+func (c *Conn) shutdown() errorHandler {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 	runtime.LockOSThread()
@@ -436,22 +655,49 @@ func (c *Conn) Close() error {
 	var errs utils.ErrorGroup
 	errs.Add(c.shutdownLoop())
 	errs.Add(c.conn.Close())
-	return errs.Finalize()
+	return c.annotateError(errs.Finalize())
 }
 
-func (c *Conn) read(b []byte) (int, func() error) {
+// read calls SSL_read once. If end is not nil, it is set to whether the
+// read consumed the rest of the current record. Otherwise, read fills b
+// from as many buffered records as possible in a single cgo call.
+func (c *Conn) read(b []byte, end *bool) (int, errorHandler) {
 	if len(b) == 0 {
 		return 0, nil
 	}
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 	if c.is_shutdown {
-		return 0, func() error { return io.EOF }
+		return 0, func(*Conn) error { return io.EOF }
+	}
+	if errcb := c.read_errcb; errcb != nil {
+		c.read_errcb = nil
+		return 0, errcb
 	}
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
+	if end == nil {
+		rv, errno := C.X_SSL_read_batch(c.ssl, unsafe.Pointer(&b[0]),
+			C.int(len(b)), &c.read_last)
+		if rv <= 0 {
+			return 0, c.getErrorHandler(rv, errno)
+		}
+		c.markHandshake()
+		if last := c.read_last; last <= 0 {
+			// the data is read, so report the error of the following
+			// record with the next read
+			switch C.SSL_get_error(c.ssl, last) {
+			case C.SSL_ERROR_WANT_READ, C.SSL_ERROR_WANT_WRITE:
+			default:
+				c.read_errcb = c.getErrorHandler(last, errno)
+			}
+		}
+		return int(rv), nil
+	}
 	rv, errno := C.SSL_read(c.ssl, unsafe.Pointer(&b[0]), C.int(len(b)))
 	if rv > 0 {
+		c.markHandshake()
+		*end = C.SSL_pending(c.ssl) == 0
 		return int(rv), nil
 	}
 	return 0, c.getErrorHandler(rv, errno)
@@ -464,22 +710,25 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
+	c.statsHandshakeStarted()
 	err = errTryAgain
 	for err == errTryAgain {
-		n, errcb := c.read(b)
+		n, errcb := c.read(b, nil)
 		err = c.handleError(errcb)
 		if err == nil {
-			go c.flushOutputBuffer()
+			c.flushOutputBufferAsync()
+			c.statsRead(n, nil)
 			return n, nil
 		}
 		if err == io.ErrUnexpectedEOF {
 			err = io.EOF
 		}
 	}
-	return 0, err
+	c.statsRead(0, err)
+	return 0, c.annotateError(err)
 }
 
-func (c *Conn) write(b []byte) (int, func() error) {
+func (c *Conn) write(b []byte) (int, errorHandler) {
 	if len(b) == 0 {
 		return 0, nil
 	}
@@ -487,12 +736,13 @@ func (c *Conn) write(b []byte) (int, func() error) {
 	defer c.mtx.Unlock()
 	if c.is_shutdown {
 		err := errors.New("connection closed")
-		return 0, func() error { return err }
+		return 0, func(*Conn) error { return err }
 	}
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 	rv, errno := C.SSL_write(c.ssl, unsafe.Pointer(&b[0]), C.int(len(b)))
 	if rv > 0 {
+		c.markHandshake()
 		return int(rv), nil
 	}
 	return 0, c.getErrorHandler(rv, errno)
@@ -500,12 +750,40 @@ func (c *Conn) write(b []byte) (int, func() error) {
 
 // Write will encrypt the contents of b and write it to the underlying stream.
 // Performance will be vastly improved if the size of b is a multiple of
-// SSLRecordSize.
+// SSLRecordSize. Write may be called concurrently with Read; concurrent
+// Writes are serialized.
 func (c *Conn) Write(b []byte) (written int, err error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
-	err = errTryAgain
+	c.statsHandshakeStarted()
+	c.write_mtx.Lock()
+	defer c.write_mtx.Unlock()
+	written, err = c.writeAll(b)
+	c.statsWrite(written, err)
+	return written, c.annotateError(err)
+}
+
+// writeAll writes b in chunks of c.write_size. It must be called with
+// c.write_mtx held.
+func (c *Conn) writeAll(b []byte) (written int, err error) {
+	for written < len(b) {
+		chunk := b[written:]
+		if len(chunk) > c.write_size {
+			chunk = chunk[:c.write_size]
+		}
+		n, err := c.writeChunk(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// writeChunk writes all of b and flushes the output buffer.
+func (c *Conn) writeChunk(b []byte) (int, error) {
+	err := errTryAgain
 	for err == errTryAgain {
 		n, errcb := c.write(b)
 		err = c.handleError(errcb)
@@ -555,6 +833,13 @@ func (c *Conn) UnderlyingConn() net.Conn {
 	return c.conn
 }
 
+// NetConn returns the underlying connection, like crypto/tls.Conn.NetConn,
+// e.g. to query transport statistics. Reading from it or writing to it
+// corrupts the TLS stream. It is the same as UnderlyingConn.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
 func (c *Conn) SetTlsExtHostName(name string) error {
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
@@ -566,10 +851,31 @@ func (c *Conn) SetTlsExtHostName(name string) error {
 	return nil
 }
 
+// VerifyResult returns the result of the verification of the peer
+// certificate chain by OpenSSL (SSL_get_verify_result). The chain is
+// verified with VerifyNone too, so clients doing custom checks can still get
+// the outcome after the handshake. It is Ok if the peer sent no
+// certificate.
 func (c *Conn) VerifyResult() VerifyResult {
 	return VerifyResult(C.SSL_get_verify_result(c.ssl))
 }
 
+// HandshakeState returns the description of the handshake state of the
+// connection, e.g. "SSLv3/TLS read server hello" for a client waiting for the
+// server, which helps to debug stuck connections.
+func (c *Conn) HandshakeState() string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return C.GoString(C.SSL_state_string_long(c.ssl))
+}
+
+// HandshakeComplete reports whether the handshake has finished.
+func (c *Conn) HandshakeComplete() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return C.SSL_is_init_finished(c.ssl) == 1
+}
+
 func (c *Conn) SessionReused() bool {
 	return C.X_SSL_session_reused(c.ssl) == 1
 }
@@ -584,7 +890,11 @@ func (c *Conn) GetSession() ([]byte, error) {
 		return nil, errors.New("failed to get session")
 	}
 	defer C.SSL_SESSION_free(session)
+	return encodeSession(session)
+}
 
+// encodeSession returns the DER encoding of session.
+func encodeSession(session *C.SSL_SESSION) ([]byte, error) {
 	// get the size of the encoding
 	slen := C.i2d_SSL_SESSION(session, nil)
 
@@ -606,16 +916,19 @@ func (c *Conn) setSession(session []byte) error {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
-	ptr := (*C.uchar)(&session[0])
+	// d2i advances the pointer it is given, so it has to live in C memory.
+	buf := C.CBytes(session)
+	defer C.free(buf)
+	ptr := (*C.uchar)(buf)
 	s := C.d2i_SSL_SESSION(nil, &ptr, C.long(len(session)))
 	if s == nil {
-		return fmt.Errorf("unable to load session: %s", errorFromErrorQueue())
+		return fmt.Errorf("unable to load session: %w", errorFromErrorQueue())
 	}
 	defer C.SSL_SESSION_free(s)
 
 	ret := C.SSL_set_session(c.ssl, s)
 	if ret != 1 {
-		return fmt.Errorf("unable to set session: %s", errorFromErrorQueue())
+		return fmt.Errorf("unable to set session: %w", errorFromErrorQueue())
 	}
 	return nil
 }
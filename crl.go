@@ -0,0 +1,232 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// CRL is a certificate revocation list.
+type CRL struct {
+	crl    *C.X509_CRL
+	issuer *Certificate
+}
+
+func newCRL(crl *C.X509_CRL) *CRL {
+	c := &CRL{crl: crl}
+	runtime.SetFinalizer(c, func(c *CRL) {
+		C.X509_CRL_free(c.crl)
+	})
+	return c
+}
+
+// NewCRL creates an empty version 2 CRL issued by issuer, valid from
+// thisUpdate until nextUpdate.
+func NewCRL(issuer *Certificate, thisUpdate, nextUpdate time.Time) (*CRL,
+	error) {
+	crl := C.X509_CRL_new()
+	if crl == nil {
+		return nil, errors.New("failed to allocate X509_CRL")
+	}
+	c := newCRL(crl)
+	c.issuer = issuer
+	// version 2 is encoded as 1
+	if C.X509_CRL_set_version(c.crl, 1) != 1 {
+		return nil, errors.New("failed to set version")
+	}
+	name, err := issuer.GetSubjectName()
+	if err != nil {
+		return nil, err
+	}
+	if C.X509_CRL_set_issuer_name(c.crl, name.name) != 1 {
+		return nil, errors.New("failed to set issuer name")
+	}
+	if err := setASN1Time(thisUpdate, func(t *C.ASN1_TIME) C.int {
+		return C.X_X509_CRL_set_lastUpdate(c.crl, t)
+	}); err != nil {
+		return nil, errors.New("failed to set last update")
+	}
+	if err := setASN1Time(nextUpdate, func(t *C.ASN1_TIME) C.int {
+		return C.X_X509_CRL_set_nextUpdate(c.crl, t)
+	}); err != nil {
+		return nil, errors.New("failed to set next update")
+	}
+	return c, nil
+}
+
+// setASN1Time converts t to an ASN1_TIME and passes it to set, which must
+// copy it.
+func setASN1Time(t time.Time, set func(*C.ASN1_TIME) C.int) error {
+	tm := C.ASN1_TIME_set(nil, C.time_t(t.Unix()))
+	if tm == nil {
+		return errors.New("failed to allocate ASN1_TIME")
+	}
+	defer C.ASN1_TIME_free(tm)
+	if set(tm) != 1 {
+		return errors.New("failed to set time")
+	}
+	return nil
+}
+
+// AddRevoked adds the certificate with the given serial number, revoked at
+// revokedAt, to the list.
+func (c *CRL) AddRevoked(serial *big.Int, revokedAt time.Time) error {
+	sno, err := newASN1Integer(serial)
+	if err != nil {
+		return err
+	}
+	defer C.ASN1_INTEGER_free(sno)
+	rev := C.X509_REVOKED_new()
+	if rev == nil {
+		return errors.New("failed to allocate X509_REVOKED")
+	}
+	if C.X509_REVOKED_set_serialNumber(rev, sno) != 1 {
+		C.X509_REVOKED_free(rev)
+		return errors.New("failed to set serial")
+	}
+	if err := setASN1Time(revokedAt, func(t *C.ASN1_TIME) C.int {
+		return C.X509_REVOKED_set_revocationDate(rev, t)
+	}); err != nil {
+		C.X509_REVOKED_free(rev)
+		return errors.New("failed to set revocation date")
+	}
+	// the CRL takes ownership of rev
+	if C.X509_CRL_add0_revoked(c.crl, rev) != 1 {
+		C.X509_REVOKED_free(rev)
+		return errors.New("failed to add revoked certificate")
+	}
+	return nil
+}
+
+// IsRevoked reports whether the certificate with the given serial number is
+// in the list.
+func (c *CRL) IsRevoked(serial *big.Int) bool {
+	sno, err := newASN1Integer(serial)
+	if err != nil {
+		return false
+	}
+	defer C.ASN1_INTEGER_free(sno)
+	var rev *C.X509_REVOKED
+	return C.X509_CRL_get0_by_serial(c.crl, &rev, sno) == 1
+}
+
+// AddExtension adds an extension to the CRL, like Certificate.AddExtension.
+// The issuer certificate passed to NewCRL is used for the authority key
+// identifier.
+func (c *CRL) AddExtension(nid NID, value string) error {
+	var issuer *C.X509
+	if c.issuer != nil {
+		issuer = c.issuer.x
+	}
+	var ctx C.X509V3_CTX
+	C.X509V3_set_ctx(&ctx, issuer, nil, nil, c.crl, 0)
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+	ex := C.X509V3_EXT_conf_nid(nil, &ctx, C.int(nid), cvalue)
+	if ex == nil {
+		return errors.New("failed to create x509v3 extension")
+	}
+	defer C.X509_EXTENSION_free(ex)
+	if C.X509_CRL_add_ext(c.crl, ex, -1) <= 0 {
+		return errors.New("failed to add x509v3 extension")
+	}
+	return nil
+}
+
+// SetNumber sets the CRL number extension, which must increase with every
+// CRL of an issuer.
+func (c *CRL) SetNumber(number *big.Int) error {
+	n, err := newASN1Integer(number)
+	if err != nil {
+		return err
+	}
+	defer C.ASN1_INTEGER_free(n)
+	if C.X509_CRL_add1_ext_i2d(c.crl, C.NID_crl_number, unsafe.Pointer(n), 0,
+		0) != 1 {
+		return errors.New("failed to set CRL number")
+	}
+	return nil
+}
+
+// Sign sorts the list and signs it with the issuer private key.
+func (c *CRL) Sign(key PrivateKey, opts SignOptions) error {
+	if C.X509_CRL_sort(c.crl) != 1 {
+		return errors.New("failed to sort CRL")
+	}
+	if opts.PSS {
+		return signPSS(key, opts.Digest, "CRL",
+			func(pkey *C.EVP_PKEY, md *C.EVP_MD) C.int {
+				return C.X_X509_CRL_sign_pss(c.crl, pkey, md)
+			})
+	}
+	md, err := signDigest(key, opts.Digest)
+	if err != nil {
+		return err
+	}
+	if C.X509_CRL_sign(c.crl, key.evpPKey(), md) <= 0 {
+		return errors.New("failed to sign CRL")
+	}
+	return nil
+}
+
+// LoadCRLFromPEM loads a PEM-encoded CRL.
+func LoadCRLFromPEM(pem_block []byte) (*CRL, error) {
+	if len(pem_block) == 0 {
+		return nil, errors.New("empty pem block")
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	bio := C.BIO_new_mem_buf(unsafe.Pointer(&pem_block[0]),
+		C.int(len(pem_block)))
+	crl := C.PEM_read_bio_X509_CRL(bio, nil, nil, nil)
+	C.BIO_free(bio)
+	if crl == nil {
+		return nil, errorFromErrorQueue()
+	}
+	return newCRL(crl), nil
+}
+
+// MarshalPEM converts the CRL to PEM-encoded format.
+func (c *CRL) MarshalPEM() (pem_block []byte, err error) {
+	bio := C.BIO_new(C.BIO_s_mem())
+	if bio == nil {
+		return nil, errors.New("failed to allocate memory BIO")
+	}
+	defer C.BIO_free(bio)
+	if int(C.PEM_write_bio_X509_CRL(bio, c.crl)) != 1 {
+		return nil, errors.New("failed dumping CRL")
+	}
+	return ioutil.ReadAll(asAnyBio(bio))
+}
+
+// Verify checks that the CRL is signed by the key of issuer.
+func (c *CRL) Verify(issuer *Certificate) error {
+	key, err := issuer.PublicKey()
+	if err != nil {
+		return err
+	}
+	if C.X509_CRL_verify(c.crl, key.evpPKey()) != 1 {
+		return errors.New("invalid CRL signature")
+	}
+	return nil
+}
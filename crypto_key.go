@@ -0,0 +1,64 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"crypto"
+	"crypto/x509"
+)
+
+func (key *pKey) ToCryptoPublicKey() (crypto.PublicKey, error) {
+	der, err := key.MarshalPKIXPublicKeyDER()
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKIXPublicKey(der)
+}
+
+func (key *pKey) ToCryptoKey() (crypto.PrivateKey, error) {
+	der, err := key.MarshalPKCS8PrivateKeyDER()
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+// FromCryptoKey converts a private key of the standard library, e.g.
+// *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey, to a
+// PrivateKey. The signers and decrypters returned by NewSigner and
+// NewDecrypter are converted back to their keys.
+func FromCryptoKey(key crypto.PrivateKey) (PrivateKey, error) {
+	switch key := key.(type) {
+	case *signer:
+		return key.key, nil
+	case *decrypter:
+		return key.key, nil
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return LoadPrivateKeyFromDER(der)
+}
+
+// FromCryptoPublicKey converts a public key of the standard library, e.g.
+// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey, to a PublicKey.
+func FromCryptoPublicKey(key crypto.PublicKey) (PublicKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return LoadPublicKeyFromDER(der)
+}
@@ -0,0 +1,105 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestCryptoKey(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type cryptoKey interface {
+		crypto.Signer
+		Equal(crypto.PrivateKey) bool
+	}
+	for _, test := range []struct {
+		name    string
+		key     cryptoKey
+		keyType NID
+	}{
+		{"RSA", rsaKey, KeyTypeRSA},
+		{"EC", ecKey, KeyTypeEC},
+		{"Ed25519", edKey, KeyTypeED25519},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := FromCryptoKey(test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.KeyType() != test.keyType {
+				t.Fatalf("unexpected key type %v", key.KeyType())
+			}
+			converted, err := key.ToCryptoKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !test.key.Equal(converted) {
+				t.Fatal("private key changed in a round trip")
+			}
+
+			pub, err := FromCryptoPublicKey(test.key.Public())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !pub.Equal(key) {
+				t.Fatal("public key mismatch")
+			}
+			convertedPub, err := pub.ToCryptoPublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			type publicKey interface {
+				Equal(crypto.PublicKey) bool
+			}
+			if !convertedPub.(publicKey).Equal(test.key.Public()) {
+				t.Fatal("public key changed in a round trip")
+			}
+
+			signer, err := NewSigner(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unwrapped, err := FromCryptoKey(signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unwrapped != key {
+				t.Fatal("signer was not converted back to its key")
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"unsafe"
+)
+
+// CertificateRequest is a PKCS #10 certificate signing request (CSR).
+type CertificateRequest struct {
+	req *C.X509_REQ
+}
+
+func newCertificateRequest(req *C.X509_REQ) *CertificateRequest {
+	r := &CertificateRequest{req: req}
+	runtime.SetFinalizer(r, func(r *CertificateRequest) {
+		C.X509_REQ_free(r.req)
+	})
+	return r
+}
+
+// NewCertificateRequest creates a request for a certificate with the given
+// subject for key and signs it with key.
+func NewCertificateRequest(subject *Name, key PrivateKey,
+	opts SignOptions) (*CertificateRequest, error) {
+	return NewCertificateRequestWithAttributes(subject, key, nil, opts)
+}
+
+// NewCertificateRequestWithAttributes acts like NewCertificateRequest and
+// adds the attributes, as UTF8String values, before signing the request.
+// Private attributes use the NIDs of RegisterObject.
+func NewCertificateRequestWithAttributes(subject *Name, key PrivateKey,
+	attributes map[NID]string, opts SignOptions) (*CertificateRequest,
+	error) {
+	req := C.X509_REQ_new()
+	if req == nil {
+		return nil, errors.New("failed to allocate X509_REQ")
+	}
+	r := newCertificateRequest(req)
+	// the only defined version is 1, encoded as 0
+	if C.X509_REQ_set_version(r.req, 0) != 1 {
+		return nil, errors.New("failed to set version")
+	}
+	if C.X509_REQ_set_subject_name(r.req, subject.name) != 1 {
+		return nil, errors.New("failed to set subject name")
+	}
+	if C.X509_REQ_set_pubkey(r.req, key.evpPKey()) != 1 {
+		return nil, errors.New("failed to set public key")
+	}
+	for nid, value := range attributes {
+		if err := r.addAttribute(nid, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.sign(key, opts); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertificateRequest) sign(key PrivateKey, opts SignOptions) error {
+	if opts.PSS {
+		return signPSS(key, opts.Digest, "certificate request",
+			func(pkey *C.EVP_PKEY, md *C.EVP_MD) C.int {
+				return C.X_X509_REQ_sign_pss(r.req, pkey, md)
+			})
+	}
+	md, err := signDigest(key, opts.Digest)
+	if err != nil {
+		return err
+	}
+	if C.X509_REQ_sign(r.req, key.evpPKey(), md) <= 0 {
+		return errors.New("failed to sign certificate request")
+	}
+	return nil
+}
+
+func (r *CertificateRequest) addAttribute(nid NID, value string) error {
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+	if C.X509_REQ_add1_attr_by_NID(r.req, C.int(nid), C.MBSTRING_UTF8,
+		(*C.uchar)(unsafe.Pointer(cvalue)), C.int(len(value))) != 1 {
+		return fmt.Errorf("failed to add attribute %s: %w", nid.ShortName(),
+			errorFromErrorQueue())
+	}
+	return nil
+}
+
+// GetAttribute returns the string value of the first attribute with the
+// given NID.
+func (r *CertificateRequest) GetAttribute(nid NID) (string, error) {
+	var out *C.uchar
+	n := C.X_X509_REQ_get_attr_utf8(r.req, C.int(nid), &out)
+	switch {
+	case n == -1:
+		return "", fmt.Errorf("no attribute %s", nid.ShortName())
+	case n < 0:
+		C.ERR_clear_error()
+		return "", fmt.Errorf("attribute %s is not a string", nid.ShortName())
+	}
+	defer C.X_OPENSSL_free(unsafe.Pointer(out))
+	return C.GoStringN((*C.char)(unsafe.Pointer(out)), n), nil
+}
+
+// LoadCertificateRequestFromPEM loads a PEM-encoded certificate request.
+func LoadCertificateRequestFromPEM(pem_block []byte) (*CertificateRequest,
+	error) {
+	if len(pem_block) == 0 {
+		return nil, errors.New("empty pem block")
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	bio := C.BIO_new_mem_buf(unsafe.Pointer(&pem_block[0]),
+		C.int(len(pem_block)))
+	req := C.PEM_read_bio_X509_REQ(bio, nil, nil, nil)
+	C.BIO_free(bio)
+	if req == nil {
+		return nil, errorFromErrorQueue()
+	}
+	return newCertificateRequest(req), nil
+}
+
+// MarshalPEM converts the certificate request to PEM-encoded format.
+func (r *CertificateRequest) MarshalPEM() (pem_block []byte, err error) {
+	bio := C.BIO_new(C.BIO_s_mem())
+	if bio == nil {
+		return nil, errors.New("failed to allocate memory BIO")
+	}
+	defer C.BIO_free(bio)
+	if int(C.PEM_write_bio_X509_REQ(bio, r.req)) != 1 {
+		return nil, errors.New("failed dumping certificate request")
+	}
+	return ioutil.ReadAll(asAnyBio(bio))
+}
+
+// GetSubjectName returns the requested subject name. The name refers to the
+// request, so it must not outlive it.
+func (r *CertificateRequest) GetSubjectName() (*Name, error) {
+	n := C.X509_REQ_get_subject_name(r.req)
+	if n == nil {
+		return nil, errors.New("failed to get subject name")
+	}
+	return &Name{name: n}, nil
+}
+
+// PublicKey returns the public key of the request.
+func (r *CertificateRequest) PublicKey() (PublicKey, error) {
+	pkey := C.X509_REQ_get_pubkey(r.req)
+	if pkey == nil {
+		return nil, errors.New("no public key found")
+	}
+	key := &pKey{key: pkey}
+	setPKeyFinalizer(key)
+	return key, nil
+}
+
+// Verify checks that the request is signed by the key it contains, which
+// proves that the requester holds the private key.
+func (r *CertificateRequest) Verify() error {
+	key, err := r.PublicKey()
+	if err != nil {
+		return err
+	}
+	if C.X509_REQ_verify(r.req, key.evpPKey()) != 1 {
+		return errors.New("invalid certificate request signature")
+	}
+	return nil
+}
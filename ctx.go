@@ -18,16 +18,17 @@ package openssl
 import "C"
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
-	"github.com/mattn/go-pointer"
 	"github.com/spacemonkeygo/spacelog"
 )
 
@@ -45,8 +46,56 @@ type Ctx struct {
 	verify_cb VerifyCallback
 	sni_cb    TLSExtServernameCallback
 
+	ocsp_policy OCSPStaplePolicy
+
+	verify_time time.Time
+	verify_skew time.Duration
+
 	ticket_store_mu sync.Mutex
 	ticket_store    *TicketStore
+
+	handshake_msg_mu  sync.RWMutex
+	handshake_msg_cbs map[HandshakeMessageType]HandshakeMessageCallback
+
+	stats Stats
+
+	read_buffer_size  int
+	write_buffer_size int
+	// set by SetIOCounting
+	io_counts bool
+
+	alpn_protos []string
+
+	// set by NewCtxFromTLSConfig
+	server_name        string
+	server_verify_mode *VerifyOptions
+	// set by NewClientCtxSecure, the connections must have a host name to
+	// verify
+	verify_host bool
+
+	session_cache   ClientSessionCache
+	session_cb_once sync.Once
+	// identifies the trust store in the session cache keys, shared by Clone
+	store_id uint64
+
+	// identity is swapped by ReloadCertificate
+	identity_mu   sync.RWMutex
+	identity      *identity
+	identity_once sync.Once
+
+	verify_config      *verifyConfig
+	verify_config_once sync.Once
+
+	// settings OpenSSL can't report, kept for Clone
+	session_id []byte
+	curve      EllipticCurve
+	dh         *DH
+	dh_auto    *bool
+	dane       bool
+	srtp       []SRTPProfile
+	groups     []string
+	// certificate types of RFC 7250, indexed by the server flag
+	cert_types [2][]CertificateType
 }
 
 //export get_ssl_ctx_idx
@@ -61,10 +110,16 @@ func newCtx(method *C.SSL_METHOD) (*Ctx, error) {
 	if ctx == nil {
 		return nil, errorFromErrorQueue()
 	}
-	c := &Ctx{ctx: ctx}
-	C.SSL_CTX_set_ex_data(ctx, get_ssl_ctx_idx(), pointer.Save(c))
+	c := &Ctx{
+		ctx:               ctx,
+		read_buffer_size:  DefaultReadBufferSize,
+		write_buffer_size: DefaultWriteBufferSize,
+		store_id:          atomic.AddUint64(&lastStoreId, 1)}
+	C.SSL_CTX_set_ex_data(ctx, get_ssl_ctx_idx(), pointers.Save(c))
+	tracked := trackAlloc(&liveAllocs.SSLCtx)
 	runtime.SetFinalizer(c, func(c *Ctx) {
 		C.SSL_CTX_free(c.ctx)
+		untrackAlloc(&liveAllocs.SSLCtx, tracked)
 	})
 	return c, nil
 }
@@ -113,61 +168,22 @@ func NewCtx() (*Ctx, error) {
 	return c, err
 }
 
+// NewDTLSCtx creates a context that supports any DTLS version 1.0 and newer.
+// Conn doesn't drive the DTLS retransmission timers, so the connections
+// need a transport that doesn't lose or reorder the handshake packets.
+func NewDTLSCtx() (*Ctx, error) {
+	return newCtx(C.X_DTLS_method())
+}
+
 // NewCtxFromFiles calls NewCtx, loads the provided files, and configures the
-// context to use them.
+// context to use them. The certificate file holds the certificate chain; see
+// NewCtxFromKeyPairFiles for the validation of the files and for several
+// identities.
 func NewCtxFromFiles(cert_file string, key_file string) (*Ctx, error) {
-	ctx, err := NewCtx()
-	if err != nil {
-		return nil, err
-	}
-
-	cert_bytes, err := ioutil.ReadFile(cert_file)
-	if err != nil {
-		return nil, err
-	}
-
-	certs := SplitPEM(cert_bytes)
-	if len(certs) == 0 {
-		return nil, fmt.Errorf("no PEM certificate found in '%s'", cert_file)
-	}
-	first, certs := certs[0], certs[1:]
-	cert, err := LoadCertificateFromPEM(first)
-	if err != nil {
-		return nil, err
-	}
-
-	err = ctx.UseCertificate(cert)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, pem := range certs {
-		cert, err := LoadCertificateFromPEM(pem)
-		if err != nil {
-			return nil, err
-		}
-		err = ctx.AddChainCertificate(cert)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	key_bytes, err := ioutil.ReadFile(key_file)
-	if err != nil {
-		return nil, err
-	}
-
-	key, err := LoadPrivateKeyFromPEM(key_bytes)
-	if err != nil {
-		return nil, err
-	}
-
-	err = ctx.UsePrivateKey(key)
-	if err != nil {
-		return nil, err
-	}
-
-	return ctx, nil
+	return NewCtxFromKeyPairFiles(KeyPairFiles{
+		CertFile: cert_file,
+		KeyFile:  key_file,
+	})
 }
 
 // EllipticCurve repesents the ASN.1 OID of an elliptic curve.
@@ -181,8 +197,25 @@ const (
 	Secp384r1 EllipticCurve = C.NID_secp384r1
 	// P-521: NIST/SECG curve over a 521 bit prime field
 	Secp521r1 EllipticCurve = C.NID_secp521r1
+	// SECG curve over a 256 bit prime field, used by Bitcoin
+	Secp256k1 EllipticCurve = C.NID_secp256k1
 )
 
+// EllipticCurveByName returns the curve with the given short name, e.g.
+// "brainpoolP256r1", or NIST name, e.g. "P-256".
+func EllipticCurveByName(name string) (EllipticCurve, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	nid := C.EC_curve_nist2nid(cname)
+	if nid == C.NID_undef {
+		nid = C.OBJ_sn2nid(cname)
+	}
+	if nid == C.NID_undef {
+		return 0, fmt.Errorf("unknown curve %s", name)
+	}
+	return EllipticCurve(nid), nil
+}
+
 // SetEllipticCurve sets the elliptic curve used by the SSL context to
 // enable an ECDH cipher suite to be selected during the handshake.
 func (c *Ctx) SetEllipticCurve(curve EllipticCurve) error {
@@ -198,6 +231,8 @@ func (c *Ctx) SetEllipticCurve(curve EllipticCurve) error {
 	if int(C.X_SSL_CTX_set_tmp_ecdh(c.ctx, k)) != 1 {
 		return errorFromErrorQueue()
 	}
+	c.curve = curve
+	c.groups = nil
 
 	return nil
 }
@@ -215,22 +250,152 @@ func (c *Ctx) UseCertificate(cert *Certificate) error {
 }
 
 // AddChainCertificate adds a certificate to the chain presented in the
-// handshake.
+// handshake. The chain is reordered by FixChainOrder once it is complete.
+// The chain may be incomplete until the last certificate is added, so it is
+// not checked; call FixChainOrder then to report certificates that don't
+// belong to it.
 func (c *Ctx) AddChainCertificate(cert *Certificate) error {
+	if err := c.addChainCertificate(cert); err != nil {
+		return err
+	}
+	if reordered, err := c.FixChainOrder(); err == nil && reordered {
+		logger.Warnf("openssl: certificate chain was out of order, reordered")
+	}
+	return nil
+}
+
+func (c *Ctx) addChainCertificate(cert *Certificate) error {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
-	c.chain = append(c.chain, cert)
 	if int(C.X_SSL_CTX_add_extra_chain_cert(c.ctx, cert.x)) != 1 {
 		return errorFromErrorQueue()
 	}
+	c.chain = append(c.chain, cert)
 	// OpenSSL takes ownership via SSL_CTX_add_extra_chain_cert
-	runtime.SetFinalizer(cert, nil)
+	clearCertificateFinalizer(cert)
+	return nil
+}
+
+// UseCertificateChain configures the context to present the given chain to
+// peers, replacing the chain configured before. The first certificate is the
+// leaf, the rest are added with AddChainCertificate and reordered by
+// FixChainOrder if they are out of order. The error of FixChainOrder is
+// returned if the chain contains certificates that don't belong to it, the
+// chain is configured as given then. See BuildCertificateChain to order an
+// unordered bundle with unrelated certificates.
+func (c *Ctx) UseCertificateChain(chain []*Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("empty certificate chain")
+	}
+	if err := c.clearChainCertificates(); err != nil {
+		return err
+	}
+	if err := c.UseCertificate(chain[0]); err != nil {
+		return err
+	}
+	for _, cert := range chain[1:] {
+		if err := c.addChainCertificate(cert); err != nil {
+			return err
+		}
+	}
+	reordered, err := c.FixChainOrder()
+	if err != nil {
+		return err
+	}
+	if reordered {
+		logger.Warnf("openssl: certificate chain was out of order, reordered")
+	}
+	return nil
+}
+
+// UseCertificateChainFromPEM is like UseCertificateChain for certificates
+// in PEM format, like SSL_CTX_use_certificate_chain_file from memory. Blocks
+// other than certificates, e.g. a private key, are skipped.
+func (c *Ctx) UseCertificateChainFromPEM(data []byte) error {
+	chain, err := loadCertificateChainFromPEM(data)
+	if err != nil {
+		return err
+	}
+	if len(chain) == 0 {
+		return errors.New("no PEM certificate found")
+	}
+	return c.UseCertificateChain(chain)
+}
+
+func loadCertificateChainFromPEM(data []byte) ([]*Certificate, error) {
+	var chain []*Certificate
+	for _, block := range SplitPEM(data) {
+		if !bytes.HasPrefix(block, []byte("-----BEGIN CERTIFICATE-----")) {
+			continue
+		}
+		cert, err := LoadCertificateFromPEM(block)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+// clearChainCertificates removes the certificates added with
+// AddChainCertificate. The context owns them, so they get a reference of
+// their own back before.
+func (c *Ctx) clearChainCertificates() error {
+	for _, cert := range c.chain {
+		if C.X_X509_add_ref(cert.x) != 1 {
+			return errors.New("failed to reference certificate")
+		}
+		setCertificateFinalizer(cert)
+	}
+	C.X_SSL_CTX_clear_extra_chain_certs(c.ctx)
+	c.chain = nil
+	return nil
+}
+
+// AddKeyPair configures a certificate chain, leaf first, and its private key
+// in the slot of the key type. OpenSSL keeps a slot per type, e.g. RSA and
+// ECDSA, and picks the certificate a client supports, so a server can offer
+// ECDSA to modern clients and RSA to legacy ones by adding both. The chain
+// replaces the one set for the slot before; it is not reordered by
+// FixChainOrder. The leaf and the key become the ones of the context, as
+// with UseCertificate and UsePrivateKey, e.g. for Clone. See
+// https://www.openssl.org/docs/ssl/SSL_CTX_add1_chain_cert.html for more.
+func (c *Ctx) AddKeyPair(chain []*Certificate, key PrivateKey) error {
+	if len(chain) == 0 {
+		return errors.New("empty certificate chain")
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	// OpenSSL would store a mismatching key in its own slot without an
+	// error.
+	if C.X509_check_private_key(chain[0].x, key.evpPKey()) != 1 {
+		return errorFromErrorQueue()
+	}
+	if C.SSL_CTX_use_certificate(c.ctx, chain[0].x) != 1 {
+		return errorFromErrorQueue()
+	}
+	if C.SSL_CTX_use_PrivateKey(c.ctx, key.evpPKey()) != 1 {
+		return errorFromErrorQueue()
+	}
+	if C.X_SSL_CTX_clear_chain_certs(c.ctx) != 1 {
+		return errors.New("failed to clear chain certificates")
+	}
+	for _, cert := range chain[1:] {
+		if C.X_SSL_CTX_add1_chain_cert(c.ctx, cert.x) != 1 {
+			return errorFromErrorQueue()
+		}
+	}
+	c.cert = chain[0]
+	c.key = key
 	return nil
 }
 
 // UsePrivateKey configures the context to use the given private key for SSL
 // handshakes.
 func (c *Ctx) UsePrivateKey(key PrivateKey) error {
+	if err := c.checkPrivateKey(key); err != nil {
+		return err
+	}
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 	c.key = key
@@ -240,11 +405,27 @@ func (c *Ctx) UsePrivateKey(key PrivateKey) error {
 	return nil
 }
 
+// checkPrivateKey fails with a clear error if the key is of the same type
+// as the certificate but doesn't match it. Keys of other types go to
+// another certificate slot and are checked by OpenSSL.
+func (c *Ctx) checkPrivateKey(key PrivateKey) error {
+	if c.cert == nil {
+		return nil
+	}
+	pub, err := c.cert.PublicKey()
+	if err != nil || pub.BaseType() != key.BaseType() || pub.Equal(key) {
+		return nil
+	}
+	return fmt.Errorf("private key does not match the %s",
+		describeCertificate(c.cert))
+}
+
 type CertificateStore struct {
 	store *C.X509_STORE
 	// for GC
 	ctx   *Ctx
 	certs []*Certificate
+	crls  []*CRL
 }
 
 // Allocate a new, empty CertificateStore
@@ -298,9 +479,68 @@ func (s *CertificateStore) AddCertificate(cert *Certificate) error {
 	return nil
 }
 
+// AddCRL adds a certificate revocation list to the store. It is only
+// checked with the CRLCheck or CRLCheckAll flags, see SetFlags.
+func (s *CertificateStore) AddCRL(crl *CRL) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	s.crls = append(s.crls, crl)
+	if int(C.X509_STORE_add_crl(s.store, crl.crl)) != 1 {
+		return errorFromErrorQueue()
+	}
+	return nil
+}
+
+// VerifyFlags are the flags of the chain verification of a
+// CertificateStore, see SetFlags and ClearFlags.
+type VerifyFlags int
+
+const (
+	// CRLCheck checks the revocation of the leaf certificate. Verification
+	// fails if the CRL of its issuer is missing.
+	CRLCheck VerifyFlags = C.X509_V_FLAG_CRL_CHECK
+	// CRLCheckAll checks the revocation of the whole chain, with CRLCheck.
+	CRLCheckAll VerifyFlags = C.X509_V_FLAG_CRL_CHECK_ALL
+	// X509Strict rejects the certificates that don't strictly follow RFC
+	// 5280, e.g. with malformed extensions, which OpenSSL accepts
+	// otherwise.
+	X509Strict VerifyFlags = C.X509_V_FLAG_X509_STRICT
+	// PartialChain accepts a chain that ends with any trusted certificate,
+	// e.g. an intermediate or the leaf itself, instead of a self-signed
+	// root. It weakens the verification: every certificate added to the
+	// store becomes a trust anchor, with no check of the issuers above it.
+	PartialChain VerifyFlags = C.X509_V_FLAG_PARTIAL_CHAIN
+)
+
+// SetFlags sets verification flags of the store, which apply to handshakes
+// of contexts using it. See
+// https://www.openssl.org/docs/crypto/X509_VERIFY_PARAM_set_flags.html
+func (s *CertificateStore) SetFlags(flags VerifyFlags) error {
+	if C.X509_STORE_set_flags(s.store, C.ulong(flags)) != 1 {
+		return errors.New("failed to set verification flags")
+	}
+	return nil
+}
+
+// ClearFlags clears verification flags of the store.
+func (s *CertificateStore) ClearFlags(flags VerifyFlags) error {
+	if C.X509_VERIFY_PARAM_clear_flags(C.X_X509_STORE_get0_param(s.store),
+		C.ulong(flags)) != 1 {
+		return errors.New("failed to clear verification flags")
+	}
+	return nil
+}
+
 type CertificateStoreCtx struct {
 	ctx     *C.X509_STORE_CTX
 	ssl_ctx *Ctx
+	ssl     *SSL
+}
+
+// Context returns the context of the connection being verified, see
+// SSL.Context.
+func (csc *CertificateStoreCtx) Context() context.Context {
+	return csc.ssl.Context()
 }
 
 func (csc *CertificateStoreCtx) VerifyResult() VerifyResult {
@@ -320,6 +560,35 @@ func (csc *CertificateStoreCtx) Depth() int {
 	return int(C.X509_STORE_CTX_get_error_depth(csc.ctx))
 }
 
+// ErrorString returns the description of the verification error.
+func (csc *CertificateStoreCtx) ErrorString() string {
+	return VerifyCertErrorString(csc.VerifyResult())
+}
+
+// SetError overrides the verification error of the certificate at the
+// error depth, e.g. with Ok to accept an expired certificate. The callback
+// should return true along with it, then the connection reports the
+// overridden result.
+func (csc *CertificateStoreCtx) SetError(result VerifyResult) {
+	C.X509_STORE_CTX_set_error(csc.ctx, C.int(result))
+}
+
+// SetErrorDepth sets the depth of the certificate the error applies to.
+func (csc *CertificateStoreCtx) SetErrorDepth(depth int) {
+	C.X509_STORE_CTX_set_error_depth(csc.ctx, C.int(depth))
+}
+
+// Chain returns the certificate chain under construction, starting from
+// the leaf. The certificates hold their own references.
+func (csc *CertificateStoreCtx) Chain() []*Certificate {
+	sk := C.X509_STORE_CTX_get1_chain(csc.ctx)
+	if sk == nil {
+		return nil
+	}
+	defer C.X_sk_X509_free(sk)
+	return certificatesFromChain(sk)
+}
+
 // the certificate returned is only valid for the lifetime of the underlying
 // X509_STORE_CTX
 func (csc *CertificateStoreCtx) GetCurrentCert() *Certificate {
@@ -334,9 +603,7 @@ func (csc *CertificateStoreCtx) GetCurrentCert() *Certificate {
 	cert := &Certificate{
 		x: x509,
 	}
-	runtime.SetFinalizer(cert, func(cert *Certificate) {
-		C.X509_free(cert.x)
-	})
+	setCertificateFinalizer(cert)
 	return cert
 }
 
@@ -362,6 +629,19 @@ func (c *Ctx) LoadVerifyLocations(ca_file string, ca_path string) error {
 	return nil
 }
 
+// SetDefaultVerifyPaths tells the context to trust the certificate
+// authorities in the default locations OpenSSL was built with. See
+// https://www.openssl.org/docs/ssl/SSL_CTX_set_default_verify_paths.html for
+// more.
+func (c *Ctx) SetDefaultVerifyPaths() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.SSL_CTX_set_default_verify_paths(c.ctx) != 1 {
+		return errorFromErrorQueue()
+	}
+	return nil
+}
+
 type Version int
 
 const (
@@ -399,6 +679,8 @@ const (
 	CipherServerPreference             Options = C.SSL_OP_CIPHER_SERVER_PREFERENCE
 	NoSessionResumptionOrRenegotiation Options = C.SSL_OP_NO_SESSION_RESUMPTION_ON_RENEGOTIATION
 	NoTicket                           Options = C.SSL_OP_NO_TICKET
+	// NoRenegotiation is only valid if you are using OpenSSL 1.1.0h or newer
+	NoRenegotiation Options = C.SSL_OP_NO_RENEGOTIATION
 )
 
 // SetOptions sets context options. See
@@ -422,8 +704,20 @@ func (c *Ctx) GetOptions() Options {
 type Modes int
 
 const (
-	// ReleaseBuffers is only valid if you are using OpenSSL 1.0.1 or newer
+	// ReleaseBuffers frees the record buffers of idle connections, about
+	// 34KB per connection, at the cost of allocating them again for each
+	// record. The connections also free their Go buffers once they are
+	// empty. It is only valid if you are using OpenSSL 1.0.1 or newer.
 	ReleaseBuffers Modes = C.SSL_MODE_RELEASE_BUFFERS
+	// AutoRetry makes reads retry after processing non-application data,
+	// such as a renegotiation.
+	AutoRetry Modes = C.SSL_MODE_AUTO_RETRY
+	// SendFallbackSCSV signals a fallback to a lower protocol version to
+	// the server, see RFC 7507.
+	SendFallbackSCSV Modes = C.SSL_MODE_SEND_FALLBACK_SCSV
+	// NoAutoChain disables building the chain of the certificate from the
+	// certificate store when no chain is set.
+	NoAutoChain Modes = C.SSL_MODE_NO_AUTO_CHAIN
 )
 
 // SetMode sets context modes. See
@@ -438,6 +732,12 @@ func (c *Ctx) GetMode() Modes {
 	return Modes(C.X_SSL_CTX_get_mode(c.ctx))
 }
 
+// ClearMode clears context modes and returns the remaining ones. See
+// http://www.openssl.org/docs/ssl/SSL_CTX_set_mode.html
+func (c *Ctx) ClearMode(modes Modes) Modes {
+	return Modes(C.X_SSL_CTX_clear_mode(c.ctx, C.long(modes)))
+}
+
 type VerifyOptions int
 
 const (
@@ -457,10 +757,26 @@ func go_ssl_ctx_verify_cb_thunk(p unsafe.Pointer, ok C.int, ctx *C.X509_STORE_CT
 			os.Exit(1)
 		}
 	}()
-	verify_cb := pointer.Restore(p).(*Ctx).verify_cb
+	c := pointers.Restore(p).(*Ctx)
+	var s *SSL
+	con := (*C.SSL)(C.X509_STORE_CTX_get_ex_data(ctx,
+		C.SSL_get_ex_data_X509_STORE_CTX_idx()))
+	if con != nil {
+		if sp := C.SSL_get_ex_data(con, get_ssl_idx()); sp != nil {
+			s = pointers.Restore(sp).(*SSL)
+		}
+	}
+	if ok == 0 && c.verify_skew > 0 && c.withinClockSkew(ctx) {
+		C.X509_STORE_CTX_set_error(ctx, C.X509_V_OK)
+		ok = 1
+	}
+	if ok == 0 && s != nil && s.allowVerifyError(ctx) {
+		ok = 1
+	}
+	verify_cb := c.verify_cb
 	// set up defaults just in case verify_cb is nil
 	if verify_cb != nil {
-		store := &CertificateStoreCtx{ctx: ctx}
+		store := &CertificateStoreCtx{ctx: ctx, ssl: s}
 		if verify_cb(ok == 1, store) {
 			ok = 1
 		} else {
@@ -474,7 +790,7 @@ func go_ssl_ctx_verify_cb_thunk(p unsafe.Pointer, ok C.int, ctx *C.X509_STORE_CT
 // http://www.openssl.org/docs/ssl/SSL_CTX_set_verify.html
 func (c *Ctx) SetVerify(options VerifyOptions, verify_cb VerifyCallback) {
 	c.verify_cb = verify_cb
-	if verify_cb != nil {
+	if verify_cb != nil || c.verify_skew > 0 {
 		C.SSL_CTX_set_verify(c.ctx, C.int(options), (*[0]byte)(C.X_SSL_CTX_verify_cb))
 	} else {
 		C.SSL_CTX_set_verify(c.ctx, C.int(options), nil)
@@ -532,6 +848,7 @@ func (c *Ctx) SetSessionId(session_id []byte) error {
 		C.uint(len(session_id)))) == 0 {
 		return errorFromErrorQueue()
 	}
+	c.session_id = append([]byte(nil), session_id...)
 	return nil
 }
 
@@ -549,7 +866,9 @@ func (c *Ctx) SetCipherList(list string) error {
 	return nil
 }
 
-// SetNextProtos sets Negotiation protocol to the ctx.
+// SetNextProtos sets the protocols for the ALPN negotiation, in the order of
+// preference. Clients offer them, and servers select the first one that the
+// client offers too.
 func (c *Ctx) SetNextProtos(protos []string) error {
 	if len(protos) == 0 {
 		return nil
@@ -569,9 +888,39 @@ func (c *Ctx) SetNextProtos(protos []string) error {
 	if ret != 0 {
 		return errors.New("error while setting protos to ctx")
 	}
+	c.alpn_protos = append([]string(nil), protos...)
+	C.X_SSL_CTX_enable_alpn_select_cb(c.ctx)
 	return nil
 }
 
+//export go_ssl_ctx_alpn_select_cb_thunk
+func go_ssl_ctx_alpn_select_cb_thunk(p unsafe.Pointer, out **C.uchar,
+	outlen *C.uchar, in *C.uchar, inlen C.uint) C.int {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Critf("openssl: alpn select callback panic'd: %v", err)
+			os.Exit(1)
+		}
+	}()
+	c := pointers.Restore(p).(*Ctx)
+	offered := C.GoBytes(unsafe.Pointer(in), C.int(inlen))
+	for _, proto := range c.alpn_protos {
+		for i := 0; i < len(offered); i += 1 + int(offered[i]) {
+			n := int(offered[i])
+			if i+1+n > len(offered) {
+				break
+			}
+			if string(offered[i+1:i+1+n]) == proto {
+				*out = (*C.uchar)(unsafe.Pointer(
+					uintptr(unsafe.Pointer(in)) + uintptr(i+1)))
+				*outlen = C.uchar(n)
+				return C.SSL_TLSEXT_ERR_OK
+			}
+		}
+	}
+	return C.SSL_TLSEXT_ERR_NOACK
+}
+
 type SessionCacheModes int
 
 const (
@@ -627,6 +976,7 @@ func (c *Ctx) DaneEnable() error {
 	if C.SSL_CTX_dane_enable(c.ctx) <= 0 {
 		return errorFromErrorQueue()
 	}
+	c.dane = true
 
 	return nil
 }
@@ -0,0 +1,191 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Config describes a context declaratively, so that TLS settings can live in
+// configuration files: it unmarshals with encoding/json or a YAML library
+// using the snake_case keys of its tags, and Config.LoadEnv reads it from
+// environment variables. Config.NewCtx creates the context.
+type Config struct {
+	// CertFile and KeyFile are the PEM files of the certificate chain and
+	// the private key, see NewCtxFromFiles. Both or none must be set.
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	// CAFile and CADir hold the trusted certificate authorities, see
+	// Ctx.LoadVerifyLocations.
+	CAFile string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	CADir  string `json:"ca_dir,omitempty" yaml:"ca_dir,omitempty"`
+	// SystemCAs trusts the certificate authorities of the system too, see
+	// Ctx.LoadSystemCAs.
+	SystemCAs bool `json:"system_cas,omitempty" yaml:"system_cas,omitempty"`
+	// MinVersion and MaxVersion bound the protocol versions: "1.0", "1.1",
+	// "1.2" or "1.3", optionally prefixed by "TLS" or "TLSv". Empty means the
+	// OpenSSL default.
+	MinVersion string `json:"min_version,omitempty" yaml:"min_version,omitempty"`
+	MaxVersion string `json:"max_version,omitempty" yaml:"max_version,omitempty"`
+	// Ciphers is the cipher list of TLS 1.2 and older, see
+	// Ctx.SetCipherList.
+	Ciphers string `json:"ciphers,omitempty" yaml:"ciphers,omitempty"`
+	// ClientAuth is the verification of the client certificates by servers:
+	// "none", the default, "request" to verify a certificate if the client
+	// sends one, or "require" to fail the handshake without one.
+	ClientAuth string `json:"client_auth,omitempty" yaml:"client_auth,omitempty"`
+	// ALPN are the protocols of the ALPN negotiation, in the order of
+	// preference, see Ctx.SetNextProtos. In the environment, they are
+	// separated by commas.
+	ALPN []string `json:"alpn,omitempty" yaml:"alpn,omitempty"`
+	// InsecureSkipVerify disables the verification of the server certificate
+	// by clients.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+var configVersions = map[string]Version{
+	"1.0": TLS1_VERSION,
+	"1.1": TLS1_1_VERSION,
+	"1.2": TLS1_2_VERSION,
+	"1.3": TLS1_3_VERSION,
+}
+
+func parseConfigVersion(version string) (Version, error) {
+	name := strings.ToLower(version)
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "tls"), "v")
+	if v, ok := configVersions[name]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("unsupported protocol version '%s'", version)
+}
+
+// LoadEnv sets the fields of c from the environment variables named by the
+// upper-cased keys of the fields prefixed by prefix, e.g. PREFIX_CERT_FILE
+// for CertFile with the prefix "PREFIX_". The fields whose variables are
+// unset keep their values, so the environment can override a file.
+func (c *Config) LoadEnv(prefix string) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := strings.Split(field.Tag.Get("json"), ",")[0]
+		name := prefix + strings.ToUpper(key)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.String:
+			v.Field(i).SetString(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			v.Field(i).SetBool(b)
+		case reflect.Slice:
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			v.Field(i).Set(reflect.ValueOf(items))
+		}
+	}
+	return nil
+}
+
+// NewCtx creates a context configured by c. It can be used by servers and
+// clients; clients verify the server certificate unless InsecureSkipVerify
+// is set.
+func (c *Config) NewCtx() (*Ctx, error) {
+	var ctx *Ctx
+	var err error
+	switch {
+	case c.CertFile != "" && c.KeyFile != "":
+		ctx, err = NewCtxFromFiles(c.CertFile, c.KeyFile)
+	case c.CertFile != "" || c.KeyFile != "":
+		return nil, errors.New("cert_file and key_file must be set together")
+	default:
+		ctx, err = NewCtx()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.CAFile != "" || c.CADir != "" {
+		if err := ctx.LoadVerifyLocations(c.CAFile, c.CADir); err != nil {
+			return nil, fmt.Errorf("failed to load certificate authorities: "+
+				"%w", err)
+		}
+	}
+	if c.SystemCAs {
+		if err := ctx.LoadSystemCAs(); err != nil {
+			return nil, err
+		}
+	}
+	if c.MinVersion != "" {
+		version, err := parseConfigVersion(c.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		if !ctx.SetMinProtoVersion(version) {
+			return nil, fmt.Errorf("failed to set min version '%s'",
+				c.MinVersion)
+		}
+	}
+	if c.MaxVersion != "" {
+		version, err := parseConfigVersion(c.MaxVersion)
+		if err != nil {
+			return nil, err
+		}
+		if !ctx.SetMaxProtoVersion(version) {
+			return nil, fmt.Errorf("failed to set max version '%s'",
+				c.MaxVersion)
+		}
+	}
+	if c.Ciphers != "" {
+		if err := ctx.SetCipherList(c.Ciphers); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.SetNextProtos(c.ALPN); err != nil {
+		return nil, err
+	}
+
+	var server_mode VerifyOptions
+	switch strings.ToLower(c.ClientAuth) {
+	case "", "none":
+		server_mode = VerifyNone
+	case "request":
+		server_mode = VerifyPeer
+	case "require":
+		server_mode = VerifyPeer | VerifyFailIfNoPeerCert
+	default:
+		return nil, fmt.Errorf("unsupported client auth '%s'", c.ClientAuth)
+	}
+	ctx.server_verify_mode = &server_mode
+	if c.InsecureSkipVerify {
+		ctx.SetVerifyMode(VerifyNone)
+	} else {
+		ctx.SetVerifyMode(VerifyPeer)
+	}
+	return ctx, nil
+}
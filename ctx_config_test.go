@@ -0,0 +1,138 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConfigNewCtx(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openssl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCertificate(t, "ca", true, nil)
+	server := newTestCertificate(t, "localhost", false, ca)
+	client := newTestCertificate(t, "client", false, ca)
+	caFile := writeTestPEM(t, dir, "ca.pem",
+		marshalTestPEM(t, ca.cert.MarshalPEM))
+	serverCertFile := writeTestPEM(t, dir, "server.crt",
+		marshalTestPEM(t, server.cert.MarshalPEM))
+	serverKeyFile := writeTestPEM(t, dir, "server.key",
+		marshalTestPEM(t, server.key.MarshalPKCS1PrivateKeyPEM))
+	clientCertFile := writeTestPEM(t, dir, "client.crt",
+		marshalTestPEM(t, client.cert.MarshalPEM))
+	clientKeyFile := writeTestPEM(t, dir, "client.key",
+		marshalTestPEM(t, client.key.MarshalPKCS1PrivateKeyPEM))
+
+	newCtx := func(data string) *Ctx {
+		var config Config
+		if err := json.Unmarshal([]byte(data), &config); err != nil {
+			t.Fatal(err)
+		}
+		ctx, err := config.NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ctx
+	}
+	serverCtx := newCtx(`{"cert_file": "` + serverCertFile + `",
+		"key_file": "` + serverKeyFile + `", "ca_file": "` + caFile + `",
+		"min_version": "TLSv1.2", "client_auth": "require",
+		"alpn": ["h2", "http/1.1"]}`)
+	clientCtx := newCtx(`{"cert_file": "` + clientCertFile + `",
+		"key_file": "` + clientKeyFile + `", "ca_file": "` + caFile + `",
+		"max_version": "1.2", "ciphers": "ECDHE-ECDSA-AES128-GCM-SHA256",
+		"alpn": ["http/1.1"]}`)
+	anonymousCtx := newCtx(`{"ca_file": "` + caFile + `"}`)
+
+	handshake := func(clientCtx *Ctx) (tls.ConnectionState, error) {
+		serverConn, clientConn := NetPipe(t)
+		server, err := Server(serverConn, serverCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer close_both(server, client)
+		go client.Handshake()
+		err = server.Handshake()
+		return server.TLSConnectionState(), err
+	}
+	state, err := handshake(clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Version != uint16(TLS1_2_VERSION) ||
+		state.NegotiatedProtocol != "http/1.1" ||
+		len(state.PeerCertificates) == 0 ||
+		state.PeerCertificates[0].Subject.CommonName != "client" {
+		t.Fatalf("unexpected connection state %+v", state)
+	}
+	if _, err := handshake(anonymousCtx); err == nil {
+		t.Fatal("client without certificate is accepted")
+	}
+
+	for _, config := range []Config{
+		{CertFile: serverCertFile},
+		{MinVersion: "1.4"},
+		{ClientAuth: "always"},
+		{CAFile: dir + "/missing.pem"},
+	} {
+		if _, err := config.NewCtx(); err == nil {
+			t.Fatalf("invalid config %+v is accepted", config)
+		}
+	}
+}
+
+func TestConfigLoadEnv(t *testing.T) {
+	env := map[string]string{
+		"TEST_TLS_CERT_FILE":   "server.crt",
+		"TEST_TLS_SYSTEM_CAS":  "true",
+		"TEST_TLS_CLIENT_AUTH": "request",
+		"TEST_TLS_ALPN":        "h2, http/1.1",
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	config := Config{CertFile: "default.crt", KeyFile: "server.key"}
+	if err := config.LoadEnv("TEST_TLS_"); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{
+		CertFile:   "server.crt",
+		KeyFile:    "server.key",
+		SystemCAs:  true,
+		ClientAuth: "request",
+		ALPN:       []string{"h2", "http/1.1"},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	os.Setenv("TEST_TLS_SYSTEM_CAS", "maybe")
+	if err := config.LoadEnv("TEST_TLS_"); err == nil {
+		t.Fatal("invalid boolean is accepted")
+	}
+}
@@ -15,6 +15,8 @@
 package openssl
 
 import (
+	"bytes"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -46,3 +48,699 @@ func TestCtxSessCacheSizeOption(t *testing.T) {
 		t.Error("SessSetCacheSize() does not save anything to ctx")
 	}
 }
+
+func TestCtxModes(t *testing.T) {
+	ctx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.SetMode(ReleaseBuffers|NoAutoChain)&ReleaseBuffers == 0 {
+		t.Fatal("SetMode() does not return the new modes")
+	}
+	modes := ctx.ClearMode(NoAutoChain)
+	if modes&NoAutoChain != 0 || modes&ReleaseBuffers == 0 {
+		t.Fatalf("unexpected modes %x", modes)
+	}
+	if ctx.GetMode() != modes {
+		t.Fatal("ClearMode() does not save anything to ctx")
+	}
+}
+
+func TestCtxSecure(t *testing.T) {
+	serverCtx, err := NewServerCtxSecure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewClientCtxSecure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ctx := range []*Ctx{serverCtx, clientCtx} {
+		if ctx.GetOptions()&NoCompression == 0 {
+			t.Fatal("compression is not disabled")
+		}
+	}
+	if clientCtx.VerifyMode() != VerifyPeer {
+		t.Fatal("peer verification is not enabled")
+	}
+	root := newTestCertificate(t, "root", true, nil)
+	leaf := newTestCertificate(t, "localhost", false, root)
+	if err := serverCtx.UseCertificate(leaf.cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+	err = clientCtx.GetCertificateStore().AddCertificate(root.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the host name is checked per connection and required
+	for _, host := range []string{"", "example.com"} {
+		serverConn, clientConn := NetPipe(t)
+		server, err := Server(serverConn, serverCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host != "" {
+			if err := client.SetVerifyHostname(host); err != nil {
+				t.Fatal(err)
+			}
+		}
+		go server.Handshake()
+		if err := client.Handshake(); err == nil {
+			t.Fatalf("certificate is accepted for %q", host)
+		}
+		close_both(server, client)
+	}
+
+	// Dial checks the server name of each connection
+	l, err := Listen("tcp", "127.0.0.1:0", serverCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	if conn, err := Dial("tcp", l.Addr().String(), clientCtx, 0); err == nil {
+		conn.Close()
+		t.Fatal("certificate is accepted for the IP address")
+	}
+	conn, err := DialWithOptions("tcp", l.Addr().String(), clientCtx,
+		WithServerName("localhost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	connect := func(session []byte) ([]byte, bool) {
+		serverConn, clientConn := NetPipe(t)
+		server, err := Server(serverConn, serverCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer close_both(server, client)
+		if err := client.SetTlsExtHostName("localhost"); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.SetVerifyHostname("localhost."); err != nil {
+			t.Fatal(err)
+		}
+		if session != nil {
+			if err := client.setSession(session); err != nil {
+				t.Fatal(err)
+			}
+		}
+		doHandshake(t, server, client)
+		if name := server.GetServername(); name != "localhost" {
+			t.Fatalf("unexpected server name %q", name)
+		}
+		if v := client.GetVersion(); v != "TLSv1.2" && v != "TLSv1.3" {
+			t.Fatalf("unexpected version %s", v)
+		}
+
+		// TLS 1.3 tickets arrive after the handshake.
+		go server.Write([]byte("x"))
+		if _, err := client.Read(make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		session, err = client.GetSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session, client.SessionReused()
+	}
+	session, reused := connect(nil)
+	if reused {
+		t.Fatal("first session is reused")
+	}
+	if _, reused := connect(session); !reused {
+		t.Fatal("session ticket is not accepted")
+	}
+}
+
+func TestRotatingTicketKeys(t *testing.T) {
+	keys := NewRotatingTicketKeys(time.Hour)
+	if keys.Current() != nil {
+		t.Fatal("unexpected current key")
+	}
+	old := keys.New()
+	if keys.Current() != old || keys.ShouldRenew(old.Name) {
+		t.Fatal("new key is not current")
+	}
+
+	keys.keys[0].created = time.Now().Add(-90 * time.Minute)
+	if keys.Current() != nil {
+		t.Fatal("key is not rotated")
+	}
+	cur := keys.New()
+	if keys.Lookup(old.Name) != old || keys.Expired(old.Name) {
+		t.Fatal("previous key is not accepted")
+	}
+	if !keys.ShouldRenew(old.Name) || keys.ShouldRenew(cur.Name) {
+		t.Fatal("previous key is not renewed")
+	}
+
+	keys.keys[1].created = time.Now().Add(-3 * time.Hour)
+	if !keys.Expired(old.Name) {
+		t.Fatal("previous key is not expired")
+	}
+	keys.New()
+	if keys.Lookup(old.Name) != nil {
+		t.Fatal("expired key is not dropped")
+	}
+}
+
+func TestRotatingTicketKeysMarshal(t *testing.T) {
+	keys := NewRotatingTicketKeys(time.Hour)
+	old := keys.New()
+	// keys of earlier versions have a fixed IV
+	old.IV = bytes.Repeat([]byte{1}, ticketIVSize)
+	keys.keys[0].created = time.Now().Add(-90 * time.Minute)
+	cur := keys.New()
+	blob, err := keys.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewRotatingTicketKeys(time.Hour)
+	if err := loaded.UnmarshalBinary(blob); err != nil {
+		t.Fatal(err)
+	}
+	if c := loaded.Current(); c == nil || !reflect.DeepEqual(c, cur) {
+		t.Fatal("current key is not loaded")
+	}
+	if k := loaded.Lookup(old.Name); k == nil || !reflect.DeepEqual(k, old) {
+		t.Fatal("previous key is not loaded")
+	}
+	if !loaded.ShouldRenew(old.Name) || loaded.Expired(old.Name) {
+		t.Fatal("creation time of the previous key is not loaded")
+	}
+	if !loaded.keys[1].created.Equal(keys.keys[1].created) {
+		t.Fatal("unexpected creation time")
+	}
+
+	// the cipher key of the first key is one byte short
+	keyOffset := 1 + 2 + 8 + len(TicketName{})
+	shortKey := append([]byte{}, blob[:keyOffset]...)
+	shortKey = append(shortKey, ticketCipherKeySize-1)
+	shortKey = append(shortKey, blob[keyOffset+2:]...)
+
+	for _, b := range [][]byte{nil, blob[:len(blob)-1], append(blob, 0),
+		append([]byte{0}, blob[1:]...), shortKey} {
+		if err := loaded.UnmarshalBinary(b); err == nil {
+			t.Fatalf("malformed blob %x is accepted", b)
+		}
+	}
+}
+
+func TestRotatingTicketKeysShared(t *testing.T) {
+	connect := func(serverCtx *Ctx, session []byte) ([]byte, bool) {
+		serverConn, clientConn := NetPipe(t)
+		server, err := newDefaultServer(t, serverConn, serverCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, GetCtx(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer close_both(server, client)
+		if session != nil {
+			if err := client.setSession(session); err != nil {
+				t.Fatal(err)
+			}
+		}
+		doHandshake(t, server, client)
+		session, err = client.GetSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session, client.SessionReused()
+	}
+
+	newServerCtx := func() (*Ctx, *TicketStore) {
+		ctx := GetCtx(t)
+		// TLS 1.2 tickets arrive during the handshake
+		ctx.SetMaxProtoVersion(TLS1_2_VERSION)
+		store, err := NewRotatingTicketStore(time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx.SetTicketStore(store)
+		return ctx, store
+	}
+	first, firstStore := newServerCtx()
+	second, secondStore := newServerCtx()
+	session, _ := connect(first, nil)
+	if _, reused := connect(second, session); reused {
+		t.Fatal("ticket is accepted without the keys")
+	}
+
+	blob, err := firstStore.Keys.(*RotatingTicketKeys).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = secondStore.Keys.(*RotatingTicketKeys).UnmarshalBinary(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, reused := connect(second, session); !reused {
+		t.Fatal("ticket is not accepted with the shared keys")
+	}
+}
+
+func TestRotatingTicketKeysRandomIV(t *testing.T) {
+	ctx := GetCtx(t)
+	// TLS 1.2 tickets arrive during the handshake
+	ctx.SetMaxProtoVersion(TLS1_2_VERSION)
+	store, err := NewRotatingTicketStore(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetTicketStore(store)
+	var tickets [][]byte
+	ctx.SetHandshakeMessageCallback(HandshakeNewSessionTicket,
+		func(ssl *SSL, msg *HandshakeMessage) {
+			// lifetime hint, length, key name and IV
+			if msg.Sent && len(msg.Body) >= 6+KeyNameSize+ticketIVSize {
+				tickets = append(tickets, append([]byte(nil),
+					msg.Body[6:6+KeyNameSize+ticketIVSize]...))
+			}
+		})
+
+	connect := func(session []byte) ([]byte, bool) {
+		serverConn, clientConn := NetPipe(t)
+		server, err := newDefaultServer(t, serverConn, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, GetCtx(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer close_both(server, client)
+		if session != nil {
+			if err := client.setSession(session); err != nil {
+				t.Fatal(err)
+			}
+		}
+		doHandshake(t, server, client)
+		session, err = client.GetSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session, client.SessionReused()
+	}
+	session, _ := connect(nil)
+	connect(nil)
+	if len(tickets) != 2 {
+		t.Fatalf("got %d tickets, want 2", len(tickets))
+	}
+	if !bytes.Equal(tickets[0][:KeyNameSize], tickets[1][:KeyNameSize]) {
+		t.Fatal("tickets are encrypted with different keys")
+	}
+	if bytes.Equal(tickets[0][KeyNameSize:], tickets[1][KeyNameSize:]) {
+		t.Fatal("tickets are encrypted with the same IV")
+	}
+	if _, reused := connect(session); !reused {
+		t.Fatal("ticket with a random IV is not accepted")
+	}
+
+	// a key with a fixed IV, as encoded by earlier versions
+	store.Keys.Current().IV = bytes.Repeat([]byte{1}, ticketIVSize)
+	session, _ = connect(nil)
+	if _, reused := connect(session); !reused {
+		t.Fatal("ticket with a fixed IV is not accepted")
+	}
+}
+
+func TestCtxAddKeyPair(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	intermediate := newTestCertificate(t, "intermediate", true, root)
+	ecdsa := newTestCertificate(t, "localhost", false, intermediate)
+
+	rsaKey, err := GenerateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaCert, err := NewCertificate(&CertificateInfo{
+		Issued:       0,
+		Expires:      24 * time.Hour,
+		Country:      "US",
+		Organization: "Test",
+		CommonName:   "localhost",
+	}, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsaCert.Sign(rsaKey, EVP_SHA256); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ctx.AddKeyPair([]*Certificate{ecdsa.cert, intermediate.cert},
+		ecdsa.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.AddKeyPair([]*Certificate{rsaCert}, rsaKey); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.cert != rsaCert || ctx.key != rsaKey {
+		t.Fatal("the last key pair is not the one of the context")
+	}
+
+	for _, test := range []struct {
+		cipher string
+		cert   *Certificate
+		chain  int
+	}{
+		{"ECDHE-ECDSA-AES128-GCM-SHA256", ecdsa.cert, 2},
+		{"ECDHE-RSA-AES128-GCM-SHA256", rsaCert, 1},
+	} {
+		clientCtx, err := NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientCtx.SetMaxProtoVersion(TLS1_2_VERSION)
+		if err := clientCtx.SetCipherList(test.cipher); err != nil {
+			t.Fatal(err)
+		}
+		serverConn, clientConn := NetPipe(t)
+		server, err := Server(serverConn, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doHandshake(t, server, client)
+		state := client.ConnectionState()
+		close_both(server, client)
+		if state.CertificateError != nil {
+			t.Fatal(state.CertificateError)
+		}
+		if state.Certificate.GetSerialNumberHex() !=
+			test.cert.GetSerialNumberHex() {
+			t.Fatalf("%s: unexpected certificate", test.cipher)
+		}
+		if len(state.CertificateChain) != test.chain {
+			t.Fatalf("%s: expected %d certificates, got %d", test.cipher,
+				test.chain, len(state.CertificateChain))
+		}
+	}
+
+	if err := ctx.AddKeyPair([]*Certificate{rsaCert}, ecdsa.key); err == nil {
+		t.Fatal("expected an error for a mismatching key")
+	}
+}
+
+func TestCtxVerifyTime(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	leaf := newTestCertificate(t, "localhost", false, root)
+
+	serverCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UseCertificate(leaf.cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx.SetVerifyMode(VerifyPeer)
+	err = clientCtx.GetCertificateStore().AddCertificate(root.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handshake := func() VerifyResult {
+		serverConn, clientConn := NetPipe(t)
+		server, err := Server(serverConn, serverCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer close_both(server, client)
+		go server.Handshake()
+		client.Handshake()
+		return client.VerifyResult()
+	}
+
+	if res := handshake(); res != Ok {
+		t.Fatalf("unexpected verify result %v", res)
+	}
+	// the certificates are valid for 24 hours
+	clientCtx.SetVerifyTime(time.Now().Add(25 * time.Hour))
+	if res := handshake(); res != CertHasExpired {
+		t.Fatalf("unexpected verify result %v", res)
+	}
+	clientCtx.SetVerifyClockSkew(2 * time.Hour)
+	if res := handshake(); res != Ok {
+		t.Fatalf("unexpected verify result %v", res)
+	}
+	clientCtx.SetVerifyClockSkew(0)
+	clientCtx.SetVerifyTime(time.Now().Add(-time.Hour))
+	if res := handshake(); res != CertNotYetValid {
+		t.Fatalf("unexpected verify result %v", res)
+	}
+	clientCtx.SetVerifyTime(time.Time{})
+	if res := handshake(); res != Ok {
+		t.Fatalf("unexpected verify result %v", res)
+	}
+}
+
+func TestVerifyCallbackOverride(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	leaf := newTestCertificate(t, "localhost", false, root)
+
+	serverCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UseCertificate(leaf.cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = clientCtx.GetCertificateStore().AddCertificate(root.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the certificates are valid for 24 hours
+	clientCtx.SetVerifyTime(time.Now().Add(25 * time.Hour))
+
+	var chainLen int
+	var errString string
+	expired := map[int]bool{}
+	// accept expired certificates that are otherwise valid
+	clientCtx.SetVerify(VerifyPeer, func(ok bool,
+		store *CertificateStoreCtx) bool {
+		if chain := store.Chain(); len(chain) > chainLen {
+			chainLen = len(chain)
+		}
+		if store.VerifyResult() == CertHasExpired {
+			expired[store.Depth()] = true
+			errString = store.ErrorString()
+			store.SetError(Ok)
+			return true
+		}
+		return ok
+	})
+
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, serverCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	go server.Handshake()
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if client.VerifyResult() != Ok {
+		t.Fatalf("unexpected verify result %v", client.VerifyResult())
+	}
+	if !expired[0] || !expired[1] {
+		t.Fatalf("unexpected expired depths %v", expired)
+	}
+	if chainLen != 2 || errString != "certificate has expired" {
+		t.Fatalf("unexpected chain length %d and error %q", chainLen,
+			errString)
+	}
+}
+
+func TestVerifyResultWithVerifyNone(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	leaf := newTestCertificate(t, "localhost", false, root)
+
+	serverCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UseCertificate(leaf.cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx.SetVerifyMode(VerifyNone)
+
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, serverCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	go server.Handshake()
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	res := client.VerifyResult()
+	if res != UnableToGetIssuerCertLocally {
+		t.Fatalf("unexpected verify result %v", res)
+	}
+	if res.String() != "unable to get local issuer certificate" {
+		t.Fatalf("unexpected verify result string %q", res.String())
+	}
+}
+
+func TestCertificateStoreVerifyTime(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	leaf := newTestCertificate(t, "localhost", false, root)
+	store, err := NewCertificateStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddCertificate(root.cert); err != nil {
+		t.Fatal(err)
+	}
+	store.SetVerifyTime(time.Now().Add(48 * time.Hour))
+	if _, err := BuildCertificateChain(leaf.cert, nil, store); err == nil {
+		t.Fatal("expected an error for an expired certificate")
+	}
+	store.SetVerifyTime(time.Time{})
+	if _, err := BuildCertificateChain(leaf.cert, nil, store); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateStoreCRL(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	leaf := newTestCertificate(t, "localhost", false, root)
+
+	serverCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UseCertificate(leaf.cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx.SetVerifyMode(VerifyPeer)
+	store := clientCtx.GetCertificateStore()
+	if err := store.AddCertificate(root.cert); err != nil {
+		t.Fatal(err)
+	}
+
+	handshake := func() VerifyResult {
+		serverConn, clientConn := NetPipe(t)
+		server, err := Server(serverConn, serverCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer close_both(server, client)
+		go server.Handshake()
+		client.Handshake()
+		return client.VerifyResult()
+	}
+
+	if err := store.SetFlags(CRLCheck); err != nil {
+		t.Fatal(err)
+	}
+	if res := handshake(); res != UnableToGetCrl {
+		t.Fatalf("unexpected verify result %v", res)
+	}
+
+	now := time.Now()
+	crl, err := NewCRL(root.cert, now.Add(-time.Minute), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.AddRevoked(leaf.cert.GetSerialNumber(), now); err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.Sign(root.key, SignOptions{Digest: EVP_SHA256}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddCRL(crl); err != nil {
+		t.Fatal(err)
+	}
+	if res := handshake(); res != CertRevoked {
+		t.Fatalf("unexpected verify result %v", res)
+	}
+
+	if err := store.ClearFlags(CRLCheck); err != nil {
+		t.Fatal(err)
+	}
+	if res := handshake(); res != Ok {
+		t.Fatalf("unexpected verify result %v", res)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+type decrypter struct {
+	*signer
+}
+
+// NewDecrypter returns a crypto.Decrypter that decrypts with the RSA key.
+// Decrypt uses PKCS #1 v1.5 padding if the options are nil or
+// *rsa.PKCS1v15DecryptOptions and OAEP padding if they are
+// *rsa.OAEPOptions. OAEP uses the options hash for MGF1 too.
+func NewDecrypter(key PrivateKey) (crypto.Decrypter, error) {
+	if key.KeyType() != KeyTypeRSA {
+		return nil, errors.New("decryption requires an RSA key")
+	}
+	s, err := NewSigner(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decrypter{signer: s.(*signer)}, nil
+}
+
+// Decrypt decrypts the msg. rand is only used to generate the random
+// session key of *rsa.PKCS1v15DecryptOptions, crypto/rand if nil.
+func (d *decrypter) Decrypt(random io.Reader, msg []byte,
+	opts crypto.DecrypterOpts) ([]byte, error) {
+	switch opts := opts.(type) {
+	case nil:
+		return rsaCrypt(d.key, true, C.RSA_PKCS1_PADDING, nil, nil, msg)
+	case *rsa.PKCS1v15DecryptOptions:
+		if opts.SessionKeyLen == 0 {
+			return rsaCrypt(d.key, true, C.RSA_PKCS1_PADDING, nil, nil,
+				msg)
+		}
+		// like rsa.DecryptPKCS1v15SessionKey, hide decryption errors
+		// behind a random key to resist Bleichenbacher attacks
+		if random == nil {
+			random = rand.Reader
+		}
+		key := make([]byte, opts.SessionKeyLen)
+		if _, err := io.ReadFull(random, key); err != nil {
+			return nil, err
+		}
+		plaintext, err := rsaCrypt(d.key, true, C.RSA_PKCS1_PADDING, nil,
+			nil, msg)
+		if err != nil || len(plaintext) != len(key) {
+			return key, nil
+		}
+		return plaintext, nil
+	case *rsa.OAEPOptions:
+		md, err := cryptoHashDigest(opts.Hash)
+		if err != nil {
+			return nil, err
+		}
+		return rsaCrypt(d.key, true, C.RSA_PKCS1_OAEP_PADDING, md,
+			opts.Label, msg)
+	default:
+		return nil, fmt.Errorf("unsupported decrypter options %T", opts)
+	}
+}
+
+// rsaCrypt encrypts or decrypts in with the RSA key and the padding. md
+// and label are the OAEP parameters.
+func rsaCrypt(key PublicKey, decrypt bool, padding C.int, md *Digest,
+	label, in []byte) ([]byte, error) {
+	if len(in) == 0 {
+		return nil, errors.New("empty input")
+	}
+	var cdecrypt C.int
+	if decrypt {
+		cdecrypt = 1
+	}
+	var cmd *C.EVP_MD
+	if md != nil {
+		cmd = md.ptr
+	}
+	out := make([]byte, key.Size())
+	outlen := C.size_t(len(out))
+	if C.X_EVP_PKEY_crypt_rsa(key.evpPKey(), cdecrypt, padding, cmd,
+		bytesPtr(label), C.size_t(len(label)),
+		(*C.uchar)(unsafe.Pointer(&out[0])), &outlen,
+		(*C.uchar)(unsafe.Pointer(&in[0])), C.size_t(len(in))) != 1 {
+		if decrypt {
+			return nil, errors.New("failed to decrypt")
+		}
+		return nil, errors.New("failed to encrypt")
+	}
+	return out[:outlen], nil
+}
@@ -0,0 +1,215 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+func TestDecrypter(t *testing.T) {
+	key, err := GenerateRSAKeyWithOptions(RSAKeyOptions{Bits: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypter, err := NewDecrypter(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := decrypter.Public().(*rsa.PublicKey)
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+
+	ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, pub, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []crypto.DecrypterOpts{
+		nil, &rsa.PKCS1v15DecryptOptions{},
+		&rsa.PKCS1v15DecryptOptions{SessionKeyLen: len(msg)},
+	} {
+		plaintext, err := decrypter.Decrypt(rand.Reader, ciphertext, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plaintext, msg) {
+			t.Fatalf("unexpected plaintext %q", plaintext)
+		}
+	}
+	// a session key of the wrong length is replaced with a random one
+	plaintext, err := decrypter.Decrypt(rand.Reader, ciphertext,
+		&rsa.PKCS1v15DecryptOptions{SessionKeyLen: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plaintext) != 16 {
+		t.Fatalf("unexpected session key length %d", len(plaintext))
+	}
+
+	label := []byte("label")
+	ciphertext, err = rsa.EncryptOAEP(crypto.SHA256.New(), rand.Reader, pub,
+		msg, label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err = decrypter.Decrypt(rand.Reader, ciphertext,
+		&rsa.OAEPOptions{Hash: crypto.SHA256, Label: label})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, msg) {
+		t.Fatalf("unexpected plaintext %q", plaintext)
+	}
+	_, err = decrypter.Decrypt(rand.Reader, ciphertext,
+		&rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err == nil {
+		t.Fatal("decrypted with the wrong label")
+	}
+
+	ecKey, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDecrypter(ecKey); err == nil {
+		t.Fatal("decrypter created for an EC key")
+	}
+}
+
+func TestOAEP(t *testing.T) {
+	key, err := GenerateRSAKeyWithOptions(RSAKeyOptions{Bits: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdKey, err := key.ToCryptoKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := stdKey.(*rsa.PrivateKey)
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	label := []byte("kms")
+
+	ciphertext, err := key.EncryptOAEP(SHA256_Method, label, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := rsa.DecryptOAEP(sha256.New(), nil, priv, ciphertext,
+		label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, msg) {
+		t.Fatalf("unexpected plaintext %q", plaintext)
+	}
+
+	ciphertext, err = rsa.EncryptOAEP(sha256.New(), rand.Reader,
+		&priv.PublicKey, msg, label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err = key.DecryptOAEP(SHA256_Method, label, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, msg) {
+		t.Fatalf("unexpected plaintext %q", plaintext)
+	}
+	if _, err := key.DecryptOAEP(SHA256_Method, []byte("other"),
+		ciphertext); err == nil {
+		t.Fatal("decrypted with the wrong label")
+	}
+
+	// nil selects SHA-1 and an empty label
+	ciphertext, err = rsa.EncryptOAEP(sha1.New(), rand.Reader,
+		&priv.PublicKey, msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err = key.DecryptOAEP(nil, nil, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, msg) {
+		t.Fatalf("unexpected plaintext %q", plaintext)
+	}
+}
+
+func TestEncryptPadding(t *testing.T) {
+	key, err := GenerateRSAKeyWithOptions(RSAKeyOptions{Bits: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdKey, err := key.ToCryptoKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := stdKey.(*rsa.PrivateKey)
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+
+	ciphertext, err := key.Encrypt(RSAPaddingPKCS1v15, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := rsa.DecryptPKCS1v15(nil, priv, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, msg) {
+		t.Fatalf("unexpected plaintext %q", plaintext)
+	}
+
+	ciphertext, err = rsa.EncryptOAEP(sha1.New(), rand.Reader,
+		&priv.PublicKey, msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err = key.Decrypt(RSAPaddingOAEP, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, msg) {
+		t.Fatalf("unexpected plaintext %q", plaintext)
+	}
+
+	// raw RSA is plain modular exponentiation
+	raw := make([]byte, key.Size())
+	copy(raw[len(raw)-len(msg):], msg)
+	ciphertext, err = key.Encrypt(RSAPaddingNone, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := new(big.Int).Exp(new(big.Int).SetBytes(raw),
+		big.NewInt(int64(priv.E)), priv.N)
+	if new(big.Int).SetBytes(ciphertext).Cmp(want) != 0 {
+		t.Fatal("raw RSA encryption mismatch")
+	}
+	plaintext, err = key.Decrypt(RSAPaddingNone, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, raw) {
+		t.Fatalf("unexpected plaintext %x", plaintext)
+	}
+	if _, err := key.Encrypt(RSAPaddingNone, msg); err == nil {
+		t.Fatal("raw RSA accepted a short input")
+	}
+	if _, err := key.Encrypt(RSAPadding(-1), msg); err == nil {
+		t.Fatal("accepted an unknown padding")
+	}
+}
@@ -18,14 +18,22 @@ package openssl
 import "C"
 import (
 	"errors"
+	"fmt"
+	"runtime"
 	"unsafe"
 )
 
 // DeriveSharedSecret derives a shared secret using a private key and a peer's
 // public key.
 // The specific algorithm that is used depends on the types of the
-// keys, but it is most commonly a variant of Diffie-Hellman.
+// keys, but it is most commonly a variant of Diffie-Hellman: ECDH for EC
+// keys, which must be on the same curve, and X25519 or X448 for those keys.
 func DeriveSharedSecret(private PrivateKey, public PublicKey) ([]byte, error) {
+	if private.BaseType() != public.BaseType() {
+		return nil, errors.New("keys of different types can't derive " +
+			"a shared secret")
+	}
+
 	// Create context for the shared secret derivation
 	dhCtx := C.EVP_PKEY_CTX_new(private.evpPKey(), nil)
 	if dhCtx == nil {
@@ -38,9 +46,12 @@ func DeriveSharedSecret(private PrivateKey, public PublicKey) ([]byte, error) {
 		return nil, errors.New("failed initializing shared secret derivation context")
 	}
 
-	// Provide the peer's public key
+	// Provide the peer's public key, it fails for EC keys on another curve
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	if int(C.EVP_PKEY_derive_set_peer(dhCtx, public.evpPKey())) != 1 {
-		return nil, errors.New("failed adding peer public key to context")
+		return nil, fmt.Errorf("failed adding peer public key to context: %w",
+			errorFromErrorQueue())
 	}
 
 	// Determine how large of a buffer we need for the shared secret
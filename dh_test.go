@@ -44,3 +44,63 @@ func TestECDH(t *testing.T) {
 		t.Fatal("shared secrets are different")
 	}
 }
+
+func TestDeriveSharedSecretTypes(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	generateEC := func(curve EllipticCurve) func() (PrivateKey, error) {
+		return func() (PrivateKey, error) { return GenerateECKey(curve) }
+	}
+	for _, test := range []struct {
+		name     string
+		generate func() (PrivateKey, error)
+		size     int
+	}{
+		{"P-384", generateEC(Secp384r1), 48},
+		{"P-521", generateEC(Secp521r1), 66},
+		{"X25519", GenerateX25519Key, 32},
+		{"X448", GenerateX448Key, 56},
+	} {
+		myKey, err := test.generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		peerKey, err := test.generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mySecret, err := DeriveSharedSecret(myKey, peerKey)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		theirSecret, err := DeriveSharedSecret(peerKey, myKey)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !bytes.Equal(mySecret, theirSecret) || len(mySecret) != test.size {
+			t.Fatalf("%s: unexpected shared secrets", test.name)
+		}
+	}
+
+	p256, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := GenerateECKey(Secp384r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519, err := GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeriveSharedSecret(p256, p384); err == nil {
+		t.Fatal("derived a secret from keys on different curves")
+	}
+	if _, err := DeriveSharedSecret(p256, x25519); err == nil {
+		t.Fatal("derived a secret from keys of different types")
+	}
+}
@@ -19,6 +19,7 @@ import "C"
 
 import (
 	"errors"
+	"io/ioutil"
 	"runtime"
 	"unsafe"
 )
@@ -44,11 +45,68 @@ func LoadDHParametersFromPEM(pem_block []byte) (*DH, error) {
 	if params == nil {
 		return nil, errors.New("failed reading dh parameters")
 	}
+	return newDH(params), nil
+}
+
+func newDH(params *C.struct_dh_st) *DH {
 	dhparams := &DH{dh: params}
 	runtime.SetFinalizer(dhparams, func(dhparams *DH) {
 		C.DH_free(dhparams.dh)
 	})
-	return dhparams, nil
+	return dhparams
+}
+
+// DHGroup is a named Diffie-Hellman group.
+type DHGroup NID
+
+// The finite field groups of RFC 7919.
+const (
+	FFDHE2048 DHGroup = DHGroup(NID_ffdhe2048)
+	FFDHE3072 DHGroup = DHGroup(NID_ffdhe3072)
+	FFDHE4096 DHGroup = DHGroup(NID_ffdhe4096)
+	FFDHE6144 DHGroup = DHGroup(NID_ffdhe6144)
+	FFDHE8192 DHGroup = DHGroup(NID_ffdhe8192)
+)
+
+// NewDHParametersFromGroup returns the parameters of a named group. It
+// requires OpenSSL 1.1.1 or newer.
+func NewDHParametersFromGroup(group DHGroup) (*DH, error) {
+	params := C.X_DH_new_by_nid(C.int(group))
+	if params == nil {
+		return nil, errors.New("unknown dh group")
+	}
+	return newDH(params), nil
+}
+
+// GenerateDHParameters generates new parameters with a prime of the size
+// bits and the generator, usually 2. It takes a long time for secure
+// sizes, the named groups of NewDHParametersFromGroup should be preferred.
+func GenerateDHParameters(bits int, generator int) (*DH, error) {
+	params := C.X_DH_generate_parameters(C.int(bits), C.int(generator))
+	if params == nil {
+		return nil, errors.New("failed generating dh parameters")
+	}
+	return newDH(params), nil
+}
+
+// Bits returns the size of the prime in bits.
+func (dh *DH) Bits() int {
+	return int(C.DH_bits(dh.dh))
+}
+
+// MarshalPEM converts the parameters to a PEM-encoded block.
+func (dh *DH) MarshalPEM() (pem_block []byte, err error) {
+	bio := C.BIO_new(C.BIO_s_mem())
+	if bio == nil {
+		return nil, errors.New("failed to allocate memory BIO")
+	}
+	defer C.BIO_free(bio)
+
+	if int(C.PEM_write_bio_DHparams(bio, dh.dh)) != 1 {
+		return nil, errors.New("failed dumping dh parameters")
+	}
+
+	return ioutil.ReadAll(asAnyBio(bio))
 }
 
 // SetDHParameters sets the DH group (DH parameters) used to
@@ -60,5 +118,21 @@ func (c *Ctx) SetDHParameters(dh *DH) error {
 	if int(C.X_SSL_CTX_set_tmp_dh(c.ctx, dh.dh)) != 1 {
 		return errorFromErrorQueue()
 	}
+	c.dh = dh
+	return nil
+}
+
+// SetDHAuto makes the DHE cipher suites use built-in parameters of a size
+// matching the certificate key instead of the ones of SetDHParameters. It
+// requires OpenSSL 1.1.0 or newer.
+func (c *Ctx) SetDHAuto(on bool) error {
+	var onoff C.int
+	if on {
+		onoff = 1
+	}
+	if int(C.X_SSL_CTX_set_dh_auto(c.ctx, onoff)) != 1 {
+		return errors.New("failed setting automatic dh parameters")
+	}
+	c.dh_auto = &on
 	return nil
 }
@@ -0,0 +1,108 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"testing"
+)
+
+func TestDHParameters(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+
+	dh, err := NewDHParametersFromGroup(FFDHE2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dh.Bits() != 2048 {
+		t.Fatalf("unexpected prime size %d", dh.Bits())
+	}
+	pem, err := dh.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDHParametersFromPEM(pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Bits() != 2048 {
+		t.Fatalf("unexpected prime size %d", loaded.Bits())
+	}
+	generated, err := GenerateDHParameters(512, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generated.Bits() != 512 {
+		t.Fatalf("unexpected prime size %d", generated.Bits())
+	}
+
+	key, err := LoadPrivateKeyFromPEM(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := LoadCertificateFromPEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const cipher = "DHE-RSA-AES128-GCM-SHA256"
+	for _, auto := range []bool{false, true} {
+		ctx, err := NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.UseCertificate(cert); err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.UsePrivateKey(key); err != nil {
+			t.Fatal(err)
+		}
+		if auto {
+			err = ctx.SetDHAuto(true)
+		} else {
+			err = ctx.SetDHParameters(dh)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientCtx, err := NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientCtx.SetMaxProtoVersion(TLS1_2_VERSION)
+		if err := clientCtx.SetCipherList(cipher); err != nil {
+			t.Fatal(err)
+		}
+
+		serverConn, clientConn := NetPipe(t)
+		server, err := Server(serverConn, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doHandshake(t, server, client)
+		current, err := client.CurrentCipher()
+		close_both(server, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current != cipher {
+			t.Fatalf("unexpected cipher %s", current)
+		}
+	}
+}
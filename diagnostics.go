@@ -0,0 +1,125 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"encoding/hex"
+	"time"
+	"unsafe"
+)
+
+// NegotiatedParameters is a snapshot of the state negotiated on a Conn. It
+// contains only plain values, so it may be kept after the connection is
+// closed and serialized with encoding/json, e.g. to back a /debug/tls
+// endpoint.
+type NegotiatedParameters struct {
+	CorrelationID string `json:"correlation_id,omitempty"`
+	Server        bool   `json:"server"`
+	Version       string `json:"version"`
+	Cipher        string `json:"cipher,omitempty"`
+	Curve         string `json:"curve,omitempty"`
+	ServerName    string `json:"server_name,omitempty"`
+	ALPN          string `json:"alpn,omitempty"`
+	SessionReused bool   `json:"session_reused"`
+	// PeerFingerprints holds hex encoded SHA-256 digests of the peer
+	// certificate chain, leaf first.
+	PeerFingerprints []string  `json:"peer_fingerprints,omitempty"`
+	LocalAddr        string    `json:"local_addr,omitempty"`
+	RemoteAddr       string    `json:"remote_addr,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	HandshakeAt      time.Time `json:"handshake_at"`
+	SessionCreatedAt time.Time `json:"session_created_at"`
+}
+
+// NegotiatedParameters returns a copy of the parameters negotiated on the
+// connection. Values which are not known yet (e.g. before the handshake) are
+// left empty.
+func (c *Conn) NegotiatedParameters() NegotiatedParameters {
+	rv := NegotiatedParameters{
+		CorrelationID: c.correlation_id,
+		CreatedAt:     c.created_at,
+	}
+	if addr := c.conn.LocalAddr(); addr != nil {
+		rv.LocalAddr = addr.String()
+	}
+	if addr := c.conn.RemoteAddr(); addr != nil {
+		rv.RemoteAddr = addr.String()
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	rv.HandshakeAt = c.handshake_at
+	if c.is_shutdown {
+		return rv
+	}
+
+	rv.Server = C.SSL_is_server(c.ssl) == 1
+	rv.Version = C.GoString(C.SSL_get_version(c.ssl))
+	if p := C.X_SSL_get_cipher_name(c.ssl); p != nil {
+		rv.Cipher = C.GoString(p)
+	}
+	if nid := C.X_SSL_get_negotiated_group(c.ssl); nid != C.NID_undef {
+		if sn := C.OBJ_nid2sn(nid); sn != nil {
+			rv.Curve = C.GoString(sn)
+		}
+	}
+	rv.ServerName = C.GoString(
+		C.SSL_get_servername(c.ssl, C.TLSEXT_NAMETYPE_host_name))
+
+	var alpn *C.uchar
+	var alpnLen C.uint
+	C.SSL_get0_alpn_selected(c.ssl, &alpn, &alpnLen)
+	if alpnLen > 0 {
+		rv.ALPN = string(C.GoBytes(unsafe.Pointer(alpn), C.int(alpnLen)))
+	}
+
+	rv.SessionReused = C.X_SSL_session_reused(c.ssl) == 1
+	if session := C.SSL_get_session(c.ssl); session != nil {
+		rv.SessionCreatedAt = time.Unix(int64(C.SSL_SESSION_get_time(session)), 0)
+	}
+
+	rv.PeerFingerprints = c.peerFingerprints()
+	return rv
+}
+
+// peerFingerprints must be called with c.mtx held.
+func (c *Conn) peerFingerprints() []string {
+	digest, err := GetDigestByName("sha256")
+	if err != nil {
+		return nil
+	}
+
+	var fingerprints []string
+	var leaf string
+	if x := C.SSL_get_peer_certificate(c.ssl); x != nil {
+		cert := &Certificate{x: x}
+		leaf = hex.EncodeToString(cert.Hash(digest))
+		fingerprints = append(fingerprints, leaf)
+		C.X509_free(x)
+	}
+	if sk := C.SSL_get_peer_cert_chain(c.ssl); sk != nil {
+		for _, cert := range c.loadCertificateStack(sk) {
+			fingerprint := hex.EncodeToString(cert.Hash(digest))
+			// The client side chain already includes the leaf.
+			if fingerprint != leaf {
+				fingerprints = append(fingerprints, fingerprint)
+			}
+		}
+	}
+	return fingerprints
+}
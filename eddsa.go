@@ -0,0 +1,114 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// EdDSAOptions select the EdDSA variant of RFC 8032 used by SignEdDSA and
+// VerifyEdDSA.
+type EdDSAOptions struct {
+	// Prehash selects Ed25519ph or Ed448ph, which sign the SHA-512 or
+	// SHAKE256 hash of the message. The message is still passed whole,
+	// OpenSSL hashes it.
+	Prehash bool
+	// Context is the context string of at most 255 bytes. A context with
+	// an Ed25519 key and without Prehash selects Ed25519ctx, which
+	// requires it to be non-empty.
+	Context []byte
+}
+
+// SignEdDSA signs the message with the Ed25519 or Ed448 key and the
+// variant of the options, pure EdDSA if nil. Variants other than pure
+// EdDSA require OpenSSL 3.2 or newer.
+func SignEdDSA(key PrivateKey, opts *EdDSAOptions, message []byte) ([]byte,
+	error) {
+	instance, context, err := eddsaInstance(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	if instance == "" {
+		return key.Sign(nil, message)
+	}
+	cinstance := C.CString(instance)
+	defer C.free(unsafe.Pointer(cinstance))
+	sig := make([]byte, key.Size())
+	siglen := C.size_t(len(sig))
+	if C.X_EVP_PKEY_eddsa(0, key.evpPKey(), cinstance, bytesPtr(context),
+		C.size_t(len(context)), (*C.uchar)(unsafe.Pointer(&sig[0])),
+		&siglen, bytesPtr(message), C.size_t(len(message))) != 1 {
+		return nil, errors.New("sign: failed to sign")
+	}
+	return sig[:siglen], nil
+}
+
+// VerifyEdDSA verifies a signature of the message made by SignEdDSA with
+// the same options.
+func VerifyEdDSA(key PublicKey, opts *EdDSAOptions, message,
+	sig []byte) error {
+	instance, context, err := eddsaInstance(key, opts)
+	if err != nil {
+		return err
+	}
+	if instance == "" {
+		return key.Verify(nil, message, sig)
+	}
+	if len(sig) == 0 {
+		return errors.New("verify: 0-length sig")
+	}
+	cinstance := C.CString(instance)
+	defer C.free(unsafe.Pointer(cinstance))
+	siglen := C.size_t(len(sig))
+	if C.X_EVP_PKEY_eddsa(1, key.evpPKey(), cinstance, bytesPtr(context),
+		C.size_t(len(context)), (*C.uchar)(unsafe.Pointer(&sig[0])),
+		&siglen, bytesPtr(message), C.size_t(len(message))) != 1 {
+		return errors.New("verify: invalid signature")
+	}
+	return nil
+}
+
+// eddsaInstance returns the name of the OpenSSL EdDSA instance selected by
+// the options and the context string, or an empty name for pure EdDSA.
+func eddsaInstance(key PublicKey, opts *EdDSAOptions) (string, []byte,
+	error) {
+	if !isEdDSA(key.KeyType()) {
+		return "", nil, errors.New("EdDSA requires an Ed25519 or Ed448 key")
+	}
+	if opts == nil || (!opts.Prehash && len(opts.Context) == 0) {
+		return "", nil, nil
+	}
+	if len(opts.Context) > 255 {
+		return "", nil, errors.New("EdDSA context longer than 255 bytes")
+	}
+	if !eddsa_instance_support {
+		return "", nil, errors.New("EdDSA variants require OpenSSL 3.2")
+	}
+	ed25519 := key.KeyType() == KeyTypeED25519
+	switch {
+	case opts.Prehash && ed25519:
+		return "Ed25519ph", opts.Context, nil
+	case opts.Prehash:
+		return "Ed448ph", opts.Context, nil
+	case ed25519:
+		return "Ed25519ctx", opts.Context, nil
+	default:
+		return "Ed448", opts.Context, nil
+	}
+}
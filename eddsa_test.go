@@ -0,0 +1,78 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestEdDSAVariants(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+	// RFC 8032, section 7.3
+	seed := mustDecodeHex(t, "833fe62409237b9d62ec77587520911e"+
+		"9a759cec1d19755b7da901b96dca3d42")
+	key, err := FromCryptoKey(ed25519.NewKeyFromSeed(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("abc")
+	ph := &EdDSAOptions{Prehash: true}
+
+	// pure EdDSA works on any version
+	sig, err := SignEdDSA(key, nil, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyEdDSA(key, &EdDSAOptions{}, msg, sig); err != nil {
+		t.Fatal(err)
+	}
+
+	if !eddsa_instance_support {
+		if _, err := SignEdDSA(key, ph, msg); err == nil {
+			t.Fatal("Ed25519ph signed without OpenSSL support")
+		}
+		return
+	}
+
+	sig, err = SignEdDSA(key, ph, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, sig, string(mustDecodeHex(t,
+		"98a70222f0b8121aa9d30f813d683f809e462b469c7ff87639499bb94e6dae41"+
+			"31f85042463c2a355a2003d062adf5aaa10b8c61e636062aaad11c2a26083406")))
+	if err := VerifyEdDSA(key, ph, msg, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyEdDSA(key, nil, msg, sig); err == nil {
+		t.Fatal("verified an Ed25519ph signature as pure Ed25519")
+	}
+
+	ctx := &EdDSAOptions{Context: []byte("foo")}
+	sig, err = SignEdDSA(key, ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyEdDSA(key, ctx, msg, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyEdDSA(key, &EdDSAOptions{Context: []byte("bar")}, msg,
+		sig); err == nil {
+		t.Fatal("verified with another context")
+	}
+}
@@ -16,10 +16,12 @@ package openssl
 
 /*
 #include "openssl/engine.h"
+#include "shim.h"
 */
 import "C"
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 	"unsafe"
@@ -29,7 +31,23 @@ type Engine struct {
 	e *C.ENGINE
 }
 
+// EngineCommand is a control command of an engine, such as the
+// MODULE_PATH or PIN of the pkcs11 engine, see `openssl engine -vvv`.
+type EngineCommand struct {
+	Name string
+	Arg  string
+}
+
 func EngineById(name string) (*Engine, error) {
+	return EngineByIdWithCommands(name, nil)
+}
+
+// EngineByIdWithCommands loads the engine with the id, runs the commands,
+// which may need to come before initialization, and initializes it. For
+// example, the dynamic engine loads another engine from a shared library
+// with the SO_PATH, ID and LOAD commands.
+func EngineByIdWithCommands(name string, commands []EngineCommand) (
+	*Engine, error) {
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 	e := &Engine{
@@ -38,6 +56,12 @@ func EngineById(name string) (*Engine, error) {
 	if e.e == nil {
 		return nil, fmt.Errorf("engine %s missing", name)
 	}
+	for _, cmd := range commands {
+		if err := e.ctrl(cmd); err != nil {
+			C.ENGINE_free(e.e)
+			return nil, err
+		}
+	}
 	if C.ENGINE_init(e.e) == 0 {
 		C.ENGINE_free(e.e)
 		return nil, fmt.Errorf("engine %s not initialized", name)
@@ -48,3 +72,65 @@ func EngineById(name string) (*Engine, error) {
 	})
 	return e, nil
 }
+
+// Ctrl runs a control command of the initialized engine.
+func (e *Engine) Ctrl(name, arg string) error {
+	err := e.ctrl(EngineCommand{Name: name, Arg: arg})
+	runtime.KeepAlive(e)
+	return err
+}
+
+func (e *Engine) ctrl(cmd EngineCommand) error {
+	cname := C.CString(cmd.Name)
+	defer C.free(unsafe.Pointer(cname))
+	// commands without an argument take NULL
+	var carg *C.char
+	if cmd.Arg != "" {
+		carg = C.CString(cmd.Arg)
+		defer C.free(unsafe.Pointer(carg))
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.ENGINE_ctrl_cmd_string(e.e, cname, carg, 0) != 1 {
+		return fmt.Errorf("engine command %s failed: %w", cmd.Name,
+			errorFromErrorQueue())
+	}
+	return nil
+}
+
+// LoadPrivateKeyFromEngine loads the private key with the id, e.g. a
+// PKCS#11 URI, from the engine. The key can be used with Ctx.UsePrivateKey
+// and signs within the engine, so an HSM key never leaves the HSM.
+func LoadPrivateKeyFromEngine(e *Engine, keyID string) (PrivateKey, error) {
+	return loadEngineKey(e, keyID, true)
+}
+
+// LoadPublicKeyFromEngine loads the public key with the id from the
+// engine.
+func LoadPublicKeyFromEngine(e *Engine, keyID string) (PublicKey, error) {
+	return loadEngineKey(e, keyID, false)
+}
+
+func loadEngineKey(e *Engine, keyID string, private bool) (*pKey, error) {
+	if e == nil {
+		return nil, errors.New("nil engine")
+	}
+	cid := C.CString(keyID)
+	defer C.free(unsafe.Pointer(cid))
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var key *C.EVP_PKEY
+	if private {
+		key = C.ENGINE_load_private_key(e.e, cid, nil, nil)
+	} else {
+		key = C.ENGINE_load_public_key(e.e, cid, nil, nil)
+	}
+	runtime.KeepAlive(e)
+	if key == nil {
+		return nil, fmt.Errorf("failed loading key %s from the engine: %w",
+			keyID, errorFromErrorQueue())
+	}
+	p := &pKey{key: key}
+	setPKeyFinalizer(p)
+	return p, nil
+}
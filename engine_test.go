@@ -0,0 +1,38 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngineCommands(t *testing.T) {
+	if _, err := EngineByIdWithCommands("dynamic", []EngineCommand{
+		{Name: "NO_SUCH_COMMAND", Arg: "x"},
+	}); err == nil {
+		t.Fatal("ran an unknown engine command")
+	}
+	if _, err := EngineByIdWithCommands("dynamic", []EngineCommand{
+		{Name: "SO_PATH", Arg: filepath.Join(os.TempDir(), "missing.so")},
+		{Name: "LOAD"},
+	}); err == nil {
+		t.Fatal("loaded a missing engine library")
+	}
+	if _, err := LoadPrivateKeyFromEngine(nil, "key"); err == nil {
+		t.Fatal("loaded a key from a nil engine")
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Envelope describes data sealed to several RSA keys: the data is
+// encrypted with a random key, and that key with each recipient key with
+// RSA-OAEP and SHA-256. With an AEAD cipher, the cipher name, the IV and the
+// recipients are authenticated along with the data.
+type Envelope struct {
+	// Cipher is the cipher of the data.
+	Cipher *Cipher
+	// IV is the random IV of the data.
+	IV []byte
+	// Tag authenticates the data encrypted with an AEAD cipher.
+	Tag []byte
+	// Recipients hold the key of the data encrypted to each recipient.
+	Recipients []EnvelopeRecipient
+}
+
+// EnvelopeRecipient is the key of the sealed data encrypted to a recipient.
+type EnvelopeRecipient struct {
+	// KeyID is the SPKIFingerprintSHA256 of the recipient key.
+	KeyID [32]byte
+	// EncryptedKey is the data key encrypted with the recipient key.
+	EncryptedKey []byte
+}
+
+// aad returns the additional authenticated data of the envelope: the cipher
+// name, the IV and the recipients, each length-prefixed.
+func (env *Envelope) aad() ([]byte, error) {
+	name, err := env.Cipher.ShortName()
+	if err != nil {
+		return nil, err
+	}
+	var aad []byte
+	put := func(field []byte) {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		aad = append(append(aad, size[:]...), field...)
+	}
+	put([]byte(name))
+	put(env.IV)
+	for _, recipient := range env.Recipients {
+		put(recipient.KeyID[:])
+		put(recipient.EncryptedKey)
+	}
+	return aad, nil
+}
+
+// sealCipher returns the cipher, AES-256-GCM if nil.
+func sealCipher(c *Cipher) (*Cipher, error) {
+	if c == nil {
+		return GetCipherByName("aes-256-gcm")
+	}
+	return c, nil
+}
+
+// NewSealCipherCtx returns a context that encrypts data to the RSA public
+// keys with the cipher, AES-256-GCM if nil, and the envelope needed to
+// open it. The context can be used with NewEncryptWriter to seal a stream.
+// With an AEAD cipher, the context is an AuthenticatedEncryptionCipherCtx and
+// its tag must be set as the Tag of the envelope once the encryption is
+// finished. Data encrypted with other ciphers can be modified undetected,
+// sign it if it must not be tampered with.
+func NewSealCipherCtx(c *Cipher, pubkeys []PublicKey) (EncryptionCipherCtx,
+	*Envelope, error) {
+	c, err := sealCipher(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(pubkeys) == 0 {
+		return nil, nil, errors.New("no recipients")
+	}
+	key := make([]byte, c.KeySize())
+	defer Cleanse(key)
+	env := &Envelope{
+		Cipher:     c,
+		IV:         make([]byte, c.IVSize()),
+		Recipients: make([]EnvelopeRecipient, len(pubkeys)),
+	}
+	if _, err := io.ReadFull(Rand, key); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(Rand, env.IV); err != nil {
+		return nil, nil, err
+	}
+	for i, pubkey := range pubkeys {
+		if pubkey.KeyType() != KeyTypeRSA {
+			return nil, nil, errors.New("sealing requires RSA keys")
+		}
+		id, err := pubkey.SPKIFingerprintSHA256()
+		if err != nil {
+			return nil, nil, err
+		}
+		ek, err := pubkey.EncryptOAEP(SHA256_Method, nil, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		env.Recipients[i] = EnvelopeRecipient{KeyID: id, EncryptedKey: ek}
+	}
+
+	var iv []byte
+	if len(env.IV) > 0 {
+		iv = env.IV
+	}
+	ectx, err := newEncryptionCipherCtx(c, nil, key, iv)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.isAEAD() {
+		return ectx, env, nil
+	}
+	actx := &authEncryptionCipherCtx{encryptionCipherCtx: ectx}
+	aad, err := env.aad()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := actx.ExtraData(aad); err != nil {
+		return nil, nil, err
+	}
+	return actx, env, nil
+}
+
+// NewOpenCipherCtx returns a context that decrypts data sealed to the RSA
+// key and described by the envelope, which must name the expected cipher c,
+// AES-256-GCM if nil. The context can be used with NewDecryptWriter or
+// NewDecryptReader to open a stream. With an AEAD cipher, the tag of the
+// envelope is checked when the decryption is finished, the data must not be
+// used before. The errors of opening an envelope must not be revealed to the
+// senders.
+func NewOpenCipherCtx(key PrivateKey, c *Cipher, env *Envelope) (
+	DecryptionCipherCtx, error) {
+	c, err := sealCipher(c)
+	if err != nil {
+		return nil, err
+	}
+	if env.Cipher == nil || env.Cipher.Nid() != c.Nid() {
+		return nil, errors.New("unexpected envelope cipher")
+	}
+	if len(env.IV) != c.IVSize() {
+		return nil, fmt.Errorf("bad IV size (%d bytes instead of %d)",
+			len(env.IV), c.IVSize())
+	}
+	aead := c.isAEAD()
+	if aead && len(env.Tag) == 0 {
+		return nil, errors.New("no tag for an AEAD cipher")
+	}
+	id, err := key.SPKIFingerprintSHA256()
+	if err != nil {
+		return nil, err
+	}
+	var ek []byte
+	for _, recipient := range env.Recipients {
+		if recipient.KeyID == id {
+			ek = recipient.EncryptedKey
+			break
+		}
+	}
+	if len(ek) == 0 {
+		return nil, errors.New("the envelope is not sealed to the key")
+	}
+
+	dataKey, err := key.DecryptOAEP(SHA256_Method, nil, ek)
+	if err != nil {
+		return nil, errors.New("failed to open the envelope")
+	}
+	defer Cleanse(dataKey)
+	if len(dataKey) != c.KeySize() {
+		return nil, errors.New("failed to open the envelope")
+	}
+	var iv []byte
+	if len(env.IV) > 0 {
+		iv = env.IV
+	}
+	dctx, err := newDecryptionCipherCtx(c, nil, dataKey, iv)
+	if err != nil {
+		return nil, err
+	}
+	if !aead {
+		return dctx, nil
+	}
+	actx := &authDecryptionCipherCtx{decryptionCipherCtx: dctx}
+	aad, err := env.aad()
+	if err != nil {
+		return nil, err
+	}
+	if err := actx.ExtraData(aad); err != nil {
+		return nil, err
+	}
+	if err := actx.SetTag(env.Tag); err != nil {
+		return nil, err
+	}
+	return actx, nil
+}
+
+// SealTo encrypts the plaintext to the RSA public keys with the cipher,
+// AES-256-GCM if nil. Any of the matching private keys opens it with Open.
+func SealTo(c *Cipher, pubkeys []PublicKey, plaintext []byte) (*Envelope,
+	[]byte, error) {
+	ctx, env, err := NewSealCipherCtx(c, pubkeys)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := ctx.EncryptUpdate(plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	final, err := ctx.EncryptFinal()
+	if err != nil {
+		return nil, nil, err
+	}
+	if actx, ok := ctx.(AuthenticatedEncryptionCipherCtx); ok {
+		if env.Tag, err = actx.GetTag(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return env, append(ciphertext, final...), nil
+}
+
+// Open decrypts the ciphertext sealed by SealTo to the key with the cipher,
+// AES-256-GCM if nil.
+func Open(key PrivateKey, c *Cipher, env *Envelope, ciphertext []byte) (
+	[]byte, error) {
+	ctx, err := NewOpenCipherCtx(key, c, env)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := ctx.DecryptUpdate(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	final, err := ctx.DecryptFinal()
+	if err != nil {
+		return nil, err
+	}
+	return append(plaintext, final...), nil
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	keys := make([]PrivateKey, 3)
+	for i := range keys {
+		bits := 2048
+		if i == 1 {
+			bits = 3072
+		}
+		key, err := GenerateRSAKeyWithOptions(RSAKeyOptions{Bits: bits})
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+
+	env, ciphertext, err := SealTo(nil, []PublicKey{keys[0], keys[1]}, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Recipients) != 2 || len(env.IV) != 12 || len(env.Tag) != 16 {
+		t.Fatalf("unexpected envelope %+v", env)
+	}
+	for _, key := range keys[:2] {
+		plaintext, err := Open(key, nil, env, ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plaintext, msg) {
+			t.Fatalf("unexpected plaintext %q", plaintext)
+		}
+	}
+	if _, err := Open(keys[2], nil, env, ciphertext); err == nil {
+		t.Fatal("opened with a key not sealed to")
+	}
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[0] ^= 1
+	if _, err := Open(keys[0], nil, env, tampered); err == nil {
+		t.Fatal("opened tampered data")
+	}
+	dropped := *env
+	dropped.Recipients = env.Recipients[:1]
+	if _, err := Open(keys[0], nil, &dropped, ciphertext); err == nil {
+		t.Fatal("opened with tampered recipients")
+	}
+
+	// an envelope switched to CTR with the GCM counter and no tag
+	ctr, err := GetCipherByName("aes-256-ctr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	switched := *env
+	switched.Cipher = ctr
+	switched.IV = append(append([]byte(nil), env.IV...), 0, 0, 0, 2)
+	switched.Tag = nil
+	if _, err := Open(keys[0], nil, &switched, ciphertext); err == nil {
+		t.Fatal("opened an envelope with a switched cipher")
+	}
+
+	ec, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := SealTo(nil, []PublicKey{ec}, msg); err == nil {
+		t.Fatal("sealed to an EC key")
+	}
+}
+
+func TestSealOpenStream(t *testing.T) {
+	key, err := GenerateRSAKeyWithOptions(RSAKeyOptions{Bits: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := GetCipherByName("aes-128-ctr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1<<20+7)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, env, err := NewSealCipherCtx(c, []PublicKey{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sealed bytes.Buffer
+	w := NewEncryptWriter(&sealed, ctx)
+	for rest := data; len(rest) > 0; {
+		n := 1000
+		if n > len(rest) {
+			n = len(rest)
+		}
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dctx, err := NewOpenCipherCtx(key, c, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := ioutil.ReadAll(NewDecryptReader(&sealed, dctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, data) {
+		t.Fatal("opened data differs")
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorEntry is an entry of the OpenSSL error stack.
+type ErrorEntry struct {
+	// Code is the packed error code of ERR_get_error.
+	Code     uint64
+	Library  int
+	Function int // always 0 with OpenSSL 3.0+
+	Reason   int
+
+	LibraryString  string
+	FunctionString string
+	ReasonString   string
+}
+
+func (e ErrorEntry) String() string {
+	return fmt.Sprintf("%s:%s:%s", e.LibraryString, e.FunctionString,
+		e.ReasonString)
+}
+
+// Error is an OpenSSL error with the error stack of the failed operation,
+// oldest entry first. Use errors.As to get it and errors.Is with the
+// sentinel errors, such as ErrBadDecrypt, to match a reason of the stack.
+type Error struct {
+	Stack []ErrorEntry
+}
+
+func (e *Error) Error() string {
+	errs := make([]string, 0, len(e.Stack))
+	for _, entry := range e.Stack {
+		errs = append(errs, entry.String())
+	}
+	return fmt.Sprintf("SSL errors: %s", strings.Join(errs, "\n"))
+}
+
+// Library returns the library code of the oldest entry of the stack, which
+// is usually the cause, or 0 if the stack is empty.
+func (e *Error) Library() int {
+	if len(e.Stack) == 0 {
+		return 0
+	}
+	return e.Stack[0].Library
+}
+
+// Reason returns the reason code of the oldest entry of the stack or 0 if
+// the stack is empty.
+func (e *Error) Reason() int {
+	if len(e.Stack) == 0 {
+		return 0
+	}
+	return e.Stack[0].Reason
+}
+
+// Is reports whether an entry of the stack has the library and the reason
+// of an entry of the target, such as a sentinel error.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	for _, entry := range e.Stack {
+		for _, reason := range t.Stack {
+			if entry.Library == reason.Library &&
+				entry.Reason == reason.Reason {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newReasonError(reasons ...ErrorEntry) *Error {
+	return &Error{Stack: reasons}
+}
+
+// Sentinel errors for common reasons, to be matched with errors.Is.
+var (
+	ErrCertificateVerifyFailed = newReasonError(ErrorEntry{
+		Library:       C.ERR_LIB_SSL,
+		Reason:        C.SSL_R_CERTIFICATE_VERIFY_FAILED,
+		LibraryString: "SSL routines",
+		ReasonString:  "certificate verify failed",
+	})
+	ErrWrongVersionNumber = newReasonError(ErrorEntry{
+		Library:       C.ERR_LIB_SSL,
+		Reason:        C.SSL_R_WRONG_VERSION_NUMBER,
+		LibraryString: "SSL routines",
+		ReasonString:  "wrong version number",
+	})
+	// ErrBadDecrypt is raised by EVP and by the providers of OpenSSL 3.0+.
+	ErrBadDecrypt = newReasonError(ErrorEntry{
+		Library:       C.ERR_LIB_EVP,
+		Reason:        C.EVP_R_BAD_DECRYPT,
+		LibraryString: "digital envelope routines",
+		ReasonString:  "bad decrypt",
+	}, ErrorEntry{
+		Library:       int(C.X_ERR_LIB_PROV),
+		Reason:        int(C.X_PROV_R_BAD_DECRYPT),
+		LibraryString: "Provider routines",
+		ReasonString:  "bad decrypt",
+	})
+)
+
+// errorFromErrorQueue needs to run in the same OS thread as the operation
+// that caused the possible error
+func errorFromErrorQueue() error {
+	e := &Error{}
+	for {
+		code := C.ERR_get_error()
+		if code == 0 {
+			break
+		}
+		e.Stack = append(e.Stack, ErrorEntry{
+			Code:           uint64(code),
+			Library:        int(C.X_ERR_GET_LIB(code)),
+			Function:       int(C.X_ERR_GET_FUNC(code)),
+			Reason:         int(C.X_ERR_GET_REASON(code)),
+			LibraryString:  C.GoString(C.ERR_lib_error_string(code)),
+			FunctionString: C.GoString(C.ERR_func_error_string(code)),
+			ReasonString:   C.GoString(C.ERR_reason_error_string(code)),
+		})
+	}
+	return e
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestErrorBadDecrypt(t *testing.T) {
+	cipher, err := GetCipherByName("aes-128-cbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, 16)
+	ectx, err := NewEncryptionCipherCtx(cipher, nil,
+		bytes.Repeat([]byte{1}, 16), iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err := ectx.EncryptUpdate([]byte("attack at dawn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	final, err := ectx.EncryptFinal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct = append(ct, final...)
+
+	dctx, err := NewDecryptionCipherCtx(cipher, nil,
+		bytes.Repeat([]byte{2}, 16), iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dctx.DecryptUpdate(ct); err != nil {
+		t.Fatal(err)
+	}
+	_, err = dctx.DecryptFinal()
+	if !errors.Is(err, ErrBadDecrypt) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if errors.Is(err, ErrWrongVersionNumber) {
+		t.Fatal("matched an unrelated reason")
+	}
+	var sslErr *Error
+	if !errors.As(err, &sslErr) || len(sslErr.Stack) == 0 {
+		t.Fatalf("unexpected error %#v", err)
+	}
+	if sslErr.Library() == 0 || sslErr.Reason() == 0 ||
+		sslErr.Stack[0].Code == 0 {
+		t.Fatalf("unexpected error stack %+v", sslErr.Stack)
+	}
+}
+
+func TestErrorCertificateVerifyFailed(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	leaf := newTestCertificate(t, "localhost", false, root)
+
+	serverCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UseCertificate(leaf.cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx.SetVerifyMode(VerifyPeer)
+
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, serverCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	go server.Handshake()
+	err = client.Handshake()
+	if !errors.Is(err, ErrCertificateVerifyFailed) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestErrorWrongVersionNumber(t *testing.T) {
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := NetPipe(t)
+	defer serverConn.Close()
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	go func() {
+		buf := make([]byte, 4096)
+		serverConn.Read(buf)
+		serverConn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+	}()
+	err = client.Handshake()
+	if !errors.Is(err, ErrWrongVersionNumber) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -1,7 +1,6 @@
 module github.com/tarantool/go-openssl
 
 require (
-	github.com/mattn/go-pointer v0.0.1
 	github.com/spacemonkeygo/spacelog v0.0.0-20180420211403-2296661a0572
 	golang.org/x/sys v0.0.0-20190626221950-04f50cda93cb // indirect
 )
@@ -0,0 +1,97 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Key exchange groups, by their OpenSSL names. The hybrid post-quantum ones
+// combine a classic ECDH share with an ML-KEM one. They are built in since
+// OpenSSL 3.5, and need OQSProvider to be loaded with older 3.x versions,
+// see GroupAvailable.
+const (
+	GroupX25519             = "X25519"
+	GroupX448               = "X448"
+	GroupP256               = "P-256"
+	GroupP384               = "P-384"
+	GroupP521               = "P-521"
+	GroupX25519MLKEM768     = "X25519MLKEM768"
+	GroupSecP256r1MLKEM768  = "SecP256r1MLKEM768"
+	GroupSecP384r1MLKEM1024 = "SecP384r1MLKEM1024"
+)
+
+// OQSProvider is the name of the Open Quantum Safe provider, which adds the
+// post-quantum groups to OpenSSL 3.0 to 3.4 once loaded with LoadProvider,
+// or by the OpenSSL configuration.
+const OQSProvider = "oqsprovider"
+
+// SetGroups sets the key exchange groups offered by clients and accepted by
+// servers, in the order of preference, e.g. GroupX25519MLKEM768 first to
+// pilot post-quantum key exchange with a classic fallback. It replaces the
+// curve set by SetEllipticCurve. It fails if a group is unknown, so
+// GroupAvailable should be checked for the optional ones.
+// See https://www.openssl.org/docs/man3.0/man3/SSL_CTX_set1_groups_list.html
+func (c *Ctx) SetGroups(groups ...string) error {
+	if len(groups) == 0 {
+		return errors.New("no groups given")
+	}
+	list := strings.Join(groups, ":")
+	clist := C.CString(list)
+	defer C.free(unsafe.Pointer(clist))
+	if C.X_SSL_CTX_set1_groups_list(c.ctx, clist) != 1 {
+		return fmt.Errorf("failed to set groups %s: %w", list,
+			errorFromErrorQueue())
+	}
+	c.groups = append([]string(nil), groups...)
+	c.curve = 0
+	return nil
+}
+
+// GroupAvailable reports whether the key exchange group is supported by the
+// library and the loaded providers, e.g. whether OQSProvider is needed for
+// GroupX25519MLKEM768.
+func GroupAvailable(group string) bool {
+	ctx := C.SSL_CTX_new(C.X_SSLv23_method())
+	if ctx == nil {
+		C.ERR_clear_error()
+		return false
+	}
+	defer C.SSL_CTX_free(ctx)
+	cgroup := C.CString(group)
+	defer C.free(unsafe.Pointer(cgroup))
+	if C.X_SSL_CTX_set1_groups_list(ctx, cgroup) != 1 {
+		C.ERR_clear_error()
+		return false
+	}
+	return true
+}
+
+// NegotiatedGroup returns the name of the key exchange group of the
+// connection, or an empty string if none was used or the library can't tell,
+// which is the case before OpenSSL 3.0.
+func (c *Conn) NegotiatedGroup() string {
+	name := C.X_SSL_get_negotiated_group_name(c.ssl)
+	if name == nil {
+		return ""
+	}
+	return C.GoString(name)
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetGroups(t *testing.T) {
+	if !GroupAvailable(GroupX25519) {
+		t.Fatal("X25519 is not available")
+	}
+	if GroupAvailable("bogus") {
+		t.Fatal("unknown group reported as available")
+	}
+	ctx := GetCtx(t)
+	if err := ctx.SetGroups("bogus"); err == nil {
+		t.Fatal("expected an error for an unknown group")
+	}
+
+	// Prefer the hybrid group when this build can negotiate it, as a
+	// deployment piloting post-quantum key exchange would.
+	groups := []string{GroupP256}
+	want := "secp256r1"
+	if GroupAvailable(GroupX25519MLKEM768) {
+		groups = append([]string{GroupX25519MLKEM768}, groups...)
+		want = GroupX25519MLKEM768
+	}
+	if err := ctx.SetGroups(groups...); err != nil {
+		t.Fatal(err)
+	}
+	clone, err := ctx.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := NetPipe(t)
+	defer serverConn.Close()
+	defer clientConn.Close()
+	server, err := Server(serverConn, clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doHandshake(t, server, client)
+	defer close_both(server, client)
+
+	for _, conn := range []*Conn{server, client} {
+		// The group can only be reported since OpenSSL 3.0.
+		got := conn.NegotiatedGroup()
+		if (got != "" || kdf_support) && !strings.EqualFold(got, want) {
+			t.Fatalf("negotiated group %q, want %q", got, want)
+		}
+	}
+}
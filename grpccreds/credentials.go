@@ -0,0 +1,186 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpccreds provides gRPC transport credentials backed by
+// github.com/tarantool/go-openssl, so that gRPC clients and servers can use
+// OpenSSL, e.g. a FIPS provider, instead of crypto/tls:
+//
+//	ctx, err := openssl.NewCtxFromFiles("server.crt", "server.key")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	creds, err := grpccreds.NewCredentials(ctx, 0)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	server := grpc.NewServer(grpc.Creds(creds))
+//
+// The package is a separate module to keep gRPC out of the dependencies of
+// go-openssl.
+package grpccreds
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tarantool/go-openssl"
+	"google.golang.org/grpc/credentials"
+)
+
+type transportCredentials struct {
+	ctx        *openssl.Ctx
+	flags      openssl.DialFlags
+	serverName string
+}
+
+// NewCredentials returns transport credentials performing the client and
+// server handshakes with a clone of ctx, whose ALPN protocols are set to h2,
+// as HTTP/2 requires; ctx itself is left unchanged. On the client side, the
+// server name, the host of the authority by default, is sent in the SNI
+// extension and checked against the server certificate; flags disable it as
+// for openssl.Dial.
+//
+// The AuthInfo of the connections is a credentials.TLSInfo, whose State is
+// reported by openssl.Conn.TLSConnectionState.
+func NewCredentials(ctx *openssl.Ctx,
+	flags openssl.DialFlags) (credentials.TransportCredentials, error) {
+	clone, err := ctx.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if err := clone.SetNextProtos([]string{"h2"}); err != nil {
+		return nil, err
+	}
+	return &transportCredentials{ctx: clone, flags: flags}, nil
+}
+
+// ClientHandshake performs the client handshake on rawConn. The handshake is
+// aborted, closing rawConn, when ctx is done.
+func (c *transportCredentials) ClientHandshake(ctx context.Context,
+	authority string, rawConn net.Conn) (_ net.Conn,
+	_ credentials.AuthInfo, err error) {
+	serverName := c.serverName
+	if serverName == "" {
+		serverName = authority
+		if host, _, err := net.SplitHostPort(authority); err == nil {
+			serverName = host
+		}
+	}
+	conn, err := openssl.Client(rawConn, c.ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+	conn.SetInsecureVerify(c.flags)
+	serverName = strings.TrimSuffix(serverName, ".")
+	// as openssl.Dial, IP addresses are not sent in the SNI extension
+	if c.flags&openssl.DisableSNI == 0 && net.ParseIP(serverName) == nil {
+		if err = conn.SetTlsExtHostName(serverName); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err = handshake(ctx, conn, rawConn); err != nil {
+		return nil, nil, err
+	}
+	if c.flags&openssl.InsecureSkipHostVerification == 0 {
+		if err = conn.VerifyHostname(serverName); err != nil {
+			return nil, nil, err
+		}
+	}
+	return conn, authInfo(conn), nil
+}
+
+// ServerHandshake performs the server handshake on rawConn.
+func (c *transportCredentials) ServerHandshake(rawConn net.Conn) (
+	net.Conn, credentials.AuthInfo, error) {
+	conn, err := openssl.Server(rawConn, c.ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = conn.Handshake(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, authInfo(conn), nil
+}
+
+// Info returns the protocol information of the credentials.
+func (c *transportCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: "tls",
+		ServerName:       c.serverName}
+}
+
+// Clone returns a copy of the credentials. The copy shares the context.
+func (c *transportCredentials) Clone() credentials.TransportCredentials {
+	clone := *c
+	return &clone
+}
+
+// OverrideServerName sets the server name used by the client handshakes
+// instead of the host of the authority.
+func (c *transportCredentials) OverrideServerName(name string) error {
+	c.serverName = name
+	return nil
+}
+
+// handshake performs the handshake of conn, respecting the deadline and the
+// cancellation of ctx.
+func handshake(ctx context.Context, conn *openssl.Conn,
+	rawConn net.Conn) (err error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+		defer func() {
+			if err == nil {
+				err = conn.SetDeadline(time.Time{})
+			}
+		}()
+	}
+	if ctx.Done() != nil {
+		done := make(chan struct{})
+		interrupted := make(chan error, 1)
+		go func() {
+			select {
+			case <-ctx.Done():
+				// closing the connection unblocks the handshake
+				rawConn.Close()
+				interrupted <- ctx.Err()
+			case <-done:
+				interrupted <- nil
+			}
+		}()
+		defer func() {
+			close(done)
+			if ctxErr := <-interrupted; ctxErr != nil {
+				err = ctxErr
+			}
+		}()
+	}
+	return conn.Handshake()
+}
+
+func authInfo(conn *openssl.Conn) credentials.TLSInfo {
+	return credentials.TLSInfo{
+		State: conn.TLSConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{
+			SecurityLevel: credentials.PrivacyAndIntegrity}}
+}
@@ -0,0 +1,261 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpccreds
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tarantool/go-openssl"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+// newTestIdentity returns a self-signed certificate for localhost and its
+// key, both PEM encoded.
+func newTestIdentity(t *testing.T) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func newTestServerCtx(t *testing.T, certPEM, keyPEM []byte) *openssl.Ctx {
+	ctx, err := openssl.NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := openssl.LoadCertificateFromPEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := openssl.LoadPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ctx.UseCertificate(cert); err != nil {
+		t.Fatal(err)
+	}
+	if err = ctx.UsePrivateKey(key); err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+func newTestClientCtx(t *testing.T, certPEM []byte) *openssl.Ctx {
+	ctx, err := openssl.NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := openssl.LoadCertificateFromPEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ctx.GetCertificateStore().AddCertificate(cert); err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetVerifyMode(openssl.VerifyPeer)
+	return ctx
+}
+
+// serveHealth starts a gRPC server with the health service, returning its
+// address.
+func serveHealth(t *testing.T, creds credentials.TransportCredentials) string {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.Creds(creds))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+	return testAddr(l)
+}
+
+// testAddr returns the address of l with the host name of the test
+// certificate.
+func testAddr(l net.Listener) string {
+	return net.JoinHostPort("localhost",
+		strconv.Itoa(l.Addr().(*net.TCPAddr).Port))
+}
+
+func checkHealth(t *testing.T, addr string,
+	creds credentials.TransportCredentials) *peer.Peer {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithTransportCredentials(creds), grpc.WithBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var p peer.Peer
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx,
+		&healthpb.HealthCheckRequest{}, grpc.Peer(&p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("unexpected status %v", resp.Status)
+	}
+	return &p
+}
+
+func TestCredentials(t *testing.T) {
+	certPEM, keyPEM := newTestIdentity(t)
+	serverCreds, err := NewCredentials(newTestServerCtx(t, certPEM, keyPEM), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveHealth(t, serverCreds)
+
+	clientCreds, err := NewCredentials(newTestClientCtx(t, certPEM), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := checkHealth(t, addr, clientCreds)
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		t.Fatalf("unexpected auth info %T", p.AuthInfo)
+	}
+	if info.State.NegotiatedProtocol != "h2" {
+		t.Fatalf("unexpected protocol %q", info.State.NegotiatedProtocol)
+	}
+	if len(info.State.PeerCertificates) != 1 ||
+		info.State.PeerCertificates[0].Subject.CommonName != "localhost" {
+		t.Fatal("unexpected peer certificates")
+	}
+
+	// crypto/tls clients interoperate with the server
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	checkHealth(t, addr, credentials.NewTLS(&tls.Config{RootCAs: pool}))
+}
+
+func TestCredentialsServerName(t *testing.T) {
+	certPEM, keyPEM := newTestIdentity(t)
+	serverCreds, err := NewCredentials(newTestServerCtx(t, certPEM, keyPEM), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serverCreds.ServerHandshake(c)
+		}
+	}()
+
+	clientCreds, err := NewCredentials(newTestClientCtx(t, certPEM), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := clientCreds.Clone()
+	if err = clone.OverrideServerName("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if name := clone.Info().ServerName; name != "example.com" {
+		t.Fatalf("unexpected server name %q", name)
+	}
+	if name := clientCreds.Info().ServerName; name != "" {
+		t.Fatalf("clone modified the server name to %q", name)
+	}
+
+	handshake := func(creds credentials.TransportCredentials) error {
+		c, err := net.Dial("tcp", testAddr(l))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		conn, _, err := creds.ClientHandshake(ctx, testAddr(l), c)
+		if err != nil {
+			c.Close()
+			return err
+		}
+		return conn.Close()
+	}
+	if err = handshake(clientCreds); err != nil {
+		t.Fatal(err)
+	}
+	if err = handshake(clone); err == nil {
+		t.Fatal("expected the hostname mismatch to fail")
+	}
+}
+
+func TestCredentialsHandshakeCanceled(t *testing.T) {
+	certPEM, _ := newTestIdentity(t)
+	creds, err := NewCredentials(newTestClientCtx(t, certPEM), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the server never answers
+	client, server := net.Pipe()
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		buf := make([]byte, 4096)
+		if _, err := server.Read(buf); err == nil {
+			cancel()
+		}
+	}()
+	_, _, err = creds.ClientHandshake(ctx, "localhost:443", client)
+	if err != context.Canceled {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/tarantool/go-openssl/grpccreds
+
+go 1.14
+
+replace github.com/tarantool/go-openssl => ../
+
+require (
+	github.com/tarantool/go-openssl v1.2.0
+	google.golang.org/grpc v1.43.0
+)
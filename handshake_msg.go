@@ -0,0 +1,112 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"os"
+	"unsafe"
+)
+
+// HandshakeMessageType is the type of a TLS handshake message.
+type HandshakeMessageType int
+
+// Handshake message types from RFC 8446 and RFC 5246.
+const (
+	HandshakeHelloRequest        HandshakeMessageType = 0
+	HandshakeClientHello         HandshakeMessageType = 1
+	HandshakeServerHello         HandshakeMessageType = 2
+	HandshakeNewSessionTicket    HandshakeMessageType = 4
+	HandshakeEndOfEarlyData      HandshakeMessageType = 5
+	HandshakeEncryptedExtensions HandshakeMessageType = 8
+	HandshakeCertificate         HandshakeMessageType = 11
+	HandshakeServerKeyExchange   HandshakeMessageType = 12
+	HandshakeCertificateRequest  HandshakeMessageType = 13
+	HandshakeServerHelloDone     HandshakeMessageType = 14
+	HandshakeCertificateVerify   HandshakeMessageType = 15
+	HandshakeClientKeyExchange   HandshakeMessageType = 16
+	HandshakeFinished            HandshakeMessageType = 20
+	HandshakeCertificateStatus   HandshakeMessageType = 22
+	HandshakeKeyUpdate           HandshakeMessageType = 24
+)
+
+// HandshakeMessage is a handshake message sent or received on a connection.
+type HandshakeMessage struct {
+	Type HandshakeMessageType
+	// Sent is true for messages sent by this side of the connection.
+	Sent bool
+	// Body is the message without the 4 byte handshake header. It is only
+	// valid during the callback.
+	Body []byte
+}
+
+// HandshakeMessageCallback is called for every handshake message of the type
+// it is registered for.
+type HandshakeMessageCallback func(ssl *SSL, msg *HandshakeMessage)
+
+// SetHandshakeMessageCallback registers cb to be called for every handshake
+// message of type typ that is sent or received on connections created from
+// the context afterwards. A nil cb removes the callback for typ.
+//
+// The callbacks are built on SSL_CTX_set_msg_callback, so SSL.EnableTracing
+// replaces them on the connection it is called for.
+// See https://www.openssl.org/docs/man1.1.1/man3/SSL_CTX_set_msg_callback.html
+func (c *Ctx) SetHandshakeMessageCallback(typ HandshakeMessageType,
+	cb HandshakeMessageCallback) {
+	c.handshake_msg_mu.Lock()
+	defer c.handshake_msg_mu.Unlock()
+	if cb == nil {
+		delete(c.handshake_msg_cbs, typ)
+		return
+	}
+	if c.handshake_msg_cbs == nil {
+		c.handshake_msg_cbs = make(map[HandshakeMessageType]HandshakeMessageCallback)
+		C.X_SSL_CTX_enable_handshake_msg_cb(c.ctx)
+	}
+	c.handshake_msg_cbs[typ] = cb
+}
+
+//export go_handshake_msg_cb_thunk
+func go_handshake_msg_cb_thunk(p unsafe.Pointer, con *C.SSL, write_p C.int,
+	buf unsafe.Pointer, length C.size_t) {
+	var s *SSL
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Critf("openssl: handshake message callback panic'd%s: %v",
+				s.correlationTag(), err)
+			os.Exit(1)
+		}
+	}()
+
+	data := nonCopyGoBytes(uintptr(buf), int(length))
+	typ := HandshakeMessageType(data[0])
+
+	c := pointers.Restore(p).(*Ctx)
+	c.handshake_msg_mu.RLock()
+	cb := c.handshake_msg_cbs[typ]
+	c.handshake_msg_mu.RUnlock()
+	if cb == nil {
+		return
+	}
+
+	s = sslFromC(con)
+	cb(s, &HandshakeMessage{
+		Type: typ,
+		Sent: write_p != 0,
+		Body: data[4:],
+	})
+}
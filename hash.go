@@ -0,0 +1,174 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"hash"
+	"runtime"
+	"unsafe"
+)
+
+// Hash computes a message digest with any EVP digest, using the assembly
+// implementations of OpenSSL. AsHash returns it as a hash.Hash.
+type Hash struct {
+	ctx    *C.EVP_MD_CTX
+	engine *Engine
+	md     *C.EVP_MD
+	// digest keeps a fetched md from being freed
+	digest *Digest
+}
+
+// NewHash returns a Hash computing the digest.
+func NewHash(digest EVP_MD) (*Hash, error) {
+	return NewHashWithEngine(digest, nil)
+}
+
+// NewHashWithEngine returns a Hash computing the digest with the engine.
+func NewHashWithEngine(digest EVP_MD, e *Engine) (*Hash, error) {
+	md := getDigestFunction(digest)
+	if md == nil {
+		return nil, errors.New("unsupported digest")
+	}
+	return newHash(md, e)
+}
+
+// NewHashWithDigest returns a Hash computing the digest, e.g. one looked up
+// by GetDigestByName.
+func NewHashWithDigest(digest *Digest) (*Hash, error) {
+	if digest == nil {
+		return nil, errors.New("nil digest")
+	}
+	h, err := newHash(digest.ptr, nil)
+	if err != nil {
+		return nil, err
+	}
+	h.digest = digest
+	return h, nil
+}
+
+// NewSHA384 returns a SHA-384 Hash.
+func NewSHA384() (*Hash, error) { return NewHash(EVP_SHA384) }
+
+// NewSHA512 returns a SHA-512 Hash.
+func NewSHA512() (*Hash, error) { return NewHash(EVP_SHA512) }
+
+// NewSHA512_256 returns a SHA-512/256 Hash.
+func NewSHA512_256() (*Hash, error) { return NewHash(EVP_SHA512_256) }
+
+// NewSHA3_256 returns a SHA3-256 Hash.
+func NewSHA3_256() (*Hash, error) { return NewHash(EVP_SHA3_256) }
+
+// NewSHA3_512 returns a SHA3-512 Hash.
+func NewSHA3_512() (*Hash, error) { return NewHash(EVP_SHA3_512) }
+
+// NewBLAKE2b512 returns a BLAKE2b-512 Hash.
+func NewBLAKE2b512() (*Hash, error) { return NewHash(EVP_BLAKE2B512) }
+
+// NewBLAKE2s256 returns a BLAKE2s-256 Hash.
+func NewBLAKE2s256() (*Hash, error) { return NewHash(EVP_BLAKE2S256) }
+
+func newHash(md *C.EVP_MD, e *Engine) (*Hash, error) {
+	h := &Hash{engine: e, md: md}
+	h.ctx = C.X_EVP_MD_CTX_new()
+	if h.ctx == nil {
+		return nil, errors.New("openssl: hash: unable to allocate ctx")
+	}
+	runtime.SetFinalizer(h, func(h *Hash) { h.Close() })
+	if C.X_EVP_DigestInit_ex(h.ctx, md, engineRef(e)) != 1 {
+		return nil, errors.New("openssl: hash: cannot init digest ctx")
+	}
+	return h, nil
+}
+
+func (h *Hash) Close() {
+	if h.ctx != nil {
+		C.X_EVP_MD_CTX_free(h.ctx)
+		h.ctx = nil
+	}
+}
+
+func (h *Hash) Write(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if C.X_EVP_DigestUpdate(h.ctx, unsafe.Pointer(&p[0]),
+		C.size_t(len(p))) != 1 {
+		return 0, errors.New("openssl: hash: cannot update digest")
+	}
+	return len(p), nil
+}
+
+// Sum appends the digest of the data written so far to b. It does not
+// change the state of the Hash.
+func (h *Hash) Sum(b []byte) []byte {
+	ctx := C.X_EVP_MD_CTX_new()
+	if ctx == nil {
+		panic("openssl: hash: unable to allocate ctx")
+	}
+	defer C.X_EVP_MD_CTX_free(ctx)
+	if C.EVP_MD_CTX_copy_ex(ctx, h.ctx) != 1 {
+		panic("openssl: hash: cannot copy digest ctx")
+	}
+	result := make([]byte, h.Size())
+	if C.X_EVP_DigestFinal_ex(ctx, (*C.uchar)(unsafe.Pointer(&result[0])),
+		nil) != 1 {
+		panic("openssl: hash: cannot finalize ctx")
+	}
+	runtime.KeepAlive(h)
+	return append(b, result...)
+}
+
+// Reset restarts the Hash.
+func (h *Hash) Reset() error {
+	if C.X_EVP_DigestInit_ex(h.ctx, h.md, engineRef(h.engine)) != 1 {
+		return errors.New("openssl: hash: cannot init digest ctx")
+	}
+	runtime.KeepAlive(h)
+	return nil
+}
+
+// AsHash returns the Hash as a hash.Hash, whose Reset panics if the Hash
+// can't be restarted.
+func (h *Hash) AsHash() hash.Hash {
+	return hashHash{h}
+}
+
+type hashHash struct {
+	*Hash
+}
+
+func (h hashHash) Reset() {
+	if err := h.Hash.Reset(); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Size returns the size of the digest in bytes.
+func (h *Hash) Size() int {
+	size := int(C.X_EVP_MD_size(h.md))
+	runtime.KeepAlive(h)
+	return size
+}
+
+// BlockSize returns the block size of the digest in bytes.
+func (h *Hash) BlockSize() int {
+	size := int(C.X_EVP_MD_block_size(h.md))
+	runtime.KeepAlive(h)
+	return size
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	data := []byte("The quick brown fox jumps over the lazy dog")
+	tests := []struct {
+		new  func() (*Hash, error)
+		std  func() hash.Hash
+		want string
+	}{
+		{new: NewSHA384, std: sha512.New384},
+		{new: NewSHA512, std: sha512.New},
+		{new: NewSHA512_256, std: sha512.New512_256},
+		{new: NewSHA3_256, want: "69070dda01975c8c120c3aada1b28239" +
+			"4e7f032fa9cf32f4cb2259a0897dfc04"},
+		{new: NewBLAKE2b512, want: "a8add4bdddfd93e4877d2746e62817b1" +
+			"16364a1fa7bc148d95090bc7333b3673f82401cf7aa2e4cb1ecd90296e3f14cb" +
+			"5413f8ed77be73045b13914cdcd6a918"},
+		{new: NewBLAKE2s256, want: "606beeec743ccbeff6cbcdf5d5302aa8" +
+			"55c256c29b88c8ed331ea1a6bf3c8812"},
+	}
+	if !ed25519_support {
+		tests = tests[:2]
+	}
+	for i, test := range tests {
+		h, err := test.new()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var _ hash.Hash = h.AsHash()
+		want := test.want
+		if test.std != nil {
+			std := test.std()
+			std.Write(data)
+			want = hex.EncodeToString(std.Sum(nil))
+			if h.Size() != std.Size() || h.BlockSize() != std.BlockSize() {
+				t.Fatalf("test %d: got sizes %d and %d, want %d and %d", i,
+					h.Size(), h.BlockSize(), std.Size(), std.BlockSize())
+			}
+		}
+		h.Write(data[:7])
+		h.Sum(nil)
+		h.Write(data[7:])
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			t.Fatalf("test %d: got %s, want %s", i, got, want)
+		}
+		if err := h.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		h.Write(data)
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			t.Fatalf("test %d after reset: got %s, want %s", i, got, want)
+		}
+		h.Close()
+	}
+}
+
+func BenchmarkSHA512Hash(b *testing.B) {
+	buf := make([]byte, 1024*1024)
+	h, err := NewSHA512()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer h.Close()
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Write(buf)
+	}
+}
@@ -19,14 +19,19 @@ import "C"
 
 import (
 	"errors"
+	"hash"
 	"runtime"
 	"unsafe"
 )
 
+// HMAC computes a keyed-hash message authentication code with any EVP
+// digest. AsHash returns it as a hash.Hash.
 type HMAC struct {
 	ctx    *C.HMAC_CTX
 	engine *Engine
 	md     *C.EVP_MD
+	// digest keeps a fetched md from being freed
+	digest *Digest
 }
 
 func NewHMAC(key []byte, digestAlgorithm EVP_MD) (*HMAC, error) {
@@ -34,22 +39,46 @@ func NewHMAC(key []byte, digestAlgorithm EVP_MD) (*HMAC, error) {
 }
 
 func NewHMACWithEngine(key []byte, digestAlgorithm EVP_MD, e *Engine) (*HMAC, error) {
-	var md *C.EVP_MD = getDigestFunction(digestAlgorithm)
+	md := getDigestFunction(digestAlgorithm)
+	if md == nil {
+		return nil, errors.New("unsupported digest")
+	}
+	return newHMAC(key, md, e)
+}
+
+// NewHMACWithDigest returns an HMAC with the digest, e.g. one looked up by
+// GetDigestByName.
+func NewHMACWithDigest(key []byte, digest *Digest) (*HMAC, error) {
+	if digest == nil {
+		return nil, errors.New("nil digest")
+	}
+	h, err := newHMAC(key, digest.ptr, nil)
+	if err != nil {
+		return nil, err
+	}
+	h.digest = digest
+	return h, nil
+}
+
+func newHMAC(key []byte, md *C.EVP_MD, e *Engine) (*HMAC, error) {
 	h := &HMAC{engine: e, md: md}
 	h.ctx = C.X_HMAC_CTX_new()
 	if h.ctx == nil {
 		return nil, errors.New("unable to allocate HMAC_CTX")
 	}
 
-	var c_e *C.ENGINE
-	if e != nil {
-		c_e = e.e
+	// HMAC_Init_ex takes a NULL key as the one set before, so pass a
+	// valid pointer for an empty key.
+	var empty [1]byte
+	keyPtr := unsafe.Pointer(&empty[0])
+	if len(key) > 0 {
+		keyPtr = unsafe.Pointer(&key[0])
 	}
 	if rc := C.X_HMAC_Init_ex(h.ctx,
-		unsafe.Pointer(&key[0]),
+		keyPtr,
 		C.int(len(key)),
 		md,
-		c_e); rc != 1 {
+		engineRef(e)); rc != 1 {
 		C.X_HMAC_CTX_free(h.ctx)
 		return nil, errors.New("failed to initialize HMAC_CTX")
 	}
@@ -59,7 +88,10 @@ func NewHMACWithEngine(key []byte, digestAlgorithm EVP_MD, e *Engine) (*HMAC, er
 }
 
 func (h *HMAC) Close() {
-	C.X_HMAC_CTX_free(h.ctx)
+	if h.ctx != nil {
+		C.X_HMAC_CTX_free(h.ctx)
+		h.ctx = nil
+	}
 }
 
 func (h *HMAC) Write(data []byte) (n int, err error) {
@@ -73,6 +105,7 @@ func (h *HMAC) Write(data []byte) (n int, err error) {
 	return len(data), nil
 }
 
+// Reset restarts the HMAC with its key.
 func (h *HMAC) Reset() error {
 	if C.X_HMAC_Init_ex(h.ctx, nil, 0, nil, nil) != 1 {
 		return errors.New("failed to reset HMAC_CTX")
@@ -80,12 +113,67 @@ func (h *HMAC) Reset() error {
 	return nil
 }
 
+// AsHash returns the HMAC as a hash.Hash, whose Reset panics if the HMAC
+// can't be restarted.
+func (h *HMAC) AsHash() hash.Hash {
+	return hmacHash{h}
+}
+
+type hmacHash struct {
+	*HMAC
+}
+
+func (h hmacHash) Reset() {
+	if err := h.HMAC.Reset(); err != nil {
+		panic("openssl: " + err.Error())
+	}
+}
+
+// Sum appends the HMAC of the data written so far to b. It does not change
+// the state of the HMAC.
+func (h *HMAC) Sum(b []byte) []byte {
+	ctx := C.X_HMAC_CTX_new()
+	if ctx == nil {
+		panic("openssl: unable to allocate HMAC_CTX")
+	}
+	defer C.X_HMAC_CTX_free(ctx)
+	if C.X_HMAC_CTX_copy(ctx, h.ctx) != 1 {
+		panic("openssl: failed to copy HMAC_CTX")
+	}
+	result := make([]byte, h.Size())
+	var length C.uint
+	if C.X_HMAC_Final(ctx, (*C.uchar)(unsafe.Pointer(&result[0])),
+		&length) != 1 {
+		panic("openssl: failed to finalize HMAC")
+	}
+	runtime.KeepAlive(h)
+	return append(b, result[:length]...)
+}
+
+// Size returns the size of the HMAC in bytes.
+func (h *HMAC) Size() int {
+	size := int(C.X_EVP_MD_size(h.md))
+	runtime.KeepAlive(h)
+	return size
+}
+
+// BlockSize returns the block size of the digest.
+func (h *HMAC) BlockSize() int {
+	size := int(C.X_EVP_MD_block_size(h.md))
+	runtime.KeepAlive(h)
+	return size
+}
+
+// Final returns the HMAC of the data written so far and resets the HMAC.
 func (h *HMAC) Final() (result []byte, err error) {
-	mdLength := C.X_EVP_MD_size(h.md)
-	result = make([]byte, mdLength)
+	result = make([]byte, h.Size())
+	var length C.uint
 	if rc := C.X_HMAC_Final(h.ctx, (*C.uchar)(unsafe.Pointer(&result[0])),
-		(*C.uint)(unsafe.Pointer(&mdLength))); rc != 1 {
+		&length); rc != 1 {
 		return nil, errors.New("failed to finalized HMAC")
 	}
-	return result, h.Reset()
+	if err := h.Reset(); err != nil {
+		return nil, err
+	}
+	return result[:length], nil
 }
@@ -17,7 +17,9 @@ package openssl
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
+	"hash"
 	"testing"
 )
 
@@ -49,6 +51,77 @@ func TestSHA256HMAC(t *testing.T) {
 	}
 }
 
+func TestHMACDigests(t *testing.T) {
+	key := []byte("Jefe")
+	data := []byte("what do ya want for nothing?")
+	tests := []struct {
+		digest EVP_MD
+		std    func() hash.Hash
+		want   string
+	}{
+		{digest: EVP_SHA384, std: sha512.New384},
+		{digest: EVP_SHA512, std: sha512.New},
+		{digest: EVP_SHA3_256, want: "c7d4072e788877ae3596bbb0da73b887" +
+			"c9171f93095b294ae857fbe2645e1ba5"},
+		{digest: EVP_BLAKE2S256, want: "90b6281e2f3038c9056af0b4a7e763ca" +
+			"e6fe5d9eb4386a0ec95237890c104ff0"},
+	}
+	for _, test := range tests {
+		if test.std == nil && !ed25519_support {
+			continue
+		}
+		h, err := NewHMAC(key, test.digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var _ hash.Hash = h.AsHash()
+		want := test.want
+		if test.std != nil {
+			mac := hmac.New(test.std, key)
+			mac.Write(data)
+			want = hex.EncodeToString(mac.Sum(nil))
+			if h.Size() != mac.Size() || h.BlockSize() != mac.BlockSize() {
+				t.Fatalf("digest %d: got sizes %d and %d, want %d and %d",
+					test.digest, h.Size(), h.BlockSize(), mac.Size(),
+					mac.BlockSize())
+			}
+		}
+		h.Write(data[:10])
+		h.Sum(nil)
+		h.Write(data[10:])
+		if got := hex.EncodeToString(h.Sum([]byte{})); got != want {
+			t.Fatalf("digest %d: got %s, want %s", test.digest, got, want)
+		}
+		if err := h.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		h.Write(data)
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			t.Fatalf("digest %d after reset: got %s, want %s", test.digest,
+				got, want)
+		}
+		mac := h.AsHash()
+		mac.Reset()
+		mac.Write(data)
+		if got := hex.EncodeToString(mac.Sum(nil)); got != want {
+			t.Fatalf("digest %d as hash.Hash: got %s, want %s", test.digest,
+				got, want)
+		}
+		h.Close()
+	}
+
+	digest, err := GetDigestByName("SHA256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHMACWithDigest(nil, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, h.Sum(nil), string(mustDecodeHex(t,
+		"b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad")))
+}
+
 func BenchmarkSHA256HMAC(b *testing.B) {
 	key := []byte("d741787cc61851af045ccd37")
 	data := []byte("5912EEFD-59EC-43E3-ADB8-D5325AEC3271")
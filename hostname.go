@@ -38,6 +38,19 @@ package openssl
 		typedef const char x509char;
 	#endif
 #endif
+
+#ifndef X509_CHECK_FLAG_NO_PARTIAL_WILDCARDS
+	#define X509_CHECK_FLAG_NO_PARTIAL_WILDCARDS	0x4
+	#define X509_CHECK_FLAG_MULTI_LABEL_WILDCARDS	0x8
+	#define X509_CHECK_FLAG_SINGLE_LABEL_SUBDOMAINS	0x10
+#endif
+#ifndef X509_CHECK_FLAG_NEVER_CHECK_SUBJECT
+	#define X509_CHECK_FLAG_NEVER_CHECK_SUBJECT	0x20
+#endif
+
+static void x_hostname_free(void *p) {
+	OPENSSL_free(p);
+}
 */
 import "C"
 
@@ -54,8 +67,13 @@ var (
 type CheckFlags int
 
 const (
-	AlwaysCheckSubject CheckFlags = C.X509_CHECK_FLAG_ALWAYS_CHECK_SUBJECT
-	NoWildcards        CheckFlags = C.X509_CHECK_FLAG_NO_WILDCARDS
+	AlwaysCheckSubject    CheckFlags = C.X509_CHECK_FLAG_ALWAYS_CHECK_SUBJECT
+	NoWildcards           CheckFlags = C.X509_CHECK_FLAG_NO_WILDCARDS
+	NoPartialWildcards    CheckFlags = C.X509_CHECK_FLAG_NO_PARTIAL_WILDCARDS
+	MultiLabelWildcards   CheckFlags = C.X509_CHECK_FLAG_MULTI_LABEL_WILDCARDS
+	SingleLabelSubdomains CheckFlags = C.X509_CHECK_FLAG_SINGLE_LABEL_SUBDOMAINS
+	// NeverCheckSubject is supported since OpenSSL 1.1.0.
+	NeverCheckSubject CheckFlags = C.X509_CHECK_FLAG_NEVER_CHECK_SUBJECT
 )
 
 // CheckHost checks that the X509 certificate is signed for the provided
@@ -64,18 +82,30 @@ const (
 // Specifically returns ValidationError if the Certificate didn't match but
 // there was no internal error.
 func (c *Certificate) CheckHost(host string, flags CheckFlags) error {
+	_, err := c.CheckHostMatch(host, flags)
+	return err
+}
+
+// CheckHostMatch acts like CheckHost, but also returns the name from the
+// certificate that matched host, e.g. the wildcard "*.example.com" for
+// "www.example.com". The name comes from the subject alternative name or
+// the common name of the subject.
+func (c *Certificate) CheckHostMatch(host string, flags CheckFlags) (string,
+	error) {
 	chost := unsafe.Pointer(C.CString(host))
 	defer C.free(chost)
 
+	var peername *C.char
 	rv := C.X509_check_host(c.x, (*C.x509char)(chost), C.size_t(len(host)),
-		C.uint(flags), nil)
+		C.uint(flags), &peername)
 	if rv > 0 {
-		return nil
+		defer C.x_hostname_free(unsafe.Pointer(peername))
+		return C.GoString(peername), nil
 	}
 	if rv == 0 {
-		return ValidationError
+		return "", ValidationError
 	}
-	return errors.New("hostname validation had an internal failure")
+	return "", errors.New("hostname validation had an internal failure")
 }
 
 // CheckEmail checks that the X509 certificate is signed for the provided
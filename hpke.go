@@ -0,0 +1,329 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// HPKEMode is a mode of the hybrid public key encryption of RFC 9180.
+type HPKEMode int
+
+const (
+	HPKEModeBase    HPKEMode = 0
+	HPKEModePSK     HPKEMode = 1
+	HPKEModeAuth    HPKEMode = 2
+	HPKEModePSKAuth HPKEMode = 3
+)
+
+// HPKEKEM, HPKEKDF and HPKEAEAD identify the algorithms of an HPKESuite by
+// their RFC 9180 code points.
+type (
+	HPKEKEM  uint16
+	HPKEKDF  uint16
+	HPKEAEAD uint16
+)
+
+const (
+	HPKEKEMP256   HPKEKEM = 0x0010
+	HPKEKEMP384   HPKEKEM = 0x0011
+	HPKEKEMP521   HPKEKEM = 0x0012
+	HPKEKEMX25519 HPKEKEM = 0x0020
+	HPKEKEMX448   HPKEKEM = 0x0021
+
+	HPKEKDFSHA256 HPKEKDF = 0x0001
+	HPKEKDFSHA384 HPKEKDF = 0x0002
+	HPKEKDFSHA512 HPKEKDF = 0x0003
+
+	HPKEAEADAES128GCM        HPKEAEAD = 0x0001
+	HPKEAEADAES256GCM        HPKEAEAD = 0x0002
+	HPKEAEADChaCha20Poly1305 HPKEAEAD = 0x0003
+	// HPKEAEADExportOnly allows Export but neither Seal nor Open.
+	HPKEAEADExportOnly HPKEAEAD = 0xffff
+)
+
+// HPKESuite is the KEM, KDF and AEAD combination that both the sender and
+// the recipient use.
+type HPKESuite struct {
+	KEM  HPKEKEM
+	KDF  HPKEKDF
+	AEAD HPKEAEAD
+}
+
+// DefaultHPKESuite is the default suite of OpenSSL: X25519, HKDF-SHA256 and
+// AES-128-GCM.
+var DefaultHPKESuite = HPKESuite{HPKEKEMX25519, HPKEKDFSHA256,
+	HPKEAEADAES128GCM}
+
+// HPKEOptions holds the extra inputs of the PSK and auth modes.
+type HPKEOptions struct {
+	// PSK and PSKID are the pre-shared key and its identifier of the PSK
+	// modes.
+	PSK   []byte
+	PSKID string
+	// AuthKey is the private key of the sender in the auth modes.
+	AuthKey PrivateKey
+	// AuthPublicKey is the encoded public key of the sender that the
+	// recipient authenticates in the auth modes.
+	AuthPublicKey []byte
+}
+
+// HPKECtx is the context of an HPKE sender or recipient. The messages are
+// sealed with successive nonces, so they have to be opened in the same
+// order. It is not safe for concurrent use.
+type HPKECtx struct {
+	ctx   unsafe.Pointer
+	suite HPKESuite
+}
+
+var errHPKEUnsupported = errors.New("HPKE is not supported")
+
+func (s HPKESuite) check() error {
+	if !hpke_support {
+		return errHPKEUnsupported
+	}
+	if C.X_OSSL_HPKE_suite_check(C.int(s.KEM), C.int(s.KDF),
+		C.int(s.AEAD)) != 1 {
+		C.ERR_clear_error()
+		return fmt.Errorf("unsupported HPKE suite %#04x, %#04x, %#04x",
+			s.KEM, s.KDF, s.AEAD)
+	}
+	return nil
+}
+
+// GenerateHPKEKey generates a key pair for the KEM of the suite, and returns
+// the encoded public key along with the private key.
+func GenerateHPKEKey(suite HPKESuite) ([]byte, PrivateKey, error) {
+	if err := suite.check(); err != nil {
+		return nil, nil, err
+	}
+	pub := make([]byte, C.X_OSSL_HPKE_get_public_encap_size(C.int(suite.KEM),
+		C.int(suite.KDF), C.int(suite.AEAD)))
+	publen := C.size_t(len(pub))
+	var pkey *C.EVP_PKEY
+	if C.X_OSSL_HPKE_keygen(C.int(suite.KEM), C.int(suite.KDF),
+		C.int(suite.AEAD), bytesPtr(pub), &publen, &pkey) != 1 {
+		return nil, nil, fmt.Errorf("failed to generate HPKE key: %w",
+			errorFromErrorQueue())
+	}
+	key := &pKey{key: pkey}
+	setPKeyFinalizer(key)
+	return pub[:publen], key, nil
+}
+
+// MarshalHPKEPublicKey returns the public key encoded as HPKE expects it for
+// its KEM: the raw key for X25519 and X448, and the uncompressed point for
+// the NIST curves.
+func MarshalHPKEPublicKey(key PublicKey) ([]byte, error) {
+	if !hpke_support {
+		return nil, errHPKEUnsupported
+	}
+	var out *C.uchar
+	n := C.X_EVP_PKEY_get1_encoded_public_key(key.evpPKey(), &out)
+	runtime.KeepAlive(key)
+	if n == 0 {
+		return nil, fmt.Errorf("failed to encode public key: %w",
+			errorFromErrorQueue())
+	}
+	defer C.X_OPENSSL_free(unsafe.Pointer(out))
+	return C.GoBytes(unsafe.Pointer(out), C.int(n)), nil
+}
+
+func newHPKECtx(mode HPKEMode, suite HPKESuite, sender bool,
+	opts *HPKEOptions) (*HPKECtx, error) {
+	if err := suite.check(); err != nil {
+		return nil, err
+	}
+	role := C.int(1)
+	if sender {
+		role = 0
+	}
+	ctx := C.X_OSSL_HPKE_CTX_new(C.int(mode), C.int(suite.KEM),
+		C.int(suite.KDF), C.int(suite.AEAD), role)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to create HPKE context: %w",
+			errorFromErrorQueue())
+	}
+	h := &HPKECtx{ctx: ctx, suite: suite}
+	runtime.SetFinalizer(h, func(h *HPKECtx) { h.Close() })
+	if opts == nil {
+		opts = &HPKEOptions{}
+	}
+
+	if mode == HPKEModePSK || mode == HPKEModePSKAuth {
+		pskid := C.CString(opts.PSKID)
+		defer C.free(unsafe.Pointer(pskid))
+		if C.X_OSSL_HPKE_CTX_set1_psk(h.ctx, pskid, bytesPtr(opts.PSK),
+			C.size_t(len(opts.PSK))) != 1 {
+			h.Close()
+			return nil, fmt.Errorf("failed to set HPKE PSK: %w",
+				errorFromErrorQueue())
+		}
+	}
+	if mode == HPKEModeAuth || mode == HPKEModePSKAuth {
+		var rc C.int
+		if sender {
+			if opts.AuthKey == nil {
+				h.Close()
+				return nil, errors.New("no HPKE sender key")
+			}
+			rc = C.X_OSSL_HPKE_CTX_set1_authpriv(h.ctx,
+				opts.AuthKey.evpPKey())
+			runtime.KeepAlive(opts.AuthKey)
+		} else {
+			rc = C.X_OSSL_HPKE_CTX_set1_authpub(h.ctx,
+				bytesPtr(opts.AuthPublicKey),
+				C.size_t(len(opts.AuthPublicKey)))
+		}
+		if rc != 1 {
+			h.Close()
+			return nil, fmt.Errorf("failed to set HPKE sender key: %w",
+				errorFromErrorQueue())
+		}
+	}
+	return h, nil
+}
+
+// NewHPKESender sets up an HPKE sender context for the encoded public key of
+// the recipient, with the info binding the context to the application. It
+// returns the encapsulated key, which the recipient needs along with the
+// ciphertexts.
+func NewHPKESender(mode HPKEMode, suite HPKESuite, recipient, info []byte,
+	opts *HPKEOptions) (*HPKECtx, []byte, error) {
+	h, err := newHPKECtx(mode, suite, true, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc := make([]byte, C.X_OSSL_HPKE_get_public_encap_size(C.int(suite.KEM),
+		C.int(suite.KDF), C.int(suite.AEAD)))
+	enclen := C.size_t(len(enc))
+	if C.X_OSSL_HPKE_encap(h.ctx, bytesPtr(enc), &enclen,
+		bytesPtr(recipient), C.size_t(len(recipient)), bytesPtr(info),
+		C.size_t(len(info))) != 1 {
+		h.Close()
+		return nil, nil, fmt.Errorf("failed to encapsulate HPKE key: %w",
+			errorFromErrorQueue())
+	}
+	return h, enc[:enclen], nil
+}
+
+// NewHPKERecipient sets up an HPKE recipient context from the encapsulated
+// key of the sender, the private key of the recipient and the info that the
+// sender used.
+func NewHPKERecipient(mode HPKEMode, suite HPKESuite, enc []byte,
+	key PrivateKey, info []byte, opts *HPKEOptions) (*HPKECtx, error) {
+	h, err := newHPKECtx(mode, suite, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	if C.X_OSSL_HPKE_decap(h.ctx, bytesPtr(enc), C.size_t(len(enc)),
+		key.evpPKey(), bytesPtr(info), C.size_t(len(info))) != 1 {
+		h.Close()
+		return nil, fmt.Errorf("failed to decapsulate HPKE key: %w",
+			errorFromErrorQueue())
+	}
+	runtime.KeepAlive(key)
+	return h, nil
+}
+
+// Seal encrypts and authenticates the plaintext and authenticates the
+// additional data with the next nonce of a sender context.
+func (h *HPKECtx) Seal(aad, plaintext []byte) ([]byte, error) {
+	ct := make([]byte, C.X_OSSL_HPKE_get_ciphertext_size(C.int(h.suite.KEM),
+		C.int(h.suite.KDF), C.int(h.suite.AEAD), C.size_t(len(plaintext))))
+	ctlen := C.size_t(len(ct))
+	if C.X_OSSL_HPKE_seal(h.ctx, bytesPtr(ct), &ctlen, bytesPtr(aad),
+		C.size_t(len(aad)), bytesPtr(plaintext),
+		C.size_t(len(plaintext))) != 1 {
+		return nil, fmt.Errorf("failed to seal HPKE message: %w",
+			errorFromErrorQueue())
+	}
+	runtime.KeepAlive(h)
+	return ct[:ctlen], nil
+}
+
+// Open decrypts and authenticates the ciphertext and authenticates the
+// additional data with the next nonce of a recipient context.
+func (h *HPKECtx) Open(aad, ciphertext []byte) ([]byte, error) {
+	// The plaintext is shorter than the ciphertext by the tag size.
+	pt := make([]byte, len(ciphertext))
+	ptlen := C.size_t(len(pt))
+	if C.X_OSSL_HPKE_open(h.ctx, bytesPtr(pt), &ptlen, bytesPtr(aad),
+		C.size_t(len(aad)), bytesPtr(ciphertext),
+		C.size_t(len(ciphertext))) != 1 {
+		return nil, fmt.Errorf("failed to open HPKE message: %w",
+			errorFromErrorQueue())
+	}
+	runtime.KeepAlive(h)
+	return pt[:ptlen], nil
+}
+
+// Export derives a secret of the length from the context and the label,
+// which the sender and the recipient get alike.
+func (h *HPKECtx) Export(label []byte, length int) ([]byte, error) {
+	if length <= 0 {
+		return nil, errors.New("invalid HPKE secret length")
+	}
+	secret := make([]byte, length)
+	if C.X_OSSL_HPKE_export(h.ctx, bytesPtr(secret), C.size_t(length),
+		bytesPtr(label), C.size_t(len(label))) != 1 {
+		return nil, fmt.Errorf("failed to export HPKE secret: %w",
+			errorFromErrorQueue())
+	}
+	runtime.KeepAlive(h)
+	return secret, nil
+}
+
+// Close frees the context. It must not be used afterwards.
+func (h *HPKECtx) Close() {
+	if h.ctx != nil {
+		C.X_OSSL_HPKE_CTX_free(h.ctx)
+		h.ctx = nil
+	}
+}
+
+// HPKESeal encrypts a single message for the encoded public key of the
+// recipient in the base mode, and returns the encapsulated key and the
+// ciphertext.
+func HPKESeal(suite HPKESuite, recipient, info, aad, plaintext []byte) (
+	enc, ciphertext []byte, err error) {
+	h, enc, err := NewHPKESender(HPKEModeBase, suite, recipient, info, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer h.Close()
+	ciphertext, err = h.Seal(aad, plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, ciphertext, nil
+}
+
+// HPKEOpen decrypts a single message sealed by HPKESeal.
+func HPKEOpen(suite HPKESuite, key PrivateKey, enc, info, aad,
+	ciphertext []byte) ([]byte, error) {
+	h, err := NewHPKERecipient(HPKEModeBase, suite, enc, key, info, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+	return h.Open(aad, ciphertext)
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHPKE(t *testing.T) {
+	if !hpke_support {
+		if _, _, err := GenerateHPKEKey(DefaultHPKESuite); err == nil {
+			t.Fatal("expected an error before OpenSSL 3.2")
+		}
+		t.Skip("HPKE needs OpenSSL 3.2 or newer")
+	}
+	info := []byte("test info")
+	aad := []byte("test aad")
+	msg := []byte("test message")
+
+	for _, suite := range []HPKESuite{
+		DefaultHPKESuite,
+		{HPKEKEMP256, HPKEKDFSHA256, HPKEAEADAES256GCM},
+		{HPKEKEMX448, HPKEKDFSHA512, HPKEAEADChaCha20Poly1305},
+	} {
+		pub, key, err := GenerateHPKEKey(suite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		marshaled, err := MarshalHPKEPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(marshaled, pub) {
+			t.Fatal("public key mismatch")
+		}
+
+		enc, ct, err := HPKESeal(suite, pub, info, aad, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pt, err := HPKEOpen(suite, key, enc, info, aad, ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pt, msg) {
+			t.Fatalf("got %q, want %q", pt, msg)
+		}
+		if _, err := HPKEOpen(suite, key, enc, info, []byte("wrong"),
+			ct); err == nil {
+			t.Fatal("opened with the wrong additional data")
+		}
+	}
+}
+
+func TestHPKEModes(t *testing.T) {
+	if !hpke_support {
+		t.Skip("HPKE needs OpenSSL 3.2 or newer")
+	}
+	suite := DefaultHPKESuite
+	info := []byte("test info")
+	pub, key, err := GenerateHPKEKey(suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	senderPub, senderKey, err := GenerateHPKEKey(suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	psk := bytes.Repeat([]byte{0x42}, 32)
+
+	for _, mode := range []HPKEMode{HPKEModeBase, HPKEModePSK, HPKEModeAuth,
+		HPKEModePSKAuth} {
+		sender, enc, err := NewHPKESender(mode, suite, pub, info,
+			&HPKEOptions{PSK: psk, PSKID: "id", AuthKey: senderKey})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sender.Close()
+		recipient, err := NewHPKERecipient(mode, suite, enc, key, info,
+			&HPKEOptions{PSK: psk, PSKID: "id", AuthPublicKey: senderPub})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer recipient.Close()
+
+		for _, msg := range []string{"first", "second"} {
+			ct, err := sender.Seal(nil, []byte(msg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pt, err := recipient.Open(nil, ct)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(pt) != msg {
+				t.Fatalf("mode %d: got %q, want %q", mode, pt, msg)
+			}
+		}
+
+		s1, err := sender.Export([]byte("label"), 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s2, err := recipient.Export([]byte("label"), 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(s1, s2) {
+			t.Fatalf("mode %d: exported secrets differ", mode)
+		}
+	}
+}
@@ -15,25 +15,40 @@
 package openssl
 
 import (
+	"context"
+	"net"
 	"net/http"
 )
 
 // ListenAndServeTLS will take an http.Handler and serve it using OpenSSL over
 // the given tcp address, configured to use the provided cert and key files.
+// The handler is wrapped with TLSStateHandler, so requests have their TLS
+// field set.
 func ListenAndServeTLS(addr string, cert_file string, key_file string,
 	handler http.Handler) error {
 	return ServerListenAndServeTLS(
-		&http.Server{Addr: addr, Handler: handler}, cert_file, key_file)
+		&http.Server{Addr: addr, Handler: TLSStateHandler(handler)},
+		cert_file, key_file)
 }
 
 // ServerListenAndServeTLS will take an http.Server and serve it using OpenSSL
-// configured to use the provided cert and key files.
+// configured to use the provided cert and key files. srv is modified: its
+// ConnContext hook is chained with ConnContext, so handlers can retrieve the
+// connection with ConnFromContext, and each call chains it again, so a server
+// should be passed once.
 func ServerListenAndServeTLS(srv *http.Server,
 	cert_file, key_file string) error {
 	addr := srv.Addr
 	if addr == "" {
 		addr = ":https"
 	}
+	if connContext := srv.ConnContext; connContext != nil {
+		srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+			return ConnContext(connContext(ctx, c), c)
+		}
+	} else {
+		srv.ConnContext = ConnContext
+	}
 
 	ctx, err := NewCtxFromFiles(cert_file, key_file)
 	if err != nil {
@@ -48,6 +63,48 @@ func ServerListenAndServeTLS(srv *http.Server,
 	return srv.Serve(l)
 }
 
+type connContextKey struct{}
+
+// ConnContext stores c in ctx if it is a Conn. It is meant to be used as the
+// http.Server.ConnContext hook of servers accepting connections from Listen,
+// since net/http leaves http.Request.TLS nil for them. Handlers retrieve the
+// connection with ConnFromContext, e.g. to authorize the client by its
+// certificate chain or the SNI.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	if conn, ok := c.(*Conn); ok {
+		return context.WithValue(ctx, connContextKey{}, conn)
+	}
+	return ctx
+}
+
+// ConnFromContext returns the connection stored in ctx by ConnContext.
+func ConnFromContext(ctx context.Context) (*Conn, bool) {
+	conn, ok := ctx.Value(connContextKey{}).(*Conn)
+	return conn, ok
+}
+
+// TLSStateHandler returns a handler that sets the TLS field of the requests
+// to the Conn.TLSConnectionState of their connection, as net/http does for
+// crypto/tls connections, and calls h, http.DefaultServeMux if nil. It
+// requires the ConnContext hook; requests without a connection in the context
+// are passed as is.
+func TLSStateHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := h
+		if handler == nil {
+			handler = http.DefaultServeMux
+		}
+		if conn, ok := ConnFromContext(r.Context()); ok && r.TLS == nil {
+			state := conn.TLSConnectionState()
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.TLS = &state
+			r = r2
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
 // TODO: http client integration
 // holy crap, getting this integrated nicely with the Go stdlib HTTP client
 // stack so that it does proxying, connection pooling, and most importantly
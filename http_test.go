@@ -0,0 +1,98 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSStateHandler(t *testing.T) {
+	ca := newTestCertificate(t, "ca", true, nil)
+	server := newTestCertificate(t, "localhost", false, ca)
+	client := newTestCertificate(t, "client", false, ca)
+	caPEM, err := ca.cert.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPEM)
+
+	ctx, err := NewCtxFromTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{
+			newTestTLSCertificate(t, server.key, server.cert)},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Listen("tcp", "localhost:0", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		ConnContext: ConnContext,
+		Handler: TLSStateHandler(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := ConnFromContext(r.Context()); !ok {
+					t.Error("no connection in the context")
+				}
+				if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+					http.Error(w, "no client certificate",
+						http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprintf(w, "%s %s", r.TLS.ServerName,
+					r.TLS.PeerCertificates[0].Subject.CommonName)
+			}))}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	httpClient := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{
+			Certificates: []tls.Certificate{
+				newTestTLSCertificate(t, client.key, client.cert)},
+			RootCAs:    pool,
+			ServerName: "localhost"}}}
+	resp, err := httpClient.Get("https://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "localhost client" {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestTLSStateHandlerDefaultServeMux(t *testing.T) {
+	const path = "/openssl-tls-state-handler-default-mux"
+	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w := httptest.NewRecorder()
+	TLSStateHandler(nil).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+}
@@ -76,7 +76,7 @@ Making a client connection is straightforward too:
 	if err != nil {
 	        log.Fatal(err)
 	}
-	err = ctx.LoadVerifyLocations("/etc/ssl/certs/ca-certificates.crt", "")
+	err = ctx.LoadSystemCAs()
 	if err != nil {
 	        log.Fatal(err)
 	}
@@ -93,7 +93,6 @@ import "C"
 
 import (
 	"fmt"
-	"strings"
 )
 
 func init() {
@@ -101,20 +100,3 @@ func init() {
 		panic(fmt.Errorf("x_shim_init failed with %d", rc))
 	}
 }
-
-// errorFromErrorQueue needs to run in the same OS thread as the operation
-// that caused the possible error
-func errorFromErrorQueue() error {
-	var errs []string
-	for {
-		err := C.ERR_get_error()
-		if err == 0 {
-			break
-		}
-		errs = append(errs, fmt.Sprintf("%s:%s:%s",
-			C.GoString(C.ERR_lib_error_string(err)),
-			C.GoString(C.ERR_func_error_string(err)),
-			C.GoString(C.ERR_reason_error_string(err))))
-	}
-	return fmt.Errorf("SSL errors: %s", strings.Join(errs, "\n"))
-}
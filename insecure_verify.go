@@ -0,0 +1,60 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+const insecureVerifyFlags = InsecureSkipChainVerification |
+	InsecureIgnoreExpiry | InsecureAllowSelfSigned
+
+// SetInsecureVerify makes the peer verification of the connection ignore the
+// errors selected by flags: any error with InsecureSkipChainVerification,
+// expired and not yet valid certificates with InsecureIgnoreExpiry, and
+// untrusted self-signed certificates with InsecureAllowSelfSigned. The other
+// flags are ignored. Each ignored error is logged as a warning and still
+// reported by Conn.VerifyResult. Dial and its variants call it with their
+// flags.
+func (s *SSL) SetInsecureVerify(flags DialFlags) {
+	s.insecure_verify = flags & insecureVerifyFlags
+	if s.insecure_verify != 0 && C.SSL_get_verify_callback(s.ssl) == nil {
+		// the errors are ignored by the verify callbacks
+		C.SSL_set_verify(s.ssl, C.SSL_get_verify_mode(s.ssl),
+			(*[0]byte)(C.X_SSL_verify_cb))
+	}
+}
+
+// allowVerifyError returns true if the current error of store is ignored by
+// the insecure verify flags of s.
+func (s *SSL) allowVerifyError(store *C.X509_STORE_CTX) bool {
+	if s.insecure_verify == 0 {
+		return false
+	}
+	result := VerifyResult(C.X509_STORE_CTX_get_error(store))
+	allowed := false
+	switch result {
+	case CertHasExpired, CertNotYetValid:
+		allowed = s.insecure_verify&InsecureIgnoreExpiry != 0
+	case DepthZeroSelfSignedCert, SelfSignedCertInChain:
+		allowed = s.insecure_verify&InsecureAllowSelfSigned != 0
+	}
+	if !allowed && s.insecure_verify&InsecureSkipChainVerification == 0 {
+		return false
+	}
+	logger.Warnf("openssl: ignoring certificate verification error%s at "+
+		"depth %d: %s", s.correlationTag(),
+		int(C.X509_STORE_CTX_get_error_depth(store)), result)
+	return true
+}
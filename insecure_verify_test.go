@@ -0,0 +1,125 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSSLSetInsecureVerify(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	leaf := newTestCertificate(t, "localhost", false, root)
+	selfSigned := newTestCertificate(t, "localhost", false, nil)
+
+	newServerCtx := func(identity *testCertificate) *Ctx {
+		ctx, err := NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.UseCertificate(identity.cert); err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.UsePrivateKey(identity.key); err != nil {
+			t.Fatal(err)
+		}
+		return ctx
+	}
+	chainCtx := newServerCtx(leaf)
+	selfSignedCtx := newServerCtx(selfSigned)
+
+	handshake := func(serverCtx, clientCtx *Ctx, flags DialFlags) error {
+		serverConn, clientConn := NetPipe(t)
+		server, err := Server(serverConn, serverCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer close_both(server, client)
+		client.SetInsecureVerify(flags)
+		go server.Handshake()
+		return client.Handshake()
+	}
+
+	// the verify callback of the context is called with the ignored errors
+	// as successes
+	for _, withCallback := range []bool{false, true} {
+		clientCtx, err := NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = clientCtx.GetCertificateStore().AddCertificate(root.cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if withCallback {
+			clientCtx.SetVerify(VerifyPeer,
+				func(ok bool, store *CertificateStoreCtx) bool {
+					return ok
+				})
+		} else {
+			clientCtx.SetVerifyMode(VerifyPeer)
+		}
+
+		for _, test := range []struct {
+			serverCtx *Ctx
+			expired   bool
+			flags     DialFlags
+			ok        bool
+		}{
+			{serverCtx: chainCtx, ok: true},
+			{serverCtx: chainCtx, expired: true},
+			{serverCtx: chainCtx, expired: true,
+				flags: InsecureAllowSelfSigned},
+			{serverCtx: chainCtx, expired: true,
+				flags: InsecureIgnoreExpiry, ok: true},
+			{serverCtx: chainCtx, expired: true,
+				flags: InsecureSkipChainVerification, ok: true},
+			{serverCtx: selfSignedCtx},
+			{serverCtx: selfSignedCtx, flags: InsecureIgnoreExpiry},
+			{serverCtx: selfSignedCtx, flags: InsecureAllowSelfSigned,
+				ok: true},
+			{serverCtx: selfSignedCtx, flags: InsecureSkipChainVerification,
+				ok: true},
+			{serverCtx: selfSignedCtx, expired: true,
+				flags: InsecureAllowSelfSigned},
+			{serverCtx: selfSignedCtx, expired: true, ok: true,
+				flags: InsecureAllowSelfSigned | InsecureIgnoreExpiry},
+		} {
+			if test.expired {
+				// the certificates are valid for 24 hours
+				clientCtx.SetVerifyTime(time.Now().Add(25 * time.Hour))
+			} else {
+				clientCtx.SetVerifyTime(time.Time{})
+			}
+			err := handshake(test.serverCtx, clientCtx, test.flags)
+			if test.ok && err != nil {
+				t.Fatalf("unexpected error with flags %d, self-signed %v, "+
+					"expired %v, callback %v: %v", test.flags,
+					test.serverCtx == selfSignedCtx, test.expired,
+					withCallback, err)
+			}
+			if !test.ok && err == nil {
+				t.Fatalf("unexpected success with flags %d, self-signed %v, "+
+					"expired %v, callback %v", test.flags,
+					test.serverCtx == selfSignedCtx, test.expired,
+					withCallback)
+			}
+		}
+	}
+}
@@ -0,0 +1,548 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interop
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tarantool/go-openssl"
+	"github.com/tarantool/go-openssl/ca"
+)
+
+// cryptoTLSCiphers maps the OpenSSL names of TLS 1.2 ciphers to crypto/tls.
+var cryptoTLSCiphers = map[string]uint16{
+	"ECDHE-RSA-AES128-GCM-SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"ECDHE-RSA-AES256-GCM-SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"ECDHE-RSA-CHACHA20-POLY1305":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"ECDHE-RSA-AES128-SHA256":       tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	"ECDHE-RSA-AES128-SHA":          tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"ECDHE-RSA-AES256-SHA":          tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"ECDHE-ECDSA-AES128-GCM-SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"ECDHE-ECDSA-AES256-GCM-SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"ECDHE-ECDSA-CHACHA20-POLY1305": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+var opensslVersions = map[Version]openssl.Version{
+	VersionTLS12: openssl.TLS1_2_VERSION,
+	VersionTLS13: openssl.TLS1_3_VERSION,
+}
+
+var cryptoTLSVersions = map[Version]uint16{
+	VersionTLS12: tls.VersionTLS12,
+	VersionTLS13: tls.VersionTLS13,
+}
+
+var sClientVersions = map[Version]string{
+	VersionTLS12: "-tls1_2",
+	VersionTLS13: "-tls1_3",
+}
+
+const (
+	request  = "ping\n"
+	response = "pong\n"
+)
+
+type keyPair struct {
+	cert     *openssl.Certificate
+	key      openssl.PrivateKey
+	tls      tls.Certificate
+	certFile string
+	keyFile  string
+}
+
+// credentials are the CA and the certificates used by all cases. They are
+// also written to files for s_client.
+type credentials struct {
+	ca     *openssl.Certificate
+	caFile string
+	pool   *x509.CertPool
+	server *keyPair
+	client *keyPair
+}
+
+func newCredentials(dir string) (*credentials, error) {
+	root, err := ca.NewRoot(ca.Subject{CommonName: "interop root"},
+		ca.Options{})
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := root.Certificate.MarshalPEM()
+	if err != nil {
+		return nil, err
+	}
+	creds := &credentials{
+		ca:     root.Certificate,
+		caFile: filepath.Join(dir, "ca.pem"),
+		pool:   x509.NewCertPool(),
+	}
+	if err := ioutil.WriteFile(creds.caFile, caPEM, 0600); err != nil {
+		return nil, err
+	}
+	creds.pool.AppendCertsFromPEM(caPEM)
+
+	creds.server, err = newKeyPair(root, dir, "server",
+		ca.LeafOptions{ServerAuth: true})
+	if err != nil {
+		return nil, err
+	}
+	creds.client, err = newKeyPair(root, dir, "client",
+		ca.LeafOptions{ClientAuth: true})
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func newKeyPair(root *ca.Authority, dir, name string,
+	opts ca.LeafOptions) (*keyPair, error) {
+	key, err := openssl.GenerateRSAKey(2048)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := openssl.NewName()
+	if err != nil {
+		return nil, err
+	}
+	if err := subject.AddTextEntry("CN", "interop "+name); err != nil {
+		return nil, err
+	}
+	req, err := openssl.NewCertificateRequest(subject, key,
+		openssl.SignOptions{Digest: openssl.EVP_SHA256})
+	if err != nil {
+		return nil, err
+	}
+	opts.DNSNames = []string{"localhost"}
+	opts.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	cert, err := root.IssueFromRequest(req, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM, err := cert.MarshalPEM()
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := key.MarshalPKCS1PrivateKeyPEM()
+	if err != nil {
+		return nil, err
+	}
+	pair := &keyPair{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".pem"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	pair.tls, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(pair.certFile, certPEM, 0600); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(pair.keyFile, keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+type harness struct {
+	creds   *credentials
+	openssl string
+	timeout time.Duration
+}
+
+// run serves one connection, two with resumption, to the client of the
+// case. Each connection exchanges a request and a response.
+func (h *harness) run(c Case) error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	conns := 1
+	if c.Resumption {
+		conns = 2
+	}
+	deadline := time.Now().Add(h.timeout)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- h.serve(c, l, conns, deadline)
+	}()
+
+	err = h.connect(c, l.Addr().String(), conns, deadline)
+	if err != nil {
+		l.Close()
+		<-serverErr
+		return fmt.Errorf("client: %v", err)
+	}
+	if err := <-serverErr; err != nil {
+		return fmt.Errorf("server: %v", err)
+	}
+	return nil
+}
+
+// serve accepts the connections of the case. The server context is shared
+// by the connections, so that sessions can be resumed.
+func (h *harness) serve(c Case, l net.Listener, conns int,
+	deadline time.Time) error {
+	var wrap func(conn net.Conn) (net.Conn, error)
+	switch c.Server {
+	case GoOpenSSL:
+		ctx, err := h.openSSLServerCtx(c)
+		if err != nil {
+			return err
+		}
+		wrap = func(conn net.Conn) (net.Conn, error) {
+			return openssl.Server(conn, ctx)
+		}
+	case CryptoTLS:
+		config := h.cryptoTLSServerConfig(c)
+		wrap = func(conn net.Conn) (net.Conn, error) {
+			return tls.Server(conn, config), nil
+		}
+	default:
+		return fmt.Errorf("unsupported server %s", c.Server)
+	}
+
+	for i := 0; i < conns; i++ {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		conn.SetDeadline(deadline)
+		tlsConn, err := wrap(conn)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		err = serveConn(tlsConn)
+		tlsConn.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serveConn(conn net.Conn) error {
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != request {
+		return fmt.Errorf("unexpected request %q", line)
+	}
+	_, err = io.WriteString(conn, response)
+	return err
+}
+
+func (h *harness) openSSLCtx(c Case) (*openssl.Ctx, error) {
+	ctx, err := openssl.NewCtx()
+	if err != nil {
+		return nil, err
+	}
+	version := opensslVersions[c.Version]
+	if !ctx.SetMinProtoVersion(version) || !ctx.SetMaxProtoVersion(version) {
+		return nil, fmt.Errorf("failed to enable only %s", c.Version)
+	}
+	if c.Cipher != "" {
+		if err := ctx.SetCipherList(c.Cipher); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.GetCertificateStore().AddCertificate(h.creds.ca); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func (h *harness) openSSLServerCtx(c Case) (*openssl.Ctx, error) {
+	ctx, err := h.openSSLCtx(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.UseCertificate(h.creds.server.cert); err != nil {
+		return nil, err
+	}
+	if err := ctx.UsePrivateKey(h.creds.server.key); err != nil {
+		return nil, err
+	}
+	// Sessions of authenticated clients are only resumed with a session
+	// ID context.
+	if err := ctx.SetSessionId([]byte("interop")); err != nil {
+		return nil, err
+	}
+	if c.ClientAuth {
+		ctx.SetVerifyMode(openssl.VerifyPeer |
+			openssl.VerifyFailIfNoPeerCert)
+	}
+	return ctx, nil
+}
+
+func (h *harness) cryptoTLSConfig(c Case) *tls.Config {
+	config := &tls.Config{
+		MinVersion: cryptoTLSVersions[c.Version],
+		MaxVersion: cryptoTLSVersions[c.Version],
+	}
+	if c.Cipher != "" {
+		config.CipherSuites = []uint16{cryptoTLSCiphers[c.Cipher]}
+	}
+	return config
+}
+
+func (h *harness) cryptoTLSServerConfig(c Case) *tls.Config {
+	config := h.cryptoTLSConfig(c)
+	config.Certificates = []tls.Certificate{h.creds.server.tls}
+	if c.ClientAuth {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = h.creds.pool
+	}
+	return config
+}
+
+// connectResult describes a client connection.
+type connectResult struct {
+	version string
+	cipher  string
+	reused  bool
+}
+
+// connect makes the client connections of the case and checks what was
+// negotiated.
+func (h *harness) connect(c Case, addr string, conns int,
+	deadline time.Time) error {
+	var (
+		connect func(resume bool) (connectResult, error)
+		err     error
+	)
+	switch c.Client {
+	case GoOpenSSL:
+		connect, err = h.openSSLClient(c, addr, deadline)
+	case CryptoTLS:
+		connect = h.cryptoTLSClient(c, addr, deadline)
+	case SClient:
+		connect, err = h.sClient(c, addr, deadline)
+	default:
+		err = fmt.Errorf("unsupported client %s", c.Client)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < conns; i++ {
+		resume := i > 0
+		res, err := connect(resume)
+		if err != nil {
+			return err
+		}
+		if res.version != string(c.Version) {
+			return fmt.Errorf("negotiated %s", res.version)
+		}
+		if c.Cipher != "" && res.cipher != c.Cipher {
+			return fmt.Errorf("negotiated %s", res.cipher)
+		}
+		if res.reused != resume {
+			if resume {
+				return errors.New("session not resumed")
+			}
+			return errors.New("unexpected session resumption")
+		}
+	}
+	return nil
+}
+
+func exchange(conn io.ReadWriter) error {
+	if _, err := io.WriteString(conn, request); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != response {
+		return fmt.Errorf("unexpected response %q", line)
+	}
+	return nil
+}
+
+func (h *harness) openSSLClient(c Case, addr string,
+	deadline time.Time) (func(bool) (connectResult, error), error) {
+	ctx, err := h.openSSLCtx(c)
+	if err != nil {
+		return nil, err
+	}
+	ctx.SetVerifyMode(openssl.VerifyPeer)
+	if c.ClientAuth {
+		if err := ctx.UseCertificate(h.creds.client.cert); err != nil {
+			return nil, err
+		}
+		if err := ctx.UsePrivateKey(h.creds.client.key); err != nil {
+			return nil, err
+		}
+	}
+
+	var session []byte
+	return func(resume bool) (connectResult, error) {
+		var res connectResult
+		if !resume {
+			session = nil
+		}
+		conn, err := openssl.DialSession("tcp", addr, ctx, 0, session)
+		if err != nil {
+			return res, err
+		}
+		defer conn.Close()
+		conn.SetDeadline(deadline)
+		if err := exchange(conn); err != nil {
+			return res, err
+		}
+		if session, err = conn.GetSession(); err != nil {
+			return res, err
+		}
+		res.version = conn.GetVersion()
+		if res.cipher, err = conn.CurrentCipher(); err != nil {
+			return res, err
+		}
+		res.reused = conn.SessionReused()
+		return res, nil
+	}, nil
+}
+
+func (h *harness) cryptoTLSClient(c Case, addr string,
+	deadline time.Time) func(bool) (connectResult, error) {
+	config := h.cryptoTLSConfig(c)
+	config.RootCAs = h.creds.pool
+	config.ServerName = "127.0.0.1"
+	if c.ClientAuth {
+		config.Certificates = []tls.Certificate{h.creds.client.tls}
+	}
+	config.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+
+	return func(resume bool) (connectResult, error) {
+		var res connectResult
+		dialer := &net.Dialer{Deadline: deadline}
+		conn, err := tls.DialWithDialer(dialer, "tcp", addr, config)
+		if err != nil {
+			return res, err
+		}
+		defer conn.Close()
+		conn.SetDeadline(deadline)
+		if err := exchange(conn); err != nil {
+			return res, err
+		}
+		state := conn.ConnectionState()
+		for version, v := range cryptoTLSVersions {
+			if v == state.Version {
+				res.version = string(version)
+			}
+		}
+		for cipher, id := range cryptoTLSCiphers {
+			if id == state.CipherSuite {
+				res.cipher = cipher
+			}
+		}
+		res.reused = state.DidResume
+		return res, nil
+	}
+}
+
+// sClientSession matches the session summary printed by s_client, e.g.
+// "New, TLSv1.3, Cipher is TLS_AES_256_GCM_SHA384".
+var sClientSession = regexp.MustCompile(
+	`(?m)^(New|Reused), (TLSv[0-9.]+), Cipher is (\S+)`)
+
+func (h *harness) sClient(c Case, addr string,
+	deadline time.Time) (func(bool) (connectResult, error), error) {
+	args := []string{"s_client", "-connect", addr,
+		sClientVersions[c.Version],
+		"-CAfile", h.creds.caFile, "-verify_return_error",
+		"-verify_ip", "127.0.0.1"}
+	if c.Cipher != "" {
+		args = append(args, "-cipher", c.Cipher)
+	}
+	if c.ClientAuth {
+		args = append(args, "-cert", h.creds.client.certFile,
+			"-key", h.creds.client.keyFile)
+	}
+	sessionFile := filepath.Join(filepath.Dir(h.creds.caFile),
+		"session.pem")
+
+	return func(resume bool) (connectResult, error) {
+		var res connectResult
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		cmdArgs := append([]string{}, args...)
+		if resume {
+			cmdArgs = append(cmdArgs, "-sess_in", sessionFile)
+		} else {
+			cmdArgs = append(cmdArgs, "-sess_out", sessionFile)
+		}
+		cmd := exec.CommandContext(ctx, h.openssl, cmdArgs...)
+		// Keep stdin open: s_client quits on EOF, possibly before the
+		// response arrives. It exits when the server closes instead.
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return res, err
+		}
+		defer stdin.Close()
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		if err := cmd.Start(); err != nil {
+			return res, err
+		}
+		if _, err := io.WriteString(stdin, request); err != nil {
+			cmd.Wait()
+			return res, err
+		}
+		if err := cmd.Wait(); err != nil {
+			return res, fmt.Errorf("%v: %s", err, lastLines(out.String()))
+		}
+
+		m := sClientSession.FindStringSubmatch(out.String())
+		if m == nil || !strings.Contains(out.String(), response) {
+			return res, fmt.Errorf("unexpected output: %s",
+				lastLines(out.String()))
+		}
+		res.reused = m[1] == "Reused"
+		res.version = m[2]
+		res.cipher = m[3]
+		return res, nil
+	}, nil
+}
+
+// lastLines returns the end of the output of a command for error messages.
+func lastLines(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) > 5 {
+		lines = lines[len(lines)-5:]
+	}
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,287 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package interop runs interoperability tests between this package,
+// crypto/tls and the openssl s_client binary. A Matrix describes the
+// combinations to test: client and server implementations, protocol
+// versions, TLS 1.2 ciphers, client authentication and session resumption.
+// Run executes every combination over loopback connections and collects the
+// outcomes in a Report, e.g. to qualify a new OpenSSL release:
+//
+//	report, err := interop.Run(interop.DefaultMatrix())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	fmt.Print(report)
+//
+// Certificates are issued for every run by a throwaway CA with RSA keys, so
+// TLS 1.2 ciphers have to use RSA authentication.
+package interop
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Implementation is a TLS implementation taking part in a test.
+type Implementation string
+
+const (
+	// GoOpenSSL is this package.
+	GoOpenSSL Implementation = "go-openssl"
+	// CryptoTLS is the Go standard library.
+	CryptoTLS Implementation = "crypto/tls"
+	// SClient is the openssl s_client binary. It can only be a client.
+	SClient Implementation = "s_client"
+)
+
+// Version is a TLS protocol version, named like OpenSSL does.
+type Version string
+
+const (
+	VersionTLS12 Version = "TLSv1.2"
+	VersionTLS13 Version = "TLSv1.3"
+)
+
+// DefaultCiphers are the TLS 1.2 ciphers tested by DefaultMatrix.
+var DefaultCiphers = []string{
+	"ECDHE-RSA-AES128-GCM-SHA256",
+	"ECDHE-RSA-AES256-GCM-SHA384",
+	"ECDHE-RSA-CHACHA20-POLY1305",
+}
+
+// DefaultTimeout limits the duration of a single test case.
+const DefaultTimeout = 10 * time.Second
+
+// Case is a single interoperability test.
+type Case struct {
+	Client Implementation
+	Server Implementation
+	// Version is the only protocol version enabled on both sides.
+	Version Version
+	// Cipher is the OpenSSL name of the only cipher enabled on both sides.
+	// It is empty for TLS 1.3, where the default suites are used.
+	Cipher string
+	// ClientAuth makes the server require a client certificate.
+	ClientAuth bool
+	// Resumption makes the client reconnect and resume the session.
+	Resumption bool
+}
+
+func (c Case) String() string {
+	s := fmt.Sprintf("%s -> %s %s", c.Client, c.Server, c.Version)
+	if c.Cipher != "" {
+		s += " " + c.Cipher
+	}
+	if c.ClientAuth {
+		s += " +client-auth"
+	}
+	if c.Resumption {
+		s += " +resumption"
+	}
+	return s
+}
+
+// Matrix describes the cases to run: every combination of its fields.
+type Matrix struct {
+	Clients    []Implementation
+	Servers    []Implementation
+	Versions   []Version
+	Ciphers    []string
+	ClientAuth []bool
+	Resumption []bool
+
+	// OpenSSL is the path of the openssl binary, "openssl" if empty. Cases
+	// with SClient are skipped if it is not found.
+	OpenSSL string
+	// Timeout limits the duration of a single case, DefaultTimeout if zero.
+	Timeout time.Duration
+}
+
+// DefaultMatrix tests all implementations against each other with TLS 1.2
+// and TLS 1.3, DefaultCiphers, and with and without client authentication
+// and resumption.
+func DefaultMatrix() Matrix {
+	return Matrix{
+		Clients:    []Implementation{GoOpenSSL, CryptoTLS, SClient},
+		Servers:    []Implementation{GoOpenSSL, CryptoTLS},
+		Versions:   []Version{VersionTLS12, VersionTLS13},
+		Ciphers:    DefaultCiphers,
+		ClientAuth: []bool{false, true},
+		Resumption: []bool{false, true},
+	}
+}
+
+// Cases returns the cases of the matrix. Ciphers only apply to TLS 1.2, so
+// there is a single TLS 1.3 case for each other combination.
+func (m Matrix) Cases() []Case {
+	var cases []Case
+	for _, client := range m.Clients {
+		for _, server := range m.Servers {
+			for _, version := range m.Versions {
+				ciphers := m.Ciphers
+				if version != VersionTLS12 || len(ciphers) == 0 {
+					ciphers = []string{""}
+				}
+				for _, cipher := range ciphers {
+					for _, auth := range orFalse(m.ClientAuth) {
+						for _, resume := range orFalse(m.Resumption) {
+							cases = append(cases, Case{
+								Client:     client,
+								Server:     server,
+								Version:    version,
+								Cipher:     cipher,
+								ClientAuth: auth,
+								Resumption: resume,
+							})
+						}
+					}
+				}
+			}
+		}
+	}
+	return cases
+}
+
+func orFalse(values []bool) []bool {
+	if len(values) == 0 {
+		return []bool{false}
+	}
+	return values
+}
+
+// Result is the outcome of a case. Err is nil if the case passed, Skipped
+// is the reason the case was not run.
+type Result struct {
+	Case     Case
+	Err      error
+	Skipped  string
+	Duration time.Duration
+}
+
+// Report holds the results of Run, in the order of Matrix.Cases.
+type Report struct {
+	Results []Result
+}
+
+// Failed returns the results of the cases that failed.
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, res := range r.Results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// String formats the report as a table with a line per case and a summary.
+func (r *Report) String() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	var passed, failed, skipped int
+	for _, res := range r.Results {
+		c := res.Case
+		status, detail := "PASS", ""
+		switch {
+		case res.Err != nil:
+			status, detail = "FAIL", res.Err.Error()
+			failed++
+		case res.Skipped != "":
+			status, detail = "SKIP", res.Skipped
+			skipped++
+		default:
+			passed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", status, c.Client,
+			c.Server, c.Version, c.Cipher, flag(c.ClientAuth, "client-auth"),
+			flag(c.Resumption, "resumption"), detail)
+	}
+	w.Flush()
+	fmt.Fprintf(&buf, "%d passed, %d failed, %d skipped\n", passed, failed,
+		skipped)
+	return buf.String()
+}
+
+func flag(set bool, name string) string {
+	if set {
+		return name
+	}
+	return "-"
+}
+
+// Run runs the cases of the matrix one by one. It only returns an error if
+// the test setup fails; the outcome of each case is in the report.
+func Run(m Matrix) (*Report, error) {
+	for _, server := range m.Servers {
+		if server == SClient {
+			return nil, errors.New("s_client can't be a server")
+		}
+	}
+	if m.OpenSSL == "" {
+		m.OpenSSL = "openssl"
+	}
+	if m.Timeout == 0 {
+		m.Timeout = DefaultTimeout
+	}
+
+	dir, err := ioutil.TempDir("", "go-openssl-interop")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	creds, err := newCredentials(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &harness{creds: creds, timeout: m.Timeout}
+	if path, err := exec.LookPath(m.OpenSSL); err == nil {
+		h.openssl = path
+	}
+
+	report := &Report{}
+	for _, c := range m.Cases() {
+		start := time.Now()
+		res := Result{Case: c}
+		if res.Skipped = h.skip(c); res.Skipped == "" {
+			res.Err = h.run(c)
+		}
+		res.Duration = time.Since(start)
+		report.Results = append(report.Results, res)
+	}
+	return report, nil
+}
+
+func (h *harness) skip(c Case) string {
+	if c.Client == SClient && h.openssl == "" {
+		return "openssl binary not found"
+	}
+	if c.Cipher != "" && (c.Client == CryptoTLS || c.Server == CryptoTLS) {
+		if _, ok := cryptoTLSCiphers[c.Cipher]; !ok {
+			return "cipher not supported by crypto/tls"
+		}
+	}
+	if strings.HasPrefix(c.Cipher, "ECDHE-ECDSA-") {
+		return "ECDSA ciphers need an ECDSA certificate"
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interop
+
+import (
+	"testing"
+)
+
+func TestMatrixCases(t *testing.T) {
+	m := Matrix{
+		Clients:  []Implementation{GoOpenSSL},
+		Servers:  []Implementation{GoOpenSSL, CryptoTLS},
+		Versions: []Version{VersionTLS12, VersionTLS13},
+		Ciphers:  DefaultCiphers,
+	}
+	// ciphers only multiply the TLS 1.2 cases
+	if n := len(m.Cases()); n != 2*(len(DefaultCiphers)+1) {
+		t.Fatalf("unexpected number of cases %d", n)
+	}
+}
+
+func TestRun(t *testing.T) {
+	m := DefaultMatrix()
+	if testing.Short() {
+		m.Ciphers = m.Ciphers[:1]
+	}
+	report, err := Run(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("\n%s", report)
+	for _, res := range report.Failed() {
+		t.Errorf("%s: %v", res.Case, res.Err)
+	}
+	if len(report.Results) != len(m.Cases()) {
+		t.Fatalf("expected %d results, got %d", len(m.Cases()),
+			len(report.Results))
+	}
+}
+
+func TestRunSClientServer(t *testing.T) {
+	m := DefaultMatrix()
+	m.Servers = append(m.Servers, SClient)
+	if _, err := Run(m); err == nil {
+		t.Fatal("expected an error for an s_client server")
+	}
+}
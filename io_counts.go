@@ -0,0 +1,137 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"net"
+	"sync"
+)
+
+// The lengths of the record headers, which end with the length of the record.
+const (
+	tlsRecordHeaderLen  = 5
+	dtlsRecordHeaderLen = 13
+)
+
+// IOCounts are the raw bytes and the TLS or DTLS records read from and
+// written to the underlying connection of a Conn, including the TLS overhead.
+type IOCounts struct {
+	BytesRead      int64
+	BytesWritten   int64
+	RecordsRead    int64
+	RecordsWritten int64
+}
+
+// SetIOCounting enables or disables the counting of the raw traffic of the
+// connections created from the context afterwards, see Conn.IOCounts. It is
+// disabled by default, since it takes a lock and follows the record headers
+// on every read and write of the underlying connection. It must not be
+// called concurrently with the creation of connections.
+func (c *Ctx) SetIOCounting(enabled bool) {
+	c.io_counts = enabled
+}
+
+// IOCounts returns the raw bytes and the TLS records read and written on
+// the connection so far, for bandwidth accounting. The counts are zero
+// unless the context of the connection has Ctx.SetIOCounting enabled.
+func (c *Conn) IOCounts() IOCounts {
+	var rv IOCounts
+	if c.counts == nil {
+		return rv
+	}
+	rv.BytesRead, rv.RecordsRead = c.counts.in.counts()
+	rv.BytesWritten, rv.RecordsWritten = c.counts.out.counts()
+	return rv
+}
+
+// recordCounter counts the bytes and the records of a direction of a
+// connection, following the record headers in the stream.
+type recordCounter struct {
+	mu        sync.Mutex
+	bytes     int64
+	records   int64
+	header    [dtlsRecordHeaderLen]byte
+	headerMax int // the length of the record headers of the protocol
+	headerLen int
+	// remaining is the length of the rest of the current record
+	remaining int
+}
+
+func (rc *recordCounter) count(b []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.bytes += int64(len(b))
+	for len(b) > 0 {
+		if rc.remaining > 0 {
+			n := rc.remaining
+			if n > len(b) {
+				n = len(b)
+			}
+			rc.remaining -= n
+			b = b[n:]
+			continue
+		}
+		n := copy(rc.header[rc.headerLen:rc.headerMax], b)
+		rc.headerLen += n
+		b = b[n:]
+		if rc.headerLen == rc.headerMax {
+			rc.records++
+			rc.remaining = int(rc.header[rc.headerMax-2])<<8 |
+				int(rc.header[rc.headerMax-1])
+			rc.headerLen = 0
+		}
+	}
+}
+
+func (rc *recordCounter) counts() (bytes, records int64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.bytes, rc.records
+}
+
+// countingConn counts the raw traffic of a connection.
+type countingConn struct {
+	net.Conn
+	in  recordCounter
+	out recordCounter
+}
+
+func newCountingConn(conn net.Conn, dtls bool) *countingConn {
+	headerLen := tlsRecordHeaderLen
+	if dtls {
+		headerLen = dtlsRecordHeaderLen
+	}
+	return &countingConn{
+		Conn: conn,
+		in:   recordCounter{headerMax: headerLen},
+		out:  recordCounter{headerMax: headerLen},
+	}
+}
+
+func (cc *countingConn) Read(b []byte) (int, error) {
+	n, err := cc.Conn.Read(b)
+	if n > 0 {
+		cc.in.count(b[:n])
+	}
+	return n, err
+}
+
+func (cc *countingConn) Write(b []byte) (int, error) {
+	n, err := cc.Conn.Write(b)
+	if n > 0 {
+		cc.out.count(b[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+)
+
+var (
+	x509_store_idx = C.X_X509_STORE_new_index()
+)
+
+//export get_x509_store_idx
+func get_x509_store_idx() C.int {
+	return x509_store_idx
+}
+
+// IssuerLookupCallback is consulted when the issuer of cert is not found in
+// the CertificateStore or among the untrusted certificates. It may fetch the
+// issuer from elsewhere (AIA chasing, a database) and return it, or return
+// nil if there is none.
+type IssuerLookupCallback func(cert *Certificate) *Certificate
+
+// SetIssuerLookupCallback registers cb to look up issuers that are missing
+// from the store during chain building and verification. Certificates
+// returned by cb are not trusted: each is used only if it chains up to a
+// certificate of the store, possibly through further lookups. A nil cb
+// removes the callback.
+// The callback may be called concurrently from several verifications.
+// See https://www.openssl.org/docs/man1.1.1/man3/X509_STORE_set_get_issuer.html
+func (s *CertificateStore) SetIssuerLookupCallback(
+	cb IssuerLookupCallback) error {
+	old := C.X509_STORE_get_ex_data(s.store, get_x509_store_idx())
+	var p unsafe.Pointer
+	if cb != nil {
+		p = pointers.Save(cb)
+	}
+	if C.X_X509_STORE_set_lookup_issuer(s.store, p) != 1 {
+		if p != nil {
+			pointers.Unref(p)
+		}
+		return errors.New("failed to set issuer lookup callback")
+	}
+	if old != nil {
+		pointers.Unref(old)
+	}
+	return nil
+}
+
+//export go_x509_store_lookup_issuer_thunk
+func go_x509_store_lookup_issuer_thunk(p unsafe.Pointer, x *C.X509) *C.X509 {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Critf("openssl: issuer lookup callback panic'd: %v", err)
+			os.Exit(1)
+		}
+	}()
+	cb := pointers.Restore(p).(IssuerLookupCallback)
+	if C.X_X509_add_ref(x) != 1 {
+		return nil
+	}
+	cert := &Certificate{x: x}
+	setCertificateFinalizer(cert)
+	issuer := cb(cert)
+	if issuer == nil || C.X_X509_add_ref(issuer.x) != 1 {
+		return nil
+	}
+	// OpenSSL now owns a reference, so issuer may be collected.
+	return issuer.x
+}
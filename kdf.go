@@ -0,0 +1,325 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// The modes of EVP_PKEY_CTX_hkdf_mode.
+const (
+	hkdfExtractAndExpand = 0
+	hkdfExtractOnly      = 1
+	hkdfExpandOnly       = 2
+)
+
+// HKDF derives a key of length bytes from the secret with the HMAC-based
+// key derivation function of RFC 5869. The salt and info are optional. It
+// requires OpenSSL 1.1.1 or newer.
+func HKDF(digest EVP_MD, secret, salt, info []byte, length int) ([]byte,
+	error) {
+	return hkdf(hkdfExtractAndExpand, "", digest, secret, salt, info, length)
+}
+
+// HKDFWithProperties is HKDF with the KDF and the digest fetched with the
+// property query. It requires OpenSSL 3.0 or newer.
+func HKDFWithProperties(properties string, digest EVP_MD, secret, salt,
+	info []byte, length int) ([]byte, error) {
+	return hkdf(hkdfExtractAndExpand, properties, digest, secret, salt, info,
+		length)
+}
+
+// HKDFExtract returns the pseudorandom key extracted from the secret and
+// the salt, the first step of HKDF. It is as long as the digest.
+func HKDFExtract(digest EVP_MD, secret, salt []byte) ([]byte, error) {
+	md := getDigestFunction(digest)
+	if md == nil {
+		return nil, errors.New("unsupported digest")
+	}
+	return hkdf(hkdfExtractOnly, "", digest, secret, salt, nil,
+		int(C.X_EVP_MD_size(md)))
+}
+
+// HKDFExpand expands the pseudorandom key to a key of length bytes bound
+// to the info, the second step of HKDF.
+func HKDFExpand(digest EVP_MD, prk, info []byte, length int) ([]byte,
+	error) {
+	return hkdf(hkdfExpandOnly, "", digest, prk, nil, info, length)
+}
+
+func hkdf(mode C.int, properties string, digest EVP_MD, secret, salt,
+	info []byte, length int) ([]byte, error) {
+	md := getDigestFunction(digest)
+	if md == nil {
+		return nil, errors.New("unsupported digest")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	if length <= 0 {
+		return nil, errors.New("key length must be positive")
+	}
+	out := make([]byte, length)
+	if properties != "" {
+		cprops := C.CString(properties)
+		defer C.free(unsafe.Pointer(cprops))
+		if C.X_EVP_KDF_hkdf(mode, cprops, md,
+			bytesPtr(secret), C.size_t(len(secret)),
+			bytesPtr(salt), C.size_t(len(salt)),
+			bytesPtr(info), C.size_t(len(info)),
+			(*C.uchar)(unsafe.Pointer(&out[0])), C.size_t(length)) != 1 {
+			return nil, errors.New("failed to derive key")
+		}
+		return out, nil
+	}
+	outlen := C.size_t(length)
+	if C.X_EVP_PKEY_hkdf(mode, md,
+		bytesPtr(secret), C.size_t(len(secret)),
+		bytesPtr(salt), C.size_t(len(salt)),
+		bytesPtr(info), C.size_t(len(info)),
+		(*C.uchar)(unsafe.Pointer(&out[0])), &outlen) != 1 {
+		return nil, errors.New("failed to derive key")
+	}
+	return out[:outlen], nil
+}
+
+// PBKDF2 derives a key of keyLen bytes from the password with PBKDF2 (RFC
+// 8018) and HMAC with the digest.
+func PBKDF2(password, salt []byte, iter, keyLen int, digest EVP_MD) ([]byte,
+	error) {
+	return pbkdf2("", password, salt, iter, keyLen, digest)
+}
+
+// PBKDF2WithProperties is PBKDF2 with the KDF and the digest fetched with
+// the property query. It requires OpenSSL 3.0 or newer.
+func PBKDF2WithProperties(properties string, password, salt []byte, iter,
+	keyLen int, digest EVP_MD) ([]byte, error) {
+	return pbkdf2(properties, password, salt, iter, keyLen, digest)
+}
+
+func pbkdf2(properties string, password, salt []byte, iter, keyLen int,
+	digest EVP_MD) ([]byte, error) {
+	md := getDigestFunction(digest)
+	if md == nil {
+		return nil, errors.New("unsupported digest")
+	}
+	if iter <= 0 {
+		return nil, errors.New("iteration count must be positive")
+	}
+	if keyLen <= 0 {
+		return nil, errors.New("key length must be positive")
+	}
+	out := make([]byte, keyLen)
+	if properties != "" {
+		cprops := C.CString(properties)
+		defer C.free(unsafe.Pointer(cprops))
+		if C.X_EVP_KDF_pbkdf2(cprops, md,
+			bytesPtr(password), C.size_t(len(password)),
+			bytesPtr(salt), C.size_t(len(salt)), C.uint64_t(iter),
+			(*C.uchar)(unsafe.Pointer(&out[0])), C.size_t(keyLen)) != 1 {
+			return nil, errors.New("failed to derive key")
+		}
+		return out, nil
+	}
+	if C.PKCS5_PBKDF2_HMAC((*C.char)(unsafe.Pointer(bytesPtr(password))),
+		C.int(len(password)), bytesPtr(salt), C.int(len(salt)),
+		C.int(iter), md, C.int(keyLen),
+		(*C.uchar)(unsafe.Pointer(&out[0]))) != 1 {
+		return nil, errors.New("failed to derive key")
+	}
+	return out, nil
+}
+
+// Scrypt derives a key of keyLen bytes from the password with scrypt (RFC
+// 7914). N is the CPU/memory cost, a power of two, r the block size and p
+// the parallelization. It needs about 128*r*N bytes of memory and requires
+// OpenSSL 1.1.0 or newer.
+func Scrypt(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	return scrypt("", password, salt, N, r, p, keyLen)
+}
+
+// ScryptWithProperties is Scrypt with the KDF and its digest fetched with
+// the property query. It requires OpenSSL 3.0 or newer.
+func ScryptWithProperties(properties string, password, salt []byte, N, r, p,
+	keyLen int) ([]byte, error) {
+	return scrypt(properties, password, salt, N, r, p, keyLen)
+}
+
+func scrypt(properties string, password, salt []byte, N, r, p,
+	keyLen int) ([]byte, error) {
+	if N <= 1 || N&(N-1) != 0 {
+		return nil, errors.New("scrypt N must be a power of two above 1")
+	}
+	if r <= 0 || p <= 0 {
+		return nil, errors.New("scrypt r and p must be positive")
+	}
+	if keyLen <= 0 {
+		return nil, errors.New("key length must be positive")
+	}
+	// the memory limit is raised above the 32 MiB default to what the
+	// parameters need
+	maxmem := 128 * uint64(r) * (uint64(N) + uint64(p) + 2)
+	out := make([]byte, keyLen)
+	if properties != "" {
+		cprops := C.CString(properties)
+		defer C.free(unsafe.Pointer(cprops))
+		if C.X_EVP_KDF_scrypt(cprops,
+			bytesPtr(password), C.size_t(len(password)),
+			bytesPtr(salt), C.size_t(len(salt)),
+			C.uint64_t(N), C.uint64_t(r), C.uint64_t(p), C.uint64_t(maxmem),
+			(*C.uchar)(unsafe.Pointer(&out[0])), C.size_t(keyLen)) != 1 {
+			return nil, errors.New("failed to derive key")
+		}
+		return out, nil
+	}
+	if C.X_EVP_PBE_scrypt((*C.char)(unsafe.Pointer(bytesPtr(password))),
+		C.size_t(len(password)), bytesPtr(salt), C.size_t(len(salt)),
+		C.uint64_t(N), C.uint64_t(r), C.uint64_t(p), C.uint64_t(maxmem),
+		(*C.uchar)(unsafe.Pointer(&out[0])), C.size_t(keyLen)) != 1 {
+		return nil, errors.New("failed to derive key")
+	}
+	return out, nil
+}
+
+// TLS1PRF computes length bytes of the TLS 1.2 pseudorandom function (RFC
+// 5246) of the secret, the label and the seed with the digest, EVP_SHA256
+// for most cipher suites. It requires OpenSSL 1.1.0 or newer.
+func TLS1PRF(digest EVP_MD, secret, label, seed []byte, length int) (
+	[]byte, error) {
+	md := getDigestFunction(digest)
+	if md == nil {
+		return nil, errors.New("unsupported digest")
+	}
+	return tls1PRF("", md, secret, label, seed, length)
+}
+
+// TLS1PRFWithProperties is TLS1PRF with the KDF and the digest fetched with
+// the property query. It requires OpenSSL 3.0 or newer.
+func TLS1PRFWithProperties(properties string, digest EVP_MD, secret, label,
+	seed []byte, length int) ([]byte, error) {
+	md := getDigestFunction(digest)
+	if md == nil {
+		return nil, errors.New("unsupported digest")
+	}
+	return tls1PRF(properties, md, secret, label, seed, length)
+}
+
+// TLS10PRF computes length bytes of the TLS 1.0 and 1.1 pseudorandom
+// function (RFC 2246), which combines MD5 and SHA-1.
+func TLS10PRF(secret, label, seed []byte, length int) ([]byte, error) {
+	md, err := GetDigestByName("MD5-SHA1")
+	if err != nil {
+		return nil, err
+	}
+	return tls1PRF("", md.ptr, secret, label, seed, length)
+}
+
+func tls1PRF(properties string, md *C.EVP_MD, secret, label, seed []byte,
+	length int) ([]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	if length <= 0 {
+		return nil, errors.New("key length must be positive")
+	}
+	labelSeed := append(append([]byte{}, label...), seed...)
+	if len(labelSeed) == 0 {
+		return nil, errors.New("empty label and seed")
+	}
+	out := make([]byte, length)
+	if properties != "" {
+		cprops := C.CString(properties)
+		defer C.free(unsafe.Pointer(cprops))
+		if C.X_EVP_KDF_tls1_prf(cprops, md,
+			bytesPtr(secret), C.size_t(len(secret)),
+			bytesPtr(labelSeed), C.size_t(len(labelSeed)),
+			(*C.uchar)(unsafe.Pointer(&out[0])), C.size_t(length)) != 1 {
+			return nil, errors.New("failed to derive key")
+		}
+		return out, nil
+	}
+	outlen := C.size_t(length)
+	if C.X_EVP_PKEY_tls1_prf(md, bytesPtr(secret), C.size_t(len(secret)),
+		bytesPtr(labelSeed), C.size_t(len(labelSeed)),
+		(*C.uchar)(unsafe.Pointer(&out[0])), &outlen) != 1 {
+		return nil, errors.New("failed to derive key")
+	}
+	return out[:outlen], nil
+}
+
+// SSKDF derives a key of length bytes from the shared secret with the
+// hash-based single-step key derivation function of NIST SP 800-56C, bound
+// to the info (FixedInfo). It requires OpenSSL 3.0 or newer.
+func SSKDF(digest EVP_MD, secret, info []byte, length int) ([]byte, error) {
+	return deriveDigestKDF("SSKDF", "", digest, secret, info, length)
+}
+
+// SSKDFWithProperties is SSKDF with the KDF and the digest fetched with
+// the property query, e.g. "provider=fips".
+func SSKDFWithProperties(properties string, digest EVP_MD, secret,
+	info []byte, length int) ([]byte, error) {
+	return deriveDigestKDF("SSKDF", properties, digest, secret, info,
+		length)
+}
+
+// X963KDF derives a key of length bytes from the shared secret with the
+// key derivation function of ANSI X9.63, bound to the shared info. It
+// requires OpenSSL 3.0 or newer.
+func X963KDF(digest EVP_MD, secret, sharedInfo []byte, length int) (
+	[]byte, error) {
+	return deriveDigestKDF("X963KDF", "", digest, secret, sharedInfo,
+		length)
+}
+
+// X963KDFWithProperties is X963KDF with the KDF and the digest fetched
+// with the property query.
+func X963KDFWithProperties(properties string, digest EVP_MD, secret,
+	sharedInfo []byte, length int) ([]byte, error) {
+	return deriveDigestKDF("X963KDF", properties, digest, secret,
+		sharedInfo, length)
+}
+
+func deriveDigestKDF(name, properties string, digest EVP_MD, secret,
+	info []byte, length int) ([]byte, error) {
+	md := getDigestFunction(digest)
+	if md == nil {
+		return nil, errors.New("unsupported digest")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	if length <= 0 {
+		return nil, errors.New("key length must be positive")
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	var cprops *C.char
+	if properties != "" {
+		cprops = C.CString(properties)
+		defer C.free(unsafe.Pointer(cprops))
+	}
+	out := make([]byte, length)
+	if C.X_EVP_KDF_derive_digest(cname, cprops, md,
+		bytesPtr(secret), C.size_t(len(secret)),
+		bytesPtr(info), C.size_t(len(info)),
+		(*C.uchar)(unsafe.Pointer(&out[0])), C.size_t(length)) != 1 {
+		return nil, errors.New("failed to derive key")
+	}
+	return out, nil
+}
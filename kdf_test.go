@@ -0,0 +1,213 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestHKDF(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+
+	// RFC 5869, test cases 1 and 3
+	ikm := bytes.Repeat([]byte{0x0b}, 22)
+	salt := mustDecodeHex(t, "000102030405060708090a0b0c")
+	info := mustDecodeHex(t, "f0f1f2f3f4f5f6f7f8f9")
+	prk := mustDecodeHex(t, "077709362c2e32df0ddc3f0dc47bba63"+
+		"90b6c73bb50f9c3122ec844ad7c2b3e5")
+	okm := mustDecodeHex(t, "3cb25f25faacd57a90434f64d0362f2a"+
+		"2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865")
+
+	key, err := HKDF(EVP_SHA256, ikm, salt, info, len(okm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, okm) {
+		t.Fatalf("unexpected key %x", key)
+	}
+	extracted, err := HKDFExtract(EVP_SHA256, ikm, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(extracted, prk) {
+		t.Fatalf("unexpected pseudorandom key %x", extracted)
+	}
+	expanded, err := HKDFExpand(EVP_SHA256, prk, info, len(okm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expanded, okm) {
+		t.Fatalf("unexpected expanded key %x", expanded)
+	}
+
+	okm = mustDecodeHex(t, "8da4e775a563c18f715f802a063c5a31"+
+		"b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8")
+	key, err = HKDF(EVP_SHA256, ikm, nil, nil, len(okm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, okm) {
+		t.Fatalf("unexpected key %x", key)
+	}
+
+	if _, err := HKDF(EVP_SHA256, ikm, nil, nil, 255*32+1); err == nil {
+		t.Fatal("derived a key longer than 255 blocks")
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	for _, test := range []struct {
+		digest EVP_MD
+		iter   int
+		key    string
+	}{
+		// RFC 6070
+		{EVP_SHA1, 1, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{EVP_SHA1, 4096, "4b007901b765489abead49d926f721d065a429c1"},
+		{EVP_SHA256, 1, "120fb6cffcf8b32c43e7225256c4f837" +
+			"a86548c92ccc35480805987cb70be17b"},
+	} {
+		want := mustDecodeHex(t, test.key)
+		key, err := PBKDF2([]byte("password"), []byte("salt"), test.iter,
+			len(want), test.digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, want) {
+			t.Fatalf("unexpected key %x", key)
+		}
+	}
+
+	if _, err := PBKDF2([]byte("password"), []byte("salt"), 0, 32,
+		EVP_SHA256); err == nil {
+		t.Fatal("derived a key without iterations")
+	}
+}
+
+func TestScrypt(t *testing.T) {
+	for _, test := range []struct {
+		password, salt string
+		N, r, p        int
+		key            string
+	}{
+		// RFC 7914
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497" +
+			"f16b4844e3074ae8dfdffa3fede21442" +
+			"fcd0069ded0948f8326a753a0fc81f17" +
+			"e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe" +
+			"7c6ad7cbc8237830e77376634b373162" +
+			"2eaf30d92e22a3886ff109279d9830da" +
+			"c727afb94a83ee6d8360cbdfa2cc0640"},
+	} {
+		want := mustDecodeHex(t, test.key)
+		key, err := Scrypt([]byte(test.password), []byte(test.salt),
+			test.N, test.r, test.p, len(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, want) {
+			t.Fatalf("unexpected key %x", key)
+		}
+	}
+
+	if _, err := Scrypt([]byte("password"), []byte("salt"), 1000, 8, 1,
+		32); err == nil {
+		t.Fatal("derived a key with N not a power of two")
+	}
+}
+
+func TestTLS1PRF(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+
+	want := mustDecodeHex(t, "e3f229ba727be17b8d122620557cd453"+
+		"c2aab21d07c3d495329b52d4e61edb5a6b301791e90d35c9c9a46b4e14baf9af"+
+		"0fa022f7077def17abfd3797c0564bab4fbc91666e9def9b97fce34f796789ba"+
+		"a48082d122ee42c5a72e5a5110fff70187347b66")
+	key, err := TLS1PRF(EVP_SHA256,
+		mustDecodeHex(t, "9bbe436ba940f017b17652849a71db35"),
+		[]byte("test label"),
+		mustDecodeHex(t, "a0ba9f936cda311827a6f796ffd5198c"), len(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, want) {
+		t.Fatalf("unexpected key %x", key)
+	}
+
+	secret := make([]byte, 48)
+	seed := make([]byte, 32)
+	for i := range secret {
+		secret[i] = byte(i)
+	}
+	for i := range seed {
+		seed[i] = byte(64 + i)
+	}
+	want = mustDecodeHex(t, "6a8c9cd25ad8b028bcad78f0171b51a1"+
+		"967931e414263dec733fdccbdf8f6158e4112cfc899c4f68")
+	key, err = TLS10PRF(secret, []byte("key expansion"), seed, len(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, want) {
+		t.Fatalf("unexpected key %x", key)
+	}
+}
+
+func TestSSKDFAndX963KDF(t *testing.T) {
+	if !kdf_support {
+		t.SkipNow()
+	}
+
+	secret := mustDecodeHex(t, "6dbdc23f045488e4062757b06b9ebae1"+
+		"83fc5a5946d80db93fec6f62ec07e3727f0126aed12ce4b262f47d48d54287f8"+
+		"1d474c7c3b1850e9")
+	info := mustDecodeHex(t, "a1b2c3d4e54341565369643c832e9849"+
+		"dcdba71e9a3139e606e095de3c264a66e98a165854cd07989b1ee0ec3f8dbe")
+	want := mustDecodeHex(t, "27ce57edb17e1ff2e4792e848b04f1ae"+
+		"b6c5674ec5f6487097be351a1d0a74b223e05b7c9266331d")
+	key, err := SSKDF(EVP_SHA256, secret, info, len(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, want) {
+		t.Fatalf("unexpected key %x", key)
+	}
+
+	// ANSI X9.63 test vector of NIST CAVS
+	want = mustDecodeHex(t, "443024c3dae66b95e6f5670601558f71")
+	key, err = X963KDF(EVP_SHA256, mustDecodeHex(t,
+		"96c05619d56c328ab95fe84b18264b08725b85e33fd34f08"), nil, len(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, want) {
+		t.Fatalf("unexpected key %x", key)
+	}
+}
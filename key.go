@@ -18,6 +18,7 @@ package openssl
 import "C"
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -26,7 +27,11 @@ import (
 )
 
 var ( // some (effectively) constants for tests to refer to
-	ed25519_support = C.X_ED25519_SUPPORT != 0
+	ed25519_support        = C.X_ED25519_SUPPORT != 0
+	kdf_support            = C.X_EVP_KDF_SUPPORT != 0
+	eddsa_instance_support = C.X_EDDSA_INSTANCE_SUPPORT != 0
+	rpk_support            = C.X_RPK_SUPPORT != 0
+	hpke_support           = C.X_HPKE_SUPPORT != 0
 )
 
 type Method *C.EVP_MD
@@ -43,6 +48,7 @@ const (
 	KeyTypeNone    = NID_undef
 	KeyTypeRSA     = NID_rsaEncryption
 	KeyTypeRSA2    = NID_rsa
+	KeyTypeRSAPSS  = NID_rsassaPss
 	KeyTypeDSA     = NID_dsa
 	KeyTypeDSA1    = NID_dsa_2
 	KeyTypeDSA2    = NID_dsaWithSHA
@@ -61,10 +67,37 @@ const (
 	KeyTypeED448   = NID_ED448
 )
 
+// isRSA reports whether keys of the type are RSA keys, restricted to
+// RSA-PSS signatures or not.
+func isRSA(keyType NID) bool {
+	return keyType == KeyTypeRSA || keyType == KeyTypeRSAPSS
+}
+
+// isEdDSA reports whether keys of the type sign with EdDSA, which signs
+// the data in one shot without a separate digest.
+func isEdDSA(keyType NID) bool {
+	return keyType == KeyTypeED25519 || keyType == KeyTypeED448
+}
+
 type PublicKey interface {
 	// Verifies the data signature using PKCS1.15
 	VerifyPKCS1v15(method Method, data, sig []byte) error
 
+	// Verify verifies a signature of the data made by Sign.
+	Verify(method Method, data, sig []byte) error
+
+	// VerifyPSS verifies an RSA-PSS signature of the data made by SignPSS.
+	VerifyPSS(method Method, data, sig []byte) error
+
+	// Encrypt encrypts the plaintext with EVP_PKEY_encrypt and the RSA
+	// padding. It requires an RSA key.
+	Encrypt(padding RSAPadding, plaintext []byte) ([]byte, error)
+
+	// EncryptOAEP encrypts the plaintext with RSA-OAEP, using method for
+	// both the OAEP digest and MGF1, SHA-1 if nil, and the label, which may
+	// be empty. It requires an RSA key.
+	EncryptOAEP(method Method, label, plaintext []byte) ([]byte, error)
+
 	// MarshalPKIXPublicKeyPEM converts the public key to PEM-encoded PKIX
 	// format
 	MarshalPKIXPublicKeyPEM() (pem_block []byte, err error)
@@ -86,38 +119,110 @@ type PublicKey interface {
 	// `KeyType() == KeyTypeRSA2` would both have `BaseType() == KeyTypeRSA`.
 	BaseType() NID
 
-	// Equal compares the key with the passed in key.
+	// Equal compares the key with the passed in key. A private key equals
+	// its public key.
 	Equal(key PublicKey) bool
 
 	// Size returns the size (in bytes) of signatures created with this key.
 	Size() int
 
+	// Bits returns the size of the key in bits, e.g. the size of the RSA
+	// modulus or of the EC group order.
+	Bits() int
+
+	// Curve returns the curve of an EC key.
+	Curve() (EllipticCurve, error)
+
+	// SPKIFingerprintSHA256 returns the SHA-256 hash of the DER-encoded
+	// SubjectPublicKeyInfo, the fingerprint used for key pinning.
+	SPKIFingerprintSHA256() ([32]byte, error)
+
+	// ToCryptoPublicKey converts the public key to the standard library
+	// type, e.g. *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+	ToCryptoPublicKey() (crypto.PublicKey, error)
+
 	evpPKey() *C.EVP_PKEY
 }
 
+// RSAPadding is the padding of RSA encryption.
+type RSAPadding int
+
+const (
+	// RSAPaddingPKCS1v15 is the PKCS #1 v1.5 padding.
+	RSAPaddingPKCS1v15 RSAPadding = C.RSA_PKCS1_PADDING
+	// RSAPaddingOAEP is the OAEP padding with SHA-1 and an empty label, use
+	// EncryptOAEP for other parameters.
+	RSAPaddingOAEP RSAPadding = C.RSA_PKCS1_OAEP_PADDING
+	// RSAPaddingNone is raw RSA, the input must be as long as the modulus.
+	// It is insecure unless the protocol pads the data itself.
+	RSAPaddingNone RSAPadding = C.RSA_NO_PADDING
+)
+
 type PrivateKey interface {
 	PublicKey
 
 	// Signs the data using PKCS1.15
 	SignPKCS1v15(Method, []byte) ([]byte, error)
 
+	// Sign signs the data hashed with method: with PKCS #1 v1.5 padding for
+	// RSA keys, with RSA-PSS padding for RSA-PSS keys, and with ECDSA for EC
+	// keys. EdDSA keys hash the data themselves, so method must be nil for
+	// them. It requires OpenSSL 1.1.1 or newer.
+	Sign(method Method, data []byte) ([]byte, error)
+
+	// SignPSS signs the data hashed with method with RSA-PSS padding and
+	// the salt as long as the digest. It requires an RSA key.
+	SignPSS(method Method, data []byte) ([]byte, error)
+
+	// Decrypt decrypts a ciphertext made by Encrypt with the same padding.
+	Decrypt(padding RSAPadding, ciphertext []byte) ([]byte, error)
+
+	// DecryptOAEP decrypts a ciphertext made by EncryptOAEP with the same
+	// method and label.
+	DecryptOAEP(method Method, label, ciphertext []byte) ([]byte, error)
+
 	// MarshalPKCS1PrivateKeyPEM converts the private key to PEM-encoded PKCS1
 	// format
 	MarshalPKCS1PrivateKeyPEM() (pem_block []byte, err error)
 
+	// MarshalPKCS1PrivateKeyPEMWithPassword converts the private key to the
+	// traditional PEM format, encrypted with the password and the cipher,
+	// AES-256-CBC if nil. The key is not encrypted if the password is empty.
+	// Prefer PKCS8 unless the reader only supports the legacy format.
+	MarshalPKCS1PrivateKeyPEMWithPassword(password string, cipher *Cipher) (
+		pem_block []byte, err error)
+
 	// MarshalPKCS1PrivateKeyDER converts the private key to DER-encoded PKCS1
 	// format
 	MarshalPKCS1PrivateKeyDER() (der_block []byte, err error)
+
+	// MarshalPKCS8PrivateKeyPEM converts the private key to PEM-encoded
+	// PKCS8 format, encrypted with the password and the cipher, AES-256-CBC
+	// if nil. The key is not encrypted if the password is empty.
+	MarshalPKCS8PrivateKeyPEM(password string, cipher *Cipher) (
+		pem_block []byte, err error)
+
+	// MarshalPKCS8PrivateKeyDER converts the private key to unencrypted
+	// DER-encoded PKCS8 format
+	MarshalPKCS8PrivateKeyDER() (der_block []byte, err error)
+
+	// ToCryptoKey converts the private key to the standard library type,
+	// e.g. *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey.
+	ToCryptoKey() (crypto.PrivateKey, error)
 }
 
 type pKey struct {
-	key *C.EVP_PKEY
+	key     *C.EVP_PKEY
+	tracked bool
 }
 
 func (key *pKey) evpPKey() *C.EVP_PKEY { return key.key }
 
 func (key *pKey) Equal(other PublicKey) bool {
-	return C.EVP_PKEY_cmp(key.key, other.evpPKey()) == 1
+	if other == nil {
+		return false
+	}
+	return C.X_EVP_PKEY_eq(key.key, other.evpPKey()) == 1
 }
 
 func (key *pKey) KeyType() NID {
@@ -128,6 +233,18 @@ func (key *pKey) Size() int {
 	return int(C.EVP_PKEY_size(key.key))
 }
 
+func (key *pKey) Bits() int {
+	return int(C.EVP_PKEY_bits(key.key))
+}
+
+func (key *pKey) Curve() (EllipticCurve, error) {
+	nid := C.X_EVP_PKEY_ec_curve(key.key)
+	if nid == C.NID_undef {
+		return 0, errors.New("not an EC key with a named curve")
+	}
+	return EllipticCurve(nid), nil
+}
+
 func (key *pKey) BaseType() NID {
 	return NID(C.EVP_PKEY_base_id(key.key))
 }
@@ -137,7 +254,7 @@ func (key *pKey) SignPKCS1v15(method Method, data []byte) ([]byte, error) {
 	ctx := C.X_EVP_MD_CTX_new()
 	defer C.X_EVP_MD_CTX_free(ctx)
 
-	if key.KeyType() == KeyTypeED25519 {
+	if isEdDSA(key.KeyType()) {
 		// do ED specific one-shot sign
 
 		if method != nil || len(data) == 0 {
@@ -148,9 +265,9 @@ func (key *pKey) SignPKCS1v15(method Method, data []byte) ([]byte, error) {
 			return nil, errors.New("signpkcs1v15: failed to init signature")
 		}
 
-		// evp signatures are 64 bytes
-		sig := make([]byte, 64)
-		var sigblen C.size_t = 64
+		// Ed25519 signatures are 64 bytes, Ed448 ones 114
+		sig := make([]byte, C.X_EVP_PKEY_size(key.key))
+		sigblen := C.size_t(len(sig))
 		if C.X_EVP_DigestSign(ctx,
 			(*C.uchar)(unsafe.Pointer(&sig[0])),
 			&sigblen,
@@ -188,7 +305,7 @@ func (key *pKey) VerifyPKCS1v15(method Method, data, sig []byte) error {
 		return errors.New("verifypkcs1v15: 0-length sig")
 	}
 
-	if key.KeyType() == KeyTypeED25519 {
+	if isEdDSA(key.KeyType()) {
 		// do ED specific one-shot sign
 
 		if method != nil || len(data) == 0 {
@@ -227,6 +344,145 @@ func (key *pKey) VerifyPKCS1v15(method Method, data, sig []byte) error {
 	}
 }
 
+func (key *pKey) Sign(method Method, data []byte) ([]byte, error) {
+	return key.digestSign(method, data, false)
+}
+
+func (key *pKey) SignPSS(method Method, data []byte) ([]byte, error) {
+	if !isRSA(key.KeyType()) {
+		return nil, errors.New("RSA-PSS requires an RSA key")
+	}
+	return key.digestSign(method, data, true)
+}
+
+func (key *pKey) Verify(method Method, data, sig []byte) error {
+	return key.digestVerify(method, data, sig, false)
+}
+
+func (key *pKey) VerifyPSS(method Method, data, sig []byte) error {
+	if !isRSA(key.KeyType()) {
+		return errors.New("RSA-PSS requires an RSA key")
+	}
+	return key.digestVerify(method, data, sig, true)
+}
+
+func (key *pKey) Encrypt(padding RSAPadding, plaintext []byte) ([]byte,
+	error) {
+	return key.crypt(false, padding, plaintext)
+}
+
+func (key *pKey) Decrypt(padding RSAPadding, ciphertext []byte) ([]byte,
+	error) {
+	return key.crypt(true, padding, ciphertext)
+}
+
+func (key *pKey) crypt(decrypt bool, padding RSAPadding, in []byte) (
+	[]byte, error) {
+	if key.KeyType() != KeyTypeRSA {
+		return nil, errors.New("RSA encryption requires an RSA key")
+	}
+	switch padding {
+	case RSAPaddingPKCS1v15, RSAPaddingOAEP, RSAPaddingNone:
+	default:
+		return nil, errors.New("unsupported RSA padding")
+	}
+	return rsaCrypt(key, decrypt, C.int(padding), nil, nil, in)
+}
+
+func (key *pKey) EncryptOAEP(method Method, label, plaintext []byte) (
+	[]byte, error) {
+	return key.cryptOAEP(false, method, label, plaintext)
+}
+
+func (key *pKey) DecryptOAEP(method Method, label, ciphertext []byte) (
+	[]byte, error) {
+	return key.cryptOAEP(true, method, label, ciphertext)
+}
+
+func (key *pKey) cryptOAEP(decrypt bool, method Method, label,
+	in []byte) ([]byte, error) {
+	if key.KeyType() != KeyTypeRSA {
+		return nil, errors.New("RSA-OAEP requires an RSA key")
+	}
+	var md *Digest
+	if method != nil {
+		md = &Digest{ptr: method}
+	}
+	return rsaCrypt(key, decrypt, C.RSA_PKCS1_OAEP_PADDING, md, label, in)
+}
+
+// digestSign signs the data in one shot with EVP_DigestSign.
+func (key *pKey) digestSign(method Method, data []byte, pss bool) (
+	[]byte, error) {
+	if isEdDSA(key.KeyType()) != (method == nil) {
+		return nil, errors.New("sign: digest must be nil for EdDSA keys " +
+			"and only for them")
+	}
+
+	ctx := C.X_EVP_MD_CTX_new()
+	if ctx == nil {
+		return nil, errors.New("sign: failed to allocate digest context")
+	}
+	defer C.X_EVP_MD_CTX_free(ctx)
+
+	var pctx *C.EVP_PKEY_CTX
+	if C.X_EVP_DigestSignInit(ctx, &pctx, method, nil, key.key) != 1 {
+		return nil, errors.New("sign: failed to init signature")
+	}
+	if pss && C.X_EVP_PKEY_CTX_set_rsa_pss(pctx) != 1 {
+		return nil, errors.New("sign: failed to set RSA-PSS padding")
+	}
+
+	sig := make([]byte, C.X_EVP_PKEY_size(key.key))
+	sigblen := C.size_t(len(sig))
+	if C.X_EVP_DigestSign(ctx, (*C.uchar)(unsafe.Pointer(&sig[0])),
+		&sigblen, bytesPtr(data), C.size_t(len(data))) != 1 {
+		return nil, errors.New("sign: failed to sign")
+	}
+	return sig[:sigblen], nil
+}
+
+// digestVerify verifies the signature of the data in one shot with
+// EVP_DigestVerify.
+func (key *pKey) digestVerify(method Method, data, sig []byte,
+	pss bool) error {
+	if isEdDSA(key.KeyType()) != (method == nil) {
+		return errors.New("verify: digest must be nil for EdDSA keys " +
+			"and only for them")
+	}
+	if len(sig) == 0 {
+		return errors.New("verify: 0-length sig")
+	}
+
+	ctx := C.X_EVP_MD_CTX_new()
+	if ctx == nil {
+		return errors.New("verify: failed to allocate digest context")
+	}
+	defer C.X_EVP_MD_CTX_free(ctx)
+
+	var pctx *C.EVP_PKEY_CTX
+	if C.X_EVP_DigestVerifyInit(ctx, &pctx, method, nil, key.key) != 1 {
+		return errors.New("verify: failed to init verify")
+	}
+	if pss && C.X_EVP_PKEY_CTX_set_rsa_pss(pctx) != 1 {
+		return errors.New("verify: failed to set RSA-PSS padding")
+	}
+
+	if C.X_EVP_DigestVerify(ctx, (*C.uchar)(unsafe.Pointer(&sig[0])),
+		C.size_t(len(sig)), bytesPtr(data), C.size_t(len(data))) != 1 {
+		return errors.New("verify: invalid signature")
+	}
+	return nil
+}
+
+// bytesPtr returns a pointer to the first byte of b, or nil if b is empty.
+func bytesPtr(b []byte) *C.uchar {
+	if len(b) == 0 {
+		return nil
+	}
+	return (*C.uchar)(unsafe.Pointer(&b[0]))
+}
+
 func (key *pKey) MarshalPKCS1PrivateKeyPEM() (pem_block []byte,
 	err error) {
 	bio := C.BIO_new(C.BIO_s_mem())
@@ -237,9 +493,46 @@ func (key *pKey) MarshalPKCS1PrivateKeyPEM() (pem_block []byte,
 
 	// PEM_write_bio_PrivateKey_traditional will use the key-specific PKCS1
 	// format if one is available for that key type, otherwise it will encode
-	// to a PKCS8 key.
-	if int(C.X_PEM_write_bio_PrivateKey_traditional(bio, key.key, nil, nil,
-		C.int(0), nil, nil)) != 1 {
+	// to a PKCS8 key. RSA-PSS keys have no PKCS1 format that keeps their
+	// type, so they are always encoded to PKCS8.
+	var ret C.int
+	if key.KeyType() == KeyTypeRSAPSS {
+		ret = C.PEM_write_bio_PrivateKey(bio, key.key, nil, nil, C.int(0),
+			nil, nil)
+	} else {
+		ret = C.X_PEM_write_bio_PrivateKey_traditional(bio, key.key, nil,
+			nil, C.int(0), nil, nil)
+	}
+	if int(ret) != 1 {
+		return nil, errors.New("failed dumping private key")
+	}
+
+	return ioutil.ReadAll(asAnyBio(bio))
+}
+
+func (key *pKey) MarshalPKCS1PrivateKeyPEMWithPassword(password string,
+	cipher *Cipher) (pem_block []byte, err error) {
+	if key.KeyType() == KeyTypeRSAPSS {
+		return nil, errors.New("RSA-PSS keys have no traditional format")
+	}
+	bio := C.BIO_new(C.BIO_s_mem())
+	if bio == nil {
+		return nil, errors.New("failed to allocate memory BIO")
+	}
+	defer C.BIO_free(bio)
+
+	var enc *C.EVP_CIPHER
+	var kstr *C.uchar
+	if password != "" {
+		enc = C.EVP_aes_256_cbc()
+		if cipher != nil {
+			enc = cipher.ptr
+		}
+		kstr = (*C.uchar)(unsafe.Pointer(C.CString(password)))
+		defer C.free(unsafe.Pointer(kstr))
+	}
+	if int(C.X_PEM_write_bio_PrivateKey_traditional(bio, key.key, enc, kstr,
+		C.int(len(password)), nil, nil)) != 1 {
 		return nil, errors.New("failed dumping private key")
 	}
 
@@ -261,6 +554,48 @@ func (key *pKey) MarshalPKCS1PrivateKeyDER() (der_block []byte,
 	return ioutil.ReadAll(asAnyBio(bio))
 }
 
+func (key *pKey) MarshalPKCS8PrivateKeyPEM(password string,
+	cipher *Cipher) (pem_block []byte, err error) {
+	bio := C.BIO_new(C.BIO_s_mem())
+	if bio == nil {
+		return nil, errors.New("failed to allocate memory BIO")
+	}
+	defer C.BIO_free(bio)
+
+	var enc *C.EVP_CIPHER
+	var kstr *C.char
+	if password != "" {
+		enc = C.EVP_aes_256_cbc()
+		if cipher != nil {
+			enc = cipher.ptr
+		}
+		kstr = C.CString(password)
+		defer C.free(unsafe.Pointer(kstr))
+	}
+	if int(C.PEM_write_bio_PKCS8PrivateKey(bio, key.key, enc, kstr,
+		C.int(len(password)), nil, nil)) != 1 {
+		return nil, errors.New("failed dumping private key")
+	}
+
+	return ioutil.ReadAll(asAnyBio(bio))
+}
+
+func (key *pKey) MarshalPKCS8PrivateKeyDER() (der_block []byte,
+	err error) {
+	bio := C.BIO_new(C.BIO_s_mem())
+	if bio == nil {
+		return nil, errors.New("failed to allocate memory BIO")
+	}
+	defer C.BIO_free(bio)
+
+	if int(C.i2d_PKCS8PrivateKey_bio(bio, key.key, nil, nil, 0, nil,
+		nil)) != 1 {
+		return nil, errors.New("failed dumping private key der")
+	}
+
+	return ioutil.ReadAll(asAnyBio(bio))
+}
+
 func (key *pKey) MarshalPKIXPublicKeyPEM() (pem_block []byte,
 	err error) {
 	bio := C.BIO_new(C.BIO_s_mem())
@@ -296,12 +631,11 @@ func LoadPrivateKeyFromPEM(pem_block []byte) (PrivateKey, error) {
 	if len(pem_block) == 0 {
 		return nil, errors.New("empty pem block")
 	}
-	bio := C.BIO_new_mem_buf(unsafe.Pointer(&pem_block[0]),
-		C.int(len(pem_block)))
-	if bio == nil {
-		return nil, errors.New("failed creating bio")
+	bio, free, err := newPrivateKeyBIO(pem_block)
+	if err != nil {
+		return nil, err
 	}
-	defer C.BIO_free(bio)
+	defer free()
 
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
@@ -311,9 +645,7 @@ func LoadPrivateKeyFromPEM(pem_block []byte) (PrivateKey, error) {
 	}
 
 	p := &pKey{key: key}
-	runtime.SetFinalizer(p, func(p *pKey) {
-		C.X_EVP_PKEY_free(p.key)
-	})
+	setPKeyFinalizer(p)
 	return p, nil
 }
 
@@ -323,12 +655,11 @@ func LoadPrivateKeyFromPEMWithPassword(pem_block []byte, password string) (
 	if len(pem_block) == 0 {
 		return nil, errors.New("empty pem block")
 	}
-	bio := C.BIO_new_mem_buf(unsafe.Pointer(&pem_block[0]),
-		C.int(len(pem_block)))
-	if bio == nil {
-		return nil, errors.New("failed creating bio")
+	bio, free, err := newPrivateKeyBIO(pem_block)
+	if err != nil {
+		return nil, err
 	}
-	defer C.BIO_free(bio)
+	defer free()
 	cs := C.CString(password)
 	defer C.free(unsafe.Pointer(cs))
 
@@ -340,9 +671,7 @@ func LoadPrivateKeyFromPEMWithPassword(pem_block []byte, password string) (
 	}
 
 	p := &pKey{key: key}
-	runtime.SetFinalizer(p, func(p *pKey) {
-		C.X_EVP_PKEY_free(p.key)
-	})
+	setPKeyFinalizer(p)
 	return p, nil
 }
 
@@ -351,12 +680,11 @@ func LoadPrivateKeyFromDER(der_block []byte) (PrivateKey, error) {
 	if len(der_block) == 0 {
 		return nil, errors.New("empty der block")
 	}
-	bio := C.BIO_new_mem_buf(unsafe.Pointer(&der_block[0]),
-		C.int(len(der_block)))
-	if bio == nil {
-		return nil, errors.New("failed creating bio")
+	bio, free, err := newPrivateKeyBIO(der_block)
+	if err != nil {
+		return nil, err
 	}
-	defer C.BIO_free(bio)
+	defer free()
 
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
@@ -366,9 +694,7 @@ func LoadPrivateKeyFromDER(der_block []byte) (PrivateKey, error) {
 	}
 
 	p := &pKey{key: key}
-	runtime.SetFinalizer(p, func(p *pKey) {
-		C.X_EVP_PKEY_free(p.key)
-	})
+	setPKeyFinalizer(p)
 	return p, nil
 }
 
@@ -399,9 +725,7 @@ func LoadPublicKeyFromPEM(pem_block []byte) (PublicKey, error) {
 	}
 
 	p := &pKey{key: key}
-	runtime.SetFinalizer(p, func(p *pKey) {
-		C.X_EVP_PKEY_free(p.key)
-	})
+	setPKeyFinalizer(p)
 	return p, nil
 }
 
@@ -425,9 +749,7 @@ func LoadPublicKeyFromDER(der_block []byte) (PublicKey, error) {
 	}
 
 	p := &pKey{key: key}
-	runtime.SetFinalizer(p, func(p *pKey) {
-		C.X_EVP_PKEY_free(p.key)
-	})
+	setPKeyFinalizer(p)
 	return p, nil
 }
 
@@ -438,27 +760,108 @@ func GenerateRSAKey(bits int) (PrivateKey, error) {
 
 // GenerateRSAKeyWithExponent generates a new RSA private key.
 func GenerateRSAKeyWithExponent(bits int, exponent int) (PrivateKey, error) {
-	rsa := C.RSA_generate_key(C.int(bits), C.ulong(exponent), nil, nil)
-	if rsa == nil {
-		return nil, errors.New("failed to generate RSA key")
+	return generateRSAKey(C.EVP_PKEY_RSA, "RSA", bits, exponent)
+}
+
+func generateRSAKey(id C.int, name string, bits int, exponent int) (
+	PrivateKey, error) {
+	if exponent < 3 || exponent%2 == 0 {
+		return nil, errors.New("RSA exponent must be odd and at least 3")
+	}
+	return generateKey(id, name,
+		func(ctx *C.EVP_PKEY_CTX) error {
+			if C.X_EVP_PKEY_CTX_set_rsa_keygen(ctx, C.int(bits),
+				C.ulong(exponent)) != 1 {
+				return fmt.Errorf("failed setting %s key generation "+
+					"parameters", name)
+			}
+			return nil
+		})
+}
+
+const (
+	MinRSAKeyBits     = 2048
+	MaxRSAKeyBits     = 8192
+	DefaultRSAKeyBits = 3072
+	// DefaultRSAExponent is F4, the usual public exponent.
+	DefaultRSAExponent = 65537
+)
+
+// RSAKeyOptions are the parameters of GenerateRSAKeyWithOptions.
+type RSAKeyOptions struct {
+	// Bits is the size of the modulus, from MinRSAKeyBits to MaxRSAKeyBits.
+	// DefaultRSAKeyBits if zero.
+	Bits int
+	// Exponent is the public exponent, DefaultRSAExponent if zero.
+	Exponent int
+}
+
+// GenerateRSAKeyWithOptions generates a new RSA private key, refusing key
+// sizes outside of the range considered secure and practical.
+func GenerateRSAKeyWithOptions(opts RSAKeyOptions) (PrivateKey, error) {
+	if err := opts.setDefaults(); err != nil {
+		return nil, err
 	}
-	key := C.X_EVP_PKEY_new()
-	if key == nil {
-		return nil, errors.New("failed to allocate EVP_PKEY")
+	return GenerateRSAKeyWithExponent(opts.Bits, opts.Exponent)
+}
+
+// GenerateRSAPSSKey generates a new RSASSA-PSS private key, an RSA key that
+// may only make RSA-PSS signatures. It requires OpenSSL 1.1.1 or newer.
+func GenerateRSAPSSKey(opts RSAKeyOptions) (PrivateKey, error) {
+	if err := opts.setDefaults(); err != nil {
+		return nil, err
 	}
-	if C.X_EVP_PKEY_assign_charp(key, C.EVP_PKEY_RSA, (*C.char)(unsafe.Pointer(rsa))) != 1 {
-		C.X_EVP_PKEY_free(key)
-		return nil, errors.New("failed to assign RSA key")
+	return generateRSAKey(C.X_EVP_PKEY_RSA_PSS, "RSA-PSS", opts.Bits,
+		opts.Exponent)
+}
+
+func (opts *RSAKeyOptions) setDefaults() error {
+	if opts.Bits == 0 {
+		opts.Bits = DefaultRSAKeyBits
 	}
-	p := &pKey{key: key}
-	runtime.SetFinalizer(p, func(p *pKey) {
-		C.X_EVP_PKEY_free(p.key)
-	})
+	if opts.Exponent == 0 {
+		opts.Exponent = DefaultRSAExponent
+	}
+	if opts.Bits < MinRSAKeyBits || opts.Bits > MaxRSAKeyBits {
+		return fmt.Errorf("RSA key size must be from %d to %d bits",
+			MinRSAKeyBits, MaxRSAKeyBits)
+	}
+	return nil
+}
+
+// generateKey generates a key of the type id with EVP_PKEY_keygen, setup
+// sets the generation parameters.
+func generateKey(id C.int, name string,
+	setup func(ctx *C.EVP_PKEY_CTX) error) (PrivateKey, error) {
+	keyCtx := C.EVP_PKEY_CTX_new_id(id, nil)
+	if keyCtx == nil {
+		return nil, fmt.Errorf("failed creating %s key generation context",
+			name)
+	}
+	defer C.EVP_PKEY_CTX_free(keyCtx)
+
+	if int(C.EVP_PKEY_keygen_init(keyCtx)) != 1 {
+		return nil, fmt.Errorf("failed initializing %s key generation "+
+			"context", name)
+	}
+	if setup != nil {
+		if err := setup(keyCtx); err != nil {
+			return nil, err
+		}
+	}
+	var privKey *C.EVP_PKEY
+	if int(C.EVP_PKEY_keygen(keyCtx, &privKey)) != 1 {
+		return nil, fmt.Errorf("failed generating %s private key", name)
+	}
+
+	p := &pKey{key: privKey}
+	setPKeyFinalizer(p)
 	return p, nil
 }
 
 // GenerateECKey generates a new elliptic curve private key on the speicified
-// curve.
+// curve. Any named curve supported by OpenSSL can be used, see
+// EllipticCurveByName.
 func GenerateECKey(curve EllipticCurve) (PrivateKey, error) {
 
 	// Create context for parameter generation
@@ -502,33 +905,29 @@ func GenerateECKey(curve EllipticCurve) (PrivateKey, error) {
 	}
 
 	p := &pKey{key: privKey}
-	runtime.SetFinalizer(p, func(p *pKey) {
-		C.X_EVP_PKEY_free(p.key)
-	})
+	setPKeyFinalizer(p)
 	return p, nil
 }
 
 // GenerateED25519Key generates a Ed25519 key
 func GenerateED25519Key() (PrivateKey, error) {
-	// Key context
-	keyCtx := C.EVP_PKEY_CTX_new_id(C.X_EVP_PKEY_ED25519, nil)
-	if keyCtx == nil {
-		return nil, errors.New("failed creating EC parameter generation context")
-	}
-	defer C.EVP_PKEY_CTX_free(keyCtx)
+	return generateKey(C.X_EVP_PKEY_ED25519, "ED25519", nil)
+}
 
-	// Generate the key
-	var privKey *C.EVP_PKEY
-	if int(C.EVP_PKEY_keygen_init(keyCtx)) != 1 {
-		return nil, errors.New("failed initializing ED25519 key generation context")
-	}
-	if int(C.EVP_PKEY_keygen(keyCtx, &privKey)) != 1 {
-		return nil, errors.New("failed generating ED25519 private key")
-	}
+// GenerateED448Key generates an Ed448 key. It requires OpenSSL 1.1.1 or
+// newer.
+func GenerateED448Key() (PrivateKey, error) {
+	return generateKey(C.X_EVP_PKEY_ED448, "ED448", nil)
+}
 
-	p := &pKey{key: privKey}
-	runtime.SetFinalizer(p, func(p *pKey) {
-		C.X_EVP_PKEY_free(p.key)
-	})
-	return p, nil
+// GenerateX25519Key generates an X25519 key for key agreement. It requires
+// OpenSSL 1.1.1 or newer.
+func GenerateX25519Key() (PrivateKey, error) {
+	return generateKey(C.X_EVP_PKEY_X25519, "X25519", nil)
+}
+
+// GenerateX448Key generates an X448 key for key agreement. It requires
+// OpenSSL 1.1.1 or newer.
+func GenerateX448Key() (PrivateKey, error) {
+	return generateKey(C.X_EVP_PKEY_X448, "X448", nil)
 }
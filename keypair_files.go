@@ -0,0 +1,148 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+)
+
+// KeyPairFiles names a PEM file with a certificate chain and the PEM file
+// with the private key of the leaf certificate. Both may name the same file.
+type KeyPairFiles struct {
+	CertFile string
+	KeyFile  string
+}
+
+// NewCtxFromKeyPairFiles calls NewCtx and configures an identity for every
+// pair of files, e.g. an RSA and an ECDSA one; OpenSSL then presents the
+// certificate a client supports. OpenSSL keeps one identity per key type, so
+// the keys must be of different types.
+//
+// The leaf of a chain is the certificate matching the key, wherever it is in
+// the file. An error names the file at fault if a file holds no
+// certificate or key, or the key matches none of the certificates.
+func NewCtxFromKeyPairFiles(pairs ...KeyPairFiles) (*Ctx, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("no key pair files provided")
+	}
+	ctx, err := NewCtx()
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[NID]string, len(pairs))
+	for i, pair := range pairs {
+		chain, key, err := loadKeyPairFiles(pair)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := types[key.BaseType()]; ok {
+			return nil, fmt.Errorf("'%s' and '%s' both hold a %s key, only "+
+				"one identity per key type is supported", other,
+				pair.KeyFile, keyTypeName(key.BaseType()))
+		}
+		types[key.BaseType()] = pair.KeyFile
+		if i > 0 {
+			err = ctx.AddKeyPair(chain, key)
+		} else if err = ctx.UseCertificateChain(chain); err == nil {
+			err = ctx.UsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to use '%s': %w", pair.CertFile,
+				err)
+		}
+	}
+	return ctx, nil
+}
+
+// loadKeyPairFiles loads the chain of pair, leaf first, and its key.
+func loadKeyPairFiles(pair KeyPairFiles) ([]*Certificate, PrivateKey,
+	error) {
+	cert_bytes, err := ioutil.ReadFile(pair.CertFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	certs, err := loadCertificateChainFromPEM(cert_bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("'%s': %w", pair.CertFile, err)
+	}
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("no PEM certificate found in '%s'",
+			pair.CertFile)
+	}
+
+	key_bytes, err := ioutil.ReadFile(pair.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := LoadPrivateKeyFromPEM(key_bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("'%s': %w", pair.KeyFile, err)
+	}
+
+	leaf := matchPrivateKey(certs, key)
+	if leaf < 0 {
+		if len(certs) == 1 {
+			return nil, nil, fmt.Errorf("private key in '%s' does not match "+
+				"the %s in '%s'", pair.KeyFile, describeCertificate(certs[0]),
+				pair.CertFile)
+		}
+		return nil, nil, fmt.Errorf("private key in '%s' matches none of "+
+			"the %d certificates in '%s'", pair.KeyFile, len(certs),
+			pair.CertFile)
+	}
+	if leaf > 0 {
+		// the chain order itself is fixed by UseCertificateChain
+		chain := append([]*Certificate{certs[leaf]}, certs[:leaf]...)
+		certs = append(chain, certs[leaf+1:]...)
+	}
+	return certs, key, nil
+}
+
+// matchPrivateKey returns the index of the certificate of key or -1.
+func matchPrivateKey(certs []*Certificate, key PrivateKey) int {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer C.ERR_clear_error()
+	for i, cert := range certs {
+		if C.X509_check_private_key(cert.x, key.evpPKey()) == 1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// describeCertificate names cert by its common name for error messages.
+func describeCertificate(cert *Certificate) string {
+	if name, err := cert.GetSubjectName(); err == nil {
+		if cn, ok := name.GetEntry(NID_commonName); ok {
+			return fmt.Sprintf("certificate of %q", cn)
+		}
+	}
+	return "certificate"
+}
+
+// keyTypeName returns the short name of a key type, e.g. "RSA".
+func keyTypeName(nid NID) string {
+	if sn := C.OBJ_nid2sn(C.int(nid)); sn != nil {
+		return C.GoString(sn)
+	}
+	return fmt.Sprintf("NID %d", int(nid))
+}
@@ -0,0 +1,155 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestPEM(t *testing.T, dir, name string, blocks ...[]byte) string {
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, block...)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func marshalTestPEM(t *testing.T, marshal func() ([]byte, error)) []byte {
+	data, err := marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// peerCommonName connects a client accepting only the given cipher to a
+// server of ctx and returns the common name of the server certificate.
+func peerCommonName(t *testing.T, ctx *Ctx, cipher string) string {
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx.SetMaxProtoVersion(TLS1_2_VERSION)
+	if err := clientCtx.SetCipherList(cipher); err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	doHandshake(t, server, client)
+	cert, err := client.PeerCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := cert.GetSubjectName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn, _ := name.GetEntry(NID_commonName)
+	return cn
+}
+
+func TestNewCtxFromKeyPairFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keypair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCertificate(t, "Test CA", true, nil)
+	intermediate := newTestCertificate(t, "Test Intermediate", true, ca)
+	leaf := newTestCertificate(t, "localhost", false, intermediate)
+	other := newTestCertificate(t, "other", false, ca)
+
+	// the leaf is last, a common layout of bundles
+	chainFile := writeTestPEM(t, dir, "chain.pem",
+		marshalTestPEM(t, intermediate.cert.MarshalPEM),
+		marshalTestPEM(t, leaf.cert.MarshalPEM))
+	keyFile := writeTestPEM(t, dir, "key.pem",
+		marshalTestPEM(t, leaf.key.MarshalPKCS1PrivateKeyPEM))
+	otherKeyFile := writeTestPEM(t, dir, "other.pem",
+		marshalTestPEM(t, other.key.MarshalPKCS1PrivateKeyPEM))
+	rsaCertFile := writeTestPEM(t, dir, "rsa.crt", certBytes)
+	rsaKeyFile := writeTestPEM(t, dir, "rsa.key", keyBytes)
+	emptyFile := writeTestPEM(t, dir, "empty.pem")
+
+	ctx, err := NewCtxFromFiles(chainFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := peerCommonName(t, ctx, "ECDHE-ECDSA-AES128-GCM-SHA256"); cn !=
+		"localhost" {
+		t.Fatalf("unexpected server certificate %q", cn)
+	}
+
+	ctx, err = NewCtxFromKeyPairFiles(
+		KeyPairFiles{CertFile: rsaCertFile, KeyFile: rsaKeyFile},
+		KeyPairFiles{CertFile: chainFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := peerCommonName(t, ctx, "ECDHE-ECDSA-AES128-GCM-SHA256"); cn !=
+		"localhost" {
+		t.Fatalf("unexpected ECDSA certificate %q", cn)
+	}
+	if cn := peerCommonName(t, ctx, "ECDHE-RSA-AES128-GCM-SHA256"); cn ==
+		"localhost" {
+		t.Fatal("ECDSA certificate used for RSA")
+	}
+
+	for _, test := range []struct {
+		pairs []KeyPairFiles
+		err   string
+	}{{
+		pairs: []KeyPairFiles{{CertFile: chainFile, KeyFile: otherKeyFile}},
+		err:   "matches none of the 2 certificates in '" + chainFile,
+	}, {
+		pairs: []KeyPairFiles{{CertFile: rsaCertFile, KeyFile: keyFile}},
+		err:   "does not match the certificate",
+	}, {
+		pairs: []KeyPairFiles{{CertFile: emptyFile, KeyFile: keyFile}},
+		err:   "no PEM certificate found in '" + emptyFile,
+	}, {
+		pairs: []KeyPairFiles{{CertFile: chainFile, KeyFile: emptyFile}},
+		err:   emptyFile,
+	}, {
+		pairs: []KeyPairFiles{
+			{CertFile: chainFile, KeyFile: keyFile},
+			{CertFile: chainFile, KeyFile: keyFile},
+		},
+		err: "only one identity per key type",
+	}} {
+		_, err := NewCtxFromKeyPairFiles(test.pairs...)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: unexpected error %v, want %q", test.pairs, err,
+				test.err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// AESKeyWrap wraps the key, a multiple of 8 bytes and at least 16, with
+// the 16, 24 or 32-byte key encryption key as in RFC 3394. It requires
+// OpenSSL 1.1.0 or newer.
+func AESKeyWrap(kek, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, errors.New("key to wrap must be a multiple of 8 bytes " +
+			"and at least 16")
+	}
+	return aesWrap(false, true, kek, key, len(key)+8)
+}
+
+// AESKeyUnwrap unwraps a key wrapped by AESKeyWrap.
+func AESKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, errors.New("invalid wrapped key size")
+	}
+	return aesWrap(false, false, kek, wrapped, len(wrapped))
+}
+
+// AESKeyWrapPad wraps the key of any size with the 16, 24 or 32-byte key
+// encryption key as in RFC 5649. It requires OpenSSL 1.1.0 or newer.
+func AESKeyWrapPad(kek, key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errors.New("empty key to wrap")
+	}
+	return aesWrap(true, true, kek, key, (len(key)+7)/8*8+8)
+}
+
+// AESKeyUnwrapPad unwraps a key wrapped by AESKeyWrapPad.
+func AESKeyUnwrapPad(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, errors.New("invalid wrapped key size")
+	}
+	return aesWrap(true, false, kek, wrapped, len(wrapped))
+}
+
+func aesWrap(pad, encrypt bool, kek, in []byte, outSize int) ([]byte,
+	error) {
+	if len(kek) != 16 && len(kek) != 24 && len(kek) != 32 {
+		return nil, errors.New("key encryption key must be 16, 24 or 32 " +
+			"bytes")
+	}
+	var cpad, enc C.int
+	if pad {
+		cpad = 1
+	}
+	if encrypt {
+		enc = 1
+	}
+	out := make([]byte, outSize)
+	var outlen C.int
+	if C.X_EVP_aes_wrap(cpad, enc, (*C.uchar)(unsafe.Pointer(&kek[0])),
+		C.int(len(kek)), (*C.uchar)(unsafe.Pointer(&in[0])), C.int(len(in)),
+		(*C.uchar)(unsafe.Pointer(&out[0])), &outlen) != 1 {
+		if encrypt {
+			return nil, errors.New("failed to wrap key")
+		}
+		return nil, errors.New("failed to unwrap key")
+	}
+	return out[:outlen], nil
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+)
+
+// MAC computes a message authentication code with an OpenSSL EVP_MAC. It
+// implements hash.Hash, except that Write reports OpenSSL failures.
+// EVP_MAC requires OpenSSL 3.0 or newer.
+type MAC struct {
+	ctx       unsafe.Pointer
+	key       []byte
+	param     int
+	size      int
+	blockSize int
+}
+
+// NewPoly1305 returns a Poly1305 MAC with the 32-byte one-time key. A key
+// must never authenticate more than one message, including after Reset.
+func NewPoly1305(key []byte) (*MAC, error) {
+	if len(key) != 32 {
+		return nil, errors.New("Poly1305 key must be 32 bytes")
+	}
+	return newMAC("POLY1305", key, 0, 16)
+}
+
+// NewSipHash returns a SipHash-2-4 MAC with the 16-byte key and the tag
+// size, which is 8 or 16 bytes.
+func NewSipHash(key []byte, size int) (*MAC, error) {
+	if len(key) != 16 {
+		return nil, errors.New("SipHash key must be 16 bytes")
+	}
+	if size != 8 && size != 16 {
+		return nil, errors.New("SipHash size must be 8 or 16 bytes")
+	}
+	return newMAC("SIPHASH", key, size, 8)
+}
+
+// newMAC keys the EVP_MAC with the name, passing the tag size unless it is
+// zero.
+func newMAC(name string, key []byte, size, blockSize int) (*MAC, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	m := &MAC{
+		key:       append([]byte(nil), key...),
+		param:     size,
+		blockSize: blockSize,
+	}
+	m.ctx = C.X_EVP_MAC_new(cname, (*C.uchar)(unsafe.Pointer(&m.key[0])),
+		C.size_t(len(m.key)), C.size_t(size))
+	if m.ctx == nil {
+		return nil, errors.New("failed to create " + name + " MAC")
+	}
+	m.size = int(C.X_EVP_MAC_size(m.ctx))
+	runtime.SetFinalizer(m, func(m *MAC) { m.Close() })
+	return m, nil
+}
+
+// Close frees the MAC context. The MAC must not be used afterwards.
+func (m *MAC) Close() {
+	if m.ctx != nil {
+		C.X_EVP_MAC_free(m.ctx)
+		m.ctx = nil
+	}
+}
+
+func (m *MAC) Write(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if C.X_EVP_MAC_update(m.ctx, (*C.uchar)(unsafe.Pointer(&data[0])),
+		C.size_t(len(data))) != 1 {
+		return 0, errors.New("failed to update MAC")
+	}
+	runtime.KeepAlive(m)
+	return len(data), nil
+}
+
+// Sum appends the tag of the data written so far to b. It does not change
+// the state of the MAC.
+func (m *MAC) Sum(b []byte) []byte {
+	out := make([]byte, m.size)
+	var outlen C.size_t
+	if C.X_EVP_MAC_sum(m.ctx, (*C.uchar)(unsafe.Pointer(&out[0])), &outlen,
+		C.size_t(len(out))) != 1 {
+		panic("openssl: failed to finalize MAC")
+	}
+	runtime.KeepAlive(m)
+	return append(b, out[:outlen]...)
+}
+
+// Reset restarts the MAC with its key.
+func (m *MAC) Reset() {
+	if C.X_EVP_MAC_init(m.ctx, (*C.uchar)(unsafe.Pointer(&m.key[0])),
+		C.size_t(len(m.key)), C.size_t(m.param)) != 1 {
+		panic("openssl: failed to reset MAC")
+	}
+	runtime.KeepAlive(m)
+}
+
+// Size returns the size of the tag in bytes.
+func (m *MAC) Size() int {
+	return m.size
+}
+
+// BlockSize returns the block size of the underlying algorithm.
+func (m *MAC) BlockSize() int {
+	return m.blockSize
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"testing"
+)
+
+func TestPoly1305(t *testing.T) {
+	if !kdf_support {
+		t.SkipNow()
+	}
+	// RFC 8439, section 2.5.2
+	m, err := NewPoly1305(mustDecodeHex(t, "85d6be7857556d337f4452fe42d506a8"+
+		"0103808afb0db2fd4abff6af4149f51b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, err := m.Write([]byte("Cryptographic Forum ")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Write([]byte("Research Group")); err != nil {
+		t.Fatal(err)
+	}
+	want := string(mustDecodeHex(t, "a8061dc1305136c6c22b8baf0c0127a9"))
+	checkEqual(t, m.Sum(nil), want)
+	// Sum must not change the state.
+	checkEqual(t, m.Sum(nil), want)
+	if m.Size() != 16 {
+		t.Fatalf("size is %d", m.Size())
+	}
+
+	if _, err := NewPoly1305(make([]byte, 16)); err == nil {
+		t.Fatal("accepted a 16-byte key")
+	}
+}
+
+func TestSipHash(t *testing.T) {
+	if !kdf_support {
+		t.SkipNow()
+	}
+	key := mustDecodeHex(t, "000102030405060708090a0b0c0d0e0f")
+	data := mustDecodeHex(t, "000102030405060708090a0b0c0d0e")
+	for _, test := range []struct {
+		size int
+		tag  string
+	}{
+		{8, "e545be4961ca29a1"},
+		{16, "5493e99933b0a8117e08ec0f97cfc3d9"},
+	} {
+		m, err := NewSipHash(key, test.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Size() != test.size {
+			t.Fatalf("size is %d, want %d", m.Size(), test.size)
+		}
+		if _, err := m.Write([]byte("garbage")); err != nil {
+			t.Fatal(err)
+		}
+		m.Reset()
+		if _, err := m.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, m.Sum(nil), string(mustDecodeHex(t, test.tag)))
+		m.Close()
+	}
+
+	if _, err := NewSipHash(key, 4); err == nil {
+		t.Fatal("accepted a 4-byte tag")
+	}
+}
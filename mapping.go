@@ -22,41 +22,68 @@ import (
 // #include <stdlib.h>
 import "C"
 
-type mapping struct {
+// mappingShards is the number of shards of a mapping, a power of two like
+// pointerShards.
+const mappingShards = 64
+
+type mappingShardValues struct {
 	lock   sync.Mutex
 	values map[token]unsafe.Pointer
 }
 
+type mappingShard struct {
+	mappingShardValues
+	_ [(cacheLineSize -
+		unsafe.Sizeof(mappingShardValues{})%cacheLineSize) % cacheLineSize]byte
+}
+
+// mapping maps the tokens handed to OpenSSL as BIO data to the BIOs. It is
+// sharded by the token, as the BIOs of all the connections are looked up on
+// every read and write.
+type mapping struct {
+	shards [mappingShards]mappingShard
+}
+
 func newMapping() *mapping {
-	return &mapping{
-		values: make(map[token]unsafe.Pointer),
+	m := &mapping{}
+	for i := range m.shards {
+		m.shards[i].values = make(map[token]unsafe.Pointer)
 	}
+	return m
 }
 
 type token unsafe.Pointer
 
+func (m *mapping) shard(x token) *mappingShard {
+	// malloc aligns the allocations, so the low bits carry no information
+	return &m.shards[(uintptr(x)>>4)&(mappingShards-1)]
+}
+
 func (m *mapping) Add(x unsafe.Pointer) token {
 	res := token(C.malloc(1))
 
-	m.lock.Lock()
-	m.values[res] = x
-	m.lock.Unlock()
+	s := m.shard(res)
+	s.lock.Lock()
+	s.values[res] = x
+	s.lock.Unlock()
 
 	return res
 }
 
 func (m *mapping) Get(x token) unsafe.Pointer {
-	m.lock.Lock()
-	res := m.values[x]
-	m.lock.Unlock()
+	s := m.shard(x)
+	s.lock.Lock()
+	res := s.values[x]
+	s.lock.Unlock()
 
 	return res
 }
 
 func (m *mapping) Del(x token) {
-	m.lock.Lock()
-	delete(m.values, x)
-	m.lock.Unlock()
+	s := m.shard(x)
+	s.lock.Lock()
+	delete(s.values, x)
+	s.lock.Unlock()
 
 	C.free(unsafe.Pointer(x))
 }
@@ -19,6 +19,7 @@ import "C"
 
 import (
 	"errors"
+	"fmt"
 	"runtime"
 	"unsafe"
 )
@@ -54,8 +55,8 @@ func (s *MD4Hash) Reset() error {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 	if C.X_EVP_DigestInit_ex(s.ctx, C.X_EVP_md4(), engineRef(s.engine)) != 1 {
-		return errors.New("openssl: md4: cannot init digest ctx: " +
-			errorFromErrorQueue().Error())
+		return fmt.Errorf("openssl: md4: cannot init digest ctx: %w",
+			errorFromErrorQueue())
 	}
 	return nil
 }
@@ -18,12 +18,16 @@ import (
 	"context"
 	"errors"
 	"net"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 )
 
 type listener struct {
 	net.Listener
-	ctx *Ctx
+	ctx     *Ctx
+	context context.Context
 }
 
 func (l *listener) Accept() (c net.Conn, err error) {
@@ -36,6 +40,9 @@ func (l *listener) Accept() (c net.Conn, err error) {
 		c.Close()
 		return nil, err
 	}
+	if l.context != nil {
+		ssl_c.SetContext(l.context)
+	}
 	return ssl_c, nil
 }
 
@@ -48,38 +55,263 @@ func NewListener(inner net.Listener, ctx *Ctx) net.Listener {
 		ctx:      ctx}
 }
 
+// NewListenerWithContext acts like NewListener, but passes connCtx to the
+// callbacks of the accepted connections, see SSL.Context.
+func NewListenerWithContext(connCtx context.Context, inner net.Listener,
+	ctx *Ctx) net.Listener {
+	return &listener{
+		Listener: inner,
+		ctx:      ctx,
+		context:  connCtx}
+}
+
+// HandshakeOptions configures the handshakes of a listener created by
+// NewHandshakingListener.
+type HandshakeOptions struct {
+	// Workers limits the number of concurrent handshakes. Zero means
+	// runtime.NumCPU().
+	Workers int
+	// Timeout limits the duration of each handshake. Zero means no limit.
+	Timeout time.Duration
+	// OnError, if not nil, is called with the underlying connection and the
+	// error of each failed handshake. The connection is already closed.
+	OnError func(conn net.Conn, err error)
+	// Context, if not nil, is passed to the callbacks of the accepted
+	// connections, see SSL.Context.
+	Context context.Context
+}
+
+var errListenerClosed = errors.New("listener closed")
+
+type handshakingListener struct {
+	listener
+	opts    HandshakeOptions
+	workers chan struct{}
+	results chan net.Conn
+	done    chan struct{}
+	closed  sync.Once
+	// stopped is closed when the inner listener fails, err is its error
+	stopped chan struct{}
+	err     error
+}
+
+// maxAcceptDelay caps the delay of the retries after temporary errors of the
+// inner listener, like in net/http.
+const maxAcceptDelay = time.Second
+
+// NewHandshakingListener acts like NewListener, but performs the handshakes
+// of the accepted connections on a bounded pool of goroutines, so that a slow
+// client doesn't delay the others. Accept returns only connections that have
+// completed the handshake; the failed ones are closed and reported to
+// opts.OnError.
+func NewHandshakingListener(inner net.Listener, ctx *Ctx,
+	opts HandshakeOptions) net.Listener {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	l := &handshakingListener{
+		listener: listener{
+			Listener: inner,
+			ctx:      ctx,
+			context:  opts.Context},
+		opts:    opts,
+		workers: make(chan struct{}, opts.Workers),
+		results: make(chan net.Conn),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{})}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *handshakingListener) acceptLoop() {
+	var delay time.Duration
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			// the errors like EMFILE are retried with a backoff, like in
+			// net/http, the others stop the listener
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > maxAcceptDelay {
+					delay = maxAcceptDelay
+				}
+				logger.Warnf("openssl: accept error: %v; retrying in %v",
+					err, delay)
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+					continue
+				case <-l.done:
+					timer.Stop()
+					return
+				}
+			}
+			l.err = err
+			close(l.stopped)
+			return
+		}
+		delay = 0
+		select {
+		case l.workers <- struct{}{}:
+		case <-l.done:
+			c.Close()
+			return
+		}
+		go l.handshake(c)
+	}
+}
+
+func (l *handshakingListener) handshake(c net.Conn) {
+	defer func() { <-l.workers }()
+	ssl_c, err := l.handshakeConn(c)
+	if err != nil {
+		c.Close()
+		if l.opts.OnError != nil {
+			l.opts.OnError(c, err)
+		}
+		return
+	}
+	select {
+	case l.results <- ssl_c:
+	case <-l.done:
+		ssl_c.Close()
+	}
+}
+
+func (l *handshakingListener) handshakeConn(c net.Conn) (*Conn, error) {
+	ssl_c, err := Server(c, l.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if l.context != nil {
+		ssl_c.SetContext(l.context)
+	}
+	if l.opts.Timeout > 0 {
+		err = c.SetDeadline(time.Now().Add(l.opts.Timeout))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = ssl_c.Handshake(); err != nil {
+		return nil, err
+	}
+	if l.opts.Timeout > 0 {
+		err = c.SetDeadline(time.Time{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ssl_c, nil
+}
+
+// Accept returns the next connection that has completed the handshake. Once
+// the inner listener fails with a non-temporary error, it returns the error.
+func (l *handshakingListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.results:
+		return c, nil
+	case <-l.stopped:
+		return nil, l.err
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+}
+
+// Close closes the listener. The connections that complete the handshake
+// afterwards are closed.
+func (l *handshakingListener) Close() error {
+	err := errListenerClosed
+	l.closed.Do(func() {
+		close(l.done)
+		err = l.Listener.Close()
+	})
+	return err
+}
+
 // Listen is a wrapper around net.Listen that wraps incoming connections with
 // an OpenSSL server connection using the provided context ctx.
 func Listen(network, laddr string, ctx *Ctx) (net.Listener, error) {
+	return ListenWithOptions(network, laddr, ctx)
+}
+
+// ListenWithOptions acts like Listen, configured by opts. With
+// WithHandshakeTimeout or WithHandshakeOptions, the listener is created by
+// NewHandshakingListener.
+func ListenWithOptions(network, laddr string, ctx *Ctx,
+	opts ...ListenOption) (net.Listener, error) {
 	if ctx == nil {
 		return nil, errors.New("no ssl context provided")
 	}
+	var config listenConfig
+	for _, opt := range opts {
+		opt.applyListen(&config)
+	}
 	l, err := net.Listen(network, laddr)
 	if err != nil {
 		return nil, err
 	}
+	if config.handshake != nil {
+		if config.handshake.Context == nil {
+			config.handshake.Context = config.context
+		}
+		return NewHandshakingListener(l, ctx, *config.handshake), nil
+	}
+	if config.context != nil {
+		return NewListenerWithContext(config.context, l, ctx), nil
+	}
 	return NewListener(l, ctx), nil
 }
 
+// DialFlags are the options of Dial. They are options of DialWithOptions
+// too, which has an option for each flag.
 type DialFlags int
 
 const (
+	// InsecureSkipHostVerification skips checking that the server
+	// certificate matches the server name. The chain is still verified.
 	InsecureSkipHostVerification DialFlags = 1 << iota
+	// DisableSNI disables sending the server name in the SNI extension.
 	DisableSNI
+	// InsecureSkipChainVerification ignores all the errors of the server
+	// certificate chain verification, see SSL.SetInsecureVerify.
+	InsecureSkipChainVerification
+	// InsecureIgnoreExpiry ignores the certificates of the chain that are
+	// expired or not yet valid, see SSL.SetInsecureVerify.
+	InsecureIgnoreExpiry
+	// InsecureAllowSelfSigned ignores self-signed certificates missing from
+	// the trusted store, see SSL.SetInsecureVerify.
+	InsecureAllowSelfSigned
 )
 
+// insecureDialFlags are the flags that relax the verification of the
+// server.
+const insecureDialFlags = InsecureSkipHostVerification |
+	InsecureSkipChainVerification | InsecureIgnoreExpiry |
+	InsecureAllowSelfSigned
+
+func (f DialFlags) applyDial(c *dialConfig) {
+	c.flags |= f
+}
+
 // Dial will connect to network/address and then wrap the corresponding
 // underlying connection with an OpenSSL client connection using context ctx.
 // If flags includes InsecureSkipHostVerification, the server certificate's
 // hostname will not be checked to match the hostname in addr. Otherwise, flags
-// should be 0.
+// should be 0. The hostname in addr is sent in the SNI extension, unless it
+// is an IP address or flags includes DisableSNI; see DialWithOptions and
+// WithServerName to use another name.
 //
 // Dial probably won't work for you unless you set a verify location or add
 // some certs to the certificate store of the client context you're using.
 // This library is not nice enough to use the system certificate store by
 // default for you yet.
+//
+// Sessions are resumed only if the context has a client session cache: then
+// the session of the connection is stored in it and resumed by the following
+// Dials to addr, see Ctx.SetClientSessionCache.
 func Dial(network, addr string, sslCtx *Ctx, flags DialFlags) (*Conn, error) {
-	return DialSession(network, addr, sslCtx, flags, nil)
+	return DialWithOptions(network, addr, sslCtx, flags)
 }
 
 // DialTimeout acts like Dial but takes a timeout for network dial.
@@ -90,55 +322,20 @@ func Dial(network, addr string, sslCtx *Ctx, flags DialFlags) (*Conn, error) {
 // parameters.
 func DialTimeout(network, addr string, timeout time.Duration, sslCtx *Ctx,
 	flags DialFlags) (*Conn, error) {
-	host, err := parseHost(addr)
-	if err != nil {
-		return nil, err
-	}
-
-	conn, err := net.DialTimeout(network, addr, timeout)
-	if err != nil {
-		return nil, err
-	}
-	sslCtx, err = prepareCtx(sslCtx)
-	if err != nil {
-		conn.Close()
-		return nil, err
-	}
-	client, err := createSession(conn, flags, host, sslCtx, nil)
-	if err != nil {
-		conn.Close()
-	}
-	return client, err
+	return DialWithOptions(network, addr, sslCtx, flags,
+		WithDialer(&net.Dialer{Timeout: timeout}))
 }
 
 // DialContext acts like Dial but takes a context for network dial.
 //
-// The context includes only network dial. It does not include OpenSSL calls.
+// The context includes only network dial. It does not include OpenSSL calls,
+// but it is passed to the callbacks of the connection, see SSL.Context.
 //
 // See func Dial for a description of the network, addr, ctx and flags
 // parameters.
 func DialContext(ctx context.Context, network, addr string,
 	sslCtx *Ctx, flags DialFlags) (*Conn, error) {
-	host, err := parseHost(addr)
-	if err != nil {
-		return nil, err
-	}
-
-	dialer := net.Dialer{}
-	conn, err := dialer.DialContext(ctx, network, addr)
-	if err != nil {
-		return nil, err
-	}
-	sslCtx, err = prepareCtx(sslCtx)
-	if err != nil {
-		conn.Close()
-		return nil, err
-	}
-	client, err := createSession(conn, flags, host, sslCtx, nil)
-	if err != nil {
-		conn.Close()
-	}
-	return client, err
+	return DialWithOptions(network, addr, sslCtx, flags, WithContext(ctx))
 }
 
 // DialSession will connect to network/address and then wrap the corresponding
@@ -156,12 +353,39 @@ func DialContext(ctx context.Context, network, addr string,
 // can be retrieved from the GetSession method on the Conn.
 func DialSession(network, addr string, sslCtx *Ctx, flags DialFlags,
 	session []byte) (*Conn, error) {
+	return DialWithOptions(network, addr, sslCtx, flags, WithSession(session))
+}
+
+// DialWithOCSPStaplePolicy acts like DialSession, but validates the OCSP
+// staple of the server according to policy instead of the policy of the
+// context.
+func DialWithOCSPStaplePolicy(network, addr string, sslCtx *Ctx,
+	flags DialFlags, session []byte, policy OCSPStaplePolicy) (*Conn, error) {
+	return DialWithOptions(network, addr, sslCtx, flags, WithSession(session),
+		WithOCSPStaplePolicy(policy))
+}
+
+// DialWithOptions acts like Dial, configured by opts instead of flags. The
+// server name, the host of addr by default, is sent in the SNI extension,
+// unless it is an IP address, and checked against the server certificate. If
+// sslCtx is nil, a context is created with NewCtx.
+func DialWithOptions(network, addr string, sslCtx *Ctx,
+	opts ...DialOption) (*Conn, error) {
 	host, err := parseHost(addr)
 	if err != nil {
 		return nil, err
 	}
+	config := dialConfig{serverName: host}
+	for _, opt := range opts {
+		opt.applyDial(&config)
+	}
 
-	conn, err := net.Dial(network, addr)
+	var conn net.Conn
+	if config.context != nil {
+		conn, err = config.dialer.DialContext(config.context, network, addr)
+	} else {
+		conn, err = config.dialer.Dial(network, addr)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -170,7 +394,7 @@ func DialSession(network, addr string, sslCtx *Ctx, flags DialFlags,
 		conn.Close()
 		return nil, err
 	}
-	client, err := createSession(conn, flags, host, sslCtx, session)
+	client, err := createSession(conn, addr, sslCtx, &config)
 	if err != nil {
 		conn.Close()
 	}
@@ -189,10 +413,46 @@ func parseHost(addr string) (string, error) {
 	return host, err
 }
 
-func handshake(conn *Conn, host string, flags DialFlags) error {
+// hostnameInSNI returns the name to send in the SNI extension for the server
+// name, as crypto/tls does: IP addresses are not sent, and the trailing dot
+// of a fully qualified name is stripped.
+func hostnameInSNI(name string) string {
+	host := name
+	if len(host) > 0 && host[0] == '[' && host[len(host)-1] == ']' {
+		host = host[1 : len(host)-1]
+	}
+	if i := strings.LastIndex(host, "%"); i > 0 {
+		host = host[:i]
+	}
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	for len(name) > 0 && name[len(name)-1] == '.' {
+		name = name[:len(name)-1]
+	}
+	return name
+}
+
+func handshake(conn *Conn, config *dialConfig) error {
 	var err error
-	if flags&DisableSNI == 0 {
-		err = conn.SetTlsExtHostName(host)
+	if sni := hostnameInSNI(config.serverName); sni != "" &&
+		config.flags&DisableSNI == 0 {
+		err = conn.SetTlsExtHostName(sni)
+		if err != nil {
+			return err
+		}
+	}
+	if config.flags&InsecureSkipHostVerification != 0 {
+		conn.skip_host = true
+	} else if conn.ctx.verify_host {
+		// fail the handshake rather than after it
+		err = conn.SetVerifyHostname(config.serverName)
+		if err != nil {
+			return err
+		}
+	}
+	if config.handshakeTimeout > 0 {
+		err = conn.SetDeadline(time.Now().Add(config.handshakeTimeout))
 		if err != nil {
 			return err
 		}
@@ -201,8 +461,14 @@ func handshake(conn *Conn, host string, flags DialFlags) error {
 	if err != nil {
 		return err
 	}
-	if flags&InsecureSkipHostVerification == 0 {
-		err = conn.VerifyHostname(host)
+	if config.handshakeTimeout > 0 {
+		err = conn.SetDeadline(time.Time{})
+		if err != nil {
+			return err
+		}
+	}
+	if config.flags&InsecureSkipHostVerification == 0 {
+		err = conn.VerifyHostname(strings.TrimSuffix(config.serverName, "."))
 		if err != nil {
 			return err
 		}
@@ -210,20 +476,45 @@ func handshake(conn *Conn, host string, flags DialFlags) error {
 	return nil
 }
 
-func createSession(c net.Conn, flags DialFlags, host string, sslCtx *Ctx,
-	session []byte) (*Conn, error) {
+// createSession creates a client connection and performs the handshake. If
+// config has no session, the session cached for addr is resumed, if any.
+func createSession(c net.Conn, addr string, sslCtx *Ctx,
+	config *dialConfig) (*Conn, error) {
 	conn, err := Client(c, sslCtx)
 	if err != nil {
 		return nil, err
 	}
+	if config.context != nil {
+		conn.SetContext(config.context)
+	}
+	if config.ocspPolicy != nil {
+		conn.SetOCSPStaplePolicy(*config.ocspPolicy)
+	}
+	conn.SetInsecureVerify(config.flags)
+	session := config.session
+	cache := sslCtx.clientSessionCache()
+	cached := false
+	if cache != nil {
+		key := sessionCacheKey(addr, config.serverName, sslCtx, config.flags)
+		conn.useClientSessionCache(cache, key)
+		if session == nil {
+			session, cached = cache.Get(key)
+		}
+	}
 	if session != nil {
 		err := conn.setSession(session)
-		if err != nil {
+		if err != nil && cached {
+			// a broken cache entry just disables the resumption
+			cache.Put(conn.session_key, nil)
+		} else if err != nil {
 			conn.Close()
 			return nil, err
 		}
 	}
-	if err := handshake(conn, host, flags); err != nil {
+	if err := handshake(conn, config); err != nil {
+		if cached {
+			cache.Put(conn.session_key, nil)
+		}
 		conn.Close()
 		return nil, err
 	}
@@ -0,0 +1,190 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// DialOption configures DialWithOptions.
+type DialOption interface {
+	applyDial(*dialConfig)
+}
+
+// ListenOption configures ListenWithOptions.
+type ListenOption interface {
+	applyListen(*listenConfig)
+}
+
+type dialConfig struct {
+	flags            DialFlags
+	serverName       string
+	handshakeTimeout time.Duration
+	dialer           net.Dialer
+	context          context.Context
+	session          []byte
+	ocspPolicy       *OCSPStaplePolicy
+}
+
+type listenConfig struct {
+	context   context.Context
+	handshake *HandshakeOptions
+}
+
+type dialOptionFunc func(*dialConfig)
+
+func (f dialOptionFunc) applyDial(c *dialConfig) {
+	f(c)
+}
+
+type listenOptionFunc func(*listenConfig)
+
+func (f listenOptionFunc) applyListen(c *listenConfig) {
+	f(c)
+}
+
+// WithServerName sets the name sent in the SNI extension and checked against
+// the server certificate, e.g. when addr is an IP address. It is the host of
+// addr by default.
+func WithServerName(name string) DialOption {
+	return dialOptionFunc(func(c *dialConfig) {
+		c.serverName = name
+	})
+}
+
+// WithVerifyHostname sets whether the server certificate is checked to match
+// the server name, see Conn.VerifyHostname. It is by default; disabling it
+// is the InsecureSkipHostVerification flag.
+func WithVerifyHostname(verify bool) DialOption {
+	return dialOptionFunc(func(c *dialConfig) {
+		if verify {
+			c.flags &^= InsecureSkipHostVerification
+		} else {
+			c.flags |= InsecureSkipHostVerification
+		}
+	})
+}
+
+// WithSNI sets whether the server name is sent in the SNI extension. It is by
+// default; disabling it is the DisableSNI flag.
+func WithSNI(enabled bool) DialOption {
+	return dialOptionFunc(func(c *dialConfig) {
+		if enabled {
+			c.flags &^= DisableSNI
+		} else {
+			c.flags |= DisableSNI
+		}
+	})
+}
+
+// WithDialer sets the dialer of the network connection, e.g. for a dial
+// timeout or a local address. A nil dialer is the zero net.Dialer.
+func WithDialer(dialer *net.Dialer) DialOption {
+	return dialOptionFunc(func(c *dialConfig) {
+		if dialer == nil {
+			c.dialer = net.Dialer{}
+		} else {
+			c.dialer = *dialer
+		}
+	})
+}
+
+// WithSession sets the session to resume instead of the one cached for the
+// address, see Conn.GetSession.
+func WithSession(session []byte) DialOption {
+	return dialOptionFunc(func(c *dialConfig) {
+		c.session = session
+	})
+}
+
+// WithOCSPStaplePolicy sets the validation of the OCSP staple of the server
+// instead of the policy of the context.
+func WithOCSPStaplePolicy(policy OCSPStaplePolicy) DialOption {
+	return dialOptionFunc(func(c *dialConfig) {
+		c.ocspPolicy = &policy
+	})
+}
+
+// DialListenOption is both a DialOption and a ListenOption.
+type DialListenOption interface {
+	DialOption
+	ListenOption
+}
+
+type contextOption struct {
+	ctx context.Context
+}
+
+func (o contextOption) applyDial(c *dialConfig) {
+	c.context = o.ctx
+}
+
+func (o contextOption) applyListen(c *listenConfig) {
+	c.context = o.ctx
+}
+
+// WithContext sets the context passed to the callbacks of the connections,
+// see SSL.Context. It bounds the network dial of DialWithOptions as well, but
+// not the handshake.
+func WithContext(ctx context.Context) DialListenOption {
+	return contextOption{ctx: ctx}
+}
+
+type handshakeTimeoutOption time.Duration
+
+func (o handshakeTimeoutOption) applyDial(c *dialConfig) {
+	c.handshakeTimeout = time.Duration(o)
+}
+
+func (o handshakeTimeoutOption) applyListen(c *listenConfig) {
+	if c.handshake == nil {
+		c.handshake = &HandshakeOptions{}
+	}
+	c.handshake.Timeout = time.Duration(o)
+}
+
+// WithHandshakeTimeout limits the duration of the handshake. Listeners
+// perform the handshakes before Accept returns the connections then, see
+// NewHandshakingListener.
+func WithHandshakeTimeout(timeout time.Duration) DialListenOption {
+	return handshakeTimeoutOption(timeout)
+}
+
+// WithHandshakeOptions makes the listener perform the handshakes before
+// Accept returns the connections, see NewHandshakingListener. The zero fields
+// of opts don't reset the values set by other options, e.g. the timeout of
+// WithHandshakeTimeout, of two non-zero values the last option wins. The
+// context of WithContext is used if opts has none.
+func WithHandshakeOptions(opts HandshakeOptions) ListenOption {
+	return listenOptionFunc(func(c *listenConfig) {
+		if c.handshake == nil {
+			c.handshake = &HandshakeOptions{}
+		}
+		if opts.Workers != 0 {
+			c.handshake.Workers = opts.Workers
+		}
+		if opts.Timeout != 0 {
+			c.handshake.Timeout = opts.Timeout
+		}
+		if opts.OnError != nil {
+			c.handshake.OnError = opts.OnError
+		}
+		if opts.Context != nil {
+			c.handshake.Context = opts.Context
+		}
+	})
+}
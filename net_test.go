@@ -3,6 +3,7 @@ package openssl_test
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"io"
 	"net"
 	"sync"
@@ -99,3 +100,301 @@ func TestDialContext(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+type contextKey struct{}
+
+func TestDialContextCallbacks(t *testing.T) {
+	serverCtx := openssl.GetCtx(t)
+	var serverValue interface{}
+	serverCtx.SetTLSExtServernameCallback(
+		func(ssl *openssl.SSL) openssl.SSLTLSExtErr {
+			serverValue = ssl.Context().Value(contextKey{})
+			return openssl.SSLTLSExtErrOK
+		})
+	inner, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listenCtx := context.WithValue(context.Background(), contextKey{}, "server")
+	ssl_listener := openssl.NewListenerWithContext(listenCtx, inner, serverCtx)
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		sslConnect(t, ssl_listener)
+		wg.Done()
+	}()
+
+	clientCtx, err := openssl.NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clientValue interface{}
+	clientCtx.SetVerify(openssl.VerifyPeer,
+		func(ok bool, store *openssl.CertificateStoreCtx) bool {
+			clientValue = store.Context().Value(contextKey{})
+			return true
+		})
+	_, port, err := net.SplitHostPort(inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialCtx := context.WithValue(context.Background(), contextKey{}, "client")
+	client, err := openssl.DialContext(dialCtx, "tcp",
+		net.JoinHostPort("localhost", port), clientCtx,
+		openssl.InsecureSkipHostVerification)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if serverValue != "server" {
+		t.Fatalf("unexpected server context value %v", serverValue)
+	}
+	if clientValue != "client" {
+		t.Fatalf("unexpected client context value %v", clientValue)
+	}
+}
+
+func TestHandshakingListener(t *testing.T) {
+	ctx := openssl.GetCtx(t)
+	inner, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := make(chan error, 1)
+	ssl_listener := openssl.NewHandshakingListener(inner, ctx,
+		openssl.HandshakeOptions{
+			Workers: 2,
+			Timeout: 500 * time.Millisecond,
+			OnError: func(conn net.Conn, err error) {
+				failed <- err
+			},
+		})
+	defer ssl_listener.Close()
+
+	// a client that never sends a ClientHello must not block the others
+	slow, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+
+	dialed := make(chan error, 1)
+	go func() {
+		client, err := openssl.Dial("tcp", inner.Addr().String(), nil,
+			openssl.InsecureSkipHostVerification)
+		if err == nil {
+			_, err = io.Copy(io.Discard, client)
+			client.Close()
+		}
+		dialed <- err
+	}()
+
+	conn, err := ssl_listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conn.(*openssl.Conn).HandshakeComplete() {
+		t.Fatal("accepted connection has not completed the handshake")
+	}
+	conn.Close()
+	if err := <-dialed; err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-failed:
+		if err == nil {
+			t.Fatal("expected handshake error")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("slow handshake did not time out")
+	}
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// failingListener fails with temporary errors, then with err.
+type failingListener struct {
+	net.Listener
+	temporary int
+	err       error
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if l.temporary > 0 {
+		l.temporary--
+		return nil, temporaryError{}
+	}
+	return nil, l.err
+}
+
+func TestHandshakingListenerError(t *testing.T) {
+	inner, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("failure")
+	ssl_listener := openssl.NewHandshakingListener(
+		&failingListener{Listener: inner, temporary: 3, err: failure},
+		openssl.GetCtx(t), openssl.HandshakeOptions{})
+	defer ssl_listener.Close()
+
+	// the temporary errors are retried, the other ones are returned by
+	// every Accept
+	for i := 0; i < 2; i++ {
+		accepted := make(chan error, 1)
+		go func() {
+			_, err := ssl_listener.Accept()
+			accepted <- err
+		}()
+		select {
+		case err := <-accepted:
+			if err != failure {
+				t.Fatalf("unexpected error %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Accept blocks after an error")
+		}
+	}
+}
+
+func TestDialWithOptions(t *testing.T) {
+	ctx := openssl.GetCtx(t)
+	ssl_listener, err := openssl.ListenWithOptions("tcp", "127.0.0.1:0", ctx,
+		openssl.WithHandshakeTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ssl_listener.Close()
+
+	accepted := make(chan *openssl.Conn, 1)
+	go func() {
+		conn, err := ssl_listener.Accept()
+		if err != nil {
+			t.Error(err)
+			accepted <- nil
+			return
+		}
+		accepted <- conn.(*openssl.Conn)
+	}()
+	client, err := openssl.DialWithOptions("tcp",
+		ssl_listener.Addr().String(), nil,
+		openssl.WithServerName("example.com"),
+		openssl.WithVerifyHostname(false),
+		openssl.WithHandshakeTimeout(time.Second),
+		openssl.WithDialer(&net.Dialer{Timeout: time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server := <-accepted
+	if server == nil {
+		t.FailNow()
+	}
+	defer server.Close()
+	if !server.HandshakeComplete() {
+		t.Fatal("accepted connection has not completed the handshake")
+	}
+	if name := server.NegotiatedParameters().ServerName; name !=
+		"example.com" {
+		t.Fatalf("unexpected server name %q", name)
+	}
+
+	// the name of the server is verified by default
+	go func() {
+		if conn, err := ssl_listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	_, err = openssl.DialWithOptions("tcp", ssl_listener.Addr().String(),
+		nil, openssl.WithServerName("example.com"), openssl.WithDialer(nil))
+	if err == nil {
+		t.Fatal("unverified server name is accepted")
+	}
+}
+
+func TestDialServerName(t *testing.T) {
+	ctx := openssl.GetCtx(t)
+	ssl_listener, err := openssl.ListenWithOptions("tcp", "127.0.0.1:0", ctx,
+		openssl.WithHandshakeTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ssl_listener.Close()
+	_, port, err := net.SplitHostPort(ssl_listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		addr string
+		opts []openssl.DialOption
+		sni  string
+	}{
+		{addr: net.JoinHostPort("localhost", port), sni: "localhost"},
+		{addr: net.JoinHostPort("127.0.0.1", port), sni: ""},
+		{addr: net.JoinHostPort("127.0.0.1", port),
+			opts: []openssl.DialOption{
+				openssl.WithServerName("example.com.")},
+			sni: "example.com"},
+	} {
+		accepted := make(chan *openssl.Conn, 1)
+		go func() {
+			conn, err := ssl_listener.Accept()
+			if err != nil {
+				t.Error(err)
+				accepted <- nil
+				return
+			}
+			accepted <- conn.(*openssl.Conn)
+		}()
+		client, err := openssl.DialWithOptions("tcp", test.addr, nil,
+			append(test.opts, openssl.WithVerifyHostname(false))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := <-accepted
+		if server == nil {
+			t.FailNow()
+		}
+		name := server.NegotiatedParameters().ServerName
+		server.Close()
+		client.Close()
+		if name != test.sni {
+			t.Fatalf("unexpected server name %q for %s", name, test.addr)
+		}
+	}
+}
+
+func TestDialWithOptionsHandshakeTimeout(t *testing.T) {
+	// a server that never answers the ClientHello
+	inner, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inner.Close()
+	go func() {
+		conn, err := inner.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	start := time.Now()
+	_, err = openssl.DialWithOptions("tcp", inner.Addr().String(), nil,
+		openssl.WithHandshakeTimeout(100*time.Millisecond))
+	if err == nil {
+		t.Fatal("handshake with a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("handshake timed out after %v", elapsed)
+	}
+}
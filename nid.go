@@ -198,8 +198,13 @@ const (
 	NID_ad_ca_issuers                      NID = 179
 	NID_OCSP_sign                          NID = 180
 	NID_X9_62_id_ecPublicKey               NID = 408
+	NID_sha256                             NID = 672
+	NID_sha384                             NID = 673
+	NID_sha512                             NID = 674
+	NID_sha224                             NID = 675
 	NID_hmac                               NID = 855
 	NID_cmac                               NID = 894
+	NID_rsassaPss                          NID = 912
 	NID_dhpublicnumber                     NID = 920
 	NID_tls1_prf                           NID = 1021
 	NID_hkdf                               NID = 1036
@@ -207,4 +212,9 @@ const (
 	NID_X448                               NID = 1035
 	NID_ED25519                            NID = 1087
 	NID_ED448                              NID = 1088
+	NID_ffdhe2048                          NID = 1126
+	NID_ffdhe3072                          NID = 1127
+	NID_ffdhe4096                          NID = 1128
+	NID_ffdhe6144                          NID = 1129
+	NID_ffdhe8192                          NID = 1130
 )
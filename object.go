@@ -17,8 +17,116 @@ package openssl
 // #include "shim.h"
 import "C"
 
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// objectsMu serializes the registrations of objects.
+var objectsMu sync.Mutex
+
 // CreateObjectIdentifier creates ObjectIdentifier and returns NID for the created
-// ObjectIdentifier
+// ObjectIdentifier. See RegisterObject, which reports errors.
 func CreateObjectIdentifier(oid string, shortName string, longName string) NID {
-	return NID(C.OBJ_create(C.CString(oid), C.CString(shortName), C.CString(longName)))
+	nid, _ := RegisterObject(oid, shortName, longName)
+	return nid
+}
+
+// RegisterObject registers the object identifier oid, in dotted form, with
+// its short and long names, and returns its NID. The NID can then be used
+// like the built-in ones, e.g. with Certificate.AddCustomExtension,
+// Certificate.GetExtensionValue and the attributes of certificate requests,
+// and NIDFromText finds it by its names. Registering an oid again with the
+// same short name returns its NID; other conflicts with the registered
+// objects are errors. Objects should be registered before the concurrent use
+// of the library, e.g. at init, since older OpenSSL versions don't lock the
+// object table.
+func RegisterObject(oid, shortName, longName string) (NID, error) {
+	if oid == "" || shortName == "" {
+		return NID_undef, errors.New("object identifier and short name " +
+			"are required")
+	}
+	coid := C.CString(oid)
+	defer C.free(unsafe.Pointer(coid))
+	csn := C.CString(shortName)
+	defer C.free(unsafe.Pointer(csn))
+	var cln *C.char
+	if longName != "" {
+		cln = C.CString(longName)
+		defer C.free(unsafe.Pointer(cln))
+	}
+
+	objectsMu.Lock()
+	defer objectsMu.Unlock()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	obj := C.OBJ_txt2obj(coid, 1)
+	if obj == nil {
+		C.ERR_clear_error()
+		return NID_undef, fmt.Errorf("invalid object identifier '%s'", oid)
+	}
+	nid := NID(C.OBJ_obj2nid(obj))
+	C.ASN1_OBJECT_free(obj)
+	if nid != NID_undef {
+		if nid.ShortName() == shortName {
+			return nid, nil
+		}
+		return NID_undef, fmt.Errorf("object identifier %s is already "+
+			"registered as %s", oid, nid.ShortName())
+	}
+	if other := NID(C.OBJ_sn2nid(csn)); other != NID_undef {
+		return NID_undef, fmt.Errorf("short name %s is already registered "+
+			"for %s", shortName, other.OID())
+	}
+	nid = NID(C.OBJ_create(coid, csn, cln))
+	if nid == NID_undef {
+		return NID_undef, fmt.Errorf("failed to register object %s: %w",
+			oid, errorFromErrorQueue())
+	}
+	return nid, nil
+}
+
+// NIDFromText returns the NID of the object with the short name, the long
+// name or the dotted object identifier text.
+func NIDFromText(text string) (NID, error) {
+	ctext := C.CString(text)
+	defer C.free(unsafe.Pointer(ctext))
+	nid := NID(C.OBJ_txt2nid(ctext))
+	if nid == NID_undef {
+		C.ERR_clear_error()
+		return NID_undef, fmt.Errorf("unknown object '%s'", text)
+	}
+	return nid, nil
+}
+
+// ShortName returns the short name of the object, or an empty string if the
+// NID is unknown.
+func (n NID) ShortName() string {
+	if sn := C.OBJ_nid2sn(C.int(n)); sn != nil {
+		return C.GoString(sn)
+	}
+	return ""
+}
+
+// LongName returns the long name of the object, or an empty string if the
+// NID is unknown.
+func (n NID) LongName() string {
+	if ln := C.OBJ_nid2ln(C.int(n)); ln != nil {
+		return C.GoString(ln)
+	}
+	return ""
+}
+
+// OID returns the dotted object identifier of the object, or an empty string
+// if the NID is unknown or has none.
+func (n NID) OID() string {
+	obj := C.OBJ_nid2obj(C.int(n))
+	if obj == nil {
+		C.ERR_clear_error()
+		return ""
+	}
+	return asn1ObjectToText(obj)
 }
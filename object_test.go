@@ -0,0 +1,96 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"testing"
+)
+
+func TestRegisterObject(t *testing.T) {
+	const oid = "1.3.6.1.4.1.55555.1.1"
+	nid, err := RegisterObject(oid, "testTenant", "Test Tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nid.ShortName() != "testTenant" || nid.LongName() != "Test Tenant" ||
+		nid.OID() != oid {
+		t.Fatalf("unexpected object %s %s %s", nid.ShortName(),
+			nid.LongName(), nid.OID())
+	}
+	for _, text := range []string{oid, "testTenant", "Test Tenant"} {
+		if found, err := NIDFromText(text); err != nil || found != nid {
+			t.Fatalf("unexpected NID %d for %s: %v", found, text, err)
+		}
+	}
+	if again, err := RegisterObject(oid, "testTenant", ""); err != nil ||
+		again != nid {
+		t.Fatalf("registering again returns %d: %v", again, err)
+	}
+	for _, args := range [][3]string{
+		{oid, "otherTenant", ""},
+		{"1.3.6.1.4.1.55555.1.2", "testTenant", ""},
+		{"2.5.4.3", "myCN", ""},
+		{"not an oid", "invalid", ""},
+	} {
+		if _, err := RegisterObject(args[0], args[1], args[2]); err == nil {
+			t.Fatalf("conflicting object %v is registered", args)
+		}
+	}
+	if _, err := NIDFromText("noSuchObject"); err == nil {
+		t.Fatal("unknown object is found")
+	}
+	if NID_commonName.ShortName() != "CN" || NID_commonName.OID() != "2.5.4.3" {
+		t.Fatal("unexpected built-in object")
+	}
+
+	// registered objects name certificate extensions and request attributes
+	cert := newTestCertificate(t, "localhost", false, nil)
+	if err := cert.cert.AddCustomExtension(nid, []byte("tenant-1")); err != nil {
+		t.Fatal(err)
+	}
+	if value := cert.cert.GetExtensionValue(nid); string(value) != "tenant-1" {
+		t.Fatalf("unexpected extension value %q", value)
+	}
+
+	name, err := NewName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := name.AddTextEntry("CN", "localhost"); err != nil {
+		t.Fatal(err)
+	}
+	req, err := NewCertificateRequestWithAttributes(name, cert.key,
+		map[NID]string{nid: "tenant-1"}, SignOptions{Digest: EVP_SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem, err := req.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = LoadCertificateRequestFromPEM(pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := req.GetAttribute(nid); err != nil || value != "tenant-1" {
+		t.Fatalf("unexpected attribute %q: %v", value, err)
+	}
+	if _, err := req.GetAttribute(NID_pkcs9_challengePassword); err == nil {
+		t.Fatal("missing attribute is found")
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"unsafe"
+)
+
+// ocspClockSkew is the clock skew tolerated when checking the validity
+// period of an OCSP response, in seconds.
+const ocspClockSkew = 5 * 60
+
+// OCSPStapleMode selects whether OCSP staples are requested from servers and
+// whether they are required.
+type OCSPStapleMode int
+
+const (
+	// OCSPStapleIgnore doesn't request a staple. This is the default.
+	OCSPStapleIgnore OCSPStapleMode = iota
+	// OCSPStapleAcceptMissing requests a staple and validates it if the
+	// server sends one, but accepts servers that don't.
+	OCSPStapleAcceptMissing
+	// OCSPStapleRequireValid requests a staple and fails the handshake
+	// unless the server sends a valid one.
+	OCSPStapleRequireValid
+)
+
+// OCSPStaplePolicy is the validation policy for OCSP staples sent by servers.
+type OCSPStaplePolicy struct {
+	Mode OCSPStapleMode
+	// MaxAge, if not zero, rejects staples produced longer than MaxAge ago,
+	// even if they are not expired yet.
+	MaxAge time.Duration
+}
+
+// OCSPStapleStatus is the outcome of the OCSP staple validation.
+type OCSPStapleStatus int
+
+const (
+	// OCSPStapleNotChecked means no staple was requested.
+	OCSPStapleNotChecked OCSPStapleStatus = iota
+	// OCSPStapleMissing means the server didn't send a staple.
+	OCSPStapleMissing
+	// OCSPStapleValid means the staple is valid and the certificate is good.
+	OCSPStapleValid
+	// OCSPStapleInvalid means the staple is malformed, not signed by a
+	// trusted responder, doesn't cover the certificate or is expired.
+	OCSPStapleInvalid
+	// OCSPStapleStale means the staple is valid, but older than MaxAge.
+	OCSPStapleStale
+	// OCSPStapleRevoked means the certificate is revoked.
+	OCSPStapleRevoked
+	// OCSPStapleUnknown means the responder doesn't know the certificate.
+	OCSPStapleUnknown
+)
+
+func (s OCSPStapleStatus) String() string {
+	switch s {
+	case OCSPStapleNotChecked:
+		return "not checked"
+	case OCSPStapleMissing:
+		return "missing"
+	case OCSPStapleValid:
+		return "valid"
+	case OCSPStapleInvalid:
+		return "invalid"
+	case OCSPStapleStale:
+		return "stale"
+	case OCSPStapleRevoked:
+		return "revoked"
+	case OCSPStapleUnknown:
+		return "unknown"
+	}
+	return fmt.Sprintf("OCSPStapleStatus(%d)", int(s))
+}
+
+// SetOCSPStaplePolicy sets the OCSP staple policy of client connections
+// created from the context afterwards. The staple is verified against the
+// certificate store of the context. Resumed sessions are not checked again.
+// See https://www.openssl.org/docs/man1.1.1/man3/SSL_CTX_set_tlsext_status_cb.html
+func (c *Ctx) SetOCSPStaplePolicy(policy OCSPStaplePolicy) {
+	c.ocsp_policy = policy
+	if policy.Mode != OCSPStapleIgnore {
+		C.X_SSL_CTX_enable_ocsp_status_cb(c.ctx)
+	}
+}
+
+// SetOCSPStaplePolicy overrides the OCSP staple policy of the context for
+// this client connection. It must be called before the handshake.
+func (c *Conn) SetOCSPStaplePolicy(policy OCSPStaplePolicy) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.ocsp_policy = policy
+	if policy.Mode == OCSPStapleIgnore {
+		// -1 is TLSEXT_STATUSTYPE_nothing
+		C.X_SSL_set_tlsext_status_type(c.ssl, -1)
+		return
+	}
+	C.X_SSL_CTX_enable_ocsp_status_cb(c.ctx.ctx)
+	C.X_SSL_set_tlsext_status_type(c.ssl, C.TLSEXT_STATUSTYPE_ocsp)
+}
+
+//export go_ocsp_status_cb_thunk
+func go_ocsp_status_cb_thunk(p unsafe.Pointer) C.int {
+	s := pointers.Restore(p).(*SSL)
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Critf("openssl: ocsp status callback panic'd%s: %v",
+				s.correlationTag(), err)
+			os.Exit(1)
+		}
+	}()
+
+	s.ocsp_status, s.ocsp_err = s.checkOCSPStaple(s.ocsp_policy)
+	if s.ocsp_err != nil {
+		return 0
+	}
+	return 1
+}
+
+// checkOCSPStaple applies policy to the staple received from the server.
+func (s *SSL) checkOCSPStaple(policy OCSPStaplePolicy) (OCSPStapleStatus,
+	error) {
+	if policy.Mode == OCSPStapleIgnore {
+		return OCSPStapleNotChecked, nil
+	}
+	status, err := s.verifyOCSPStaple(policy.MaxAge)
+	if status == OCSPStapleMissing && policy.Mode == OCSPStapleRequireValid {
+		err = errors.New("server didn't staple an OCSP response")
+	}
+	return status, err
+}
+
+// verifyOCSPStaple verifies the staple received from the server and checks
+// the status of the server certificate.
+func (s *SSL) verifyOCSPStaple(maxAge time.Duration) (OCSPStapleStatus,
+	error) {
+	var der *C.uchar
+	n := C.X_SSL_get_tlsext_status_ocsp_resp(s.ssl, &der)
+	if n <= 0 || der == nil {
+		return OCSPStapleMissing, nil
+	}
+	resp := C.d2i_OCSP_RESPONSE(nil, &der, C.long(n))
+	if resp == nil {
+		return OCSPStapleInvalid, errors.New("failed to parse OCSP response")
+	}
+	defer C.OCSP_RESPONSE_free(resp)
+	if code := C.OCSP_response_status(resp); code !=
+		C.OCSP_RESPONSE_STATUS_SUCCESSFUL {
+		return OCSPStapleInvalid, fmt.Errorf("OCSP responder error: %s",
+			C.GoString(C.OCSP_response_status_str(C.long(code))))
+	}
+	basic := C.OCSP_response_get1_basic(resp)
+	if basic == nil {
+		return OCSPStapleInvalid, errors.New("failed to decode OCSP response")
+	}
+	defer C.OCSP_BASICRESP_free(basic)
+
+	leaf := C.SSL_get_peer_certificate(s.ssl)
+	if leaf == nil {
+		return OCSPStapleInvalid, errors.New("no peer certificate found")
+	}
+	defer C.X509_free(leaf)
+	peers := C.SSL_get_peer_cert_chain(s.ssl)
+	issuer := findIssuer(leaf, C.X_SSL_get0_verified_chain(s.ssl), peers)
+	if issuer == nil {
+		return OCSPStapleInvalid,
+			errors.New("issuer of the peer certificate not found")
+	}
+
+	store := C.SSL_CTX_get_cert_store(C.SSL_get_SSL_CTX(s.ssl))
+	if C.OCSP_basic_verify(basic, peers, store, 0) <= 0 {
+		return OCSPStapleInvalid, errors.New("failed to verify OCSP response")
+	}
+
+	id := C.OCSP_cert_to_id(nil, leaf, issuer)
+	if id == nil {
+		return OCSPStapleInvalid, errors.New("failed to allocate OCSP_CERTID")
+	}
+	defer C.OCSP_CERTID_free(id)
+	var status, reason C.int
+	var revoked, thisUpdate, nextUpdate *C.ASN1_GENERALIZEDTIME
+	if C.OCSP_resp_find_status(basic, id, &status, &reason, &revoked,
+		&thisUpdate, &nextUpdate) != 1 {
+		return OCSPStapleInvalid,
+			errors.New("OCSP response doesn't cover the peer certificate")
+	}
+	if C.OCSP_check_validity(thisUpdate, nextUpdate, ocspClockSkew, -1) != 1 {
+		return OCSPStapleInvalid, errors.New("OCSP response is expired")
+	}
+	switch status {
+	case C.V_OCSP_CERTSTATUS_REVOKED:
+		return OCSPStapleRevoked, errors.New("peer certificate is revoked")
+	case C.V_OCSP_CERTSTATUS_UNKNOWN:
+		return OCSPStapleUnknown,
+			errors.New("peer certificate is unknown to the OCSP responder")
+	}
+	if maxAge > 0 && C.OCSP_check_validity(thisUpdate, nextUpdate,
+		ocspClockSkew, C.long(maxAge/time.Second)) != 1 {
+		return OCSPStapleStale, errors.New("OCSP response is too old")
+	}
+	return OCSPStapleValid, nil
+}
+
+// findIssuer looks for the issuer of cert in the certificate stacks.
+func findIssuer(cert *C.X509, stacks ...*C.struct_stack_st_X509) *C.X509 {
+	for _, sk := range stacks {
+		if sk == nil {
+			continue
+		}
+		for i := 0; i < int(C.X_sk_X509_num(sk)); i++ {
+			x := C.X_sk_X509_value(sk, C.int(i))
+			if C.X_X509_check_issued(x, cert) == C.X509_V_OK {
+				return x
+			}
+		}
+	}
+	return nil
+}
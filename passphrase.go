@@ -0,0 +1,123 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// PassphraseFunc returns the passphrase of an encrypted private key. It is
+// only called if the key is encrypted, and the returned slice is wiped
+// after use.
+type PassphraseFunc func() ([]byte, error)
+
+type passphraseState struct {
+	fn  PassphraseFunc
+	err error
+}
+
+//export go_pem_password_cb_thunk
+func go_pem_password_cb_thunk(p unsafe.Pointer, buf *C.char,
+	size C.int) (n C.int) {
+	state := pointers.Restore(p).(*passphraseState)
+	defer func() {
+		if err := recover(); err != nil {
+			state.err = fmt.Errorf("passphrase callback panicked: %v", err)
+			n = -1
+		}
+	}()
+	passphrase, err := state.fn()
+	if err != nil {
+		state.err = err
+		return -1
+	}
+	defer Cleanse(passphrase)
+	if len(passphrase) > int(size) {
+		state.err = errors.New("passphrase too long")
+		return -1
+	}
+	if len(passphrase) > 0 {
+		C.memcpy(unsafe.Pointer(buf), unsafe.Pointer(&passphrase[0]),
+			C.size_t(len(passphrase)))
+	}
+	return C.int(len(passphrase))
+}
+
+// LoadPrivateKeyFromPEMWithPassphrase loads a private key from a
+// PEM-encoded block, calling passphrase for the passphrase if the key is
+// encrypted, so that it can be fetched lazily, e.g. from a vault or a
+// prompt.
+func LoadPrivateKeyFromPEMWithPassphrase(pem_block []byte,
+	passphrase PassphraseFunc) (PrivateKey, error) {
+	if len(pem_block) == 0 {
+		return nil, errors.New("empty pem block")
+	}
+	return loadPrivateKeyWithPassphrase(pem_block, passphrase, false)
+}
+
+// LoadPrivateKeyFromPKCS8DER loads a private key from a DER-encoded PKCS8
+// block, encrypted unless passphrase is nil.
+func LoadPrivateKeyFromPKCS8DER(der_block []byte,
+	passphrase PassphraseFunc) (PrivateKey, error) {
+	if passphrase == nil {
+		return LoadPrivateKeyFromDER(der_block)
+	}
+	if len(der_block) == 0 {
+		return nil, errors.New("empty der block")
+	}
+	return loadPrivateKeyWithPassphrase(der_block, passphrase, true)
+}
+
+func loadPrivateKeyWithPassphrase(block []byte, passphrase PassphraseFunc,
+	der bool) (PrivateKey, error) {
+	if passphrase == nil {
+		return nil, errors.New("nil passphrase callback")
+	}
+	bio, free, err := newPrivateKeyBIO(block)
+	if err != nil {
+		return nil, err
+	}
+	defer free()
+	state := &passphraseState{fn: passphrase}
+	p := pointers.Save(state)
+	defer pointers.Unref(p)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var key *C.EVP_PKEY
+	if der {
+		key = C.X_d2i_PKCS8PrivateKey_bio_cb(bio, p)
+	} else {
+		key = C.X_PEM_read_bio_PrivateKey_cb(bio, p)
+	}
+	if key == nil {
+		queueErr := errorFromErrorQueue()
+		if state.err != nil {
+			return nil, fmt.Errorf("failed reading private key: %w",
+				state.err)
+		}
+		return nil, fmt.Errorf("failed reading private key: %w", queueErr)
+	}
+
+	pk := &pKey{key: key}
+	setPKeyFinalizer(pk)
+	return pk, nil
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestPassphraseCallback(t *testing.T) {
+	key, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := key.MarshalPKCS8PrivateKeyPEM("secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	passphrase := func() ([]byte, error) {
+		calls++
+		return []byte("secret"), nil
+	}
+
+	loaded, err := LoadPrivateKeyFromPEMWithPassphrase(encrypted, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(key) || calls != 1 {
+		t.Fatalf("unexpected key after %d calls", calls)
+	}
+
+	block, _ := pem.Decode(encrypted)
+	loaded, err = LoadPrivateKeyFromPKCS8DER(block.Bytes, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(key) {
+		t.Fatal("unexpected key from DER")
+	}
+
+	_, err = LoadPrivateKeyFromPEMWithPassphrase(encrypted,
+		func() ([]byte, error) { return []byte("wrong"), nil })
+	if err == nil {
+		t.Fatal("loaded with a wrong passphrase")
+	}
+	errVault := errors.New("vault sealed")
+	_, err = LoadPrivateKeyFromPEMWithPassphrase(encrypted,
+		func() ([]byte, error) { return nil, errVault })
+	if !errors.Is(err, errVault) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	plain, err := key.MarshalPKCS8PrivateKeyPEM("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls = 0
+	if _, err := LoadPrivateKeyFromPEMWithPassphrase(plain,
+		passphrase); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Fatal("passphrase asked for an unencrypted key")
+	}
+}
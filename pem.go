@@ -15,6 +15,7 @@
 package openssl
 
 import (
+	"encoding/pem"
 	"regexp"
 )
 
@@ -26,3 +27,76 @@ var pemSplit *regexp.Regexp = regexp.MustCompile(`(?sm)` +
 func SplitPEM(data []byte) [][]byte {
 	return pemSplit.FindAll(data, -1)
 }
+
+// PEMKind classifies a PEM block by its label.
+type PEMKind int
+
+const (
+	PEMUnknown PEMKind = iota
+	PEMCertificate
+	PEMCertificateRequest
+	PEMPrivateKey
+	PEMPublicKey
+	PEMCRL
+	PEMParameters
+)
+
+// pemKinds maps the PEM labels written by OpenSSL to their kind.
+var pemKinds = map[string]PEMKind{
+	"CERTIFICATE":             PEMCertificate,
+	"X509 CERTIFICATE":        PEMCertificate,
+	"TRUSTED CERTIFICATE":     PEMCertificate,
+	"CERTIFICATE REQUEST":     PEMCertificateRequest,
+	"NEW CERTIFICATE REQUEST": PEMCertificateRequest,
+	"PRIVATE KEY":             PEMPrivateKey,
+	"ENCRYPTED PRIVATE KEY":   PEMPrivateKey,
+	"RSA PRIVATE KEY":         PEMPrivateKey,
+	"EC PRIVATE KEY":          PEMPrivateKey,
+	"DSA PRIVATE KEY":         PEMPrivateKey,
+	"PUBLIC KEY":              PEMPublicKey,
+	"RSA PUBLIC KEY":          PEMPublicKey,
+	"X509 CRL":                PEMCRL,
+	"DH PARAMETERS":           PEMParameters,
+	"X9.42 DH PARAMETERS":     PEMParameters,
+	"EC PARAMETERS":           PEMParameters,
+	"DSA PARAMETERS":          PEMParameters,
+}
+
+// PEMBlock is a single block of a PEM bundle.
+type PEMBlock struct {
+	Kind PEMKind
+	// Type is the label of the block, e.g. "RSA PRIVATE KEY".
+	Type    string
+	Headers map[string]string
+	// Bytes is the decoded content of the block.
+	Bytes []byte
+	// PEM is the block alone, as accepted by the Load*FromPEM functions.
+	PEM []byte
+}
+
+// Encrypted reports whether the block holds an encrypted private key, either
+// PKCS8 or traditional.
+func (b *PEMBlock) Encrypted() bool {
+	return b.Type == "ENCRYPTED PRIVATE KEY" ||
+		b.Headers["Proc-Type"] == "4,ENCRYPTED"
+}
+
+// ParsePEMBlocks returns the blocks of a PEM bundle in order. Text outside the
+// blocks is ignored.
+func ParsePEMBlocks(data []byte) []PEMBlock {
+	var blocks []PEMBlock
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			return blocks
+		}
+		blocks = append(blocks, PEMBlock{
+			Kind:    pemKinds[block.Type],
+			Type:    block.Type,
+			Headers: block.Headers,
+			Bytes:   block.Bytes,
+			PEM:     pem.EncodeToMemory(block),
+		})
+		data = rest
+	}
+}
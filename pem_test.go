@@ -0,0 +1,103 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParsePEMBlocks(t *testing.T) {
+	ca := newTestCertificate(t, "ca", true, nil)
+	certPEM, err := ca.cert.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := ca.key.MarshalPKCS1PrivateKeyPEMWithPassword("secret",
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8PEM, err := ca.key.MarshalPKCS8PrivateKeyPEM("secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := ca.key.MarshalPKIXPublicKeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	crl, err := NewCRL(ca.cert, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.Sign(ca.key, SignOptions{Digest: EVP_SHA256}); err != nil {
+		t.Fatal(err)
+	}
+	crlPEM, err := crl.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paramsPEM := []byte("-----BEGIN EC PARAMETERS-----\n" +
+		"BggqhkjOPQMBBw==\n-----END EC PARAMETERS-----\n")
+
+	bundle := bytes.Join([][]byte{
+		[]byte("subject=CN = ca\n"), certPEM, keyPEM, pkcs8PEM, pubPEM,
+		crlPEM, paramsPEM, []byte("-----BEGIN FOO-----\n-----END FOO-----\n"),
+	}, nil)
+	blocks := ParsePEMBlocks(bundle)
+	want := []struct {
+		kind      PEMKind
+		typ       string
+		encrypted bool
+	}{
+		{PEMCertificate, "CERTIFICATE", false},
+		{PEMPrivateKey, "EC PRIVATE KEY", true},
+		{PEMPrivateKey, "ENCRYPTED PRIVATE KEY", true},
+		{PEMPublicKey, "PUBLIC KEY", false},
+		{PEMCRL, "X509 CRL", false},
+		{PEMParameters, "EC PARAMETERS", false},
+		{PEMUnknown, "FOO", false},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(want))
+	}
+	for i, w := range want {
+		b := blocks[i]
+		if b.Kind != w.kind || b.Type != w.typ || b.Encrypted() != w.encrypted {
+			t.Fatalf("block %d: got %v %q %v, want %v %q %v", i, b.Kind,
+				b.Type, b.Encrypted(), w.kind, w.typ, w.encrypted)
+		}
+	}
+
+	cert, err := LoadCertificateFromPEM(blocks[0].PEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.GetSerialNumber().Cmp(ca.cert.GetSerialNumber()) != 0 {
+		t.Fatal("certificate mismatch")
+	}
+	key, err := LoadPrivateKeyFromPEMWithPassword(blocks[1].PEM, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(ca.key) {
+		t.Fatal("private key mismatch")
+	}
+	if _, err := LoadCRLFromPEM(blocks[4].PEM); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+func (key *pKey) SPKIFingerprintSHA256() ([32]byte, error) {
+	der, err := key.MarshalPKIXPublicKeyDER()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return SHA256(der)
+}
+
+// SPKIPin returns the pin of the public key, the base64-encoded SHA-256
+// hash of its SubjectPublicKeyInfo as used by HPKP (RFC 7469).
+func SPKIPin(key PublicKey) (string, error) {
+	fingerprint, err := key.SPKIFingerprintSHA256()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(fingerprint[:]), nil
+}
+
+// VerifyPin checks that the key of a certificate of the peer matches one of
+// the pins, base64-encoded SHA-256 hashes of SubjectPublicKeyInfo (see
+// SPKIPin). The certificates are the peer certificate and, if it was
+// verified, its verified chain, so pins of issuers only match when the
+// peer is verified. Call it after the handshake.
+//
+// A resumed session has no verified chain, OpenSSL keeps only the peer
+// certificate with it, so only the pins of the leaf key match then. Pin the
+// leaf key as well, or disable the resumption of the sessions, when pinning
+// issuers.
+func VerifyPin(conn *Conn, pins []string) error {
+	certs, err := conn.VerifiedChain()
+	if err != nil {
+		leaf, err := conn.PeerCertificate()
+		if err != nil {
+			return err
+		}
+		certs = []*Certificate{leaf}
+	}
+	for _, cert := range certs {
+		key, err := cert.PublicKey()
+		if err != nil {
+			return err
+		}
+		pin, err := SPKIPin(key)
+		if err != nil {
+			return err
+		}
+		for _, p := range pins {
+			if p == pin {
+				return nil
+			}
+		}
+	}
+	if len(certs) == 1 && conn.SessionReused() {
+		return errors.New("the peer certificate of the resumed session " +
+			"matches no pin, issuers are not checked on resumption")
+	}
+	return errors.New("no certificate of the peer matches a pin")
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestVerifyPin(t *testing.T) {
+	root := newTestCertificate(t, "root", true, nil)
+	leaf := newTestCertificate(t, "localhost", false, root)
+	other := newTestCertificate(t, "other", true, nil)
+
+	pin := func(c *testCertificate) string {
+		key, err := c.cert.PublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pin, err := SPKIPin(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pin
+	}
+
+	certPEM, err := leaf.cert.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPEM)
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := leaf.key.SPKIFingerprintSHA256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fingerprint != sha256.Sum256(parsed.RawSubjectPublicKeyInfo) {
+		t.Fatal("unexpected SPKI fingerprint")
+	}
+
+	for _, test := range []struct {
+		name   string
+		verify bool
+		pins   []string
+		ok     bool
+	}{
+		{"leaf", false, []string{pin(other), pin(leaf)}, true},
+		{"verified root", true, []string{pin(root)}, true},
+		{"unverified root", false, []string{pin(root)}, false},
+		{"other", true, []string{pin(other)}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, err := NewCtx()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ctx.UseCertificate(leaf.cert); err != nil {
+				t.Fatal(err)
+			}
+			if err := ctx.UsePrivateKey(leaf.key); err != nil {
+				t.Fatal(err)
+			}
+			// the root is sent to check it is only pinned once verified
+			if err := ctx.AddChainCertificate(root.cert); err != nil {
+				t.Fatal(err)
+			}
+			clientCtx, err := NewCtx()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.verify {
+				err := clientCtx.GetCertificateStore().AddCertificate(
+					root.cert)
+				if err != nil {
+					t.Fatal(err)
+				}
+				clientCtx.SetVerifyMode(VerifyPeer)
+			}
+
+			serverConn, clientConn := NetPipe(t)
+			server, err := Server(serverConn, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := Client(clientConn, clientCtx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer close_both(server, client)
+			doHandshake(t, server, client)
+
+			err = VerifyPin(client, test.pins)
+			if test.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !test.ok && err == nil {
+				t.Fatal("pin matched")
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// pointerShards is the number of shards of the registry. It is a power of
+// two, so that a shard is picked with a mask.
+const pointerShards = 64
+
+// cacheLineSize is the size the shards are padded to, so that the locks of
+// neighbouring shards don't share a cache line.
+const cacheLineSize = 64
+
+type pointerShardValues struct {
+	mtx    sync.RWMutex
+	values map[unsafe.Pointer]interface{}
+}
+
+type pointerShard struct {
+	pointerShardValues
+	_ [(cacheLineSize -
+		unsafe.Sizeof(pointerShardValues{})%cacheLineSize) % cacheLineSize]byte
+}
+
+// pointerRegistry maps the C pointers handed to OpenSSL as callback
+// arguments and ex data to the Go values, since C can't keep Go pointers.
+// It is sharded by the pointer, so that the callbacks of concurrent
+// handshakes don't contend on a single lock.
+type pointerRegistry struct {
+	shards [pointerShards]pointerShard
+}
+
+var pointers = newPointerRegistry()
+
+func newPointerRegistry() *pointerRegistry {
+	r := &pointerRegistry{}
+	for i := range r.shards {
+		r.shards[i].values = make(map[unsafe.Pointer]interface{})
+	}
+	return r
+}
+
+func (r *pointerRegistry) shard(p unsafe.Pointer) *pointerShard {
+	// malloc aligns the allocations, so the low bits carry no information
+	return &r.shards[(uintptr(p)>>4)&(pointerShards-1)]
+}
+
+// Save registers v and returns the C pointer to pass instead of it. The
+// pointer must be released with Unref.
+func (r *pointerRegistry) Save(v interface{}) unsafe.Pointer {
+	if v == nil {
+		return nil
+	}
+	// a real allocation, so that the pointer is unique while it is in use
+	p := C.malloc(1)
+	if p == nil {
+		panic("openssl: failed to allocate a registry pointer")
+	}
+	s := r.shard(p)
+	s.mtx.Lock()
+	s.values[p] = v
+	s.mtx.Unlock()
+	return p
+}
+
+// Restore returns the value registered for p, or nil.
+func (r *pointerRegistry) Restore(p unsafe.Pointer) interface{} {
+	if p == nil {
+		return nil
+	}
+	s := r.shard(p)
+	s.mtx.RLock()
+	v := s.values[p]
+	s.mtx.RUnlock()
+	return v
+}
+
+// Unref removes the value registered for p and frees p.
+func (r *pointerRegistry) Unref(p unsafe.Pointer) {
+	if p == nil {
+		return
+	}
+	s := r.shard(p)
+	s.mtx.Lock()
+	delete(s.values, p)
+	s.mtx.Unlock()
+	C.free(p)
+}
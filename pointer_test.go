@@ -0,0 +1,90 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestPointerRegistry(t *testing.T) {
+	r := newPointerRegistry()
+	values := []int{1, 2, 3}
+	var ptrs []unsafe.Pointer
+	for i := range values {
+		p := r.Save(&values[i])
+		if r.Restore(p) != &values[i] {
+			t.Fatalf("unexpected value for %d", i)
+		}
+		ptrs = append(ptrs, p)
+	}
+	if r.Save(nil) != nil || r.Restore(nil) != nil {
+		t.Fatal("nil is registered")
+	}
+	for _, p := range ptrs {
+		r.Unref(p)
+	}
+	for i := range r.shards {
+		if len(r.shards[i].values) != 0 {
+			t.Fatal("values are not removed")
+		}
+	}
+}
+
+func TestMapping(t *testing.T) {
+	m := newMapping()
+	values := []int{1, 2, 3}
+	var tokens []token
+	for i := range values {
+		x := m.Add(unsafe.Pointer(&values[i]))
+		if m.Get(x) != unsafe.Pointer(&values[i]) {
+			t.Fatalf("unexpected value for %d", i)
+		}
+		tokens = append(tokens, x)
+	}
+	for _, x := range tokens {
+		m.Del(x)
+	}
+	for i := range m.shards {
+		if len(m.shards[i].values) != 0 {
+			t.Fatal("values are not removed")
+		}
+	}
+}
+
+func TestShardSizes(t *testing.T) {
+	for _, size := range []uintptr{unsafe.Sizeof(pointerShard{}),
+		unsafe.Sizeof(mappingShard{})} {
+		if size%cacheLineSize != 0 {
+			t.Fatalf("shard of %d bytes spans cache lines partially", size)
+		}
+	}
+}
+
+// BenchmarkPointerRegistry models the callbacks of concurrent handshakes:
+// each saves the value of its connection and restores the values of the
+// connection and the context.
+func BenchmarkPointerRegistry(b *testing.B) {
+	ctx := pointers.Save(b)
+	defer pointers.Unref(ctx)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			conn := pointers.Save(pb)
+			pointers.Restore(ctx)
+			pointers.Restore(conn)
+			pointers.Unref(conn)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// SetDefaultProperties sets the default property query used when
+// algorithms are fetched implicitly, e.g. "provider=fips" or "-fips".
+// An empty string resets it. It is only supported with OpenSSL 3.0+.
+func SetDefaultProperties(properties string) error {
+	if !kdf_support {
+		return errors.New("property queries are not supported")
+	}
+	cprops := C.CString(properties)
+	defer C.free(unsafe.Pointer(cprops))
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.X_EVP_set_default_properties(cprops) != 1 {
+		return fmt.Errorf("failed to set default properties %q: %w",
+			properties, errorFromErrorQueue())
+	}
+	return nil
+}
+
+// FetchDigest fetches the Digest with the name from a provider that
+// matches the property query, which overrides the default properties.
+// It is only supported with OpenSSL 3.0+.
+func FetchDigest(name, properties string) (*Digest, error) {
+	if !kdf_support {
+		return nil, errors.New("property queries are not supported")
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cprops := C.CString(properties)
+	defer C.free(unsafe.Pointer(cprops))
+	p := C.X_EVP_MD_fetch(cname, cprops)
+	if p == nil {
+		return nil, fmt.Errorf("Digest %v not found for properties %q",
+			name, properties)
+	}
+	d := &Digest{ptr: p}
+	runtime.SetFinalizer(d, func(d *Digest) {
+		C.X_EVP_MD_free(d.ptr)
+	})
+	return d, nil
+}
+
+// FetchCipher fetches the Cipher with the name from a provider that
+// matches the property query, which overrides the default properties.
+// It is only supported with OpenSSL 3.0+.
+func FetchCipher(name, properties string) (*Cipher, error) {
+	if !kdf_support {
+		return nil, errors.New("property queries are not supported")
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cprops := C.CString(properties)
+	defer C.free(unsafe.Pointer(cprops))
+	p := C.X_EVP_CIPHER_fetch(cname, cprops)
+	if p == nil {
+		return nil, fmt.Errorf("Cipher %v not found for properties %q",
+			name, properties)
+	}
+	c := &Cipher{ptr: p}
+	runtime.SetFinalizer(c, func(c *Cipher) {
+		C.X_EVP_CIPHER_free(c.ptr)
+	})
+	return c, nil
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+)
+
+func TestFetchProperties(t *testing.T) {
+	if !kdf_support {
+		t.SkipNow()
+	}
+
+	d, err := FetchDigest("SHA256", "provider=default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ptr == nil {
+		t.Fatal("nil digest")
+	}
+	if _, err := FetchDigest("SHA256", "provider=nonexistent"); err == nil {
+		t.Fatal("expected an error for an unmatched property query")
+	}
+
+	c, err := FetchCipher("AES-128-GCM", "provider=default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.KeySize() != 16 {
+		t.Fatalf("unexpected key size %d", c.KeySize())
+	}
+	if _, err := FetchCipher("AES-128-GCM", "provider=nonexistent"); err == nil {
+		t.Fatal("expected an error for an unmatched property query")
+	}
+
+	secret := []byte("secret")
+	want, err := SSKDF(EVP_SHA256, secret, nil, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := SSKDFWithProperties("provider=default", EVP_SHA256, secret,
+		nil, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, want) {
+		t.Fatalf("unexpected key %x", key)
+	}
+	if _, err := X963KDFWithProperties("provider=nonexistent", EVP_SHA256,
+		secret, nil, 32); err == nil {
+		t.Fatal("expected an error for an unmatched property query")
+	}
+
+	salt := []byte("salt")
+	kdfs := []struct {
+		name   string
+		derive func(properties string) ([]byte, error)
+	}{
+		{"HKDF", func(properties string) ([]byte, error) {
+			return HKDFWithProperties(properties, EVP_SHA256, secret, salt,
+				[]byte("info"), 42)
+		}},
+		{"PBKDF2", func(properties string) ([]byte, error) {
+			return PBKDF2WithProperties(properties, secret, salt, 2, 20,
+				EVP_SHA1)
+		}},
+		{"Scrypt", func(properties string) ([]byte, error) {
+			return ScryptWithProperties(properties, secret, salt, 16, 1, 1,
+				64)
+		}},
+		{"TLS1PRF", func(properties string) ([]byte, error) {
+			return TLS1PRFWithProperties(properties, EVP_SHA256, secret,
+				[]byte("label"), []byte("seed"), 48)
+		}},
+	}
+	for _, kdf := range kdfs {
+		want, err := kdf.derive("")
+		if err != nil {
+			t.Fatalf("%s: %v", kdf.name, err)
+		}
+		key, err := kdf.derive("provider=default")
+		if err != nil {
+			t.Fatalf("%s: %v", kdf.name, err)
+		}
+		if !bytes.Equal(key, want) {
+			t.Fatalf("%s: unexpected key %x", kdf.name, key)
+		}
+		if _, err := kdf.derive("provider=nonexistent"); err == nil {
+			t.Fatalf("%s: expected an error for an unmatched property query",
+				kdf.name)
+		}
+	}
+}
+
+func TestFetchedDigestOutlivesReferences(t *testing.T) {
+	if !kdf_support {
+		t.SkipNow()
+	}
+
+	newHashes := func() (*Hash, *HMAC) {
+		d, err := FetchDigest("SHA256", "provider=default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := NewHashWithDigest(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mac, err := NewHMACWithDigest([]byte("key"), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h, mac
+	}
+	h, mac := newHashes()
+	// the finalizer of the fetched digest must not free it under the hashes
+	runtime.GC()
+	runtime.GC()
+	if err := h.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if h.Size() != 32 || h.BlockSize() != 64 || len(h.Sum(nil)) != 32 {
+		t.Fatal("unexpected hash sizes")
+	}
+	if mac.Size() != 32 || mac.BlockSize() != 64 || len(mac.Sum(nil)) != 32 {
+		t.Fatal("unexpected HMAC sizes")
+	}
+}
+
+func TestSetDefaultProperties(t *testing.T) {
+	if !kdf_support {
+		t.SkipNow()
+	}
+	defer SetDefaultProperties("")
+
+	if err := SetDefaultProperties("provider=nonexistent"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FetchDigest("SHA256", ""); err == nil {
+		t.Fatal("expected the default properties to apply")
+	}
+	// a per-operation query overrides the default properties
+	if _, err := FetchDigest("SHA256", "provider=default"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDefaultProperties(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FetchDigest("SHA256", ""); err != nil {
+		t.Fatal(err)
+	}
+}
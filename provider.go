@@ -0,0 +1,80 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// Provider is a loaded OpenSSL provider, such as "fips", "pkcs11" or
+// "tpm2". Providers are only supported with OpenSSL 3.0+.
+type Provider struct {
+	name string
+	p    unsafe.Pointer
+}
+
+// LoadProvider loads the provider with the name into the default library
+// context. The provider stays loaded until Unload is called, since keys
+// loaded from it may outlive the Provider.
+func LoadProvider(name string) (*Provider, error) {
+	if !kdf_support {
+		return nil, errors.New("providers are not supported")
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	p := C.X_OSSL_PROVIDER_load(cname)
+	if p == nil {
+		return nil, fmt.Errorf("failed loading provider %s: %w", name,
+			errorFromErrorQueue())
+	}
+	return &Provider{name: name, p: p}, nil
+}
+
+// Name returns the name of the provider.
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// Unload unloads the provider, which is only deactivated once every
+// LoadProvider call of the name is unloaded.
+func (p *Provider) Unload() error {
+	if p.p == nil {
+		return errors.New("provider already unloaded")
+	}
+	if C.X_OSSL_PROVIDER_unload(p.p) != 1 {
+		return fmt.Errorf("failed unloading provider %s", p.name)
+	}
+	p.p = nil
+	return nil
+}
+
+// ProviderAvailable reports whether the provider with the name is loaded or
+// can be loaded by the configuration.
+func ProviderAvailable(name string) bool {
+	if !kdf_support {
+		return false
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	return C.X_OSSL_PROVIDER_available(cname) == 1
+}
@@ -0,0 +1,56 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"testing"
+)
+
+func TestProvider(t *testing.T) {
+	if !kdf_support {
+		t.SkipNow()
+	}
+	if !ProviderAvailable("default") {
+		t.Fatal("default provider is not available")
+	}
+	p, err := LoadProvider("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name() != "default" {
+		t.Fatalf("unexpected name %s", p.Name())
+	}
+	if err := p.Unload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Unload(); err == nil {
+		t.Fatal("unloaded a provider twice")
+	}
+	if !ProviderAvailable("default") {
+		t.Fatal("default provider was deactivated")
+	}
+	if _, err := LoadProvider("nonexistent"); err == nil {
+		t.Fatal("loaded a missing provider")
+	}
+}
+
+func TestLoadTPMPrivateKey(t *testing.T) {
+	if !kdf_support || ProviderAvailable(TPM2ProviderName) {
+		t.SkipNow()
+	}
+	if _, err := LoadTPMPrivateKey("handle:0x81000001", nil); err == nil {
+		t.Fatal("loaded a TPM key without the tpm2 provider")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"io"
+	"math"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+type randReader struct {
+	private bool
+}
+
+// Rand is a reader of cryptographically secure random bytes from the
+// OpenSSL DRBG with RAND_bytes, e.g. for deployments that must use the
+// FIPS validated generator rather than crypto/rand.
+var Rand io.Reader = randReader{}
+
+// PrivateRand is like Rand, but reads from the separate DRBG meant for
+// secret values with RAND_priv_bytes. It requires OpenSSL 1.1.1 or newer.
+var PrivateRand io.Reader = randReader{private: true}
+
+func (r randReader) Read(b []byte) (int, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	for n := 0; n < len(b); {
+		chunk := len(b) - n
+		if chunk > math.MaxInt32 {
+			chunk = math.MaxInt32
+		}
+		buf := (*C.uchar)(unsafe.Pointer(&b[n]))
+		var rc C.int
+		if r.private {
+			rc = C.X_RAND_priv_bytes(buf, C.int(chunk))
+		} else {
+			rc = C.X_RAND_bytes(buf, C.int(chunk))
+		}
+		if rc != 1 {
+			if !r.private || ed25519_support {
+				return n, errorFromErrorQueue()
+			}
+			return n, errors.New("RAND_priv_bytes requires OpenSSL 1.1.1")
+		}
+		n += chunk
+	}
+	return len(b), nil
+}
+
+// RandReseed reseeds the OpenSSL DRBG from the system entropy source.
+func RandReseed() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if C.X_RAND_poll() != 1 {
+		return errorFromErrorQueue()
+	}
+	return nil
+}
+
+// SetRandReseedInterval sets how many requests and how long the primary
+// DRBG serves before it reseeds itself; zero disables either limit. The
+// DRBGs feeding Rand and PrivateRand follow the reseeds of the primary
+// one. It requires OpenSSL 3.0 or newer.
+func SetRandReseedInterval(requests uint32, interval time.Duration) error {
+	if !kdf_support {
+		return errors.New("DRBG reseed controls require OpenSSL 3.0")
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if C.X_RAND_set_reseed(C.uint(requests),
+		C.int64_t(interval/time.Second)) != 1 {
+		return errorFromErrorQueue()
+	}
+	return nil
+}
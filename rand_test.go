@@ -0,0 +1,55 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRand(t *testing.T) {
+	readers := []io.Reader{Rand}
+	if ed25519_support {
+		readers = append(readers, PrivateRand)
+	}
+	for _, r := range readers {
+		a := make([]byte, 64)
+		b := make([]byte, 64)
+		if _, err := io.ReadFull(r, a); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(a, b) || bytes.Equal(a, make([]byte, 64)) {
+			t.Fatal("random bytes repeat")
+		}
+	}
+
+	if err := RandReseed(); err != nil {
+		t.Fatal(err)
+	}
+	if !kdf_support {
+		return
+	}
+	if err := SetRandReseedInterval(1<<16, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Rand.Read(make([]byte, 32)); err != nil {
+		t.Fatal(err)
+	}
+}
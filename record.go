@@ -0,0 +1,76 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"io"
+)
+
+// RecordType is the content type of a TLS record.
+type RecordType int
+
+const (
+	RecordTypeChangeCipherSpec RecordType = C.SSL3_RT_CHANGE_CIPHER_SPEC
+	RecordTypeAlert            RecordType = C.SSL3_RT_ALERT
+	RecordTypeHandshake        RecordType = C.SSL3_RT_HANDSHAKE
+	RecordTypeApplicationData  RecordType = C.SSL3_RT_APPLICATION_DATA
+)
+
+// RecordInfo describes the TLS record the data returned by ReadRecord came
+// from.
+type RecordInfo struct {
+	Type RecordType
+	// End reports whether the read reached the end of the record, so the
+	// next read starts with a new record.
+	End bool
+}
+
+// ReadRecord acts like Read, but also reports the TLS record boundaries,
+// which is useful for protocols that send one message per record. A single
+// call never returns data from more than one record. If b is smaller than the
+// record, the rest of it is returned by the next calls and End is false until
+// the record is consumed.
+//
+// Only application data records are returned to the caller, other records are
+// processed by OpenSSL. A close_notify alert is reported as io.EOF with an
+// alert record type.
+func (c *Conn) ReadRecord(b []byte) (n int, info RecordInfo, err error) {
+	if len(b) == 0 {
+		return 0, info, nil
+	}
+	c.statsHandshakeStarted()
+	err = errTryAgain
+	for err == errTryAgain {
+		n, errcb := c.read(b, &info.End)
+		err = c.handleError(errcb)
+		if err == nil {
+			c.flushOutputBufferAsync()
+			c.statsRead(n, nil)
+			info.Type = RecordTypeApplicationData
+			return n, info, nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+	}
+	c.statsRead(0, err)
+	if err == io.EOF {
+		info = RecordInfo{Type: RecordTypeAlert, End: true}
+	}
+	return 0, info, c.annotateError(err)
+}
@@ -0,0 +1,180 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// identity is a certificate chain, leaf first, and the key of the leaf.
+type identity struct {
+	chain []*Certificate
+	key   PrivateKey
+}
+
+// ReloadCertificate replaces the certificate chain and the private key
+// presented by connections created from the context. The chain may be in any
+// order; the certificate matching the key is the leaf. The swap is atomic:
+// every handshake starting after ReloadCertificate returns uses the new
+// identity, established connections are left alone, and the identity in use
+// is kept if an error is returned.
+//
+// The identity is installed in every connection from a certificate
+// callback, which the first call enables. That call should be made before
+// the context is in use, like other setters; the following ones are safe at
+// any time. The identity takes precedence over the ones set with
+// UseCertificate, UseCertificateChain and AddKeyPair for its key type.
+func (c *Ctx) ReloadCertificate(certPEM, keyPEM []byte) error {
+	certs, err := loadCertificateChainFromPEM(certPEM)
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		return errors.New("no PEM certificate found")
+	}
+	key, err := LoadPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return err
+	}
+	leaf := matchPrivateKey(certs, key)
+	if leaf < 0 {
+		return errors.New("private key matches none of the certificates")
+	}
+	pile := append(append([]*Certificate(nil), certs[:leaf]...),
+		certs[leaf+1:]...)
+	chain, err := BuildCertificateChain(certs[leaf], pile, nil)
+	if err != nil {
+		return err
+	}
+
+	c.identity_once.Do(func() {
+		C.X_SSL_CTX_enable_cert_cb(c.ctx)
+	})
+	c.identity_mu.Lock()
+	c.identity = &identity{chain: chain, key: key}
+	c.identity_mu.Unlock()
+	return nil
+}
+
+// use installs the identity in ssl.
+func (id *identity) use(ssl *C.SSL) bool {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	// the references are taken by OpenSSL
+	if C.SSL_use_certificate(ssl, id.chain[0].x) != 1 ||
+		C.SSL_use_PrivateKey(ssl, id.key.evpPKey()) != 1 ||
+		C.X_SSL_clear_chain_certs(ssl) != 1 {
+		return false
+	}
+	for _, cert := range id.chain[1:] {
+		if C.X_SSL_add1_chain_cert(ssl, cert.x) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+//export go_ssl_ctx_cert_cb_thunk
+func go_ssl_ctx_cert_cb_thunk(p unsafe.Pointer, ssl *C.SSL) C.int {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Critf("openssl: certificate callback panic'd: %v", err)
+			os.Exit(1)
+		}
+	}()
+	c := pointers.Restore(p).(*Ctx)
+	c.identity_mu.RLock()
+	id := c.identity
+	c.identity_mu.RUnlock()
+	if id == nil {
+		return 1
+	}
+	if !id.use(ssl) {
+		logger.Warnf("openssl: failed to use the reloaded certificate: %v",
+			errorFromErrorQueue())
+		return 0
+	}
+	return 1
+}
+
+// WatchCertificateFiles loads the certificate chain and the private key
+// files with ReloadCertificate, then checks them every interval and reloads
+// them when their content changes, e.g. after a renewal. Failed reloads,
+// such as of a half written renewal, keep the identity in use and are
+// passed to onError, or logged if it is nil. The returned function stops
+// the watch; the context is kept alive until it is called.
+func (c *Ctx) WatchCertificateFiles(certFile, keyFile string,
+	interval time.Duration, onError func(error)) (stop func(), err error) {
+	if interval <= 0 {
+		return nil, errors.New("watch interval must be positive")
+	}
+	var certPEM, keyPEM []byte
+	reload := func() error {
+		newCert, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			return err
+		}
+		newKey, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(newCert, certPEM) && bytes.Equal(newKey, keyPEM) {
+			return nil
+		}
+		if err := c.ReloadCertificate(newCert, newKey); err != nil {
+			return err
+		}
+		certPEM, keyPEM = newCert, newKey
+		return nil
+	}
+	if err := reload(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if err := reload(); err == nil {
+				continue
+			} else if onError != nil {
+				onError(err)
+			} else {
+				logger.Warnf("openssl: failed to reload '%s': %v",
+					certFile, err)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}, nil
+}
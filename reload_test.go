@@ -0,0 +1,172 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serverCommonName connects a client to a server of ctx and returns the
+// client and the common name of the server certificate.
+func serverCommonName(t *testing.T, ctx *Ctx) (*Conn, *Conn, string) {
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doHandshake(t, server, client)
+	cert, err := client.PeerCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := cert.GetSubjectName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn, _ := name.GetEntry(NID_commonName)
+	return server, client, cn
+}
+
+func testIdentityPEM(t *testing.T, cert *testCertificate) ([]byte, []byte) {
+	return marshalTestPEM(t, cert.cert.MarshalPEM),
+		marshalTestPEM(t, cert.key.MarshalPKCS1PrivateKeyPEM)
+}
+
+func TestCtxReloadCertificate(t *testing.T) {
+	ca := newTestCertificate(t, "Test CA", true, nil)
+	intermediate := newTestCertificate(t, "Test Intermediate", true, ca)
+	first := newTestCertificate(t, "first", false, ca)
+	second := newTestCertificate(t, "second", false, intermediate)
+
+	ctx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.ReloadCertificate(testIdentityPEM(t, first)); err != nil {
+		t.Fatal(err)
+	}
+	server, client, cn := serverCommonName(t, ctx)
+	if cn != "first" {
+		t.Fatalf("unexpected certificate %q", cn)
+	}
+
+	// the leaf is found after the intermediate
+	certPEM, keyPEM := testIdentityPEM(t, second)
+	certPEM = append(marshalTestPEM(t, intermediate.cert.MarshalPEM),
+		certPEM...)
+	if err := ctx.ReloadCertificate(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	// a bad identity keeps the current one
+	if err := ctx.ReloadCertificate(certPEM,
+		marshalTestPEM(t, first.key.MarshalPKCS1PrivateKeyPEM)); err == nil {
+		t.Fatal("mismatching key is accepted")
+	}
+
+	// the established connection still works
+	go server.Write([]byte("x"))
+	if _, err := client.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	close_both(server, client)
+
+	server, client, cn = serverCommonName(t, ctx)
+	defer close_both(server, client)
+	if cn != "second" {
+		t.Fatalf("unexpected certificate %q", cn)
+	}
+	chain, err := client.PeerCertificateChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("unexpected chain length %d", len(chain))
+	}
+}
+
+func TestCtxWatchCertificateFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	write := func(cert *testCertificate) {
+		certPEM, keyPEM := testIdentityPEM(t, cert)
+		if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(newTestCertificate(t, "first", false, nil))
+	errs := make(chan error, 1)
+	stop, err := ctx.WatchCertificateFiles(certFile, keyFile,
+		10*time.Millisecond, func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	server, client, cn := serverCommonName(t, ctx)
+	close_both(server, client)
+	if cn != "first" {
+		t.Fatalf("unexpected certificate %q", cn)
+	}
+
+	// a certificate without its key is reported and ignored
+	if err := ioutil.WriteFile(keyFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed reload is not reported")
+	}
+
+	write(newTestCertificate(t, "second", false, nil))
+	deadline := time.Now().Add(5 * time.Second)
+	for cn != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate is not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+		server, client, cn = serverCommonName(t, ctx)
+		close_both(server, client)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// CertificateType is a type of the credentials that a peer authenticates
+// with, as negotiated by the certificate type extensions of RFC 7250.
+type CertificateType byte
+
+const (
+	CertificateTypeX509         CertificateType = 0
+	CertificateTypeRawPublicKey CertificateType = 2
+)
+
+// errRawPublicKeysUnsupported is returned before OpenSSL 3.2.
+var errRawPublicKeysUnsupported = errors.New(
+	"raw public keys are not supported")
+
+// SetClientCertificateTypes sets the certificate types of the client, in the
+// order of preference: the types a client can send, or the types a server
+// accepts from clients. The server picks the first type of the client that it
+// accepts too, and falls back to X.509 if the client sent none of them.
+// CertificateTypeRawPublicKey sends the public key of the configured private
+// key instead of the certificate. It requires OpenSSL 3.2 or newer.
+// See https://www.openssl.org/docs/man3.2/man3/SSL_CTX_set1_client_cert_type.html
+func (c *Ctx) SetClientCertificateTypes(types ...CertificateType) error {
+	return c.setCertificateTypes(false, types)
+}
+
+// SetServerCertificateTypes sets the certificate types of the server, in the
+// order of preference: the types a client accepts from servers, or the types
+// a server can send. See SetClientCertificateTypes.
+func (c *Ctx) SetServerCertificateTypes(types ...CertificateType) error {
+	return c.setCertificateTypes(true, types)
+}
+
+func (c *Ctx) setCertificateTypes(server bool, types []CertificateType) error {
+	if !rpk_support {
+		return errRawPublicKeysUnsupported
+	}
+	if len(types) == 0 {
+		return errors.New("no certificate types given")
+	}
+	var cserver C.int
+	if server {
+		cserver = 1
+	}
+	buf := make([]byte, len(types))
+	for i, t := range types {
+		buf[i] = byte(t)
+	}
+	if C.X_SSL_CTX_set1_cert_type(c.ctx, cserver,
+		(*C.uchar)(unsafe.Pointer(&buf[0])), C.size_t(len(buf))) != 1 {
+		return fmt.Errorf("failed to set certificate types: %w",
+			errorFromErrorQueue())
+	}
+	c.cert_types[cserver] = append([]CertificateType(nil), types...)
+	return nil
+}
+
+// AddExpectedRawPublicKey adds a raw public key that the peer may
+// authenticate with. The key is matched as a DANE-EE record, so the context
+// needs Ctx.DaneEnable, and SSL.DaneEnable is called with no base domain if
+// it was not already. The peer is only rejected on a mismatch with
+// VerifyPeer; otherwise Conn.PeerRawPublicKey can be checked after the
+// handshake. It requires OpenSSL 3.2 or newer.
+func (s *SSL) AddExpectedRawPublicKey(key PublicKey) error {
+	if !rpk_support {
+		return errRawPublicKeysUnsupported
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if C.X_SSL_add_expected_rpk(s.ssl, key.evpPKey()) != 1 {
+		return fmt.Errorf("failed to add the raw public key: %w",
+			errorFromErrorQueue())
+	}
+	runtime.KeepAlive(key)
+	return nil
+}
+
+// ClientCertificateType returns the negotiated certificate type of the
+// client. It is CertificateTypeX509 if the extension was not negotiated.
+func (c *Conn) ClientCertificateType() CertificateType {
+	return CertificateType(C.X_SSL_get_negotiated_cert_type(c.ssl, 0))
+}
+
+// ServerCertificateType returns the negotiated certificate type of the
+// server. It is CertificateTypeX509 if the extension was not negotiated.
+func (c *Conn) ServerCertificateType() CertificateType {
+	return CertificateType(C.X_SSL_get_negotiated_cert_type(c.ssl, 1))
+}
+
+// PeerRawPublicKey returns the raw public key that the peer authenticated
+// with, when the negotiated certificate type of the peer is
+// CertificateTypeRawPublicKey.
+func (c *Conn) PeerRawPublicKey() (PublicKey, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.is_shutdown {
+		return nil, errors.New("connection closed")
+	}
+	pkey := C.X_SSL_get1_peer_rpk(c.ssl)
+	if pkey == nil {
+		return nil, errors.New("no peer raw public key found")
+	}
+	key := &pKey{key: pkey}
+	setPKeyFinalizer(key)
+	return key, nil
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"testing"
+)
+
+func TestRawPublicKeys(t *testing.T) {
+	if !rpk_support {
+		ctx := GetCtx(t)
+		if err := ctx.SetServerCertificateTypes(
+			CertificateTypeRawPublicKey); err == nil {
+			t.Fatal("expected an error before OpenSSL 3.2")
+		}
+		t.Skip("raw public keys need OpenSSL 3.2 or newer")
+	}
+	serverKey, err := LoadPrivateKeyFromPEM(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handshake := func(expected PublicKey) (*Conn, error) {
+		serverCtx := GetCtx(t)
+		if err := serverCtx.SetServerCertificateTypes(
+			CertificateTypeRawPublicKey, CertificateTypeX509); err != nil {
+			t.Fatal(err)
+		}
+		clientCtx, err := NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := clientCtx.DaneEnable(); err != nil {
+			t.Fatal(err)
+		}
+		if err := clientCtx.SetServerCertificateTypes(
+			CertificateTypeRawPublicKey); err != nil {
+			t.Fatal(err)
+		}
+		clientCtx.SetVerify(VerifyPeer, nil)
+
+		serverConn, clientConn := NetPipe(t)
+		server, err := Server(serverConn, serverCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.AddExpectedRawPublicKey(expected); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			server.Handshake()
+			server.Close()
+		}()
+		if err := client.Handshake(); err != nil {
+			client.Close()
+			return nil, err
+		}
+		return client, nil
+	}
+
+	client, err := handshake(serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if typ := client.ServerCertificateType(); typ != CertificateTypeRawPublicKey {
+		t.Fatalf("negotiated server certificate type %d", typ)
+	}
+	if typ := client.ClientCertificateType(); typ != CertificateTypeX509 {
+		t.Fatalf("negotiated client certificate type %d", typ)
+	}
+	peerKey, err := client.PeerRawPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !peerKey.Equal(serverKey) {
+		t.Fatal("peer raw public key mismatch")
+	}
+
+	if _, err := handshake(otherKey); err == nil {
+		t.Fatal("handshake succeeded with an unexpected raw public key")
+	}
+}
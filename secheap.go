@@ -0,0 +1,95 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// InitSecureHeap sets up the OpenSSL secure heap of size bytes, split in
+// blocks of at least minSize bytes; both must be powers of two. The heap
+// is locked in memory, excluded from core dumps and zeroized on free.
+// OpenSSL then keeps private keys there, and the LoadPrivateKey functions
+// copy the encoded keys there before parsing them. It can only be set up
+// once and requires OpenSSL 1.1.1 or newer.
+func InitSecureHeap(size, minSize int) error {
+	if !ed25519_support {
+		return errors.New("secure heap requires OpenSSL 1.1.1")
+	}
+	if size <= 0 || size&(size-1) != 0 || minSize <= 0 ||
+		minSize&(minSize-1) != 0 {
+		return errors.New("secure heap sizes must be powers of two")
+	}
+	switch C.X_CRYPTO_secure_malloc_init(C.size_t(size), C.size_t(minSize)) {
+	case 1:
+		return nil
+	case 2:
+		// the heap works but is not locked, which defeats its purpose
+		C.X_CRYPTO_secure_malloc_done()
+		return errors.New("failed to lock the secure heap in memory")
+	default:
+		return errors.New("failed to initialize the secure heap")
+	}
+}
+
+// SecureHeapInitialized reports whether the secure heap is set up.
+func SecureHeapInitialized() bool {
+	return C.X_CRYPTO_secure_malloc_initialized() == 1
+}
+
+// SecureHeapUsed returns the number of bytes allocated in the secure heap.
+func SecureHeapUsed() int {
+	return int(C.X_CRYPTO_secure_used())
+}
+
+// FreeSecureHeap releases the secure heap. It fails while anything is
+// allocated in it, e.g. private keys not yet garbage collected.
+func FreeSecureHeap() error {
+	if C.X_CRYPTO_secure_malloc_done() != 1 {
+		return errors.New("secure heap is still in use")
+	}
+	return nil
+}
+
+// newPrivateKeyBIO returns a memory BIO reading the encoded private key
+// and a function freeing it. The key is copied to the secure heap if it is
+// set up.
+func newPrivateKeyBIO(data []byte) (*C.BIO, func(), error) {
+	buf := unsafe.Pointer(&data[0])
+	free := func() {}
+	if SecureHeapInitialized() {
+		buf = C.X_OPENSSL_secure_malloc(C.size_t(len(data)))
+		if buf == nil {
+			return nil, nil, errors.New("failed to allocate secure memory")
+		}
+		C.memcpy(buf, unsafe.Pointer(&data[0]), C.size_t(len(data)))
+		free = func() {
+			C.X_OPENSSL_secure_clear_free(buf, C.size_t(len(data)))
+		}
+	}
+	bio := C.BIO_new_mem_buf(buf, C.int(len(data)))
+	if bio == nil {
+		free()
+		return nil, nil, errors.New("failed creating bio")
+	}
+	return bio, func() {
+		C.BIO_free(bio)
+		free()
+	}, nil
+}
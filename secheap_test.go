@@ -0,0 +1,71 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// TestSecureHeap runs in a child process since the secure heap can only be
+// set up once and would then hold the keys of all other tests.
+func TestSecureHeap(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+	if os.Getenv("GO_OPENSSL_TEST_SECURE_HEAP") != "1" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestSecureHeap$",
+			"-test.v")
+		cmd.Env = append(os.Environ(), "GO_OPENSSL_TEST_SECURE_HEAP=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s\n%s", err, out)
+		}
+		return
+	}
+
+	if SecureHeapInitialized() {
+		t.Fatal("secure heap set up before init")
+	}
+	if err := InitSecureHeap(1000, 16); err == nil {
+		t.Fatal("accepted a size that is not a power of two")
+	}
+	if err := InitSecureHeap(1<<16, 16); err != nil {
+		t.Skip(err)
+	}
+	if !SecureHeapInitialized() {
+		t.Fatal("secure heap not set up")
+	}
+	used := SecureHeapUsed()
+	key, err := LoadPrivateKeyFromPEM(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if SecureHeapUsed() <= used {
+		t.Fatal("private key not in the secure heap")
+	}
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	sig, err := key.Sign(SHA256_Method, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Verify(SHA256_Method, data, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := FreeSecureHeap(); err == nil {
+		t.Fatal("freed the secure heap in use")
+	}
+}
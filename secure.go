@@ -0,0 +1,94 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"time"
+)
+
+// SecureCipherList is the TLS 1.2 cipher list used by NewServerCtxSecure and
+// NewClientCtxSecure: forward secret AEAD suites only. TLS 1.3 suites are
+// left at the OpenSSL defaults, which are all strong.
+const SecureCipherList = "ECDHE-ECDSA-AES128-GCM-SHA256:" +
+	"ECDHE-RSA-AES128-GCM-SHA256:" +
+	"ECDHE-ECDSA-AES256-GCM-SHA384:" +
+	"ECDHE-RSA-AES256-GCM-SHA384:" +
+	"ECDHE-ECDSA-CHACHA20-POLY1305:" +
+	"ECDHE-RSA-CHACHA20-POLY1305"
+
+// SecureTicketKeyRotation is how often NewServerCtxSecure rotates session
+// ticket keys.
+const SecureTicketKeyRotation = 12 * time.Hour
+
+func newCtxSecure() (*Ctx, error) {
+	c, err := NewCtx()
+	if err != nil {
+		return nil, err
+	}
+	if !c.SetMinProtoVersion(TLS1_2_VERSION) {
+		return nil, errors.New("failed to set minimum protocol version")
+	}
+	if err := c.SetCipherList(SecureCipherList); err != nil {
+		return nil, err
+	}
+	c.SetOptions(NoCompression | NoRenegotiation)
+	return c, nil
+}
+
+// NewServerCtxSecure creates a server context with modern defaults: TLS 1.2
+// or newer, strong cipher suites preferred by the server, no compression, no
+// renegotiation and session tickets with keys rotated every
+// SecureTicketKeyRotation. The certificate and private key still need to be
+// configured.
+func NewServerCtxSecure() (*Ctx, error) {
+	c, err := newCtxSecure()
+	if err != nil {
+		return nil, err
+	}
+	c.SetOptions(CipherServerPreference)
+	store, err := NewRotatingTicketStore(SecureTicketKeyRotation)
+	if err != nil {
+		return nil, err
+	}
+	c.SetTicketStore(store)
+	return c, nil
+}
+
+// NewClientCtxSecure creates a client context with modern defaults: TLS 1.2
+// or newer, strong cipher suites, no compression, no renegotiation, peer
+// verification against the default certificate authorities and host name
+// verification. Dial checks the server name of each connection in the
+// handshake unless InsecureSkipHostVerification is set. The connections made
+// with Client need the name set with SSL.SetVerifyHostname, their handshakes
+// fail otherwise, and SetTlsExtHostName to send it in the SNI extension.
+func NewClientCtxSecure() (*Ctx, error) {
+	c, err := newCtxSecure()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetDefaultVerifyPaths(); err != nil {
+		return nil, err
+	}
+	c.SetVerifyMode(VerifyPeer)
+	c.verify_host = true
+	c.verify_config_once.Do(func() {
+		C.X_SSL_CTX_enable_cert_verify_cb(c.ctx)
+	})
+	return c, nil
+}
@@ -0,0 +1,171 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+// ClientSessionCache stores the sessions of client connections for
+// resumption, like tls.ClientSessionCache. The sessions are DER encoded, as
+// returned by Conn.GetSession. Implementations must be safe for concurrent
+// use.
+type ClientSessionCache interface {
+	// Get returns the session stored for key.
+	Get(key string) (session []byte, ok bool)
+	// Put stores session for key. A nil session removes the entry.
+	Put(key string, session []byte)
+}
+
+// defaultSessionCacheCapacity is the capacity of an LRU cache created with
+// a non-positive capacity.
+const defaultSessionCacheCapacity = 64
+
+type lruSessionEntry struct {
+	key     string
+	session []byte
+}
+
+type lruSessionCache struct {
+	mtx      sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+// NewLRUClientSessionCache returns a ClientSessionCache that keeps up to
+// capacity sessions and evicts the least recently used ones. If capacity is
+// less than 1, a default capacity is used.
+func NewLRUClientSessionCache(capacity int) ClientSessionCache {
+	if capacity < 1 {
+		capacity = defaultSessionCacheCapacity
+	}
+	return &lruSessionCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element)}
+}
+
+func (c *lruSessionCache) Get(key string) ([]byte, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruSessionEntry).session, true
+}
+
+func (c *lruSessionCache) Put(key string, session []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		if session == nil {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+			return
+		}
+		elem.Value.(*lruSessionEntry).session = session
+		c.order.MoveToFront(elem)
+		return
+	}
+	if session == nil {
+		return
+	}
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruSessionEntry).key)
+	}
+	entry := &lruSessionEntry{key: key, session: session}
+	c.entries[key] = c.order.PushFront(entry)
+}
+
+// DefaultClientSessionCache is a cache that the contexts may share with
+// Ctx.SetClientSessionCache. It isn't used unless set. A resumed session
+// keeps the client certificate and the verification result of the original
+// connection, so a context resumes only the sessions of the contexts with
+// the same trust store, i.e. itself and the contexts cloned from it or from
+// the same context with Clone.
+var DefaultClientSessionCache = NewLRUClientSessionCache(0)
+
+// SetClientSessionCache sets the cache of the sessions of the connections
+// made by Dial and the related functions with the context. The resumption is
+// disabled by default and with a nil cache. The sessions are keyed by the
+// address, the verification settings and the trust store of the context, so
+// a session is resumed only by the contexts sharing the store through Clone.
+// Such contexts must use the same client certificate. It must not be called
+// concurrently with Dial.
+func (c *Ctx) SetClientSessionCache(cache ClientSessionCache) {
+	c.session_cache = cache
+}
+
+// clientSessionCache returns the cache of the client sessions of c, if any.
+func (c *Ctx) clientSessionCache() ClientSessionCache {
+	return c.session_cache
+}
+
+// sessionCacheKey returns the key of the sessions with serverName at addr.
+// It includes the verification settings and the trust store, so that a
+// session established without verification or verified against other
+// certificates isn't resumed by a context that requires it.
+func sessionCacheKey(addr, serverName string, ctx *Ctx,
+	flags DialFlags) string {
+	return fmt.Sprintf("%s|%s|%d|%d|%d", addr, serverName, ctx.VerifyMode(),
+		flags&insecureDialFlags, ctx.store_id)
+}
+
+// lastStoreId is the last trust store identifier given to a new context.
+var lastStoreId uint64
+
+// useClientSessionCache makes the new sessions of conn stored in cache with
+// key.
+func (c *Conn) useClientSessionCache(cache ClientSessionCache, key string) {
+	c.ctx.session_cb_once.Do(func() {
+		C.X_SSL_CTX_enable_client_session_cb(c.ctx.ctx)
+	})
+	c.session_cache = cache
+	c.session_key = key
+}
+
+//export go_ssl_new_session_cb_thunk
+func go_ssl_new_session_cb_thunk(p unsafe.Pointer, session *C.SSL_SESSION) {
+	var s *SSL
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Critf("openssl: new session callback panic'd%s: %v",
+				s.correlationTag(), err)
+			os.Exit(1)
+		}
+	}()
+	s = pointers.Restore(p).(*SSL)
+
+	if s.session_cache == nil {
+		return
+	}
+	der, err := encodeSession(session)
+	if err != nil {
+		return
+	}
+	s.session_cache.Put(s.session_key, der)
+}
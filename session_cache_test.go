@@ -0,0 +1,234 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLRUClientSessionCache(t *testing.T) {
+	cache := NewLRUClientSessionCache(2)
+	cache.Put("a", []byte("1"))
+	cache.Put("b", []byte("2"))
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("session a is missing")
+	}
+	// b is the least recently used one now
+	cache.Put("c", []byte("3"))
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("session b is not evicted")
+	}
+	if s, ok := cache.Get("c"); !ok || !bytes.Equal(s, []byte("3")) {
+		t.Fatalf("unexpected session c %q", s)
+	}
+	cache.Put("a", nil)
+	if _, ok := cache.Get("a"); ok {
+		t.Fatal("session a is not removed")
+	}
+}
+
+func TestDialResumesCachedSession(t *testing.T) {
+	listener, err := Listen("tcp", "localhost:0", GetCtx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// TLS 1.3 tickets arrive before this byte
+			conn.Write([]byte("x"))
+			conn.Close()
+		}
+	}()
+
+	cache := NewLRUClientSessionCache(0)
+	withCache := false
+	base, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func() bool {
+		// a fresh clone for every connection
+		ctx, err := base.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if withCache {
+			ctx.SetClientSessionCache(cache)
+		}
+		conn, err := Dial("tcp", listener.Addr().String(), ctx,
+			InsecureSkipHostVerification)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err := conn.Read(make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		return conn.SessionReused()
+	}
+	// the contexts don't cache the sessions by default
+	dial()
+	if dial() {
+		t.Fatal("session is resumed without a cache")
+	}
+
+	withCache = true
+	if dial() {
+		t.Fatal("first session is reused")
+	}
+	if !dial() {
+		t.Fatal("cached session is not resumed")
+	}
+
+	// the sessions are not shared with stricter verification settings
+	addr := listener.Addr().String()
+	host, err := parseHost(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get(sessionCacheKey(addr, host, base,
+		InsecureSkipHostVerification)); !ok {
+		t.Fatal("session is not cached")
+	}
+	if _, ok := cache.Get(sessionCacheKey(addr, host, base, 0)); ok {
+		t.Fatal("session is cached for host verification")
+	}
+
+	// nor with the contexts trusting other certificates
+	other, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get(sessionCacheKey(addr, host, other,
+		InsecureSkipHostVerification)); ok {
+		t.Fatal("session is cached for another trust store")
+	}
+	other.SetClientSessionCache(cache)
+	conn, err := Dial("tcp", addr, other, InsecureSkipHostVerification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if conn.SessionReused() {
+		t.Fatal("session is resumed with another trust store")
+	}
+}
+
+func TestDialSessionResumes(t *testing.T) {
+	listener, err := Listen("tcp", "localhost:0", GetCtx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// TLS 1.3 tickets arrive before this byte
+			conn.Write([]byte("x"))
+			conn.Close()
+		}
+	}()
+
+	dial := func(session []byte) ([]byte, bool) {
+		ctx, err := NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// panicked with cgo pointer checks when the session was resumed
+		conn, err := DialSession("tcp", listener.Addr().String(), ctx,
+			InsecureSkipHostVerification, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err := conn.Read(make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		session, err = conn.GetSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session, conn.SessionReused()
+	}
+	session, _ := dial(nil)
+	if _, reused := dial(session); !reused {
+		t.Fatal("session is not resumed")
+	}
+}
+
+func TestDialInsecureSessionNotResumedStrictly(t *testing.T) {
+	listener, err := Listen("tcp", "localhost:0", GetCtx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("x"))
+			conn.Close()
+		}
+	}()
+
+	cache := NewLRUClientSessionCache(0)
+	// the server certificate is not trusted by the client
+	base, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base.SetVerifyMode(VerifyPeer)
+	base.SetClientSessionCache(cache)
+	dial := func(flags DialFlags) (bool, error) {
+		ctx, err := base.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := Dial("tcp", listener.Addr().String(), ctx, flags)
+		if err != nil {
+			return false, err
+		}
+		defer conn.Close()
+		if _, err := conn.Read(make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		return conn.SessionReused(), nil
+	}
+	insecure := InsecureSkipHostVerification | InsecureSkipChainVerification
+	if _, err := dial(insecure); err != nil {
+		t.Fatal(err)
+	}
+	if reused, err := dial(insecure); err != nil || !reused {
+		t.Fatalf("insecure session is not resumed: %v", err)
+	}
+	// a strict dial does a full handshake and fails the verification
+	if _, err := dial(InsecureSkipHostVerification); err == nil {
+		t.Fatal("strict dial resumed an insecure session")
+	}
+}
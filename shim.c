@@ -25,6 +25,21 @@
 #include <openssl/err.h>
 #include <openssl/evp.h>
 #include <openssl/ssl.h>
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+#include <openssl/kdf.h>
+#endif
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+#include <openssl/store.h>
+#include <openssl/ui.h>
+#endif
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+#include <openssl/core_names.h>
+#include <openssl/proverr.h>
+#include <openssl/provider.h>
+#endif
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+#include <openssl/hpke.h>
+#endif
 
 #include "_cgo_export.h"
 
@@ -38,6 +53,22 @@ static int go_write_bio_puts(BIO *b, const char *str) {
 	return go_write_bio_write(b, (char*)str, (int)strlen(str));
 }
 
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+const int X_EVP_KDF_SUPPORT = 1;
+#else
+const int X_EVP_KDF_SUPPORT = 0;
+#endif
+
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+const int X_EDDSA_INSTANCE_SUPPORT = 1;
+const int X_RPK_SUPPORT = 1;
+const int X_HPKE_SUPPORT = 1;
+#else
+const int X_EDDSA_INSTANCE_SUPPORT = 0;
+const int X_RPK_SUPPORT = 0;
+const int X_HPKE_SUPPORT = 0;
+#endif
+
 /*
  ************************************************
  * v1.1.1 and later implementation
@@ -47,6 +78,10 @@ static int go_write_bio_puts(BIO *b, const char *str) {
 
 const int X_ED25519_SUPPORT = 1;
 int X_EVP_PKEY_ED25519 = EVP_PKEY_ED25519;
+int X_EVP_PKEY_ED448 = EVP_PKEY_ED448;
+int X_EVP_PKEY_X25519 = EVP_PKEY_X25519;
+int X_EVP_PKEY_X448 = EVP_PKEY_X448;
+int X_EVP_PKEY_RSA_PSS = EVP_PKEY_RSA_PSS;
 
 int X_EVP_DigestSignInit(EVP_MD_CTX *ctx, EVP_PKEY_CTX **pctx,
 		const EVP_MD *type, ENGINE *e, EVP_PKEY *pkey){
@@ -69,10 +104,42 @@ int X_EVP_DigestVerify(EVP_MD_CTX *ctx, const unsigned char *sigret,
 	return EVP_DigestVerify(ctx, sigret, siglen, tbs, tbslen);
 }
 
+const EVP_MD *X_EVP_sha512_256() {
+	return EVP_sha512_256();
+}
+
+const EVP_MD *X_EVP_sha3_224() {
+	return EVP_sha3_224();
+}
+
+const EVP_MD *X_EVP_sha3_256() {
+	return EVP_sha3_256();
+}
+
+const EVP_MD *X_EVP_sha3_384() {
+	return EVP_sha3_384();
+}
+
+const EVP_MD *X_EVP_sha3_512() {
+	return EVP_sha3_512();
+}
+
+const EVP_MD *X_EVP_blake2b512() {
+	return EVP_blake2b512();
+}
+
+const EVP_MD *X_EVP_blake2s256() {
+	return EVP_blake2s256();
+}
+
 #else
 
 const int X_ED25519_SUPPORT = 0;
 int X_EVP_PKEY_ED25519 = EVP_PKEY_NONE;
+int X_EVP_PKEY_ED448 = EVP_PKEY_NONE;
+int X_EVP_PKEY_X25519 = EVP_PKEY_NONE;
+int X_EVP_PKEY_X448 = EVP_PKEY_NONE;
+int X_EVP_PKEY_RSA_PSS = EVP_PKEY_NONE;
 
 int X_EVP_DigestSignInit(EVP_MD_CTX *ctx, EVP_PKEY_CTX **pctx,
 		const EVP_MD *type, ENGINE *e, EVP_PKEY *pkey){
@@ -95,6 +162,34 @@ int X_EVP_DigestVerify(EVP_MD_CTX *ctx, const unsigned char *sigret,
 	return 0;
 }
 
+const EVP_MD *X_EVP_sha512_256() {
+	return NULL;
+}
+
+const EVP_MD *X_EVP_sha3_224() {
+	return NULL;
+}
+
+const EVP_MD *X_EVP_sha3_256() {
+	return NULL;
+}
+
+const EVP_MD *X_EVP_sha3_384() {
+	return NULL;
+}
+
+const EVP_MD *X_EVP_sha3_512() {
+	return NULL;
+}
+
+const EVP_MD *X_EVP_blake2b512() {
+	return NULL;
+}
+
+const EVP_MD *X_EVP_blake2s256() {
+	return NULL;
+}
+
 #endif
 
 /*
@@ -200,6 +295,10 @@ int X_X509_add_ref(X509* x509) {
 	return X509_up_ref(x509);
 }
 
+int X_X509_STORE_add_ref(X509_STORE* store) {
+	return X509_STORE_up_ref(store);
+}
+
 const ASN1_TIME *X_X509_get0_notBefore(const X509 *x) {
 	return X509_get0_notBefore(x);
 }
@@ -296,6 +395,11 @@ int X_X509_add_ref(X509* x509) {
 	return 1;
 }
 
+int X_X509_STORE_add_ref(X509_STORE* store) {
+	CRYPTO_add(&store->references, 1, CRYPTO_LOCK_X509_STORE);
+	return 1;
+}
+
 const ASN1_TIME *X_X509_get0_notBefore(const X509 *x) {
 	return x->cert_info->validity->notBefore;
 }
@@ -397,6 +501,31 @@ int X_shim_init() {
 	return 0;
 }
 
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+const int X_ERR_LIB_PROV = ERR_LIB_PROV;
+const int X_PROV_R_BAD_DECRYPT = PROV_R_BAD_DECRYPT;
+#else
+const int X_ERR_LIB_PROV = -1;
+const int X_PROV_R_BAD_DECRYPT = -1;
+#endif
+
+int X_ERR_GET_LIB(unsigned long e) {
+	return ERR_GET_LIB(e);
+}
+
+int X_ERR_GET_FUNC(unsigned long e) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	// function codes are gone since OpenSSL 3.0
+	return 0;
+#else
+	return ERR_GET_FUNC(e);
+#endif
+}
+
+int X_ERR_GET_REASON(unsigned long e) {
+	return ERR_GET_REASON(e);
+}
+
 void * X_OPENSSL_malloc(size_t size) {
 	return OPENSSL_malloc(size);
 }
@@ -420,13 +549,61 @@ long X_SSL_clear_options(SSL* ssl, long options) {
 long X_SSL_set_tlsext_host_name(SSL *ssl, const char *name) {
    return SSL_set_tlsext_host_name(ssl, name);
 }
+long X_SSL_set_tlsext_status_type(SSL *ssl, int type) {
+   return SSL_set_tlsext_status_type(ssl, type);
+}
+long X_SSL_get_tlsext_status_ocsp_resp(SSL *ssl, const unsigned char **resp) {
+   return SSL_get_tlsext_status_ocsp_resp(ssl, resp);
+}
+STACK_OF(X509) *X_SSL_get0_verified_chain(const SSL *ssl) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+   return SSL_get0_verified_chain(ssl);
+#else
+   return NULL;
+#endif
+}
 const char * X_SSL_get_cipher_name(const SSL *ssl) {
    return SSL_get_cipher_name(ssl);
 }
+long X_SSL_set_mode(SSL* ssl, long modes) {
+	return SSL_set_mode(ssl, modes);
+}
+
+long X_SSL_clear_mode(SSL* ssl, long modes) {
+	return SSL_clear_mode(ssl, modes);
+}
+
+long X_SSL_get_mode(SSL* ssl) {
+	return SSL_get_mode(ssl);
+}
+
 int X_SSL_session_reused(SSL *ssl) {
     return SSL_session_reused(ssl);
 }
 
+int X_SSL_read_batch(SSL *ssl, void *buf, int num, int *last) {
+	int total = 0;
+	*last = 1;
+	for (;;) {
+		int rv = SSL_read(ssl, (char *)buf + total, num - total);
+		if (rv <= 0) {
+			if (total == 0) {
+				return rv;
+			}
+			*last = rv;
+			return total;
+		}
+		total += rv;
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+		if (total >= num || !SSL_has_pending(ssl)) {
+#else
+		if (total >= num || SSL_pending(ssl) == 0) {
+#endif
+			return total;
+		}
+	}
+}
+
 int X_SSL_new_index() {
 	return SSL_get_ex_new_index(0, NULL, NULL, NULL, go_ssl_crypto_ex_free);
 }
@@ -443,16 +620,35 @@ int X_SSL_verify_cb(int ok, X509_STORE_CTX* store) {
 	return go_ssl_verify_cb_thunk(p, ok, store);
 }
 
-void X_SSL_toggle_tracing(SSL* ssl, FILE* output, short enable) {
+void X_SSL_toggle_tracing(SSL* ssl, FILE* output, short enable, const char *prefix) {
 	if (enable) {
+		BIO *bio = BIO_new_fp(output, BIO_NOCLOSE);
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+		if (bio != NULL && prefix != NULL) {
+			BIO *pbio = BIO_new(BIO_f_prefix());
+			if (pbio != NULL && BIO_set_prefix(pbio, prefix) == 1) {
+				bio = BIO_push(pbio, bio);
+			} else {
+				BIO_free(pbio);
+			}
+		}
+#endif
 		SSL_set_msg_callback(ssl, SSL_trace);
-		SSL_set_msg_callback_arg(ssl, BIO_new_fp(output, BIO_NOCLOSE));
+		SSL_set_msg_callback_arg(ssl, bio);
 	} else {
 		SSL_set_msg_callback(ssl, NULL);
 		SSL_set_msg_callback_arg(ssl, NULL);
 	}
 }
 
+int X_SSL_get_negotiated_group(SSL *ssl) {
+#if defined(SSL_get_negotiated_group)
+	return SSL_get_negotiated_group(ssl);
+#else
+	return NID_undef;
+#endif
+}
+
 const SSL_METHOD *X_SSLv23_method() {
 	return SSLv23_method();
 }
@@ -485,6 +681,42 @@ const SSL_METHOD *X_TLSv1_2_method() {
 #endif
 }
 
+const SSL_METHOD *X_DTLS_method() {
+#if OPENSSL_VERSION_NUMBER >= 0x1000200fL
+	return DTLS_method();
+#else
+	return DTLSv1_method();
+#endif
+}
+
+int X_SSL_is_dtls(const SSL *ssl) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	return SSL_is_dtls(ssl);
+#else
+	int version = SSL_version(ssl);
+	return version == DTLS1_BAD_VER || version == DTLS_ANY_VERSION ||
+		(version >> 8) == 0xfe;
+#endif
+}
+
+int X_SSL_CTX_set_tlsext_use_srtp(SSL_CTX *ctx, const char *profiles) {
+#ifndef OPENSSL_NO_SRTP
+	return SSL_CTX_set_tlsext_use_srtp(ctx, profiles);
+#else
+	return 1;
+#endif
+}
+
+const char *X_SSL_get_selected_srtp_profile(SSL *ssl) {
+#ifndef OPENSSL_NO_SRTP
+	SRTP_PROTECTION_PROFILE *profile = SSL_get_selected_srtp_profile(ssl);
+	if (profile != NULL) {
+		return profile->name;
+	}
+#endif
+	return NULL;
+}
+
 int X_SSL_CTX_new_index() {
 	return SSL_CTX_get_ex_new_index(0, NULL, NULL, NULL, NULL);
 }
@@ -505,6 +737,138 @@ int X_SSL_CTX_set_max_proto_version(SSL_CTX *ctx, int version) {
 #endif
 }
 
+// x_ssl_ctx_copy_ciphers sets the cipher list of src, and its TLS 1.3
+// cipher suites, on dst.
+static int x_ssl_ctx_copy_ciphers(SSL_CTX *dst, SSL_CTX *src) {
+	STACK_OF(SSL_CIPHER) *sk = SSL_CTX_get_ciphers(src);
+	size_t size = 1;
+	int i, rv = 1;
+	for (i = 0; i < sk_SSL_CIPHER_num(sk); i++) {
+		size += strlen(SSL_CIPHER_get_name(sk_SSL_CIPHER_value(sk, i))) + 1;
+	}
+	char *list = calloc(1, size);
+	char *suites = calloc(1, size);
+	if (list == NULL || suites == NULL) {
+		free(list);
+		free(suites);
+		return 0;
+	}
+	for (i = 0; i < sk_SSL_CIPHER_num(sk); i++) {
+		const SSL_CIPHER *cipher = sk_SSL_CIPHER_value(sk, i);
+		char *out = list;
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+		if (strcmp(SSL_CIPHER_get_version(cipher), "TLSv1.3") == 0) {
+			out = suites;
+		}
+#endif
+		if (*out != '\0') {
+			strcat(out, ":");
+		}
+		strcat(out, SSL_CIPHER_get_name(cipher));
+	}
+	if (*list != '\0') {
+		rv = SSL_CTX_set_cipher_list(dst, list);
+	}
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	if (rv == 1) {
+		rv = SSL_CTX_set_ciphersuites(dst, suites);
+	}
+#endif
+	free(list);
+	free(suites);
+	return rv;
+}
+
+// x_ssl_ctx_copy_certificates sets the certificates, keys and chains of src
+// on dst. The slots of src are walked on an SSL, which has a copy of them,
+// so that the current slot of src isn't changed.
+static int x_ssl_ctx_copy_certificates(SSL_CTX *dst, SSL_CTX *src) {
+	STACK_OF(X509) *chain = NULL;
+	int i, rv = 0;
+	SSL *ssl = SSL_new(src);
+	if (ssl == NULL) {
+		return 0;
+	}
+	int more = SSL_set_current_cert(ssl, SSL_CERT_SET_FIRST);
+	if (more != 1 && SSL_get_certificate(ssl) != NULL) {
+		// a certificate without a key isn't a slot to walk
+		if (SSL_CTX_use_certificate(dst, SSL_get_certificate(ssl)) != 1) {
+			goto end;
+		}
+	}
+	while (more == 1) {
+		if (SSL_CTX_use_certificate(dst, SSL_get_certificate(ssl)) != 1 ||
+				SSL_CTX_use_PrivateKey(dst, SSL_get_privatekey(ssl)) != 1 ||
+				SSL_get0_chain_certs(ssl, &chain) != 1 ||
+				SSL_CTX_set1_chain(dst, chain) != 1) {
+			goto end;
+		}
+		more = SSL_set_current_cert(ssl, SSL_CERT_SET_NEXT);
+	}
+	chain = NULL;
+	SSL_CTX_get_extra_chain_certs_only(src, &chain);
+	for (i = 0; chain != NULL && i < sk_X509_num(chain); i++) {
+		X509 *x = sk_X509_value(chain, i);
+		X_X509_add_ref(x);
+		if (SSL_CTX_add_extra_chain_cert(dst, x) != 1) {
+			X509_free(x);
+			goto end;
+		}
+	}
+	rv = 1;
+end:
+	SSL_free(ssl);
+	return rv;
+}
+
+int X_SSL_CTX_copy(SSL_CTX *dst, SSL_CTX *src) {
+	SSL_CTX_clear_options(dst, SSL_CTX_get_options(dst));
+	SSL_CTX_set_options(dst, SSL_CTX_get_options(src));
+	SSL_CTX_clear_mode(dst, SSL_CTX_get_mode(dst));
+	SSL_CTX_set_mode(dst, SSL_CTX_get_mode(src));
+#ifdef SSL_CTRL_GET_MIN_PROTO_VERSION
+	SSL_CTX_set_min_proto_version(dst, SSL_CTX_get_min_proto_version(src));
+	SSL_CTX_set_max_proto_version(dst, SSL_CTX_get_max_proto_version(src));
+#endif
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	SSL_CTX_set_security_level(dst, SSL_CTX_get_security_level(src));
+#endif
+	SSL_CTX_set_read_ahead(dst, SSL_CTX_get_read_ahead(src));
+	SSL_CTX_set_quiet_shutdown(dst, SSL_CTX_get_quiet_shutdown(src));
+	SSL_CTX_set_max_cert_list(dst, SSL_CTX_get_max_cert_list(src));
+
+	SSL_CTX_set_verify(dst, SSL_CTX_get_verify_mode(src),
+		SSL_CTX_get_verify_callback(src));
+	SSL_CTX_set_verify_depth(dst, SSL_CTX_get_verify_depth(src));
+	if (X509_VERIFY_PARAM_set1(SSL_CTX_get0_param(dst),
+			SSL_CTX_get0_param(src)) != 1) {
+		return 0;
+	}
+	// the trust store is shared
+	X509_STORE *store = SSL_CTX_get_cert_store(src);
+	if (store != NULL) {
+		X_X509_STORE_add_ref(store);
+		SSL_CTX_set_cert_store(dst, store);
+	}
+	STACK_OF(X509_NAME) *cas = SSL_CTX_get_client_CA_list(src);
+	if (cas != NULL) {
+		STACK_OF(X509_NAME) *dup = SSL_dup_CA_list(cas);
+		if (dup == NULL) {
+			return 0;
+		}
+		SSL_CTX_set_client_CA_list(dst, dup);
+	}
+
+	SSL_CTX_set_session_cache_mode(dst, SSL_CTX_get_session_cache_mode(src));
+	SSL_CTX_set_timeout(dst, SSL_CTX_get_timeout(src));
+	SSL_CTX_sess_set_cache_size(dst, SSL_CTX_sess_get_cache_size(src));
+
+	if (x_ssl_ctx_copy_ciphers(dst, src) != 1) {
+		return 0;
+	}
+	return x_ssl_ctx_copy_certificates(dst, src);
+}
+
 long X_SSL_CTX_set_options(SSL_CTX* ctx, long options) {
 	return SSL_CTX_set_options(ctx, options);
 }
@@ -525,6 +889,10 @@ long X_SSL_CTX_get_mode(SSL_CTX* ctx) {
 	return SSL_CTX_get_mode(ctx);
 }
 
+long X_SSL_CTX_clear_mode(SSL_CTX* ctx, long modes) {
+	return SSL_CTX_clear_mode(ctx, modes);
+}
+
 long X_SSL_CTX_set_session_cache_mode(SSL_CTX* ctx, long modes) {
 	return SSL_CTX_set_session_cache_mode(ctx, modes);
 }
@@ -549,6 +917,26 @@ long X_SSL_CTX_add_extra_chain_cert(SSL_CTX* ctx, X509 *cert) {
 	return SSL_CTX_add_extra_chain_cert(ctx, cert);
 }
 
+long X_SSL_CTX_clear_extra_chain_certs(SSL_CTX* ctx) {
+	return SSL_CTX_clear_extra_chain_certs(ctx);
+}
+
+long X_SSL_CTX_add1_chain_cert(SSL_CTX* ctx, X509 *cert) {
+	return SSL_CTX_add1_chain_cert(ctx, cert);
+}
+
+long X_SSL_CTX_clear_chain_certs(SSL_CTX* ctx) {
+	return SSL_CTX_clear_chain_certs(ctx);
+}
+
+long X_SSL_add1_chain_cert(SSL* ssl, X509 *cert) {
+	return SSL_add1_chain_cert(ssl, cert);
+}
+
+long X_SSL_clear_chain_certs(SSL* ssl) {
+	return SSL_clear_chain_certs(ssl);
+}
+
 long X_SSL_CTX_set_tmp_ecdh(SSL_CTX* ctx, EC_KEY *key) {
 	return SSL_CTX_set_tmp_ecdh(ctx, key);
 }
@@ -571,6 +959,188 @@ int X_SSL_CTX_verify_cb(int ok, X509_STORE_CTX* store) {
 	return go_ssl_ctx_verify_cb_thunk(p, ok, store);
 }
 
+static void x_ssl_ctx_handshake_msg_cb(int write_p, int version,
+		int content_type, const void *buf, size_t len, SSL *ssl, void *arg) {
+	// only whole handshake messages, which start with a 4 byte header
+	if (content_type != SSL3_RT_HANDSHAKE || len < 4) {
+		return;
+	}
+
+	SSL_CTX* ssl_ctx = SSL_get_SSL_CTX(ssl);
+	void* p = SSL_CTX_get_ex_data(ssl_ctx, get_ssl_ctx_idx());
+	go_handshake_msg_cb_thunk(p, ssl, write_p, (void *)buf, len);
+}
+
+void X_SSL_CTX_enable_handshake_msg_cb(SSL_CTX* ctx) {
+	SSL_CTX_set_msg_callback(ctx, x_ssl_ctx_handshake_msg_cb);
+}
+
+static void x_ssl_ctx_info_cb(const SSL *ssl, int where, int ret) {
+	if ((where & SSL_CB_READ_ALERT) != SSL_CB_READ_ALERT) {
+		return;
+	}
+
+	SSL_CTX* ssl_ctx = SSL_get_SSL_CTX(ssl);
+	void* p = SSL_CTX_get_ex_data(ssl_ctx, get_ssl_ctx_idx());
+	go_ssl_alert_cb_thunk(p, (SSL *)ssl, ret);
+}
+
+void X_SSL_CTX_enable_info_cb(SSL_CTX* ctx) {
+	SSL_CTX_set_info_callback(ctx, x_ssl_ctx_info_cb);
+}
+
+static int x_ssl_ctx_ocsp_status_cb(SSL *ssl, void *arg) {
+	// servers don't staple responses
+	if (SSL_is_server(ssl)) {
+		return SSL_TLSEXT_ERR_NOACK;
+	}
+
+	void* p = SSL_get_ex_data(ssl, get_ssl_idx());
+	if (p == NULL) {
+		return 1;
+	}
+	// get the pointer to the go SSL object and pass it back into the thunk
+	return go_ocsp_status_cb_thunk(p);
+}
+
+static int x_ssl_ctx_alpn_select_cb(SSL *ssl, const unsigned char **out,
+		unsigned char *outlen, const unsigned char *in, unsigned int inlen,
+		void *arg) {
+	SSL_CTX* ssl_ctx = SSL_get_SSL_CTX(ssl);
+	void* p = SSL_CTX_get_ex_data(ssl_ctx, get_ssl_ctx_idx());
+	return go_ssl_ctx_alpn_select_cb_thunk(p, (unsigned char **)out, outlen,
+		(unsigned char *)in, inlen);
+}
+
+void X_SSL_CTX_enable_alpn_select_cb(SSL_CTX* ctx) {
+	SSL_CTX_set_alpn_select_cb(ctx, x_ssl_ctx_alpn_select_cb, NULL);
+}
+
+static int x_ssl_ctx_cert_cb(SSL *ssl, void *arg) {
+	SSL_CTX* ssl_ctx = SSL_get_SSL_CTX(ssl);
+	void* p = SSL_CTX_get_ex_data(ssl_ctx, get_ssl_ctx_idx());
+	if (p == NULL) {
+		return 1;
+	}
+	return go_ssl_ctx_cert_cb_thunk(p, ssl);
+}
+
+void X_SSL_CTX_enable_cert_cb(SSL_CTX* ctx) {
+	SSL_CTX_set_cert_cb(ctx, x_ssl_ctx_cert_cb, NULL);
+}
+
+void X_SSL_CTX_enable_ocsp_status_cb(SSL_CTX* ctx) {
+	SSL_CTX_set_tlsext_status_cb(ctx, x_ssl_ctx_ocsp_status_cb);
+}
+
+static int x_ssl_new_session_cb(SSL *ssl, SSL_SESSION *session) {
+	void* p = SSL_get_ex_data(ssl, get_ssl_idx());
+	if (p != NULL) {
+		go_ssl_new_session_cb_thunk(p, session);
+	}
+	// the session is encoded by the thunk, it isn't referenced anymore
+	return 0;
+}
+
+void X_SSL_CTX_enable_client_session_cb(SSL_CTX* ctx) {
+	SSL_CTX_set_session_cache_mode(ctx,
+		SSL_CTX_get_session_cache_mode(ctx) | SSL_SESS_CACHE_CLIENT);
+	SSL_CTX_sess_set_new_cb(ctx, x_ssl_new_session_cb);
+}
+
+static int x_pem_password_cb(char *buf, int size, int rwflag, void *u) {
+	return go_pem_password_cb_thunk(u, buf, size);
+}
+
+EVP_PKEY *X_PEM_read_bio_PrivateKey_cb(BIO *bio, void *u) {
+	return PEM_read_bio_PrivateKey(bio, NULL, x_pem_password_cb, u);
+}
+
+EVP_PKEY *X_d2i_PKCS8PrivateKey_bio_cb(BIO *bio, void *u) {
+	return d2i_PKCS8PrivateKey_bio(bio, NULL, x_pem_password_cb, u);
+}
+
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+struct x_store {
+	OSSL_STORE_CTX *ctx;
+	UI_METHOD *ui;
+};
+#endif
+
+void *X_OSSL_STORE_open(const char *uri, void *u) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	struct x_store *store = OPENSSL_zalloc(sizeof(*store));
+	if (store == NULL) {
+		return NULL;
+	}
+	store->ui = UI_UTIL_wrap_read_pem_callback(x_pem_password_cb, 0);
+	if (store->ui == NULL) {
+		OPENSSL_free(store);
+		return NULL;
+	}
+	store->ctx = OSSL_STORE_open(uri, store->ui, u, NULL, NULL);
+	if (store->ctx == NULL) {
+		UI_destroy_method(store->ui);
+		OPENSSL_free(store);
+		return NULL;
+	}
+	return store;
+#else
+	return NULL;
+#endif
+}
+
+// X_OSSL_STORE_load loads the next object of the store. It returns 0 at the
+// end of the store, -1 on error, X_STORE_OTHER for objects that are skipped
+// and the type of the object otherwise.
+int X_OSSL_STORE_load(void *s, EVP_PKEY **pkey, X509 **cert) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	struct x_store *store = s;
+	OSSL_STORE_INFO *info;
+	int ret = X_STORE_OTHER;
+
+	if (OSSL_STORE_eof(store->ctx)) {
+		return 0;
+	}
+	info = OSSL_STORE_load(store->ctx);
+	if (info == NULL) {
+		if (OSSL_STORE_eof(store->ctx)) {
+			return 0;
+		}
+		return OSSL_STORE_error(store->ctx) ? -1 : X_STORE_OTHER;
+	}
+	switch (OSSL_STORE_INFO_get_type(info)) {
+	case OSSL_STORE_INFO_PKEY:
+		*pkey = OSSL_STORE_INFO_get1_PKEY(info);
+		ret = *pkey != NULL ? X_STORE_PRIVATE_KEY : -1;
+		break;
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	case OSSL_STORE_INFO_PUBKEY:
+		*pkey = OSSL_STORE_INFO_get1_PUBKEY(info);
+		ret = *pkey != NULL ? X_STORE_PUBLIC_KEY : -1;
+		break;
+#endif
+	case OSSL_STORE_INFO_CERT:
+		*cert = OSSL_STORE_INFO_get1_CERT(info);
+		ret = *cert != NULL ? X_STORE_CERTIFICATE : -1;
+		break;
+	}
+	OSSL_STORE_INFO_free(info);
+	return ret;
+#else
+	return -1;
+#endif
+}
+
+void X_OSSL_STORE_close(void *s) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	struct x_store *store = s;
+	OSSL_STORE_close(store->ctx);
+	UI_destroy_method(store->ui);
+	OPENSSL_free(store);
+#endif
+}
+
 long X_SSL_CTX_set_tmp_dh(SSL_CTX* ctx, DH *dh) {
     return SSL_CTX_set_tmp_dh(ctx, dh);
 }
@@ -579,6 +1149,34 @@ long X_PEM_read_DHparams(SSL_CTX* ctx, DH *dh) {
     return SSL_CTX_set_tmp_dh(ctx, dh);
 }
 
+long X_SSL_CTX_set_dh_auto(SSL_CTX* ctx, int onoff) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+    return SSL_CTX_set_dh_auto(ctx, onoff);
+#else
+    return 0;
+#endif
+}
+
+DH *X_DH_new_by_nid(int nid) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+    return DH_new_by_nid(nid);
+#else
+    return NULL;
+#endif
+}
+
+DH *X_DH_generate_parameters(int bits, int generator) {
+    DH *dh = DH_new();
+    if (dh == NULL) {
+        return NULL;
+    }
+    if (DH_generate_parameters_ex(dh, bits, generator, NULL) != 1) {
+        DH_free(dh);
+        return NULL;
+    }
+    return dh;
+}
+
 int X_SSL_CTX_set_tlsext_ticket_key_cb(SSL_CTX *sslctx,
         int (*cb)(SSL *s, unsigned char key_name[16],
                   unsigned char iv[EVP_MAX_IV_LENGTH],
@@ -668,6 +1266,10 @@ int X_EVP_MD_size(const EVP_MD *md) {
 	return EVP_MD_size(md);
 }
 
+int X_EVP_MD_block_size(const EVP_MD *md) {
+	return EVP_MD_block_size(md);
+}
+
 int X_EVP_DigestInit_ex(EVP_MD_CTX *ctx, const EVP_MD *type, ENGINE *impl) {
 	return EVP_DigestInit_ex(ctx, type, impl);
 }
@@ -745,6 +1347,10 @@ int X_EVP_CIPHER_nid(EVP_CIPHER *c) {
     return EVP_CIPHER_nid(c);
 }
 
+int X_EVP_CIPHER_is_aead(EVP_CIPHER *c) {
+    return (EVP_CIPHER_flags(c) & EVP_CIPH_FLAG_AEAD_CIPHER) != 0;
+}
+
 int X_EVP_CIPHER_CTX_block_size(EVP_CIPHER_CTX *ctx) {
     return EVP_CIPHER_CTX_block_size(ctx);
 }
@@ -767,17 +1373,879 @@ const EVP_CIPHER *X_EVP_CIPHER_CTX_cipher(EVP_CIPHER_CTX *ctx) {
     return EVP_CIPHER_CTX_cipher(ctx);
 }
 
-int X_EVP_PKEY_CTX_set_ec_paramgen_curve_nid(EVP_PKEY_CTX *ctx, int nid) {
-	return EVP_PKEY_CTX_set_ec_paramgen_curve_nid(ctx, nid);
+const EVP_CIPHER *X_EVP_chacha20_poly1305() {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL && !defined(OPENSSL_NO_CHACHA)
+	return EVP_chacha20_poly1305();
+#else
+	return NULL;
+#endif
 }
 
-size_t X_HMAC_size(const HMAC_CTX *e) {
-	return HMAC_size(e);
+int X_CRYPTO_secure_malloc_init(size_t size, size_t minsize) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	return CRYPTO_secure_malloc_init(size, minsize);
+#else
+	return 0;
+#endif
 }
 
-int X_HMAC_Init_ex(HMAC_CTX *ctx, const void *key, int len, const EVP_MD *md, ENGINE *impl) {
-	return HMAC_Init_ex(ctx, key, len, md, impl);
-}
+int X_CRYPTO_secure_malloc_done() {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	return CRYPTO_secure_malloc_done();
+#else
+	return 0;
+#endif
+}
+
+int X_CRYPTO_secure_malloc_initialized() {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	return CRYPTO_secure_malloc_initialized();
+#else
+	return 0;
+#endif
+}
+
+size_t X_CRYPTO_secure_used() {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	return CRYPTO_secure_used();
+#else
+	return 0;
+#endif
+}
+
+void *X_OPENSSL_secure_malloc(size_t num) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	return OPENSSL_secure_malloc(num);
+#else
+	return NULL;
+#endif
+}
+
+void X_OPENSSL_secure_clear_free(void *ptr, size_t num) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	OPENSSL_secure_clear_free(ptr, num);
+#endif
+}
+
+int X_SSL_CTX_set1_cert_type(SSL_CTX *ctx, int server, const unsigned char *types, size_t len) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	if (server) {
+		return SSL_CTX_set1_server_cert_type(ctx, types, len);
+	}
+	return SSL_CTX_set1_client_cert_type(ctx, types, len);
+#else
+	return 0;
+#endif
+}
+
+int X_SSL_get_negotiated_cert_type(SSL *ssl, int server) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	if (server) {
+		return SSL_get_negotiated_server_cert_type(ssl);
+	}
+	return SSL_get_negotiated_client_cert_type(ssl);
+#else
+	return 0;
+#endif
+}
+
+EVP_PKEY *X_SSL_get1_peer_rpk(SSL *ssl) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	EVP_PKEY *rpk = SSL_get0_peer_rpk(ssl);
+	if (rpk != NULL && EVP_PKEY_up_ref(rpk) != 1) {
+		return NULL;
+	}
+	return rpk;
+#else
+	return NULL;
+#endif
+}
+
+int X_SSL_add_expected_rpk(SSL *ssl, EVP_PKEY *rpk) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	/* The expected keys are DANE-EE(3) SPKI(1) Full(0) TLSA records, so
+	 * DANE has to be enabled on the connection first, unless it already
+	 * is. */
+	ERR_set_mark();
+	if (SSL_dane_enable(ssl, NULL) <= 0 &&
+			ERR_GET_REASON(ERR_peek_last_error()) != SSL_R_DANE_ALREADY_ENABLED) {
+		ERR_clear_last_mark();
+		return 0;
+	}
+	ERR_pop_to_mark();
+	return SSL_add_expected_rpk(ssl, rpk);
+#else
+	return 0;
+#endif
+}
+
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+static OSSL_HPKE_SUITE x_hpke_suite(int kem, int kdf, int aead) {
+	OSSL_HPKE_SUITE suite;
+	suite.kem_id = (uint16_t)kem;
+	suite.kdf_id = (uint16_t)kdf;
+	suite.aead_id = (uint16_t)aead;
+	return suite;
+}
+#endif
+
+int X_OSSL_HPKE_suite_check(int kem, int kdf, int aead) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_suite_check(x_hpke_suite(kem, kdf, aead));
+#else
+	return 0;
+#endif
+}
+
+size_t X_OSSL_HPKE_get_public_encap_size(int kem, int kdf, int aead) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_get_public_encap_size(x_hpke_suite(kem, kdf, aead));
+#else
+	return 0;
+#endif
+}
+
+size_t X_OSSL_HPKE_get_ciphertext_size(int kem, int kdf, int aead, size_t clearlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_get_ciphertext_size(x_hpke_suite(kem, kdf, aead), clearlen);
+#else
+	return 0;
+#endif
+}
+
+int X_OSSL_HPKE_keygen(int kem, int kdf, int aead, unsigned char *pub, size_t *publen, EVP_PKEY **priv) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_keygen(x_hpke_suite(kem, kdf, aead), pub, publen, priv,
+		NULL, 0, NULL, NULL);
+#else
+	return 0;
+#endif
+}
+
+void *X_OSSL_HPKE_CTX_new(int mode, int kem, int kdf, int aead, int role) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_CTX_new(mode, x_hpke_suite(kem, kdf, aead), role, NULL, NULL);
+#else
+	return NULL;
+#endif
+}
+
+void X_OSSL_HPKE_CTX_free(void *ctx) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	OSSL_HPKE_CTX_free(ctx);
+#endif
+}
+
+int X_OSSL_HPKE_CTX_set1_psk(void *ctx, const char *pskid, const unsigned char *psk, size_t psklen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_CTX_set1_psk(ctx, pskid, psk, psklen);
+#else
+	return 0;
+#endif
+}
+
+int X_OSSL_HPKE_CTX_set1_authpriv(void *ctx, EVP_PKEY *priv) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_CTX_set1_authpriv(ctx, priv);
+#else
+	return 0;
+#endif
+}
+
+int X_OSSL_HPKE_CTX_set1_authpub(void *ctx, const unsigned char *pub, size_t publen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_CTX_set1_authpub(ctx, pub, publen);
+#else
+	return 0;
+#endif
+}
+
+int X_OSSL_HPKE_encap(void *ctx, unsigned char *enc, size_t *enclen, const unsigned char *pub, size_t publen, const unsigned char *info, size_t infolen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_encap(ctx, enc, enclen, pub, publen, info, infolen);
+#else
+	return 0;
+#endif
+}
+
+int X_OSSL_HPKE_decap(void *ctx, const unsigned char *enc, size_t enclen, EVP_PKEY *priv, const unsigned char *info, size_t infolen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_decap(ctx, enc, enclen, priv, info, infolen);
+#else
+	return 0;
+#endif
+}
+
+int X_OSSL_HPKE_seal(void *ctx, unsigned char *ct, size_t *ctlen, const unsigned char *aad, size_t aadlen, const unsigned char *pt, size_t ptlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_seal(ctx, ct, ctlen, aad, aadlen, pt, ptlen);
+#else
+	return 0;
+#endif
+}
+
+int X_OSSL_HPKE_open(void *ctx, unsigned char *pt, size_t *ptlen, const unsigned char *aad, size_t aadlen, const unsigned char *ct, size_t ctlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_open(ctx, pt, ptlen, aad, aadlen, ct, ctlen);
+#else
+	return 0;
+#endif
+}
+
+int X_OSSL_HPKE_export(void *ctx, unsigned char *secret, size_t secretlen, const unsigned char *label, size_t labellen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	return OSSL_HPKE_export(ctx, secret, secretlen, label, labellen);
+#else
+	return 0;
+#endif
+}
+
+size_t X_EVP_PKEY_get1_encoded_public_key(EVP_PKEY *pkey, unsigned char **out) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_PKEY_get1_encoded_public_key(pkey, out);
+#else
+	return 0;
+#endif
+}
+
+int X_SSL_CTX_set1_groups_list(SSL_CTX *ctx, const char *list) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	return SSL_CTX_set1_groups_list(ctx, list);
+#elif OPENSSL_VERSION_NUMBER >= 0x1000200fL
+	return SSL_CTX_set1_curves_list(ctx, (char *)list);
+#else
+	return 0;
+#endif
+}
+
+const char *X_SSL_get_negotiated_group_name(SSL *ssl) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	int id = SSL_get_negotiated_group(ssl);
+	return id == 0 ? NULL : SSL_group_to_name(ssl, id);
+#else
+	return NULL;
+#endif
+}
+
+void *X_OSSL_PROVIDER_load(const char *name) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return OSSL_PROVIDER_load(NULL, name);
+#else
+	return NULL;
+#endif
+}
+
+int X_OSSL_PROVIDER_unload(void *prov) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return OSSL_PROVIDER_unload(prov);
+#else
+	return 0;
+#endif
+}
+
+int X_OSSL_PROVIDER_available(const char *name) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return OSSL_PROVIDER_available(NULL, name);
+#else
+	return 0;
+#endif
+}
+
+int X_EVP_set_default_properties(const char *propq) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_set_default_properties(NULL, propq);
+#else
+	return 0;
+#endif
+}
+
+const EVP_MD *X_EVP_MD_fetch(const char *name, const char *propq) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_MD_fetch(NULL, name, propq);
+#else
+	return NULL;
+#endif
+}
+
+void X_EVP_MD_free(const EVP_MD *md) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	EVP_MD_free((EVP_MD *)md);
+#endif
+}
+
+const EVP_CIPHER *X_EVP_CIPHER_fetch(const char *name, const char *propq) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_CIPHER_fetch(NULL, name, propq);
+#else
+	return NULL;
+#endif
+}
+
+void X_EVP_CIPHER_free(const EVP_CIPHER *cipher) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	EVP_CIPHER_free((EVP_CIPHER *)cipher);
+#endif
+}
+
+int X_EVP_PKEY_eq(const EVP_PKEY *a, const EVP_PKEY *b) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_PKEY_eq(a, b);
+#else
+	return EVP_PKEY_cmp(a, b);
+#endif
+}
+
+// X_EVP_PKEY_ec_curve returns the NID of the curve of an EC key, or
+// NID_undef for other keys.
+int X_EVP_PKEY_ec_curve(EVP_PKEY *pkey) {
+	EC_KEY *ec = EVP_PKEY_get1_EC_KEY(pkey);
+	int nid;
+
+	if (ec == NULL) {
+		ERR_clear_error();
+		return NID_undef;
+	}
+	nid = EC_GROUP_get_curve_name(EC_KEY_get0_group(ec));
+	EC_KEY_free(ec);
+	return nid;
+}
+
+int X_BN_is_negative(const BIGNUM *b) {
+	return BN_is_negative(b);
+}
+
+int X_BN_is_odd(const BIGNUM *b) {
+	return BN_is_odd(b);
+}
+
+void X_BN_set_flags(BIGNUM *b, int n) {
+	BN_set_flags(b, n);
+}
+
+int X_RAND_bytes(unsigned char *buf, int num) {
+	return RAND_bytes(buf, num);
+}
+
+int X_RAND_priv_bytes(unsigned char *buf, int num) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	return RAND_priv_bytes(buf, num);
+#else
+	return 0;
+#endif
+}
+
+int X_RAND_poll() {
+	return RAND_poll();
+}
+
+// X_RAND_set_reseed sets how many requests and seconds the primary DRBG
+// serves before it reseeds.
+int X_RAND_set_reseed(unsigned int requests, int64_t seconds) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	EVP_RAND_CTX *primary = RAND_get0_primary(NULL);
+	OSSL_PARAM params[3];
+	time_t interval = (time_t)seconds;
+
+	if (primary == NULL) {
+		return 0;
+	}
+	params[0] = OSSL_PARAM_construct_uint(OSSL_DRBG_PARAM_RESEED_REQUESTS,
+		&requests);
+	params[1] = OSSL_PARAM_construct_time_t(
+		OSSL_DRBG_PARAM_RESEED_TIME_INTERVAL, &interval);
+	params[2] = OSSL_PARAM_construct_end();
+	return EVP_RAND_CTX_set_params(primary, params);
+#else
+	return 0;
+#endif
+}
+
+// X_EVP_PKEY_eddsa signs or verifies tbs with the EdDSA instance, such as
+// Ed25519ph, and the context string.
+int X_EVP_PKEY_eddsa(int verify, EVP_PKEY *pkey, const char *instance,
+		const unsigned char *context, size_t contextlen,
+		unsigned char *sig, size_t *siglen,
+		const unsigned char *tbs, size_t tbslen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	EVP_MD_CTX *mctx = EVP_MD_CTX_new();
+	OSSL_PARAM params[3], *p = params;
+	int ret;
+
+	if (mctx == NULL) {
+		return 0;
+	}
+	*p++ = OSSL_PARAM_construct_utf8_string(OSSL_SIGNATURE_PARAM_INSTANCE,
+		(char *)instance, 0);
+	if (contextlen > 0) {
+		*p++ = OSSL_PARAM_construct_octet_string(
+			OSSL_SIGNATURE_PARAM_CONTEXT_STRING, (void *)context,
+			contextlen);
+	}
+	*p = OSSL_PARAM_construct_end();
+	if (verify) {
+		ret = EVP_DigestVerifyInit_ex(mctx, NULL, NULL, NULL, NULL, pkey,
+				params) == 1 &&
+			EVP_DigestVerify(mctx, sig, *siglen, tbs, tbslen) == 1;
+	} else {
+		ret = EVP_DigestSignInit_ex(mctx, NULL, NULL, NULL, NULL, pkey,
+				params) == 1 &&
+			EVP_DigestSign(mctx, sig, siglen, tbs, tbslen) == 1;
+	}
+	EVP_MD_CTX_free(mctx);
+	return ret;
+#else
+	return 0;
+#endif
+}
+
+// X_EVP_aes_wrap wraps or unwraps in with the key encryption key, with
+// the padding of RFC 5649 if pad is set or as in RFC 3394 otherwise
+int X_EVP_aes_wrap(int pad, int enc, const unsigned char *kek, int keklen,
+		const unsigned char *in, int inlen, unsigned char *out,
+		int *outlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	const EVP_CIPHER *cipher;
+	EVP_CIPHER_CTX *ctx;
+	int len, ret;
+
+	switch (keklen) {
+	case 16:
+		cipher = pad ? EVP_aes_128_wrap_pad() : EVP_aes_128_wrap();
+		break;
+	case 24:
+		cipher = pad ? EVP_aes_192_wrap_pad() : EVP_aes_192_wrap();
+		break;
+	case 32:
+		cipher = pad ? EVP_aes_256_wrap_pad() : EVP_aes_256_wrap();
+		break;
+	default:
+		return 0;
+	}
+	ctx = EVP_CIPHER_CTX_new();
+	if (ctx == NULL) {
+		return 0;
+	}
+	EVP_CIPHER_CTX_set_flags(ctx, EVP_CIPHER_CTX_FLAG_WRAP_ALLOW);
+	ret = EVP_CipherInit_ex(ctx, cipher, NULL, kek, NULL, enc) == 1 &&
+		EVP_CipherUpdate(ctx, out, outlen, in, inlen) == 1 &&
+		EVP_CipherFinal_ex(ctx, out + *outlen, &len) == 1;
+	if (ret) {
+		*outlen += len;
+	}
+	EVP_CIPHER_CTX_free(ctx);
+	return ret;
+#else
+	return 0;
+#endif
+}
+
+// x_aead_init starts an AEAD operation with the nonce and the additional
+// data
+static EVP_CIPHER_CTX *x_aead_init(const EVP_CIPHER *cipher, int enc,
+		const unsigned char *key, const unsigned char *nonce, int noncelen,
+		const unsigned char *aad, int aadlen) {
+	EVP_CIPHER_CTX *ctx = EVP_CIPHER_CTX_new();
+	int outlen;
+
+	if (ctx == NULL) {
+		return NULL;
+	}
+	if (EVP_CipherInit_ex(ctx, cipher, NULL, NULL, NULL, enc) != 1 ||
+			EVP_CIPHER_CTX_ctrl(ctx, EVP_CTRL_AEAD_SET_IVLEN, noncelen,
+				NULL) != 1 ||
+			EVP_CipherInit_ex(ctx, NULL, NULL, key, nonce, enc) != 1 ||
+			(aadlen > 0 &&
+				EVP_CipherUpdate(ctx, NULL, &outlen, aad, aadlen) != 1)) {
+		EVP_CIPHER_CTX_free(ctx);
+		return NULL;
+	}
+	return ctx;
+}
+
+int X_EVP_AEAD_seal(const EVP_CIPHER *cipher, const unsigned char *key,
+		const unsigned char *nonce, int noncelen,
+		const unsigned char *aad, int aadlen,
+		const unsigned char *in, int inlen,
+		unsigned char *out, unsigned char *tag, int taglen) {
+	unsigned char final[EVP_MAX_BLOCK_LENGTH];
+	EVP_CIPHER_CTX *ctx = x_aead_init(cipher, 1, key, nonce, noncelen,
+		aad, aadlen);
+	int outlen, ret;
+
+	if (ctx == NULL) {
+		return 0;
+	}
+	ret = (inlen == 0 || EVP_EncryptUpdate(ctx, out, &outlen, in,
+			inlen) == 1) &&
+		EVP_EncryptFinal_ex(ctx, final, &outlen) == 1 &&
+		EVP_CIPHER_CTX_ctrl(ctx, EVP_CTRL_AEAD_GET_TAG, taglen, tag) == 1;
+	EVP_CIPHER_CTX_free(ctx);
+	return ret;
+}
+
+int X_EVP_AEAD_open(const EVP_CIPHER *cipher, const unsigned char *key,
+		const unsigned char *nonce, int noncelen,
+		const unsigned char *aad, int aadlen,
+		const unsigned char *in, int inlen,
+		const unsigned char *tag, int taglen, unsigned char *out) {
+	unsigned char final[EVP_MAX_BLOCK_LENGTH];
+	EVP_CIPHER_CTX *ctx = x_aead_init(cipher, 0, key, nonce, noncelen,
+		aad, aadlen);
+	int outlen, ret;
+
+	if (ctx == NULL) {
+		return 0;
+	}
+	ret = (inlen == 0 || EVP_DecryptUpdate(ctx, out, &outlen, in,
+			inlen) == 1) &&
+		EVP_CIPHER_CTX_ctrl(ctx, EVP_CTRL_AEAD_SET_TAG, taglen,
+			(void *)tag) == 1 &&
+		EVP_DecryptFinal_ex(ctx, final, &outlen) == 1;
+	EVP_CIPHER_CTX_free(ctx);
+	return ret;
+}
+
+int X_EVP_PKEY_CTX_set_ec_paramgen_curve_nid(EVP_PKEY_CTX *ctx, int nid) {
+	return EVP_PKEY_CTX_set_ec_paramgen_curve_nid(ctx, nid);
+}
+
+int X_EVP_PKEY_CTX_set_rsa_keygen(EVP_PKEY_CTX *ctx, int bits,
+		unsigned long exponent) {
+	BIGNUM *e = BN_new();
+	int ret;
+
+	if (e == NULL || BN_set_word(e, exponent) != 1 ||
+			EVP_PKEY_CTX_set_rsa_keygen_bits(ctx, bits) <= 0) {
+		BN_free(e);
+		return 0;
+	}
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	ret = EVP_PKEY_CTX_set1_rsa_keygen_pubexp(ctx, e);
+	BN_free(e);
+#else
+	// the context takes ownership of e on success
+	ret = EVP_PKEY_CTX_set_rsa_keygen_pubexp(ctx, e);
+	if (ret <= 0) {
+		BN_free(e);
+	}
+#endif
+	return ret > 0;
+}
+
+int X_EVP_PKEY_hkdf(int mode, const EVP_MD *md,
+		const unsigned char *secret, size_t secretlen,
+		const unsigned char *salt, size_t saltlen,
+		const unsigned char *info, size_t infolen,
+		unsigned char *out, size_t *outlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010100fL
+	EVP_PKEY_CTX *pctx = EVP_PKEY_CTX_new_id(EVP_PKEY_HKDF, NULL);
+	int ret;
+
+	if (pctx == NULL) {
+		return 0;
+	}
+	ret = EVP_PKEY_derive_init(pctx) == 1 &&
+		EVP_PKEY_CTX_hkdf_mode(pctx, mode) > 0 &&
+		EVP_PKEY_CTX_set_hkdf_md(pctx, md) > 0 &&
+		EVP_PKEY_CTX_set1_hkdf_key(pctx, secret, secretlen) > 0 &&
+		(saltlen == 0 ||
+			EVP_PKEY_CTX_set1_hkdf_salt(pctx, salt, saltlen) > 0) &&
+		(infolen == 0 ||
+			EVP_PKEY_CTX_add1_hkdf_info(pctx, info, infolen) > 0) &&
+		EVP_PKEY_derive(pctx, out, outlen) == 1;
+	EVP_PKEY_CTX_free(pctx);
+	return ret;
+#else
+	return 0;
+#endif
+}
+
+int X_EVP_PBE_scrypt(const char *pass, size_t passlen,
+		const unsigned char *salt, size_t saltlen,
+		uint64_t N, uint64_t r, uint64_t p, uint64_t maxmem,
+		unsigned char *key, size_t keylen) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	return EVP_PBE_scrypt(pass, passlen, salt, saltlen, N, r, p, maxmem,
+		key, keylen);
+#else
+	return 0;
+#endif
+}
+
+int X_EVP_PKEY_tls1_prf(const EVP_MD *md,
+		const unsigned char *secret, size_t secretlen,
+		const unsigned char *seed, size_t seedlen,
+		unsigned char *out, size_t *outlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	EVP_PKEY_CTX *pctx = EVP_PKEY_CTX_new_id(EVP_PKEY_TLS1_PRF, NULL);
+	int ret;
+
+	if (pctx == NULL) {
+		return 0;
+	}
+	ret = EVP_PKEY_derive_init(pctx) == 1 &&
+		EVP_PKEY_CTX_set_tls1_prf_md(pctx, md) > 0 &&
+		EVP_PKEY_CTX_set1_tls1_prf_secret(pctx, secret, secretlen) > 0 &&
+		EVP_PKEY_CTX_add1_tls1_prf_seed(pctx, seed, seedlen) > 0 &&
+		EVP_PKEY_derive(pctx, out, outlen) == 1;
+	EVP_PKEY_CTX_free(pctx);
+	return ret;
+#else
+	return 0;
+#endif
+}
+
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+// x_kdf_derive derives a key with the EVP_KDF name fetched with the
+// property query, which is also appended to the params for the fetches of
+// the KDF itself. params must have room for two more entries.
+static int x_kdf_derive(const char *name, const char *propq,
+		OSSL_PARAM *params, OSSL_PARAM *p,
+		unsigned char *out, size_t outlen) {
+	EVP_KDF *kdf = EVP_KDF_fetch(NULL, name, propq);
+	EVP_KDF_CTX *kctx;
+	int ret;
+
+	if (kdf == NULL) {
+		return 0;
+	}
+	kctx = EVP_KDF_CTX_new(kdf);
+	EVP_KDF_free(kdf);
+	if (kctx == NULL) {
+		return 0;
+	}
+	if (propq != NULL) {
+		// the properties of the digest fetch
+		*p++ = OSSL_PARAM_construct_utf8_string(OSSL_KDF_PARAM_PROPERTIES,
+			(char *)propq, 0);
+	}
+	*p = OSSL_PARAM_construct_end();
+	ret = EVP_KDF_derive(kctx, out, outlen, params) == 1;
+	EVP_KDF_CTX_free(kctx);
+	return ret;
+}
+#endif
+
+// X_EVP_KDF_derive_digest derives a key with a digest-based EVP_KDF such
+// as SSKDF and X963KDF, which take the secret as key and the info. The KDF
+// and the digest are fetched with the property query if not NULL.
+int X_EVP_KDF_derive_digest(const char *name, const char *propq,
+		const EVP_MD *md, const unsigned char *secret, size_t secretlen,
+		const unsigned char *info, size_t infolen,
+		unsigned char *out, size_t outlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	OSSL_PARAM params[5], *p = params;
+
+	*p++ = OSSL_PARAM_construct_utf8_string(OSSL_KDF_PARAM_DIGEST,
+		(char *)EVP_MD_get0_name(md), 0);
+	*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_KEY,
+		(void *)secret, secretlen);
+	*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_INFO,
+		(void *)info, infolen);
+	return x_kdf_derive(name, propq, params, p, out, outlen);
+#else
+	return 0;
+#endif
+}
+
+// X_EVP_KDF_hkdf is X_EVP_PKEY_hkdf with the KDF and the digest fetched
+// with the property query.
+int X_EVP_KDF_hkdf(int mode, const char *propq, const EVP_MD *md,
+		const unsigned char *secret, size_t secretlen,
+		const unsigned char *salt, size_t saltlen,
+		const unsigned char *info, size_t infolen,
+		unsigned char *out, size_t outlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	OSSL_PARAM params[7], *p = params;
+
+	*p++ = OSSL_PARAM_construct_int(OSSL_KDF_PARAM_MODE, &mode);
+	*p++ = OSSL_PARAM_construct_utf8_string(OSSL_KDF_PARAM_DIGEST,
+		(char *)EVP_MD_get0_name(md), 0);
+	*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_KEY,
+		(void *)secret, secretlen);
+	if (saltlen > 0) {
+		*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_SALT,
+			(void *)salt, saltlen);
+	}
+	if (infolen > 0) {
+		*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_INFO,
+			(void *)info, infolen);
+	}
+	return x_kdf_derive("HKDF", propq, params, p, out, outlen);
+#else
+	return 0;
+#endif
+}
+
+// X_EVP_KDF_pbkdf2 is PKCS5_PBKDF2_HMAC with the KDF and the digest
+// fetched with the property query.
+int X_EVP_KDF_pbkdf2(const char *propq, const EVP_MD *md,
+		const unsigned char *pass, size_t passlen,
+		const unsigned char *salt, size_t saltlen, uint64_t iter,
+		unsigned char *out, size_t outlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	OSSL_PARAM params[7], *p = params;
+	// no SP 800-132 lower bounds, like PKCS5_PBKDF2_HMAC
+	int pkcs5 = 1;
+
+	*p++ = OSSL_PARAM_construct_utf8_string(OSSL_KDF_PARAM_DIGEST,
+		(char *)EVP_MD_get0_name(md), 0);
+	*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_PASSWORD,
+		(void *)pass, passlen);
+	*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_SALT,
+		(void *)salt, saltlen);
+	*p++ = OSSL_PARAM_construct_uint64(OSSL_KDF_PARAM_ITER, &iter);
+	*p++ = OSSL_PARAM_construct_int(OSSL_KDF_PARAM_PKCS5, &pkcs5);
+	return x_kdf_derive("PBKDF2", propq, params, p, out, outlen);
+#else
+	return 0;
+#endif
+}
+
+// X_EVP_KDF_scrypt is X_EVP_PBE_scrypt with the KDF and its digest
+// fetched with the property query.
+int X_EVP_KDF_scrypt(const char *propq,
+		const unsigned char *pass, size_t passlen,
+		const unsigned char *salt, size_t saltlen,
+		uint64_t N, uint64_t r, uint64_t p_, uint64_t maxmem,
+		unsigned char *out, size_t outlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	OSSL_PARAM params[9], *p = params;
+	uint32_t r32 = (uint32_t)r, p32 = (uint32_t)p_;
+
+	if (r32 != r || p32 != p_) {
+		return 0;
+	}
+	*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_PASSWORD,
+		(void *)pass, passlen);
+	*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_SALT,
+		(void *)salt, saltlen);
+	*p++ = OSSL_PARAM_construct_uint64(OSSL_KDF_PARAM_SCRYPT_N, &N);
+	*p++ = OSSL_PARAM_construct_uint32(OSSL_KDF_PARAM_SCRYPT_R, &r32);
+	*p++ = OSSL_PARAM_construct_uint32(OSSL_KDF_PARAM_SCRYPT_P, &p32);
+	*p++ = OSSL_PARAM_construct_uint64(OSSL_KDF_PARAM_SCRYPT_MAXMEM,
+		&maxmem);
+	return x_kdf_derive("SCRYPT", propq, params, p, out, outlen);
+#else
+	return 0;
+#endif
+}
+
+// X_EVP_KDF_tls1_prf is X_EVP_PKEY_tls1_prf with the KDF and the digest
+// fetched with the property query.
+int X_EVP_KDF_tls1_prf(const char *propq, const EVP_MD *md,
+		const unsigned char *secret, size_t secretlen,
+		const unsigned char *seed, size_t seedlen,
+		unsigned char *out, size_t outlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	OSSL_PARAM params[5], *p = params;
+
+	*p++ = OSSL_PARAM_construct_utf8_string(OSSL_KDF_PARAM_DIGEST,
+		(char *)EVP_MD_get0_name(md), 0);
+	*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_SECRET,
+		(void *)secret, secretlen);
+	*p++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_SEED,
+		(void *)seed, seedlen);
+	return x_kdf_derive("TLS1-PRF", propq, params, p, out, outlen);
+#else
+	return 0;
+#endif
+}
+
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+static int x_mac_init(EVP_MAC_CTX *ctx, const unsigned char *key,
+		size_t keylen, size_t size) {
+	OSSL_PARAM params[2], *p = params;
+
+	if (size != 0) {
+		*p++ = OSSL_PARAM_construct_size_t(OSSL_MAC_PARAM_SIZE, &size);
+	}
+	*p = OSSL_PARAM_construct_end();
+	return EVP_MAC_init(ctx, key, keylen, params);
+}
+#endif
+
+// X_EVP_MAC_new returns a keyed context of the EVP_MAC with the name and,
+// unless zero, the tag size. The context is opaque so that the shim builds
+// against OpenSSL versions without EVP_MAC.
+void *X_EVP_MAC_new(const char *name, const unsigned char *key,
+		size_t keylen, size_t size) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	EVP_MAC *mac = EVP_MAC_fetch(NULL, name, NULL);
+	EVP_MAC_CTX *ctx;
+
+	if (mac == NULL) {
+		return NULL;
+	}
+	ctx = EVP_MAC_CTX_new(mac);
+	EVP_MAC_free(mac);
+	if (ctx != NULL && x_mac_init(ctx, key, keylen, size) != 1) {
+		EVP_MAC_CTX_free(ctx);
+		ctx = NULL;
+	}
+	return ctx;
+#else
+	return NULL;
+#endif
+}
+
+int X_EVP_MAC_init(void *ctx, const unsigned char *key, size_t keylen,
+		size_t size) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return x_mac_init(ctx, key, keylen, size);
+#else
+	return 0;
+#endif
+}
+
+int X_EVP_MAC_update(void *ctx, const unsigned char *data, size_t len) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_MAC_update(ctx, data, len);
+#else
+	return 0;
+#endif
+}
+
+// X_EVP_MAC_sum writes the tag of the data so far to out, leaving the
+// context open for more data.
+int X_EVP_MAC_sum(void *ctx, unsigned char *out, size_t *outlen,
+		size_t outsize) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	EVP_MAC_CTX *dup = EVP_MAC_CTX_dup(ctx);
+	int ret;
+
+	if (dup == NULL) {
+		return 0;
+	}
+	ret = EVP_MAC_final(dup, out, outlen, outsize);
+	EVP_MAC_CTX_free(dup);
+	return ret;
+#else
+	return 0;
+#endif
+}
+
+size_t X_EVP_MAC_size(void *ctx) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	return EVP_MAC_CTX_get_mac_size(ctx);
+#else
+	return 0;
+#endif
+}
+
+void X_EVP_MAC_free(void *ctx) {
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+	EVP_MAC_CTX_free(ctx);
+#endif
+}
+
+size_t X_HMAC_size(const HMAC_CTX *e) {
+	return HMAC_size(e);
+}
+
+int X_HMAC_Init_ex(HMAC_CTX *ctx, const void *key, int len, const EVP_MD *md, ENGINE *impl) {
+	return HMAC_Init_ex(ctx, key, len, md, impl);
+}
 
 int X_HMAC_Update(HMAC_CTX *ctx, const unsigned char *data, size_t len) {
 	return HMAC_Update(ctx, data, len);
@@ -787,6 +2255,85 @@ int X_HMAC_Final(HMAC_CTX *ctx, unsigned char *md, unsigned int *len) {
 	return HMAC_Final(ctx, md, len);
 }
 
+int X_HMAC_CTX_copy(HMAC_CTX *dctx, HMAC_CTX *sctx) {
+	return HMAC_CTX_copy(dctx, sctx);
+}
+
+STACK_OF(X509) *X_X509_STORE_CTX_get0_untrusted(X509_STORE_CTX *ctx) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	return X509_STORE_CTX_get0_untrusted(ctx);
+#else
+	return ctx->untrusted;
+#endif
+}
+
+void X_X509_STORE_CTX_set0_untrusted(X509_STORE_CTX *ctx,
+		STACK_OF(X509) *sk) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	X509_STORE_CTX_set0_untrusted(ctx, sk);
+#else
+	ctx->untrusted = sk;
+#endif
+}
+
+int X_X509_STORE_CTX_check_leaf_purposes(X509_STORE_CTX *ctx,
+		int *purposes, int n) {
+	int i;
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	X509 *leaf = X509_STORE_CTX_get0_cert(ctx);
+#else
+	X509 *leaf = ctx->cert;
+#endif
+	for (i = 0; i < n; i++) {
+		if (X509_check_purpose(leaf, purposes[i], 0) == 1) {
+			return 1;
+		}
+	}
+	// report the failure to the verify callback like X509_verify_cert
+	X509_STORE_CTX_set_error(ctx, X509_V_ERR_INVALID_PURPOSE);
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	X509_STORE_CTX_set_error_depth(ctx, 0);
+	X509_STORE_CTX_set_current_cert(ctx, leaf);
+	X509_STORE_CTX_verify_cb cb = X509_STORE_CTX_get_verify_cb(ctx);
+#else
+	ctx->error_depth = 0;
+	ctx->current_cert = leaf;
+	int (*cb)(int, X509_STORE_CTX *) = ctx->verify_cb;
+#endif
+	return cb != NULL ? cb(0, ctx) : 0;
+}
+
+int X_X509_VERIFY_PARAM_set1_host(X509_VERIFY_PARAM *param,
+		const char *name, size_t len) {
+	return X509_VERIFY_PARAM_set1_host(param, name, len);
+}
+
+int X_X509_VERIFY_PARAM_set_no_check_time(X509_VERIFY_PARAM *param) {
+#ifdef X509_V_FLAG_NO_CHECK_TIME
+	return X509_VERIFY_PARAM_set_flags(param, X509_V_FLAG_NO_CHECK_TIME);
+#else
+	return 0;
+#endif
+}
+
+static int x_ssl_ctx_cert_verify_cb(X509_STORE_CTX *store, void *arg) {
+	SSL *ssl = X509_STORE_CTX_get_ex_data(store,
+		SSL_get_ex_data_X509_STORE_CTX_idx());
+	void* p = SSL_CTX_get_ex_data(SSL_get_SSL_CTX(ssl), get_ssl_ctx_idx());
+	if (p == NULL) {
+		return X509_verify_cert(store);
+	}
+	return go_ssl_ctx_cert_verify_cb_thunk(p, store);
+}
+
+void X_SSL_CTX_enable_cert_verify_cb(SSL_CTX *ctx) {
+	SSL_CTX_set_cert_verify_callback(ctx, x_ssl_ctx_cert_verify_cb, NULL);
+}
+
+long X_SSL_CTX_set1_verify_cert_store(SSL_CTX *ctx, X509_STORE *store) {
+	return SSL_CTX_set1_verify_cert_store(ctx, store);
+}
+
 int X_sk_X509_num(STACK_OF(X509) *sk) {
 	return sk_X509_num(sk);
 }
@@ -795,6 +2342,511 @@ X509 *X_sk_X509_value(STACK_OF(X509)* sk, int i) {
    return sk_X509_value(sk, i);
 }
 
+STACK_OF(X509) *X_sk_X509_new_null() {
+	return sk_X509_new_null();
+}
+
+int X_sk_X509_push(STACK_OF(X509) *sk, X509 *x509) {
+	return sk_X509_push(sk, x509);
+}
+
+void X_sk_X509_free(STACK_OF(X509) *sk) {
+	sk_X509_free(sk);
+}
+
+int X_X509_check_issued(X509 *issuer, X509 *subject) {
+	return X509_check_issued(issuer, subject);
+}
+
+int X_X509_verify_cb_accept_all(int ok, X509_STORE_CTX *store) {
+	return 1;
+}
+
+int X_X509_check_time_skew(X509 *x, time_t now, long skew) {
+	time_t not_yet_valid = now + skew, expired = now - skew;
+
+	return X509_cmp_time(X_X509_get0_notBefore(x), &not_yet_valid) < 0 &&
+		X509_cmp_time(X_X509_get0_notAfter(x), &expired) > 0;
+}
+
+void X_X509_VERIFY_PARAM_set_time(X509_VERIFY_PARAM *param, time_t t,
+		int use) {
+	if (use) {
+		X509_VERIFY_PARAM_set_time(param, t);
+	} else {
+		X509_VERIFY_PARAM_clear_flags(param, X509_V_FLAG_USE_CHECK_TIME);
+	}
+}
+
+X509_VERIFY_PARAM *X_X509_STORE_get0_param(X509_STORE *store) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	return X509_STORE_get0_param(store);
+#else
+	return store->param;
+#endif
+}
+
+// x_key_id returns the subject key identifier of x, or the SHA-1 hash of its
+// public key (RFC 5280, section 4.2.1.2, method 1) if it has none.
+static ASN1_OCTET_STRING *x_key_id(X509 *x, int use_ext) {
+	ASN1_OCTET_STRING *id = NULL;
+	unsigned char md[EVP_MAX_MD_SIZE];
+	unsigned int len;
+
+	if (use_ext) {
+		id = X509_get_ext_d2i(x, NID_subject_key_identifier, NULL, NULL);
+		if (id != NULL) {
+			return id;
+		}
+	}
+	if (X509_pubkey_digest(x, EVP_sha1(), md, &len) != 1) {
+		return NULL;
+	}
+	id = ASN1_OCTET_STRING_new();
+	if (id == NULL || ASN1_OCTET_STRING_set(id, md, len) != 1) {
+		ASN1_OCTET_STRING_free(id);
+		return NULL;
+	}
+	return id;
+}
+
+int X_X509_add_subject_key_id(X509 *x) {
+	ASN1_OCTET_STRING *id = x_key_id(x, 0);
+	int ret;
+
+	if (id == NULL) {
+		return 0;
+	}
+	ret = X509_add1_ext_i2d(x, NID_subject_key_identifier, id, 0,
+		X509V3_ADD_REPLACE);
+	ASN1_OCTET_STRING_free(id);
+	return ret;
+}
+
+int X_X509_add_authority_key_id(X509 *x, X509 *issuer) {
+	AUTHORITY_KEYID *akid = AUTHORITY_KEYID_new();
+	int ret;
+
+	if (akid == NULL) {
+		return 0;
+	}
+	akid->keyid = x_key_id(issuer, 1);
+	if (akid->keyid == NULL) {
+		AUTHORITY_KEYID_free(akid);
+		return 0;
+	}
+	ret = X509_add1_ext_i2d(x, NID_authority_key_identifier, akid, 0,
+		X509V3_ADD_REPLACE);
+	AUTHORITY_KEYID_free(akid);
+	return ret;
+}
+
+// X_EVP_PKEY_CTX_set_rsa_pss selects RSA-PSS padding with the salt as long
+// as the digest
+int X_EVP_PKEY_CTX_set_rsa_pss(EVP_PKEY_CTX *pctx) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	return EVP_PKEY_CTX_set_rsa_padding(pctx, RSA_PKCS1_PSS_PADDING) > 0 &&
+		EVP_PKEY_CTX_set_rsa_pss_saltlen(pctx, RSA_PSS_SALTLEN_DIGEST) > 0;
+#else
+	return 0;
+#endif
+}
+
+// X_EVP_PKEY_sign_digest signs a digest made with md. If pss is set, it
+// uses RSA-PSS padding with the salt length saltlen.
+int X_EVP_PKEY_sign_digest(EVP_PKEY *pkey, const EVP_MD *md, int pss,
+		int saltlen, unsigned char *sig, size_t *siglen,
+		const unsigned char *tbs, size_t tbslen) {
+	EVP_PKEY_CTX *pctx = EVP_PKEY_CTX_new(pkey, NULL);
+	int ret;
+
+	if (pctx == NULL) {
+		return 0;
+	}
+	ret = EVP_PKEY_sign_init(pctx) == 1 &&
+		EVP_PKEY_CTX_set_signature_md(pctx, md) > 0 &&
+		(!pss || (EVP_PKEY_CTX_set_rsa_padding(pctx,
+				RSA_PKCS1_PSS_PADDING) > 0 &&
+			EVP_PKEY_CTX_set_rsa_pss_saltlen(pctx, saltlen) > 0)) &&
+		EVP_PKEY_sign(pctx, sig, siglen, tbs, tbslen) == 1;
+	EVP_PKEY_CTX_free(pctx);
+	return ret;
+}
+
+// X_EVP_PKEY_crypt_rsa encrypts or decrypts in with an RSA key and the
+// padding. OAEP padding uses md for both the label hash and MGF1.
+int X_EVP_PKEY_crypt_rsa(EVP_PKEY *pkey, int decrypt, int padding,
+		const EVP_MD *md, const unsigned char *label, size_t labellen,
+		unsigned char *out, size_t *outlen,
+		const unsigned char *in, size_t inlen) {
+	EVP_PKEY_CTX *pctx = EVP_PKEY_CTX_new(pkey, NULL);
+	unsigned char *label_copy = NULL;
+	int ret = 0;
+
+	if (pctx == NULL) {
+		return 0;
+	}
+	if ((decrypt ? EVP_PKEY_decrypt_init(pctx) :
+			EVP_PKEY_encrypt_init(pctx)) != 1 ||
+			EVP_PKEY_CTX_set_rsa_padding(pctx, padding) <= 0) {
+		goto end;
+	}
+	if (padding == RSA_PKCS1_OAEP_PADDING && md != NULL) {
+		if (EVP_PKEY_CTX_set_rsa_oaep_md(pctx, md) <= 0 ||
+				EVP_PKEY_CTX_set_rsa_mgf1_md(pctx, md) <= 0) {
+			goto end;
+		}
+	}
+	if (padding == RSA_PKCS1_OAEP_PADDING && labellen > 0) {
+		// the context takes ownership of the label on success
+		label_copy = OPENSSL_malloc(labellen);
+		if (label_copy == NULL) {
+			goto end;
+		}
+		memcpy(label_copy, label, labellen);
+		if (EVP_PKEY_CTX_set0_rsa_oaep_label(pctx, label_copy,
+				labellen) <= 0) {
+			OPENSSL_free(label_copy);
+			goto end;
+		}
+	}
+	ret = (decrypt ? EVP_PKEY_decrypt(pctx, out, outlen, in, inlen) :
+		EVP_PKEY_encrypt(pctx, out, outlen, in, inlen)) == 1;
+end:
+	EVP_PKEY_CTX_free(pctx);
+	return ret;
+}
+
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+// x_pss_sign_init returns a digest context set up for RSA-PSS signing
+static EVP_MD_CTX *x_pss_sign_init(EVP_PKEY *pkey, const EVP_MD *md) {
+	EVP_MD_CTX *mctx = X_EVP_MD_CTX_new();
+	EVP_PKEY_CTX *pctx = NULL;
+	if (mctx == NULL) {
+		return NULL;
+	}
+	if (EVP_DigestSignInit(mctx, &pctx, md, NULL, pkey) != 1 ||
+			X_EVP_PKEY_CTX_set_rsa_pss(pctx) != 1) {
+		X_EVP_MD_CTX_free(mctx);
+		return NULL;
+	}
+	return mctx;
+}
+#endif
+
+int X_X509_sign_pss(X509 *x, EVP_PKEY *pkey, const EVP_MD *md) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	EVP_MD_CTX *mctx = x_pss_sign_init(pkey, md);
+	int rv = mctx != NULL ? X509_sign_ctx(x, mctx) : 0;
+	X_EVP_MD_CTX_free(mctx);
+	return rv;
+#else
+	return 0;
+#endif
+}
+
+int X_X509_REQ_sign_pss(X509_REQ *req, EVP_PKEY *pkey, const EVP_MD *md) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	EVP_MD_CTX *mctx = x_pss_sign_init(pkey, md);
+	int rv = mctx != NULL ? X509_REQ_sign_ctx(req, mctx) : 0;
+	X_EVP_MD_CTX_free(mctx);
+	return rv;
+#else
+	return 0;
+#endif
+}
+
+static int x_asn1_type_to_utf8(const ASN1_TYPE *t, unsigned char **out) {
+	switch (t->type) {
+	case V_ASN1_UTF8STRING:
+	case V_ASN1_PRINTABLESTRING:
+	case V_ASN1_IA5STRING:
+	case V_ASN1_T61STRING:
+	case V_ASN1_BMPSTRING:
+	case V_ASN1_UNIVERSALSTRING:
+		return ASN1_STRING_to_UTF8(out, t->value.asn1_string);
+	default:
+		return -2;
+	}
+}
+
+int X_X509_REQ_get_attr_utf8(X509_REQ *req, int nid, unsigned char **out) {
+	int idx = X509_REQ_get_attr_by_NID(req, nid, -1);
+	if (idx < 0) {
+		return -1;
+	}
+	ASN1_TYPE *t = X509_ATTRIBUTE_get0_type(X509_REQ_get_attr(req, idx), 0);
+	if (t == NULL) {
+		return -2;
+	}
+	return x_asn1_type_to_utf8(t, out);
+}
+
+int X_d2i_ASN1_TYPE_utf8(const unsigned char *der, long len, unsigned char **out) {
+	ASN1_TYPE *t = d2i_ASN1_TYPE(NULL, &der, len);
+	if (t == NULL) {
+		return -1;
+	}
+	int rv = x_asn1_type_to_utf8(t, out);
+	ASN1_TYPE_free(t);
+	return rv;
+}
+
+int X_ASN1_TIME_to_unix(const ASN1_TIME *tm, int64_t *out) {
+	int day, sec;
+	ASN1_TIME *epoch = ASN1_TIME_set(NULL, 0);
+	if (epoch == NULL) {
+		return 0;
+	}
+	int rv = ASN1_TIME_diff(&day, &sec, epoch, tm);
+	ASN1_TIME_free(epoch);
+	if (rv != 1) {
+		return 0;
+	}
+	*out = (int64_t)day * 86400 + sec;
+	return 1;
+}
+
+const unsigned char *X_ASN1_STRING_get0_data(const ASN1_STRING *str) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	return ASN1_STRING_get0_data(str);
+#else
+	return str->data;
+#endif
+}
+
+int X_sk_GENERAL_NAME_num(GENERAL_NAMES *sk) {
+	return sk_GENERAL_NAME_num(sk);
+}
+
+GENERAL_NAME *X_sk_GENERAL_NAME_value(GENERAL_NAMES *sk, int i) {
+	return sk_GENERAL_NAME_value(sk, i);
+}
+
+int X_GENERAL_NAME_type(const GENERAL_NAME *gn) {
+	return gn->type;
+}
+
+ASN1_STRING *X_GENERAL_NAME_get0_string(const GENERAL_NAME *gn) {
+	switch (gn->type) {
+	case GEN_EMAIL:
+	case GEN_DNS:
+	case GEN_URI:
+	case GEN_IPADD:
+		return gn->d.ia5;
+	default:
+		return NULL;
+	}
+}
+
+X509_NAME *X_GENERAL_NAME_get0_dirn(const GENERAL_NAME *gn) {
+	return gn->type == GEN_DIRNAME ? gn->d.directoryName : NULL;
+}
+
+ASN1_OBJECT *X_GENERAL_NAME_get0_oid(const GENERAL_NAME *gn) {
+	switch (gn->type) {
+	case GEN_RID:
+		return gn->d.registeredID;
+	case GEN_OTHERNAME:
+		return gn->d.otherName->type_id;
+	default:
+		return NULL;
+	}
+}
+
+/* X_TS_verify verifies the DER time-stamp response against the request it
+ * answers, or the DER time-stamp token against the message imprint when
+ * req_der is NULL. The token info is stored in info on success. */
+int X_TS_verify(const unsigned char *der, long len, const unsigned char *req_der, long req_len, const unsigned char *imprint, size_t imprint_len, X509_STORE *store, TS_TST_INFO **info) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	int rv = 0;
+	TS_RESP *resp = NULL;
+	PKCS7 *token = NULL;
+	TS_REQ *req = NULL;
+	TS_VERIFY_CTX *ctx = NULL;
+
+	if (req_der != NULL) {
+		resp = d2i_TS_RESP(NULL, &der, len);
+		req = d2i_TS_REQ(NULL, &req_der, req_len);
+		if (resp == NULL || req == NULL) {
+			goto end;
+		}
+		/* The imprint, nonce and version checks come from the request, and
+		 * the signature check has to be asked for. */
+		ctx = TS_REQ_to_TS_VERIFY_CTX(req, NULL);
+		if (ctx == NULL) {
+			goto end;
+		}
+		TS_VERIFY_CTX_add_flags(ctx, TS_VFY_SIGNATURE);
+	} else {
+		unsigned char *buf;
+
+		token = d2i_PKCS7(NULL, &der, len);
+		ctx = TS_VERIFY_CTX_new();
+		if (token == NULL || ctx == NULL) {
+			goto end;
+		}
+		/* The context frees the imprint. */
+		buf = OPENSSL_malloc(imprint_len);
+		if (buf == NULL) {
+			goto end;
+		}
+		memcpy(buf, imprint, imprint_len);
+		TS_VERIFY_CTX_set_imprint(ctx, buf, imprint_len);
+		TS_VERIFY_CTX_set_flags(ctx,
+			TS_VFY_VERSION | TS_VFY_SIGNATURE | TS_VFY_IMPRINT);
+	}
+	/* The context frees the store too. */
+	if (X509_STORE_up_ref(store) != 1) {
+		goto end;
+	}
+#if OPENSSL_VERSION_NUMBER >= 0x30400000L
+	TS_VERIFY_CTX_set0_store(ctx, store);
+#else
+	TS_VERIFY_CTX_set_store(ctx, store);
+#endif
+
+	if (resp != NULL) {
+		rv = TS_RESP_verify_response(ctx, resp);
+		if (rv == 1) {
+			*info = TS_TST_INFO_dup(TS_RESP_get_tst_info(resp));
+		}
+	} else {
+		rv = TS_RESP_verify_token(ctx, token);
+		if (rv == 1) {
+			*info = PKCS7_to_TS_TST_INFO(token);
+		}
+	}
+	if (rv == 1 && *info == NULL) {
+		rv = 0;
+	}
+
+end:
+	TS_VERIFY_CTX_free(ctx);
+	TS_REQ_free(req);
+	TS_RESP_free(resp);
+	PKCS7_free(token);
+	return rv;
+#else
+	return 0;
+#endif
+}
+
+int X_X509_CRL_sign_pss(X509_CRL *crl, EVP_PKEY *pkey, const EVP_MD *md) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	EVP_MD_CTX *mctx = x_pss_sign_init(pkey, md);
+	int rv = mctx != NULL ? X509_CRL_sign_ctx(crl, mctx) : 0;
+	X_EVP_MD_CTX_free(mctx);
+	return rv;
+#else
+	return 0;
+#endif
+}
+
+int X_X509_CRL_set_lastUpdate(X509_CRL *crl, const ASN1_TIME *tm) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	return X509_CRL_set1_lastUpdate(crl, tm);
+#else
+	return X509_CRL_set_lastUpdate(crl, tm);
+#endif
+}
+
+int X_X509_CRL_set_nextUpdate(X509_CRL *crl, const ASN1_TIME *tm) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	return X509_CRL_set1_nextUpdate(crl, tm);
+#else
+	return X509_CRL_set_nextUpdate(crl, tm);
+#endif
+}
+
+int X_X509_STORE_new_index() {
+	return X509_STORE_get_ex_new_index(0, NULL, NULL, NULL, go_ssl_crypto_ex_free);
+}
+
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+// x_x509_store_verify_fetched verifies the certificate fetched by the issuer
+// lookup callback as an untrusted one: it must chain up to a certificate of
+// the store, which may involve further lookups. OpenSSL treats the issuers
+// returned by get_issuer as trusted, so they are only returned after this.
+static int x_x509_store_verify_fetched(X509_STORE_CTX *ctx, X509 *fetched) {
+	// a self-issued certificate can't be anchored in the store, the store
+	// lookup found nothing for it
+	if (X509_check_issued(fetched, fetched) == X509_V_OK) {
+		return 0;
+	}
+	X509_VERIFY_PARAM *param = X509_STORE_CTX_get0_param(ctx);
+	// each nested verification decreases the depth, bounding the lookups
+	int depth = X509_VERIFY_PARAM_get_depth(param);
+	if (depth < 0) {
+		depth = 100;
+	}
+	if (depth == 0) {
+		return 0;
+	}
+
+	X509_STORE_CTX *nested = X509_STORE_CTX_new();
+	if (nested == NULL) {
+		return 0;
+	}
+	int rv = 0;
+	if (X509_STORE_CTX_init(nested, X509_STORE_CTX_get0_store(ctx), fetched,
+			X509_STORE_CTX_get0_untrusted(ctx)) != 1) {
+		goto end;
+	}
+	X509_VERIFY_PARAM *nested_param = X509_STORE_CTX_get0_param(nested);
+	// the host and purpose checks are for the leaf, not for the issuers
+	X509_VERIFY_PARAM_set_depth(nested_param, depth - 1);
+	X509_VERIFY_PARAM_set_purpose(nested_param, X509_PURPOSE_ANY);
+	X509_VERIFY_PARAM_set_flags(nested_param, X509_VERIFY_PARAM_get_flags(param) &
+		~(X509_V_FLAG_PARTIAL_CHAIN | X509_V_FLAG_USE_CHECK_TIME));
+	X509_VERIFY_PARAM_clear_flags(nested_param, X509_V_FLAG_PARTIAL_CHAIN);
+	if (X509_VERIFY_PARAM_get_flags(param) & X509_V_FLAG_USE_CHECK_TIME) {
+		X509_VERIFY_PARAM_set_time(nested_param, X509_VERIFY_PARAM_get_time(param));
+	}
+	rv = X509_verify_cert(nested) == 1;
+end:
+	X509_STORE_CTX_free(nested);
+	return rv;
+}
+
+static int x_x509_store_get_issuer(X509 **issuer, X509_STORE_CTX *ctx, X509 *x) {
+	int rv = X509_STORE_CTX_get1_issuer(issuer, ctx, x);
+	if (rv != 0) {
+		return rv;
+	}
+
+	X509_STORE *store = X509_STORE_CTX_get0_store(ctx);
+	void *p = X509_STORE_get_ex_data(store, get_x509_store_idx());
+	if (p == NULL) {
+		return 0;
+	}
+	// the thunk returns a new reference
+	X509 *found = go_x509_store_lookup_issuer_thunk(p, x);
+	if (found == NULL) {
+		return 0;
+	}
+	if (X509_check_issued(found, x) != X509_V_OK ||
+			x_x509_store_verify_fetched(ctx, found) != 1) {
+		X509_free(found);
+		return 0;
+	}
+	*issuer = found;
+	return 1;
+}
+#endif
+
+int X_X509_STORE_set_lookup_issuer(X509_STORE *store, void *p) {
+#if OPENSSL_VERSION_NUMBER >= 0x1010000fL
+	if (X509_STORE_set_ex_data(store, get_x509_store_idx(), p) != 1) {
+		return 0;
+	}
+	X509_STORE_set_get_issuer(store, p != NULL ? x_x509_store_get_issuer : NULL);
+	return 1;
+#else
+	return 0;
+#endif
+}
+
 long X_X509_get_version(const X509 *x) {
 	return X509_get_version(x);
 }
@@ -18,6 +18,7 @@
 #include <stdlib.h>
 #include <string.h>
 #include <stdio.h>
+#include <stdint.h>
 
 #include <openssl/bio.h>
 #include <openssl/crypto.h>
@@ -25,8 +26,11 @@
 #include <openssl/err.h>
 #include <openssl/evp.h>
 #include <openssl/hmac.h>
+#include <openssl/ocsp.h>
 #include <openssl/pem.h>
+#include <openssl/rand.h>
 #include <openssl/ssl.h>
+#include <openssl/ts.h>
 #include <openssl/x509v3.h>
 #include <openssl/ec.h>
 
@@ -39,9 +43,20 @@
 #define SSL_OP_NO_COMPRESSION 0
 #endif
 
+#ifndef SSL_OP_NO_RENEGOTIATION
+#define SSL_OP_NO_RENEGOTIATION 0
+#endif
+
 /* shim  methods */
 extern int X_shim_init();
 
+/* ERR methods */
+extern const int X_ERR_LIB_PROV;
+extern const int X_PROV_R_BAD_DECRYPT;
+extern int X_ERR_GET_LIB(unsigned long e);
+extern int X_ERR_GET_FUNC(unsigned long e);
+extern int X_ERR_GET_REASON(unsigned long e);
+
 /* Library methods */
 extern void X_OPENSSL_free(void *ref);
 extern void *X_OPENSSL_malloc(size_t size);
@@ -51,16 +66,34 @@ extern long X_SSL_set_options(SSL* ssl, long options);
 extern long X_SSL_get_options(SSL* ssl);
 extern long X_SSL_clear_options(SSL* ssl, long options);
 extern long X_SSL_set_tlsext_host_name(SSL *ssl, const char *name);
+extern long X_SSL_set_tlsext_status_type(SSL *ssl, int type);
+extern long X_SSL_get_tlsext_status_ocsp_resp(SSL *ssl, const unsigned char **resp);
+extern STACK_OF(X509) *X_SSL_get0_verified_chain(const SSL *ssl);
 extern const char * X_SSL_get_cipher_name(const SSL *ssl);
+extern long X_SSL_set_mode(SSL* ssl, long modes);
+extern long X_SSL_clear_mode(SSL* ssl, long modes);
+extern long X_SSL_get_mode(SSL* ssl);
 extern int X_SSL_session_reused(SSL *ssl);
+extern int X_SSL_read_batch(SSL *ssl, void *buf, int num, int *last);
 extern int X_SSL_new_index();
-extern void X_SSL_toggle_tracing(SSL* ssl, FILE* output, short enable);
+extern void X_SSL_toggle_tracing(SSL* ssl, FILE* output, short enable, const char *prefix);
+extern int X_SSL_get_negotiated_group(SSL *ssl);
 
 extern const SSL_METHOD *X_SSLv23_method();
 extern const SSL_METHOD *X_SSLv3_method();
 extern const SSL_METHOD *X_TLSv1_method();
 extern const SSL_METHOD *X_TLSv1_1_method();
 extern const SSL_METHOD *X_TLSv1_2_method();
+extern const SSL_METHOD *X_DTLS_method();
+extern int X_SSL_is_dtls(const SSL *ssl);
+extern int X_SSL_CTX_set_tlsext_use_srtp(SSL_CTX *ctx, const char *profiles);
+extern int X_SSL_CTX_set1_groups_list(SSL_CTX *ctx, const char *list);
+extern int X_SSL_CTX_set1_cert_type(SSL_CTX *ctx, int server, const unsigned char *types, size_t len);
+extern const char *X_SSL_get_selected_srtp_profile(SSL *ssl);
+extern const char *X_SSL_get_negotiated_group_name(SSL *ssl);
+extern int X_SSL_get_negotiated_cert_type(SSL *ssl, int server);
+extern EVP_PKEY *X_SSL_get1_peer_rpk(SSL *ssl);
+extern int X_SSL_add_expected_rpk(SSL *ssl, EVP_PKEY *rpk);
 
 #if defined SSL_CTRL_SET_TLSEXT_HOSTNAME
 extern int sni_cb(SSL *ssl_conn, int *ad, void *arg);
@@ -74,22 +107,52 @@ extern int X_SSL_CTX_new_index();
 #endif
 extern int X_SSL_CTX_set_min_proto_version(SSL_CTX *ctx, int version);
 extern int X_SSL_CTX_set_max_proto_version(SSL_CTX *ctx, int version);
+extern int X_SSL_CTX_copy(SSL_CTX *dst, SSL_CTX *src);
 extern long X_SSL_CTX_set_options(SSL_CTX* ctx, long options);
 extern long X_SSL_CTX_clear_options(SSL_CTX* ctx, long options);
 extern long X_SSL_CTX_get_options(SSL_CTX* ctx);
 extern long X_SSL_CTX_set_mode(SSL_CTX* ctx, long modes);
 extern long X_SSL_CTX_get_mode(SSL_CTX* ctx);
+extern long X_SSL_CTX_clear_mode(SSL_CTX* ctx, long modes);
 extern long X_SSL_CTX_set_session_cache_mode(SSL_CTX* ctx, long modes);
 extern long X_SSL_CTX_sess_set_cache_size(SSL_CTX* ctx, long t);
 extern long X_SSL_CTX_sess_get_cache_size(SSL_CTX* ctx);
 extern long X_SSL_CTX_set_timeout(SSL_CTX* ctx, long t);
 extern long X_SSL_CTX_get_timeout(SSL_CTX* ctx);
 extern long X_SSL_CTX_add_extra_chain_cert(SSL_CTX* ctx, X509 *cert);
+extern long X_SSL_CTX_clear_extra_chain_certs(SSL_CTX* ctx);
+extern long X_SSL_CTX_add1_chain_cert(SSL_CTX* ctx, X509 *cert);
+extern long X_SSL_CTX_clear_chain_certs(SSL_CTX* ctx);
+extern long X_SSL_add1_chain_cert(SSL* ssl, X509 *cert);
+extern long X_SSL_clear_chain_certs(SSL* ssl);
 extern long X_SSL_CTX_set_tmp_ecdh(SSL_CTX* ctx, EC_KEY *key);
 extern long X_SSL_CTX_set_tlsext_servername_callback(SSL_CTX* ctx, int (*cb)(SSL *con, int *ad, void *args));
 extern int X_SSL_CTX_verify_cb(int ok, X509_STORE_CTX* store);
+extern void X_SSL_CTX_enable_handshake_msg_cb(SSL_CTX* ctx);
+extern void X_SSL_CTX_enable_info_cb(SSL_CTX* ctx);
+extern void X_SSL_CTX_enable_ocsp_status_cb(SSL_CTX* ctx);
+extern void X_SSL_CTX_enable_alpn_select_cb(SSL_CTX* ctx);
+extern void X_SSL_CTX_enable_cert_cb(SSL_CTX* ctx);
+extern void X_SSL_CTX_enable_cert_verify_cb(SSL_CTX *ctx);
+extern long X_SSL_CTX_set1_verify_cert_store(SSL_CTX *ctx, X509_STORE *store);
+extern void X_SSL_CTX_enable_client_session_cb(SSL_CTX* ctx);
+extern EVP_PKEY *X_PEM_read_bio_PrivateKey_cb(BIO *bio, void *u);
+extern EVP_PKEY *X_d2i_PKCS8PrivateKey_bio_cb(BIO *bio, void *u);
+
+/* OSSL_STORE methods */
+#define X_STORE_OTHER 1
+#define X_STORE_PRIVATE_KEY 2
+#define X_STORE_PUBLIC_KEY 3
+#define X_STORE_CERTIFICATE 4
+extern void *X_OSSL_STORE_open(const char *uri, void *u);
+extern int X_OSSL_STORE_load(void *store, EVP_PKEY **pkey, X509 **cert);
+extern void X_OSSL_STORE_close(void *store);
+
 extern long X_SSL_CTX_set_tmp_dh(SSL_CTX* ctx, DH *dh);
 extern long X_PEM_read_DHparams(SSL_CTX* ctx, DH *dh);
+extern long X_SSL_CTX_set_dh_auto(SSL_CTX* ctx, int onoff);
+extern DH *X_DH_new_by_nid(int nid);
+extern DH *X_DH_generate_parameters(int bits, int generator);
 extern int X_SSL_CTX_set_tlsext_ticket_key_cb(SSL_CTX *sslctx,
         int (*cb)(SSL *s, unsigned char key_name[16],
                   unsigned char iv[EVP_MAX_IV_LENGTH],
@@ -113,7 +176,15 @@ extern BIO *X_BIO_new_read_bio();
 
 /* EVP methods */
 extern const int X_ED25519_SUPPORT;
+extern const int X_EVP_KDF_SUPPORT;
+extern const int X_EDDSA_INSTANCE_SUPPORT;
+extern const int X_RPK_SUPPORT;
+extern const int X_HPKE_SUPPORT;
 extern int X_EVP_PKEY_ED25519;
+extern int X_EVP_PKEY_ED448;
+extern int X_EVP_PKEY_X25519;
+extern int X_EVP_PKEY_X448;
+extern int X_EVP_PKEY_RSA_PSS;
 extern const EVP_MD *X_EVP_get_digestbyname(const char *name);
 extern EVP_MD_CTX *X_EVP_MD_CTX_new();
 extern void X_EVP_MD_CTX_free(EVP_MD_CTX *ctx);
@@ -129,7 +200,23 @@ extern const EVP_MD *X_EVP_sha224();
 extern const EVP_MD *X_EVP_sha256();
 extern const EVP_MD *X_EVP_sha384();
 extern const EVP_MD *X_EVP_sha512();
+extern const EVP_MD *X_EVP_sha512_256();
+extern const EVP_MD *X_EVP_sha3_224();
+extern const EVP_MD *X_EVP_sha3_256();
+extern const EVP_MD *X_EVP_sha3_384();
+extern const EVP_MD *X_EVP_sha3_512();
+extern const EVP_MD *X_EVP_blake2b512();
+extern const EVP_MD *X_EVP_blake2s256();
 extern int X_EVP_MD_size(const EVP_MD *md);
+extern int X_EVP_MD_block_size(const EVP_MD *md);
+extern int X_EVP_PKEY_hkdf(int mode, const EVP_MD *md, const unsigned char *secret, size_t secretlen, const unsigned char *salt, size_t saltlen, const unsigned char *info, size_t infolen, unsigned char *out, size_t *outlen);
+extern int X_EVP_PBE_scrypt(const char *pass, size_t passlen, const unsigned char *salt, size_t saltlen, uint64_t N, uint64_t r, uint64_t p, uint64_t maxmem, unsigned char *key, size_t keylen);
+extern int X_EVP_PKEY_tls1_prf(const EVP_MD *md, const unsigned char *secret, size_t secretlen, const unsigned char *seed, size_t seedlen, unsigned char *out, size_t *outlen);
+extern int X_EVP_KDF_derive_digest(const char *name, const char *propq, const EVP_MD *md, const unsigned char *secret, size_t secretlen, const unsigned char *info, size_t infolen, unsigned char *out, size_t outlen);
+extern int X_EVP_KDF_hkdf(int mode, const char *propq, const EVP_MD *md, const unsigned char *secret, size_t secretlen, const unsigned char *salt, size_t saltlen, const unsigned char *info, size_t infolen, unsigned char *out, size_t outlen);
+extern int X_EVP_KDF_pbkdf2(const char *propq, const EVP_MD *md, const unsigned char *pass, size_t passlen, const unsigned char *salt, size_t saltlen, uint64_t iter, unsigned char *out, size_t outlen);
+extern int X_EVP_KDF_scrypt(const char *propq, const unsigned char *pass, size_t passlen, const unsigned char *salt, size_t saltlen, uint64_t N, uint64_t r, uint64_t p, uint64_t maxmem, unsigned char *out, size_t outlen);
+extern int X_EVP_KDF_tls1_prf(const char *propq, const EVP_MD *md, const unsigned char *secret, size_t secretlen, const unsigned char *seed, size_t seedlen, unsigned char *out, size_t outlen);
 extern int X_EVP_DigestInit_ex(EVP_MD_CTX *ctx, const EVP_MD *type, ENGINE *impl);
 extern int X_EVP_DigestUpdate(EVP_MD_CTX *ctx, const void *d, size_t cnt);
 extern int X_EVP_DigestFinal_ex(EVP_MD_CTX *ctx, unsigned char *md, unsigned int *s);
@@ -153,13 +240,65 @@ extern int X_EVP_CIPHER_block_size(EVP_CIPHER *c);
 extern int X_EVP_CIPHER_key_length(EVP_CIPHER *c);
 extern int X_EVP_CIPHER_iv_length(EVP_CIPHER *c);
 extern int X_EVP_CIPHER_nid(EVP_CIPHER *c);
+extern int X_EVP_CIPHER_is_aead(EVP_CIPHER *c);
 extern int X_EVP_CIPHER_CTX_block_size(EVP_CIPHER_CTX *ctx);
 extern int X_EVP_CIPHER_CTX_key_length(EVP_CIPHER_CTX *ctx);
 extern int X_EVP_CIPHER_CTX_iv_length(EVP_CIPHER_CTX *ctx);
 extern void X_EVP_CIPHER_CTX_set_padding(EVP_CIPHER_CTX *ctx, int padding);
 extern const EVP_CIPHER *X_EVP_CIPHER_CTX_cipher(EVP_CIPHER_CTX *ctx);
+extern const EVP_CIPHER *X_EVP_chacha20_poly1305();
+extern void *X_EVP_MAC_new(const char *name, const unsigned char *key, size_t keylen, size_t size);
+extern int X_EVP_MAC_init(void *ctx, const unsigned char *key, size_t keylen, size_t size);
+extern int X_EVP_MAC_update(void *ctx, const unsigned char *data, size_t len);
+extern int X_EVP_MAC_sum(void *ctx, unsigned char *out, size_t *outlen, size_t outsize);
+extern size_t X_EVP_MAC_size(void *ctx);
+extern void X_EVP_MAC_free(void *ctx);
+extern int X_OSSL_HPKE_suite_check(int kem, int kdf, int aead);
+extern size_t X_OSSL_HPKE_get_public_encap_size(int kem, int kdf, int aead);
+extern size_t X_OSSL_HPKE_get_ciphertext_size(int kem, int kdf, int aead, size_t clearlen);
+extern int X_OSSL_HPKE_keygen(int kem, int kdf, int aead, unsigned char *pub, size_t *publen, EVP_PKEY **priv);
+extern void *X_OSSL_HPKE_CTX_new(int mode, int kem, int kdf, int aead, int role);
+extern void X_OSSL_HPKE_CTX_free(void *ctx);
+extern int X_OSSL_HPKE_CTX_set1_psk(void *ctx, const char *pskid, const unsigned char *psk, size_t psklen);
+extern int X_OSSL_HPKE_CTX_set1_authpriv(void *ctx, EVP_PKEY *priv);
+extern int X_OSSL_HPKE_CTX_set1_authpub(void *ctx, const unsigned char *pub, size_t publen);
+extern int X_OSSL_HPKE_encap(void *ctx, unsigned char *enc, size_t *enclen, const unsigned char *pub, size_t publen, const unsigned char *info, size_t infolen);
+extern int X_OSSL_HPKE_decap(void *ctx, const unsigned char *enc, size_t enclen, EVP_PKEY *priv, const unsigned char *info, size_t infolen);
+extern int X_OSSL_HPKE_seal(void *ctx, unsigned char *ct, size_t *ctlen, const unsigned char *aad, size_t aadlen, const unsigned char *pt, size_t ptlen);
+extern int X_OSSL_HPKE_open(void *ctx, unsigned char *pt, size_t *ptlen, const unsigned char *aad, size_t aadlen, const unsigned char *ct, size_t ctlen);
+extern int X_OSSL_HPKE_export(void *ctx, unsigned char *secret, size_t secretlen, const unsigned char *label, size_t labellen);
+extern size_t X_EVP_PKEY_get1_encoded_public_key(EVP_PKEY *pkey, unsigned char **out);
+extern void *X_OSSL_PROVIDER_load(const char *name);
+extern int X_OSSL_PROVIDER_unload(void *prov);
+extern int X_OSSL_PROVIDER_available(const char *name);
+extern int X_EVP_set_default_properties(const char *propq);
+extern const EVP_MD *X_EVP_MD_fetch(const char *name, const char *propq);
+extern void X_EVP_MD_free(const EVP_MD *md);
+extern const EVP_CIPHER *X_EVP_CIPHER_fetch(const char *name, const char *propq);
+extern void X_EVP_CIPHER_free(const EVP_CIPHER *cipher);
+extern int X_EVP_PKEY_eq(const EVP_PKEY *a, const EVP_PKEY *b);
+extern int X_EVP_PKEY_ec_curve(EVP_PKEY *pkey);
+extern int X_CRYPTO_secure_malloc_init(size_t size, size_t minsize);
+extern int X_CRYPTO_secure_malloc_done();
+extern int X_CRYPTO_secure_malloc_initialized();
+extern size_t X_CRYPTO_secure_used();
+extern void *X_OPENSSL_secure_malloc(size_t num);
+extern void X_OPENSSL_secure_clear_free(void *ptr, size_t num);
+extern int X_BN_is_negative(const BIGNUM *b);
+extern int X_BN_is_odd(const BIGNUM *b);
+extern void X_BN_set_flags(BIGNUM *b, int n);
+extern int X_RAND_bytes(unsigned char *buf, int num);
+extern int X_RAND_priv_bytes(unsigned char *buf, int num);
+extern int X_RAND_poll();
+extern int X_RAND_set_reseed(unsigned int requests, int64_t seconds);
+extern int X_EVP_PKEY_eddsa(int verify, EVP_PKEY *pkey, const char *instance, const unsigned char *context, size_t contextlen, unsigned char *sig, size_t *siglen, const unsigned char *tbs, size_t tbslen);
+extern int X_EVP_aes_wrap(int pad, int enc, const unsigned char *kek, int keklen, const unsigned char *in, int inlen, unsigned char *out, int *outlen);
+extern int X_EVP_AEAD_seal(const EVP_CIPHER *cipher, const unsigned char *key, const unsigned char *nonce, int noncelen, const unsigned char *aad, int aadlen, const unsigned char *in, int inlen, unsigned char *out, unsigned char *tag, int taglen);
+extern int X_EVP_AEAD_open(const EVP_CIPHER *cipher, const unsigned char *key, const unsigned char *nonce, int noncelen, const unsigned char *aad, int aadlen, const unsigned char *in, int inlen, const unsigned char *tag, int taglen, unsigned char *out);
 extern int X_EVP_CIPHER_CTX_encrypting(const EVP_CIPHER_CTX *ctx);
 extern int X_EVP_PKEY_CTX_set_ec_paramgen_curve_nid(EVP_PKEY_CTX *ctx, int nid);
+extern int X_EVP_PKEY_CTX_set_rsa_keygen(EVP_PKEY_CTX *ctx, int bits,
+	unsigned long exponent);
 
 /* HMAC methods */
 extern size_t X_HMAC_size(const HMAC_CTX *e);
@@ -168,15 +307,64 @@ extern void X_HMAC_CTX_free(HMAC_CTX *ctx);
 extern int X_HMAC_Init_ex(HMAC_CTX *ctx, const void *key, int len, const EVP_MD *md, ENGINE *impl);
 extern int X_HMAC_Update(HMAC_CTX *ctx, const unsigned char *data, size_t len);
 extern int X_HMAC_Final(HMAC_CTX *ctx, unsigned char *md, unsigned int *len);
+extern int X_HMAC_CTX_copy(HMAC_CTX *dctx, HMAC_CTX *sctx);
 
 /* X509 methods */
+#ifndef X509_PURPOSE_CODE_SIGN
+#define X509_PURPOSE_CODE_SIGN -1
+#endif
 extern int X_X509_add_ref(X509* x509);
+extern int X_X509_STORE_add_ref(X509_STORE* store);
 extern const ASN1_TIME *X_X509_get0_notBefore(const X509 *x);
 extern const ASN1_TIME *X_X509_get0_notAfter(const X509 *x);
+extern STACK_OF(X509) *X_X509_STORE_CTX_get0_untrusted(X509_STORE_CTX *ctx);
+extern void X_X509_STORE_CTX_set0_untrusted(X509_STORE_CTX *ctx, STACK_OF(X509) *sk);
+extern int X_X509_STORE_CTX_check_leaf_purposes(X509_STORE_CTX *ctx, int *purposes, int n);
+extern int X_X509_VERIFY_PARAM_set1_host(X509_VERIFY_PARAM *param, const char *name, size_t len);
+extern int X_X509_VERIFY_PARAM_set_no_check_time(X509_VERIFY_PARAM *param);
 extern int X_sk_X509_num(STACK_OF(X509) *sk);
 extern X509 *X_sk_X509_value(STACK_OF(X509)* sk, int i);
+extern STACK_OF(X509) *X_sk_X509_new_null();
+extern int X_sk_X509_push(STACK_OF(X509) *sk, X509 *x509);
+extern void X_sk_X509_free(STACK_OF(X509) *sk);
+extern int X_X509_check_issued(X509 *issuer, X509 *subject);
+extern int X_X509_verify_cb_accept_all(int ok, X509_STORE_CTX *store);
 extern long X_X509_get_version(const X509 *x);
 extern int X_X509_set_version(X509 *x, long version);
+extern int X_X509_add_subject_key_id(X509 *x);
+extern int X_X509_check_time_skew(X509 *x, time_t now, long skew);
+extern void X_X509_VERIFY_PARAM_set_time(X509_VERIFY_PARAM *param, time_t t,
+	int use);
+extern X509_VERIFY_PARAM *X_X509_STORE_get0_param(X509_STORE *store);
+extern int X_X509_add_authority_key_id(X509 *x, X509 *issuer);
+
+extern int X_EVP_PKEY_CTX_set_rsa_pss(EVP_PKEY_CTX *pctx);
+extern int X_EVP_PKEY_sign_digest(EVP_PKEY *pkey, const EVP_MD *md, int pss, int saltlen, unsigned char *sig, size_t *siglen, const unsigned char *tbs, size_t tbslen);
+extern int X_EVP_PKEY_crypt_rsa(EVP_PKEY *pkey, int decrypt, int padding, const EVP_MD *md, const unsigned char *label, size_t labellen, unsigned char *out, size_t *outlen, const unsigned char *in, size_t inlen);
+extern int X_X509_sign_pss(X509 *x, EVP_PKEY *pkey, const EVP_MD *md);
+extern int X_X509_REQ_sign_pss(X509_REQ *req, EVP_PKEY *pkey, const EVP_MD *md);
+extern int X_X509_REQ_get_attr_utf8(X509_REQ *req, int nid, unsigned char **out);
+extern int X_X509_CRL_sign_pss(X509_CRL *crl, EVP_PKEY *pkey, const EVP_MD *md);
+extern int X_X509_CRL_set_lastUpdate(X509_CRL *crl, const ASN1_TIME *tm);
+extern int X_X509_CRL_set_nextUpdate(X509_CRL *crl, const ASN1_TIME *tm);
+
+/* ASN.1 conversion helpers */
+extern int X_d2i_ASN1_TYPE_utf8(const unsigned char *der, long len, unsigned char **out);
+extern int X_ASN1_TIME_to_unix(const ASN1_TIME *tm, int64_t *out);
+extern const unsigned char *X_ASN1_STRING_get0_data(const ASN1_STRING *str);
+extern int X_sk_GENERAL_NAME_num(GENERAL_NAMES *sk);
+extern GENERAL_NAME *X_sk_GENERAL_NAME_value(GENERAL_NAMES *sk, int i);
+extern int X_GENERAL_NAME_type(const GENERAL_NAME *gn);
+extern ASN1_STRING *X_GENERAL_NAME_get0_string(const GENERAL_NAME *gn);
+extern X509_NAME *X_GENERAL_NAME_get0_dirn(const GENERAL_NAME *gn);
+extern ASN1_OBJECT *X_GENERAL_NAME_get0_oid(const GENERAL_NAME *gn);
+
+/* TS methods */
+extern int X_TS_verify(const unsigned char *der, long len, const unsigned char *req_der, long req_len, const unsigned char *imprint, size_t imprint_len, X509_STORE *store, TS_TST_INFO **info);
+
+/* X509_STORE methods */
+extern int X_X509_STORE_new_index();
+extern int X_X509_STORE_set_lookup_issuer(X509_STORE *store, void *p);
 
 /* PEM methods */
 extern int X_PEM_write_bio_PrivateKey_traditional(BIO *bio, EVP_PKEY *key, const EVP_CIPHER *enc, unsigned char *kstr, int klen, pem_password_cb *cb, void *u);
@@ -0,0 +1,191 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+)
+
+// StreamSigner signs data written to it piece by piece, so that large
+// data needs not be held in memory. It is not safe for concurrent use.
+type StreamSigner struct {
+	ctx *C.EVP_MD_CTX
+	key PrivateKey
+}
+
+// StreamVerifier verifies a signature of data written to it piece by
+// piece. It is not safe for concurrent use.
+type StreamVerifier struct {
+	ctx *C.EVP_MD_CTX
+	key PublicKey
+}
+
+// NewStreamSigner returns a signer making the same signatures as
+// PrivateKey.Sign. EdDSA keys only sign in one shot, so they are not
+// supported. It requires OpenSSL 1.1.1 or newer.
+func NewStreamSigner(key PrivateKey, method Method) (*StreamSigner, error) {
+	return newStreamSigner(key, method, false)
+}
+
+// NewStreamSignerPSS returns a signer making the same signatures as
+// PrivateKey.SignPSS.
+func NewStreamSignerPSS(key PrivateKey, method Method) (*StreamSigner,
+	error) {
+	if !isRSA(key.KeyType()) {
+		return nil, errors.New("RSA-PSS requires an RSA key")
+	}
+	return newStreamSigner(key, method, true)
+}
+
+// NewStreamVerifier returns a verifier of signatures made by
+// PrivateKey.Sign or a StreamSigner.
+func NewStreamVerifier(key PublicKey, method Method) (*StreamVerifier,
+	error) {
+	return newStreamVerifier(key, method, false)
+}
+
+// NewStreamVerifierPSS returns a verifier of signatures made by
+// PrivateKey.SignPSS or a StreamSigner from NewStreamSignerPSS.
+func NewStreamVerifierPSS(key PublicKey, method Method) (*StreamVerifier,
+	error) {
+	if !isRSA(key.KeyType()) {
+		return nil, errors.New("RSA-PSS requires an RSA key")
+	}
+	return newStreamVerifier(key, method, true)
+}
+
+func checkStreamMethod(key PublicKey, method Method) error {
+	if isEdDSA(key.KeyType()) {
+		return errors.New("EdDSA keys cannot sign a stream")
+	}
+	if method == nil {
+		return errors.New("nil digest")
+	}
+	return nil
+}
+
+func newStreamSigner(key PrivateKey, method Method, pss bool) (
+	*StreamSigner, error) {
+	if err := checkStreamMethod(key, method); err != nil {
+		return nil, err
+	}
+	s := &StreamSigner{key: key}
+	s.ctx = C.X_EVP_MD_CTX_new()
+	if s.ctx == nil {
+		return nil, errors.New("sign: failed to allocate digest context")
+	}
+	runtime.SetFinalizer(s, func(s *StreamSigner) { s.Close() })
+	var pctx *C.EVP_PKEY_CTX
+	if C.X_EVP_DigestSignInit(s.ctx, &pctx, method, nil,
+		key.evpPKey()) != 1 {
+		return nil, errors.New("sign: failed to init signature")
+	}
+	if pss && C.X_EVP_PKEY_CTX_set_rsa_pss(pctx) != 1 {
+		return nil, errors.New("sign: failed to set RSA-PSS padding")
+	}
+	return s, nil
+}
+
+func newStreamVerifier(key PublicKey, method Method, pss bool) (
+	*StreamVerifier, error) {
+	if err := checkStreamMethod(key, method); err != nil {
+		return nil, err
+	}
+	v := &StreamVerifier{key: key}
+	v.ctx = C.X_EVP_MD_CTX_new()
+	if v.ctx == nil {
+		return nil, errors.New("verify: failed to allocate digest context")
+	}
+	runtime.SetFinalizer(v, func(v *StreamVerifier) { v.Close() })
+	var pctx *C.EVP_PKEY_CTX
+	if C.X_EVP_DigestVerifyInit(v.ctx, &pctx, method, nil,
+		key.evpPKey()) != 1 {
+		return nil, errors.New("verify: failed to init verify")
+	}
+	if pss && C.X_EVP_PKEY_CTX_set_rsa_pss(pctx) != 1 {
+		return nil, errors.New("verify: failed to set RSA-PSS padding")
+	}
+	return v, nil
+}
+
+// Close frees the signer. It must not be used afterwards.
+func (s *StreamSigner) Close() {
+	if s.ctx != nil {
+		C.X_EVP_MD_CTX_free(s.ctx)
+		s.ctx = nil
+	}
+}
+
+func (s *StreamSigner) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if C.X_EVP_DigestUpdate(s.ctx, unsafe.Pointer(&p[0]),
+		C.size_t(len(p))) != 1 {
+		return 0, errors.New("sign: failed to update digest")
+	}
+	return len(p), nil
+}
+
+// Sign returns the signature of the data written so far. The signer must
+// not be written to afterwards.
+func (s *StreamSigner) Sign() ([]byte, error) {
+	sig := make([]byte, s.key.Size())
+	siglen := C.size_t(len(sig))
+	if C.EVP_DigestSignFinal(s.ctx, (*C.uchar)(unsafe.Pointer(&sig[0])),
+		&siglen) != 1 {
+		return nil, errors.New("sign: failed to sign")
+	}
+	runtime.KeepAlive(s)
+	return sig[:siglen], nil
+}
+
+// Close frees the verifier. It must not be used afterwards.
+func (v *StreamVerifier) Close() {
+	if v.ctx != nil {
+		C.X_EVP_MD_CTX_free(v.ctx)
+		v.ctx = nil
+	}
+}
+
+func (v *StreamVerifier) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if C.X_EVP_DigestUpdate(v.ctx, unsafe.Pointer(&p[0]),
+		C.size_t(len(p))) != 1 {
+		return 0, errors.New("verify: failed to update digest")
+	}
+	return len(p), nil
+}
+
+// Verify verifies the signature of the data written so far. The verifier
+// must not be written to afterwards.
+func (v *StreamVerifier) Verify(sig []byte) error {
+	if len(sig) == 0 {
+		return errors.New("verify: 0-length sig")
+	}
+	if C.EVP_DigestVerifyFinal(v.ctx, (*C.uchar)(unsafe.Pointer(&sig[0])),
+		C.size_t(len(sig))) != 1 {
+		return errors.New("verify: invalid signature")
+	}
+	runtime.KeepAlive(v)
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStreamSign(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+	rsaKey, err := GenerateRSAKeyWithOptions(RSAKeyOptions{Bits: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := strings.Repeat("the quick brown fox jumps over the lazy dog\n",
+		10000)
+
+	for _, test := range []struct {
+		key PrivateKey
+		pss bool
+	}{
+		{rsaKey, false},
+		{rsaKey, true},
+		{ecKey, false},
+	} {
+		var signer *StreamSigner
+		if test.pss {
+			signer, err = NewStreamSignerPSS(test.key, SHA256_Method)
+		} else {
+			signer, err = NewStreamSigner(test.key, SHA256_Method)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(signer, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		sig, err := signer.Sign()
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer.Close()
+		if test.pss {
+			err = test.key.VerifyPSS(SHA256_Method, []byte(data), sig)
+		} else {
+			err = test.key.Verify(SHA256_Method, []byte(data), sig)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tampered := range []bool{false, true} {
+			var verifier *StreamVerifier
+			if test.pss {
+				verifier, err = NewStreamVerifierPSS(test.key, SHA256_Method)
+			} else {
+				verifier, err = NewStreamVerifier(test.key, SHA256_Method)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.Copy(verifier,
+				strings.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			if tampered {
+				verifier.Write([]byte("!"))
+			}
+			err = verifier.Verify(sig)
+			if tampered && err == nil {
+				t.Fatal("verified tampered data")
+			} else if !tampered && err != nil {
+				t.Fatal(err)
+			}
+			verifier.Close()
+		}
+	}
+
+	edKey, err := GenerateED25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStreamSigner(edKey, SHA256_Method); err == nil {
+		t.Fatal("stream signer accepted an Ed25519 key")
+	}
+	if _, err := NewStreamSignerPSS(ecKey, SHA256_Method); err == nil {
+		t.Fatal("RSA-PSS stream signer accepted an EC key")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// cryptoHashNames maps the hashes of the standard library to the names of
+// OpenSSL digests.
+var cryptoHashNames = map[crypto.Hash]string{
+	crypto.MD5:        "MD5",
+	crypto.SHA1:       "SHA1",
+	crypto.SHA224:     "SHA224",
+	crypto.SHA256:     "SHA256",
+	crypto.SHA384:     "SHA384",
+	crypto.SHA512:     "SHA512",
+	crypto.SHA512_224: "SHA512-224",
+	crypto.SHA512_256: "SHA512-256",
+	crypto.SHA3_224:   "SHA3-224",
+	crypto.SHA3_256:   "SHA3-256",
+	crypto.SHA3_384:   "SHA3-384",
+	crypto.SHA3_512:   "SHA3-512",
+}
+
+// cryptoHashDigest returns the OpenSSL digest of the hash.
+func cryptoHashDigest(hash crypto.Hash) (*Digest, error) {
+	name, ok := cryptoHashNames[hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash function %v", hash)
+	}
+	return GetDigestByName(name)
+}
+
+type signer struct {
+	key    PrivateKey
+	public crypto.PublicKey
+}
+
+// NewSigner returns a crypto.Signer that signs with the key, so it can be
+// used by the standard library, e.g. x509.CreateCertificate. Public returns
+// the public key as one of the standard library types. RSA keys sign with
+// PKCS #1 v1.5 padding, or with RSA-PSS padding if the options are
+// *rsa.PSSOptions. EdDSA keys sign the whole message and need a zero hash
+// in the options.
+func NewSigner(key PrivateKey) (crypto.Signer, error) {
+	public, err := key.ToCryptoPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return &signer{key: key, public: public}, nil
+}
+
+func (s *signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs the digest. The random source is ignored, OpenSSL uses its
+// own.
+func (s *signer) Sign(_ io.Reader, digest []byte,
+	opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if isEdDSA(s.key.KeyType()) {
+		if hash != 0 {
+			return nil, errors.New("EdDSA keys sign the message, " +
+				"not a digest")
+		}
+		return s.key.Sign(nil, digest)
+	}
+	if hash == 0 {
+		return nil, errors.New("a hash function is required")
+	}
+	md, err := cryptoHashDigest(hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(digest) != hash.Size() {
+		return nil, errors.New("digest length does not match the hash " +
+			"function")
+	}
+
+	var pss, saltlen C.int
+	if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+		pss = 1
+		switch pssOpts.SaltLength {
+		case rsa.PSSSaltLengthAuto:
+			saltlen = C.RSA_PSS_SALTLEN_MAX
+		case rsa.PSSSaltLengthEqualsHash:
+			saltlen = C.RSA_PSS_SALTLEN_DIGEST
+		default:
+			saltlen = C.int(pssOpts.SaltLength)
+		}
+	}
+
+	sig := make([]byte, s.key.Size())
+	sigblen := C.size_t(len(sig))
+	if C.X_EVP_PKEY_sign_digest(s.key.evpPKey(), md.ptr, pss, saltlen,
+		(*C.uchar)(unsafe.Pointer(&sig[0])), &sigblen,
+		(*C.uchar)(unsafe.Pointer(&digest[0])),
+		C.size_t(len(digest))) != 1 {
+		return nil, errors.New("failed to sign digest")
+	}
+	return sig[:sigblen], nil
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+
+	rsaKey, err := GenerateRSAKeyWithOptions(RSAKeyOptions{Bits: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, err := GenerateED25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name string
+		key  PrivateKey
+		alg  x509.SignatureAlgorithm
+	}{
+		{"RSA", rsaKey, x509.SHA256WithRSA},
+		{"RSA-PSS", rsaKey, x509.SHA384WithRSAPSS},
+		{"EC", ecKey, x509.ECDSAWithSHA256},
+		{"Ed25519", edKey, x509.PureEd25519},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			signer, err := NewSigner(test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch signer.Public().(type) {
+			case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+			default:
+				t.Fatalf("unexpected public key %T", signer.Public())
+			}
+
+			template := &x509.Certificate{
+				SerialNumber:       big.NewInt(1),
+				Subject:            pkix.Name{CommonName: "signer"},
+				NotBefore:          time.Now(),
+				NotAfter:           time.Now().Add(time.Hour),
+				SignatureAlgorithm: test.alg,
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template,
+				template, signer.Public(), signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = cert.CheckSignature(cert.SignatureAlgorithm,
+				cert.RawTBSCertificate, cert.Signature)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	signer, err := NewSigner(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("the quick brown fox"))
+	sig, err := signer.Sign(nil, digest[:], &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthAuto,
+		Hash:       crypto.SHA256,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rsa.VerifyPSS(signer.Public().(*rsa.PublicKey), crypto.SHA256,
+		digest[:], sig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Sign(nil, digest[:16], crypto.SHA256); err == nil {
+		t.Fatal("short digest signed")
+	}
+}
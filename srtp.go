@@ -0,0 +1,123 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// SRTPProfile is a DTLS-SRTP protection profile of RFC 5764, by its OpenSSL
+// name.
+type SRTPProfile string
+
+const (
+	SRTP_AES128_CM_SHA1_80 SRTPProfile = "SRTP_AES128_CM_SHA1_80"
+	SRTP_AES128_CM_SHA1_32 SRTPProfile = "SRTP_AES128_CM_SHA1_32"
+	SRTP_AEAD_AES_128_GCM  SRTPProfile = "SRTP_AEAD_AES_128_GCM"
+	SRTP_AEAD_AES_256_GCM  SRTPProfile = "SRTP_AEAD_AES_256_GCM"
+)
+
+// srtpKeyLengths are the master key and salt lengths of the profiles, see
+// RFC 5764 and RFC 7714.
+var srtpKeyLengths = map[SRTPProfile][2]int{
+	SRTP_AES128_CM_SHA1_80: {16, 14},
+	SRTP_AES128_CM_SHA1_32: {16, 14},
+	SRTP_AEAD_AES_128_GCM:  {16, 12},
+	SRTP_AEAD_AES_256_GCM:  {32, 12},
+}
+
+// SetSRTPProfiles sets the DTLS-SRTP protection profiles, in the order of
+// preference, negotiated with the use_srtp extension by the DTLS contexts of
+// NewDTLSCtx. Clients offer them, and servers select their most preferred
+// one that the client offers too. An empty list disables the negotiation.
+func (c *Ctx) SetSRTPProfiles(profiles []SRTPProfile) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		names = append(names, string(profile))
+	}
+	cnames := C.CString(strings.Join(names, ":"))
+	defer C.free(unsafe.Pointer(cnames))
+	// unlike most of OpenSSL, zero is the success
+	if C.X_SSL_CTX_set_tlsext_use_srtp(c.ctx, cnames) != 0 {
+		return fmt.Errorf("unsupported SRTP profiles %s: %w",
+			strings.Join(names, ":"), errorFromErrorQueue())
+	}
+	c.srtp = append([]SRTPProfile(nil), profiles...)
+	return nil
+}
+
+// SelectedSRTPProfile returns the DTLS-SRTP protection profile negotiated by
+// the handshake, or false if there is none.
+func (c *Conn) SelectedSRTPProfile() (SRTPProfile, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.is_shutdown {
+		return "", false
+	}
+	name := C.X_SSL_get_selected_srtp_profile(c.ssl)
+	if name == nil {
+		return "", false
+	}
+	return SRTPProfile(C.GoString(name)), true
+}
+
+// SRTPKeyingMaterial holds the SRTP master keys and salts of both sides of a
+// DTLS-SRTP connection, see RFC 5764 section 4.2.
+type SRTPKeyingMaterial struct {
+	Profile    SRTPProfile
+	ClientKey  []byte
+	ClientSalt []byte
+	ServerKey  []byte
+	ServerSalt []byte
+}
+
+// ExportSRTPKeyingMaterial exports the SRTP master keys and salts of the
+// negotiated profile with the EXTRACTOR-dtls_srtp exporter. The client ones
+// protect what the client sends, and the server ones what the server sends.
+// Only valid after a handshake that negotiated a profile.
+func (c *Conn) ExportSRTPKeyingMaterial() (*SRTPKeyingMaterial, error) {
+	profile, ok := c.SelectedSRTPProfile()
+	if !ok {
+		return nil, errors.New("no SRTP profile negotiated")
+	}
+	lengths, ok := srtpKeyLengths[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown key lengths of SRTP profile %s",
+			profile)
+	}
+	keyLen, saltLen := lengths[0], lengths[1]
+	material, err := c.ExportKeyingMaterial("EXTRACTOR-dtls_srtp", nil,
+		2*(keyLen+saltLen))
+	if err != nil {
+		return nil, err
+	}
+	// client key | server key | client salt | server salt
+	return &SRTPKeyingMaterial{
+		Profile:    profile,
+		ClientKey:  material[:keyLen],
+		ServerKey:  material[keyLen : 2*keyLen],
+		ClientSalt: material[2*keyLen : 2*keyLen+saltLen],
+		ServerSalt: material[2*keyLen+saltLen:],
+	}, nil
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSRTPKeyingMaterial(t *testing.T) {
+	newCtx := func(profiles ...SRTPProfile) *Ctx {
+		ctx, err := NewDTLSCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.SetSRTPProfiles(profiles); err != nil {
+			t.Fatal(err)
+		}
+		return ctx
+	}
+	serverCtx := newCtx(SRTP_AEAD_AES_128_GCM, SRTP_AES128_CM_SHA1_80)
+	clientCtx := newCtx(SRTP_AES128_CM_SHA1_80, SRTP_AEAD_AES_128_GCM)
+	clone, err := clientCtx.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := NetPipe(t)
+	server, err := newDefaultServer(t, serverConn, serverCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	doHandshake(t, server, client)
+	if v := client.GetVersion(); v != "DTLSv1.2" {
+		t.Fatalf("unexpected version %s", v)
+	}
+
+	// the server preference wins
+	if profile, ok := client.SelectedSRTPProfile(); !ok ||
+		profile != SRTP_AEAD_AES_128_GCM {
+		t.Fatalf("unexpected profile %q", profile)
+	}
+	serverKeys, err := server.ExportSRTPKeyingMaterial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKeys, err := client.ExportSRTPKeyingMaterial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range [][2][]byte{
+		{serverKeys.ClientKey, clientKeys.ClientKey},
+		{serverKeys.ClientSalt, clientKeys.ClientSalt},
+		{serverKeys.ServerKey, clientKeys.ServerKey},
+		{serverKeys.ServerSalt, clientKeys.ServerSalt},
+	} {
+		if !bytes.Equal(pair[0], pair[1]) {
+			t.Fatal("keying material differs between the sides")
+		}
+	}
+	if len(clientKeys.ClientKey) != 16 || len(clientKeys.ClientSalt) != 12 ||
+		bytes.Equal(clientKeys.ClientKey, clientKeys.ServerKey) {
+		t.Fatalf("unexpected keying material %+v", clientKeys)
+	}
+}
+
+func TestSRTPProfilesErrors(t *testing.T) {
+	ctx, err := NewDTLSCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SetSRTPProfiles([]SRTPProfile{"SRTP_UNKNOWN"}); err == nil {
+		t.Fatal("unknown profile is accepted")
+	}
+
+	// no profile is negotiated without the extension
+	serverConn, clientConn := NetPipe(t)
+	server, err := newDefaultServer(t, serverConn, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewDTLSCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	doHandshake(t, server, client)
+	if _, ok := client.SelectedSRTPProfile(); ok {
+		t.Fatal("unexpected profile")
+	}
+	if _, err := client.ExportSRTPKeyingMaterial(); err == nil {
+		t.Fatal("keying material is exported without a profile")
+	}
+}
@@ -18,11 +18,13 @@ package openssl
 import "C"
 
 import (
+	"context"
+	"errors"
+	"net"
 	"os"
 	"runtime"
+	"strings"
 	"unsafe"
-
-	"github.com/mattn/go-pointer"
 )
 
 type SSLTLSExtErr int
@@ -44,22 +46,83 @@ func get_ssl_idx() C.int {
 }
 
 type SSL struct {
-	ssl       *C.SSL
-	verify_cb VerifyCallback
+	ssl             *C.SSL
+	verify_cb       VerifyCallback
+	insecure_verify DialFlags
+	correlation_id  string
+
+	ocsp_policy OCSPStaplePolicy
+	ocsp_status OCSPStapleStatus
+	ocsp_err    error
+
+	context context.Context
+
+	session_cache ClientSessionCache
+	session_key   string
+
+	// stats are the hooks of the context when the connection was created.
+	stats Stats
+
+	// the host name checked by the chain verification, see
+	// SetVerifyHostname, or whether Dial skips checking it
+	verify_host string
+	skip_host   bool
+}
+
+// SetCorrelationID stamps the connection with a user-supplied identifier,
+// such as a request ID. The identifier is included in log lines, errors and
+// trace output produced by the package for this connection.
+func (s *SSL) SetCorrelationID(id string) {
+	s.correlation_id = id
+}
+
+// CorrelationID returns the identifier set by SetCorrelationID.
+func (s *SSL) CorrelationID() string {
+	return s.correlation_id
+}
+
+// SetContext sets the context passed to callbacks of the connection, e.g. to
+// carry request-scoped values or to let them give up on cancellation.
+func (s *SSL) SetContext(ctx context.Context) {
+	s.context = ctx
+}
+
+// Context returns the context set with SetContext. It is available to the
+// verify, SNI and handshake message callbacks through their SSL or
+// CertificateStoreCtx argument. It defaults to context.Background.
+func (s *SSL) Context() context.Context {
+	if s == nil || s.context == nil {
+		return context.Background()
+	}
+	return s.context
+}
+
+// correlationTag returns a log suffix with the correlation ID, if any.
+func (s *SSL) correlationTag() string {
+	if s == nil || s.correlation_id == "" {
+		return ""
+	}
+	return " [" + s.correlation_id + "]"
 }
 
 //export go_ssl_verify_cb_thunk
 func go_ssl_verify_cb_thunk(p unsafe.Pointer, ok C.int, ctx *C.X509_STORE_CTX) C.int {
+	var s *SSL
 	defer func() {
 		if err := recover(); err != nil {
-			logger.Critf("openssl: verify callback panic'd: %v", err)
+			logger.Critf("openssl: verify callback panic'd%s: %v",
+				s.correlationTag(), err)
 			os.Exit(1)
 		}
 	}()
-	verify_cb := pointer.Restore(p).(*SSL).verify_cb
+	s = pointers.Restore(p).(*SSL)
+	if ok == 0 && s.allowVerifyError(ctx) {
+		ok = 1
+	}
+	verify_cb := s.verify_cb
 	// set up defaults just in case verify_cb is nil
 	if verify_cb != nil {
-		store := &CertificateStoreCtx{ctx: ctx}
+		store := &CertificateStoreCtx{ctx: ctx, ssl: s}
 		if verify_cb(ok == 1, store) {
 			ok = 1
 		} else {
@@ -69,6 +132,34 @@ func go_ssl_verify_cb_thunk(p unsafe.Pointer, ok C.int, ctx *C.X509_STORE_CTX) C
 	return ok
 }
 
+// SetVerifyHostname makes the verification of the peer certificate chain
+// check that the leaf certificate is valid for host, a DNS name or an IP
+// address, so that the handshake fails otherwise. The connections of the
+// contexts of NewClientCtxSecure require it; Dial calls it with the server
+// name for them, unless InsecureSkipHostVerification is set.
+func (s *SSL) SetVerifyHostname(host string) error {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return errors.New("no host name to verify")
+	}
+	chost := C.CString(host)
+	defer C.free(unsafe.Pointer(chost))
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	param := C.SSL_get0_param(s.ssl)
+	var rc C.int
+	if net.ParseIP(host) != nil {
+		rc = C.X509_VERIFY_PARAM_set1_ip_asc(param, chost)
+	} else {
+		rc = C.X_X509_VERIFY_PARAM_set1_host(param, chost, 0)
+	}
+	if rc != 1 {
+		return errorFromErrorQueue()
+	}
+	s.verify_host = host
+	return nil
+}
+
 // Wrapper around SSL_get_servername. Returns server name according to rfc6066
 // http://tools.ietf.org/html/rfc6066.
 func (s *SSL) GetServername() string {
@@ -93,8 +184,27 @@ func (s *SSL) ClearOptions(options Options) Options {
 	return Options(C.X_SSL_clear_options(s.ssl, C.long(options)))
 }
 
+// SetMode sets SSL modes and returns the resulting ones. See
+// https://www.openssl.org/docs/ssl/SSL_CTX_set_mode.html
+func (s *SSL) SetMode(modes Modes) Modes {
+	return Modes(C.X_SSL_set_mode(s.ssl, C.long(modes)))
+}
+
+// ClearMode clears SSL modes and returns the remaining ones. See
+// https://www.openssl.org/docs/ssl/SSL_CTX_set_mode.html
+func (s *SSL) ClearMode(modes Modes) Modes {
+	return Modes(C.X_SSL_clear_mode(s.ssl, C.long(modes)))
+}
+
+// GetMode returns SSL modes. See
+// https://www.openssl.org/docs/ssl/SSL_CTX_set_mode.html
+func (s *SSL) GetMode() Modes {
+	return Modes(C.X_SSL_get_mode(s.ssl))
+}
+
 // EnableTracing enables TLS handshake tracing using openssls
-// SSL_trace function. If useStderr is false, stdout is used.
+// SSL_trace function. If useStderr is false, stdout is used. With OpenSSL
+// 3.0 or newer each trace line is prefixed with the correlation ID, if set.
 // https://www.openssl.org/docs/manmaster/man3/SSL_trace.html
 func (s *SSL) EnableTracing(useStderr bool) {
 	output := C.stdout
@@ -102,12 +212,17 @@ func (s *SSL) EnableTracing(useStderr bool) {
 		output = C.stderr
 	}
 
-	C.X_SSL_toggle_tracing(s.ssl, output, 1)
+	var prefix *C.char
+	if s.correlation_id != "" {
+		prefix = C.CString("[" + s.correlation_id + "] ")
+		defer C.free(unsafe.Pointer(prefix))
+	}
+	C.X_SSL_toggle_tracing(s.ssl, output, 1, prefix)
 }
 
 // DisableTracing unsets the msg callback from EnableTracing.
 func (s *SSL) DisableTracing() {
-	C.X_SSL_toggle_tracing(s.ssl, nil, 0)
+	C.X_SSL_toggle_tracing(s.ssl, nil, 0, nil)
 }
 
 // SetVerify controls peer verification settings. See
@@ -245,19 +360,31 @@ func (s *SSL) DaneClearFlags(flags DaneFlags) DaneFlags {
 
 //export sni_cb_thunk
 func sni_cb_thunk(p unsafe.Pointer, con *C.SSL, ad unsafe.Pointer, arg unsafe.Pointer) C.int {
+	var s *SSL
 	defer func() {
 		if err := recover(); err != nil {
-			logger.Critf("openssl: verify callback sni panic'd: %v", err)
+			logger.Critf("openssl: verify callback sni panic'd%s: %v",
+				s.correlationTag(), err)
 			os.Exit(1)
 		}
 	}()
 
-	sni_cb := pointer.Restore(p).(*Ctx).sni_cb
-
-	s := &SSL{ssl: con}
-	// This attaches a pointer to our SSL struct into the SNI callback.
-	C.SSL_set_ex_data(s.ssl, get_ssl_idx(), pointer.Save(s))
+	sni_cb := pointers.Restore(p).(*Ctx).sni_cb
+	s = sslFromC(con)
 
 	// Note: this is ctx.sni_cb, not C.sni_cb
 	return C.int(sni_cb(s))
 }
+
+// sslFromC returns the SSL struct attached to con. It reuses the SSL struct
+// of the connection, if there is one, so that callbacks see its settings
+// (e.g. the correlation ID).
+func sslFromC(con *C.SSL) *SSL {
+	if sp := C.SSL_get_ex_data(con, get_ssl_idx()); sp != nil {
+		return pointers.Restore(sp).(*SSL)
+	}
+	s := &SSL{ssl: con}
+	// This attaches a pointer to our SSL struct to the connection.
+	C.SSL_set_ex_data(s.ssl, get_ssl_idx(), pointers.Save(s))
+	return s
+}
@@ -0,0 +1,174 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"os"
+	"time"
+	"unsafe"
+)
+
+// Alert is a TLS alert received from the peer.
+type Alert struct {
+	Fatal       bool
+	Description int
+}
+
+// String returns the description of the alert, e.g. "unknown CA".
+func (a Alert) String() string {
+	return C.GoString(C.SSL_alert_desc_string_long(C.int(a.Description)))
+}
+
+// Stats receives the events of the connections of a Ctx, e.g. to export
+// metrics of the TLS layer. The methods are called synchronously from the
+// goroutines using the connections, so they must be fast and safe for
+// concurrent use.
+type Stats interface {
+	// HandshakeStarted is called before the first handshake step.
+	HandshakeStarted(ssl *SSL)
+	// HandshakeCompleted is called once the handshake completes.
+	HandshakeCompleted(ssl *SSL, duration time.Duration)
+	// HandshakeFailed is called if the connection fails before the
+	// handshake completes.
+	HandshakeFailed(ssl *SSL, err error)
+	// SessionResumed is called after HandshakeCompleted if a session was
+	// resumed.
+	SessionResumed(ssl *SSL)
+	// BytesRead and BytesWritten are called with the number of application
+	// data bytes of every Read and Write.
+	BytesRead(ssl *SSL, n int)
+	BytesWritten(ssl *SSL, n int)
+	// AlertReceived is called for every alert received from the peer,
+	// including close_notify.
+	AlertReceived(ssl *SSL, alert Alert)
+}
+
+// NopStats implements Stats with methods that do nothing, to be embedded in
+// implementations interested in a part of the events.
+type NopStats struct{}
+
+func (NopStats) HandshakeStarted(*SSL)                  {}
+func (NopStats) HandshakeCompleted(*SSL, time.Duration) {}
+func (NopStats) HandshakeFailed(*SSL, error)            {}
+func (NopStats) SessionResumed(*SSL)                    {}
+func (NopStats) BytesRead(*SSL, int)                    {}
+func (NopStats) BytesWritten(*SSL, int)                 {}
+func (NopStats) AlertReceived(*SSL, Alert)              {}
+
+// SetStats sets the hooks for the events of the connections created from
+// the context afterwards. A nil stats disables them. It must not be called
+// concurrently with the creation of connections.
+func (c *Ctx) SetStats(stats Stats) {
+	c.stats = stats
+	if stats != nil {
+		C.X_SSL_CTX_enable_info_cb(c.ctx)
+	}
+}
+
+//export go_ssl_alert_cb_thunk
+func go_ssl_alert_cb_thunk(p unsafe.Pointer, con *C.SSL, ret C.int) {
+	var s *SSL
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Critf("openssl: alert callback panic'd%s: %v",
+				s.correlationTag(), err)
+			os.Exit(1)
+		}
+	}()
+
+	// the hooks of the context may be replaced concurrently, the ones the
+	// connection was created with are used
+	s = sslFromC(con)
+	if s.stats == nil {
+		return
+	}
+	s.stats.AlertReceived(s, Alert{
+		Fatal:       ret>>8 == C.SSL3_AL_FATAL,
+		Description: int(ret & 0xff),
+	})
+}
+
+// statsHandshakeStarted reports the start of the handshake once.
+func (c *Conn) statsHandshakeStarted() {
+	if c.stats == nil {
+		return
+	}
+	c.stats_started.Do(func() {
+		c.stats_started_at = time.Now()
+		c.stats.HandshakeStarted(c.SSL)
+	})
+}
+
+// statsHandshakeFinished reports the outcome of the handshake once. It must
+// be called without c.mtx held.
+func (c *Conn) statsHandshakeFinished(err error) {
+	if c.stats == nil {
+		return
+	}
+	c.stats_finished.Do(func() {
+		if err != nil {
+			c.stats.HandshakeFailed(c.SSL, err)
+			return
+		}
+		c.mtx.Lock()
+		handshake_at := c.handshake_at
+		c.mtx.Unlock()
+		c.stats.HandshakeCompleted(c.SSL,
+			handshake_at.Sub(c.stats_started_at))
+		if c.SessionReused() {
+			c.stats.SessionResumed(c.SSL)
+		}
+	})
+}
+
+// handshakeCompleted reports whether the handshake has completed.
+func (c *Conn) handshakeCompleted() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return !c.handshake_at.IsZero()
+}
+
+// statsRead reports a read of n bytes that failed with err.
+func (c *Conn) statsRead(n int, err error) {
+	if c.stats == nil {
+		return
+	}
+	if err != nil {
+		if !c.handshakeCompleted() {
+			c.statsHandshakeFinished(err)
+		}
+		return
+	}
+	c.statsHandshakeFinished(nil)
+	c.stats.BytesRead(c.SSL, n)
+}
+
+// statsWrite reports a write of n bytes that failed with err.
+func (c *Conn) statsWrite(n int, err error) {
+	if c.stats == nil {
+		return
+	}
+	if err != nil {
+		if !c.handshakeCompleted() {
+			c.statsHandshakeFinished(err)
+		}
+		return
+	}
+	c.statsHandshakeFinished(nil)
+	c.stats.BytesWritten(c.SSL, n)
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingStats struct {
+	NopStats
+	mu        sync.Mutex
+	started   int
+	completed int
+	failed    int
+	read      int
+	written   int
+	alerts    []Alert
+}
+
+func (s *recordingStats) HandshakeStarted(*SSL) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started++
+}
+
+func (s *recordingStats) HandshakeCompleted(_ *SSL, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completed++
+}
+
+func (s *recordingStats) HandshakeFailed(*SSL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed++
+}
+
+func (s *recordingStats) BytesRead(_ *SSL, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.read += n
+}
+
+func (s *recordingStats) BytesWritten(_ *SSL, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written += n
+}
+
+func (s *recordingStats) AlertReceived(_ *SSL, alert Alert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, alert)
+}
+
+func newStatsTestCtxs(t *testing.T) (*Ctx, *Ctx) {
+	leaf := newTestCertificate(t, "localhost", false, nil)
+	serverCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UseCertificate(leaf.cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serverCtx, clientCtx
+}
+
+func TestStats(t *testing.T) {
+	serverCtx, clientCtx := newStatsTestCtxs(t)
+	stats := &recordingStats{}
+	serverCtx.SetStats(stats)
+
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, serverCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the connection keeps the hooks it was created with
+	serverCtx.SetStats(&recordingStats{})
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		if _, err := client.Write([]byte("hello")); err != nil {
+			done <- err
+			return
+		}
+		done <- client.Close()
+	}()
+	// the handshake runs within the first Read
+	buf := make([]byte, 16)
+	n, err := server.Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("unexpected read %q: %v", buf[:n], err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Read(buf); err != io.EOF {
+		t.Fatalf("unexpected error %v", err)
+	}
+	server.Close()
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.started != 1 || stats.completed != 1 || stats.failed != 0 {
+		t.Fatalf("unexpected handshakes %+v", stats)
+	}
+	if stats.read != 5 || stats.written != 0 {
+		t.Fatalf("unexpected bytes %+v", stats)
+	}
+	if len(stats.alerts) != 1 || stats.alerts[0].Fatal ||
+		stats.alerts[0].String() != "close notify" {
+		t.Fatalf("unexpected alerts %+v", stats.alerts)
+	}
+}
+
+func TestStatsHandshakeFailed(t *testing.T) {
+	serverCtx, clientCtx := newStatsTestCtxs(t)
+	serverStats := &recordingStats{}
+	serverCtx.SetStats(serverStats)
+	clientStats := &recordingStats{}
+	clientCtx.SetStats(clientStats)
+	// the client does not trust the self-signed certificate
+	clientCtx.SetVerifyMode(VerifyPeer)
+
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, serverCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	done := make(chan error, 1)
+	go func() { done <- server.Handshake() }()
+	if err := client.Handshake(); err == nil {
+		t.Fatal("handshake succeeded")
+	}
+	if err := <-done; err == nil {
+		t.Fatal("server handshake succeeded")
+	}
+
+	for _, stats := range []*recordingStats{clientStats, serverStats} {
+		stats.mu.Lock()
+		if stats.started != 1 || stats.completed != 0 || stats.failed != 1 {
+			t.Fatalf("unexpected handshakes %+v", stats)
+		}
+		stats.mu.Unlock()
+	}
+	serverStats.mu.Lock()
+	defer serverStats.mu.Unlock()
+	if len(serverStats.alerts) != 1 || !serverStats.alerts[0].Fatal {
+		t.Fatalf("unexpected alerts %+v", serverStats.alerts)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// StoreObjects are the objects loaded from OSSL_STORE URIs.
+type StoreObjects struct {
+	PrivateKeys  []PrivateKey
+	PublicKeys   []PublicKey
+	Certificates []*Certificate
+}
+
+// LoadFromURI loads the keys and certificates from the URIs, e.g.
+// "file:/etc/ssl/key.pem" or "pkcs11:token=...;object=...", with the
+// OSSL_STORE API. This gives a uniform path to files, HSMs and engines with
+// a store loader. Encrypted objects are not supported, see
+// LoadFromURIWithPassphrase. Public keys are only loaded with OpenSSL 3.0+.
+func LoadFromURI(uris ...string) (*StoreObjects, error) {
+	return LoadFromURIWithPassphrase(nil, uris...)
+}
+
+// LoadFromURIWithPassphrase is LoadFromURI calling passphrase for the
+// passphrase or the PIN of encrypted or protected objects.
+func LoadFromURIWithPassphrase(passphrase PassphraseFunc,
+	uris ...string) (*StoreObjects, error) {
+	// OSSL_STORE is available since OpenSSL 1.1.1 as is Ed25519
+	if !ed25519_support {
+		return nil, errors.New("OSSL_STORE is not supported")
+	}
+	if passphrase == nil {
+		passphrase = func() ([]byte, error) {
+			return nil, errors.New("no passphrase callback")
+		}
+	}
+	objects := &StoreObjects{}
+	for _, uri := range uris {
+		if err := objects.load(uri, passphrase); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+func (objects *StoreObjects) load(uri string,
+	passphrase PassphraseFunc) error {
+	curi := C.CString(uri)
+	defer C.free(unsafe.Pointer(curi))
+	state := &passphraseState{fn: passphrase}
+	p := pointers.Save(state)
+	defer pointers.Unref(p)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	storeErr := func(err error) error {
+		if state.err != nil {
+			err = state.err
+		}
+		return fmt.Errorf("failed loading %q: %w", uri, err)
+	}
+	store := C.X_OSSL_STORE_open(curi, p)
+	if store == nil {
+		return storeErr(errorFromErrorQueue())
+	}
+	defer C.X_OSSL_STORE_close(store)
+	for {
+		var key *C.EVP_PKEY
+		var cert *C.X509
+		switch C.X_OSSL_STORE_load(store, &key, &cert) {
+		case 0:
+			return nil
+		case -1:
+			return storeErr(errorFromErrorQueue())
+		case C.X_STORE_PRIVATE_KEY:
+			objects.PrivateKeys = append(objects.PrivateKeys,
+				newStoreKey(key))
+		case C.X_STORE_PUBLIC_KEY:
+			objects.PublicKeys = append(objects.PublicKeys,
+				newStoreKey(key))
+		case C.X_STORE_CERTIFICATE:
+			x := &Certificate{x: cert}
+			setCertificateFinalizer(x)
+			objects.Certificates = append(objects.Certificates, x)
+		}
+	}
+}
+
+func newStoreKey(key *C.EVP_PKEY) *pKey {
+	pk := &pKey{key: key}
+	setPKeyFinalizer(pk)
+	return pk
+}
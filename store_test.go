@@ -0,0 +1,86 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFromURI(t *testing.T) {
+	if !ed25519_support {
+		t.SkipNow()
+	}
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	chain := filepath.Join(dir, "chain.pem")
+	if err := ioutil.WriteFile(chain, append(append([]byte{}, certBytes...),
+		keyBytes...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := GenerateECKey(Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := key.MarshalPKCS8PrivateKeyPEM("secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedPath := filepath.Join(dir, "encrypted.pem")
+	if err := ioutil.WriteFile(encryptedPath, encrypted, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := LoadFromURI("file:" + chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects.Certificates) != 1 || len(objects.PrivateKeys) != 1 {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+	cert, err := LoadCertificateFromPEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := cert.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !objects.PrivateKeys[0].Equal(pub) {
+		t.Fatal("loaded key does not match the certificate")
+	}
+
+	if _, err := LoadFromURI(encryptedPath); err == nil {
+		t.Fatal("loaded an encrypted key without a passphrase")
+	}
+	objects, err = LoadFromURIWithPassphrase(func() ([]byte, error) {
+		return []byte("secret"), nil
+	}, "file:"+chain, encryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects.PrivateKeys) != 2 || !objects.PrivateKeys[1].Equal(key) {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+
+	if _, err := LoadFromURI(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Fatal("loaded a missing file")
+	}
+}
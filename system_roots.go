@@ -0,0 +1,88 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"os"
+)
+
+// systemRootFiles are the usual locations of the certificate authority
+// bundles, as known to crypto/x509.
+var systemRootFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian/Ubuntu/Gentoo etc.
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora/RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/tls/cacert.pem",                           // OpenELEC
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS/RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine Linux, BSDs, macOS
+	"/usr/local/etc/ssl/cert.pem",                       // FreeBSD
+	"/usr/local/share/certs/ca-root-nss.crt",            // FreeBSD
+}
+
+// systemRootDirs are the usual locations of the hashed certificate authority
+// directories.
+var systemRootDirs = []string{
+	"/etc/ssl/certs",
+	"/etc/pki/tls/certs",
+	"/system/etc/security/cacerts", // Android
+}
+
+// LoadSystemCAs tells the context to trust the certificate authorities of
+// the system, so that clients verify public endpoints without shipping a
+// bundle. The SSL_CERT_FILE and SSL_CERT_DIR environment variables override
+// the locations, SSL_CERT_DIR may list several directories separated by
+// colons. Otherwise, the default locations OpenSSL was built with are used,
+// see SetDefaultVerifyPaths, unless they don't exist, as with an OpenSSL
+// built for another filesystem layout; then the usual locations of the
+// system are tried. Only bundles and directories of PEM files are
+// supported, not the platform stores of Windows and macOS.
+func (c *Ctx) LoadSystemCAs() error {
+	file := os.Getenv(C.GoString(C.X509_get_default_cert_file_env()))
+	dir := os.Getenv(C.GoString(C.X509_get_default_cert_dir_env()))
+	if file != "" || dir != "" {
+		return c.LoadVerifyLocations(file, dir)
+	}
+
+	if fileExists(C.GoString(C.X509_get_default_cert_file())) ||
+		fileExists(C.GoString(C.X509_get_default_cert_dir())) {
+		return c.SetDefaultVerifyPaths()
+	}
+
+	for _, f := range systemRootFiles {
+		if fileExists(f) {
+			file = f
+			break
+		}
+	}
+	for _, d := range systemRootDirs {
+		if fileExists(d) {
+			dir = d
+			break
+		}
+	}
+	if file == "" && dir == "" {
+		return errors.New("no system certificate authorities found")
+	}
+	return c.LoadVerifyLocations(file, dir)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
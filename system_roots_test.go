@@ -0,0 +1,72 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCtxLoadSystemCAs(t *testing.T) {
+	ca := newTestCertificate(t, "ca", true, nil)
+	leaf := newTestCertificate(t, "localhost", false, ca)
+	dir, err := ioutil.TempDir("", "openssl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bundle := writeTestPEM(t, dir, "ca.pem", marshalTestPEM(t, ca.cert.MarshalPEM))
+
+	for _, env := range []string{"SSL_CERT_FILE", "SSL_CERT_DIR"} {
+		defer os.Setenv(env, os.Getenv(env))
+	}
+	os.Setenv("SSL_CERT_FILE", bundle)
+	os.Setenv("SSL_CERT_DIR", "")
+
+	serverCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UseCertificate(leaf.cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clientCtx.LoadSystemCAs(); err != nil {
+		t.Fatal(err)
+	}
+	clientCtx.SetVerifyMode(VerifyPeer)
+
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, serverCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	doHandshake(t, server, client)
+	if result := client.VerifyResult(); result != Ok {
+		t.Fatalf("unexpected verify result %v", result)
+	}
+}
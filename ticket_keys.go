@@ -0,0 +1,248 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The sizes of the parts of the keys, for AES-256-CBC and HMAC-SHA256. Keys
+// generated by New have no IV, so that every ticket gets a random one, but
+// keys with a fixed IV encoded by earlier versions are still accepted.
+const (
+	ticketCipherKeySize = 32
+	ticketHMACKeySize   = 32
+	ticketIVSize        = 16
+)
+
+type rotatingTicketKey struct {
+	key     *TicketKey
+	created time.Time
+}
+
+// RotatingTicketKeys is a TicketKeyManager that generates random keys and
+// replaces the current key every rotation period. Tickets issued with a
+// previous key are still accepted, and renewed, for one more period.
+type RotatingTicketKeys struct {
+	period time.Duration
+	mu     sync.Mutex
+	keys   []rotatingTicketKey // newest first
+}
+
+// NewRotatingTicketKeys creates a TicketKeyManager that rotates keys every
+// period.
+func NewRotatingTicketKeys(period time.Duration) *RotatingTicketKeys {
+	return &RotatingTicketKeys{period: period}
+}
+
+// NewRotatingTicketStore creates a TicketStore that encrypts tickets with
+// AES-256-CBC, authenticates them with HMAC-SHA256 and rotates keys every
+// period.
+func NewRotatingTicketStore(period time.Duration) (*TicketStore, error) {
+	cipher, err := GetCipherByName("aes-256-cbc")
+	if err != nil {
+		return nil, err
+	}
+	digest, err := GetDigestByName("sha256")
+	if err != nil {
+		return nil, err
+	}
+	return &TicketStore{
+		CipherCtx: TicketCipherCtx{Cipher: cipher},
+		DigestCtx: TicketDigestCtx{Digest: digest},
+		Keys:      NewRotatingTicketKeys(period),
+	}, nil
+}
+
+// New generates a new current key and drops keys that have expired.
+func (r *RotatingTicketKeys) New() *TicketKey {
+	key := &TicketKey{
+		CipherKey: make([]byte, ticketCipherKeySize),
+		HMACKey:   make([]byte, ticketHMACKeySize),
+	}
+	for _, b := range [][]byte{key.Name[:], key.CipherKey, key.HMACKey} {
+		if _, err := rand.Read(b); err != nil {
+			return nil
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	keys := []rotatingTicketKey{{key: key, created: now}}
+	for _, k := range r.keys {
+		if now.Sub(k.created) < 2*r.period {
+			keys = append(keys, k)
+		}
+	}
+	r.keys = keys
+	return key
+}
+
+// Current returns the current key, or nil if it is due for rotation.
+func (r *RotatingTicketKeys) Current() *TicketKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.keys) == 0 || time.Since(r.keys[0].created) >= r.period {
+		return nil
+	}
+	return r.keys[0].key
+}
+
+func (r *RotatingTicketKeys) lookup(name TicketName) *rotatingTicketKey {
+	for i := range r.keys {
+		if r.keys[i].key.Name == name {
+			return &r.keys[i]
+		}
+	}
+	return nil
+}
+
+// Lookup returns the key with the given name, or nil if it is unknown.
+func (r *RotatingTicketKeys) Lookup(name TicketName) *TicketKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if k := r.lookup(name); k != nil {
+		return k.key
+	}
+	return nil
+}
+
+// Expired returns true if the key is unknown or older than two rotation
+// periods.
+func (r *RotatingTicketKeys) Expired(name TicketName) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := r.lookup(name)
+	return k == nil || time.Since(k.created) >= 2*r.period
+}
+
+// ShouldRenew returns true if the key is no longer the current one.
+func (r *RotatingTicketKeys) ShouldRenew(name TicketName) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.keys) == 0 || r.keys[0].key.Name != name ||
+		time.Since(r.keys[0].created) >= r.period
+}
+
+// ticketKeysVersion is the version of the format of MarshalBinary.
+const ticketKeysVersion = 1
+
+var errTruncatedTicketKeys = errors.New("truncated ticket keys")
+
+// MarshalBinary encodes the keys, the current one and the previous ones that
+// are still accepted, with their creation times, into an opaque blob. The
+// blob holds the key material, so it must be stored and transferred as
+// securely as the keys themselves.
+func (r *RotatingTicketKeys) MarshalBinary() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var buf bytes.Buffer
+	buf.WriteByte(ticketKeysVersion)
+	binary.Write(&buf, binary.BigEndian, uint16(len(r.keys)))
+	for _, k := range r.keys {
+		binary.Write(&buf, binary.BigEndian, k.created.UnixNano())
+		buf.Write(k.key.Name[:])
+		for _, b := range [][]byte{k.key.CipherKey, k.key.HMACKey,
+			k.key.IV} {
+			if len(b) > 255 {
+				return nil, fmt.Errorf("ticket key part of %d bytes is "+
+					"too long", len(b))
+			}
+			buf.WriteByte(byte(len(b)))
+			buf.Write(b)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the keys with the ones encoded by MarshalBinary,
+// e.g. to share them across servers or restarts. The newest key becomes the
+// current one until it is due for rotation, after which the ticket key
+// callback calls New, so a distributed key set should be refreshed more often
+// than the rotation period to keep servers in sync.
+func (r *RotatingTicketKeys) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewReader(data)
+	version, err := buf.ReadByte()
+	if err != nil {
+		return errTruncatedTicketKeys
+	}
+	if version != ticketKeysVersion {
+		return fmt.Errorf("unsupported ticket keys version %d", version)
+	}
+	var count uint16
+	if err := binary.Read(buf, binary.BigEndian, &count); err != nil {
+		return errTruncatedTicketKeys
+	}
+	keys := make([]rotatingTicketKey, 0, count)
+	for i := 0; i < int(count); i++ {
+		var created int64
+		if err := binary.Read(buf, binary.BigEndian, &created); err != nil {
+			return errTruncatedTicketKeys
+		}
+		key := &TicketKey{}
+		if _, err := io.ReadFull(buf, key.Name[:]); err != nil {
+			return errTruncatedTicketKeys
+		}
+		for _, part := range []struct {
+			b        *[]byte
+			size     int
+			optional bool
+		}{
+			{&key.CipherKey, ticketCipherKeySize, false},
+			{&key.HMACKey, ticketHMACKeySize, false},
+			{&key.IV, ticketIVSize, true},
+		} {
+			n, err := buf.ReadByte()
+			if err != nil {
+				return errTruncatedTicketKeys
+			}
+			if n == 0 && part.optional {
+				continue
+			}
+			if int(n) != part.size {
+				return fmt.Errorf("ticket key part of %d bytes, expected %d",
+					n, part.size)
+			}
+			b := part.b
+			*b = make([]byte, n)
+			if _, err := io.ReadFull(buf, *b); err != nil {
+				return errTruncatedTicketKeys
+			}
+		}
+		keys = append(keys, rotatingTicketKey{
+			key:     key,
+			created: time.Unix(0, created)})
+	}
+	if buf.Len() != 0 {
+		return errors.New("trailing data after ticket keys")
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].created.After(keys[j].created)
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = keys
+	return nil
+}
@@ -20,8 +20,6 @@ import "C"
 import (
 	"os"
 	"unsafe"
-
-	"github.com/mattn/go-pointer"
 )
 
 const (
@@ -47,6 +45,9 @@ type TicketName [KeyNameSize]byte
 
 // TicketKey is the key material for a ticket. If this is lost, forward secrecy
 // is lost as it allows decrypting TLS sessions retroactively.
+//
+// If IV is empty, a random IV is generated for every ticket and carried in
+// it. Otherwise IV is used for all the tickets encrypted with the key.
 type TicketKey struct {
 	Name      TicketName
 	CipherKey []byte
@@ -129,7 +130,7 @@ func go_ticket_key_cb_thunk(p unsafe.Pointer, s *C.SSL, key_name *C.uchar,
 		}
 	}()
 
-	ctx := pointer.Restore(p).(*Ctx)
+	ctx := pointers.Restore(p).(*Ctx)
 	store := ctx.ticket_store
 	if store == nil {
 		// TODO(jeff): should this be an error condition? it doesn't make sense
@@ -156,12 +157,19 @@ func go_ticket_key_cb_thunk(p unsafe.Pointer, s *C.SSL, key_name *C.uchar,
 			unsafe.Pointer(key_name),
 			unsafe.Pointer(&key.Name[0]),
 			KeyNameSize)
+		ticket_iv := iv
+		if len(key.IV) != 0 {
+			ticket_iv = (*C.uchar)(&key.IV[0])
+		} else if C.X_RAND_bytes(iv, C.X_EVP_CIPHER_iv_length(
+			store.CipherCtx.Cipher.ptr)) != 1 {
+			return ticket_resp_error
+		}
 		C.EVP_EncryptInit_ex(
 			cctx,
 			store.CipherCtx.Cipher.ptr,
 			store.cipherEngine(),
 			(*C.uchar)(&key.CipherKey[0]),
-			(*C.uchar)(&key.IV[0]))
+			ticket_iv)
 		C.HMAC_Init_ex(
 			hctx,
 			unsafe.Pointer(&key.HMACKey[0]),
@@ -186,12 +194,16 @@ func go_ticket_key_cb_thunk(p unsafe.Pointer, s *C.SSL, key_name *C.uchar,
 			return ticket_resp_requireHandshake
 		}
 
+		ticket_iv := iv
+		if len(key.IV) != 0 {
+			ticket_iv = (*C.uchar)(&key.IV[0])
+		}
 		C.EVP_DecryptInit_ex(
 			cctx,
 			store.CipherCtx.Cipher.ptr,
 			store.cipherEngine(),
 			(*C.uchar)(&key.CipherKey[0]),
-			(*C.uchar)(&key.IV[0]))
+			ticket_iv)
 		C.HMAC_Init_ex(
 			hctx,
 			unsafe.Pointer(&key.HMACKey[0]),
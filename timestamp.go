@@ -0,0 +1,123 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// TimestampInfo is the TSTInfo of an RFC 3161 time-stamp token: what the
+// time-stamping authority asserts to have seen at the time.
+type TimestampInfo struct {
+	Time          time.Time
+	SerialNumber  *big.Int
+	Policy        string
+	HashAlgorithm NID
+	HashedMessage []byte
+	// Nonce is nil if the request had none.
+	Nonce *big.Int
+	// TSA is the name of the authority if it included it.
+	TSA *GeneralName
+}
+
+// VerifyTimestampResponse verifies the DER-encoded TimeStampResp against the
+// DER-encoded TimeStampReq that it answers: the status has to be granted, the
+// token has to be signed by a time-stamping certificate that chains to the
+// store, and the message imprint, the nonce and the policy, if any, have to
+// match the request. The TSA certificate has to be in the token, which the request
+// asks for with certReq. It requires OpenSSL 1.1.0 or newer.
+func VerifyTimestampResponse(resp, req []byte,
+	store *CertificateStore) (*TimestampInfo, error) {
+	if len(resp) == 0 || len(req) == 0 {
+		return nil, errors.New("empty time-stamp response or request")
+	}
+	return verifyTimestamp(resp, req, nil, store)
+}
+
+// VerifyTimestampToken verifies a DER-encoded TimeStampToken, as kept from a
+// TimeStampResp, against the hash of the time-stamped data: the token has to
+// be signed by a time-stamping certificate that chains to the store and its
+// message imprint has to be hashedMessage. The caller should check the
+// HashAlgorithm of the result. It requires OpenSSL 1.1.0 or newer.
+func VerifyTimestampToken(token, hashedMessage []byte,
+	store *CertificateStore) (*TimestampInfo, error) {
+	if len(token) == 0 || len(hashedMessage) == 0 {
+		return nil, errors.New("empty time-stamp token or message imprint")
+	}
+	return verifyTimestamp(token, nil, hashedMessage, store)
+}
+
+func verifyTimestamp(der, req, imprint []byte,
+	store *CertificateStore) (*TimestampInfo, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var info *C.TS_TST_INFO
+	if C.X_TS_verify(bytesPtr(der), C.long(len(der)), bytesPtr(req),
+		C.long(len(req)), bytesPtr(imprint), C.size_t(len(imprint)),
+		store.store, &info) != 1 {
+		return nil, fmt.Errorf("time-stamp verification failed: %w",
+			errorFromErrorQueue())
+	}
+	runtime.KeepAlive(store)
+	defer C.TS_TST_INFO_free(info)
+	return newTimestampInfo(info)
+}
+
+func newTimestampInfo(info *C.TS_TST_INFO) (*TimestampInfo, error) {
+	t, err := asn1TimeToTime(
+		(*C.ASN1_TIME)(unsafe.Pointer(C.TS_TST_INFO_get_time(info))))
+	if err != nil {
+		return nil, err
+	}
+	serial, err := asn1IntegerToBig(C.TS_TST_INFO_get_serial(info))
+	if err != nil {
+		return nil, err
+	}
+	imprint := C.TS_TST_INFO_get_msg_imprint(info)
+	var algo *C.ASN1_OBJECT
+	C.X509_ALGOR_get0(&algo, nil, nil, C.TS_MSG_IMPRINT_get_algo(imprint))
+	msg := C.TS_MSG_IMPRINT_get_msg(imprint)
+	ts := &TimestampInfo{
+		Time:          t,
+		SerialNumber:  serial,
+		Policy:        asn1ObjectToText(C.TS_TST_INFO_get_policy_id(info)),
+		HashAlgorithm: NID(C.OBJ_obj2nid(algo)),
+		HashedMessage: C.GoBytes(
+			unsafe.Pointer(C.X_ASN1_STRING_get0_data(msg)),
+			C.ASN1_STRING_length(msg)),
+	}
+	if nonce := C.TS_TST_INFO_get_nonce(info); nonce != nil {
+		if ts.Nonce, err = asn1IntegerToBig(nonce); err != nil {
+			return nil, err
+		}
+	}
+	if tsa := C.TS_TST_INFO_get_tsa(info); tsa != nil {
+		name, err := generalNameToGo(tsa)
+		if err != nil {
+			return nil, err
+		}
+		ts.TSA = &name
+	}
+	return ts, nil
+}
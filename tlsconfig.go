@@ -0,0 +1,318 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// tlsCipherSuiteNames maps the TLS 1.0-1.2 cipher suites of crypto/tls to
+// their OpenSSL names.
+var tlsCipherSuiteNames = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                      "RC4-SHA",
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:                 "DES-CBC3-SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:                  "AES128-SHA",
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:                  "AES256-SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:               "AES128-SHA256",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:               "AES128-GCM-SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:               "AES256-GCM-SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:              "ECDHE-ECDSA-RC4-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:          "ECDHE-ECDSA-AES128-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:          "ECDHE-ECDSA-AES256-SHA",
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:                "ECDHE-RSA-RC4-SHA",
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:           "ECDHE-RSA-DES-CBC3-SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:            "ECDHE-RSA-AES128-SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:            "ECDHE-RSA-AES256-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256:       "ECDHE-ECDSA-AES128-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:         "ECDHE-RSA-AES128-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:         "ECDHE-RSA-AES128-GCM-SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:       "ECDHE-ECDSA-AES128-GCM-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:         "ECDHE-RSA-AES256-GCM-SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384:       "ECDHE-ECDSA-AES256-GCM-SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256:   "ECDHE-RSA-CHACHA20-POLY1305",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256: "ECDHE-ECDSA-CHACHA20-POLY1305",
+}
+
+// NewCtxFromTLSConfig creates a context that behaves like config: it
+// translates the certificates, RootCAs and ClientCAs, the protocol versions,
+// the cipher suites, NextProtos, ServerName, ClientAuth, InsecureSkipVerify,
+// SessionTicketsDisabled, PreferServerCipherSuites and VerifyPeerCertificate.
+//
+// The peer certificates are verified with crypto/x509 against the
+// certificate pools of config, since they can't be exported. A client
+// verifies the name of the server against ServerName or, if it is empty, the
+// SNI of the connection, and fails without either unless InsecureSkipVerify
+// is set. The TLS 1.3 suites in CipherSuites are ignored, like crypto/tls
+// does. The callbacks that select certificates or configs
+// per connection can't be translated, an error is returned if they are set.
+func NewCtxFromTLSConfig(config *tls.Config) (*Ctx, error) {
+	if config == nil {
+		return NewCtx()
+	}
+	if config.GetCertificate != nil || config.GetClientCertificate != nil ||
+		config.GetConfigForClient != nil || config.VerifyConnection != nil {
+		return nil, errors.New("per-connection callbacks of tls.Config " +
+			"are not supported")
+	}
+	ctx, err := NewCtx()
+	if err != nil {
+		return nil, err
+	}
+	for i, cert := range config.Certificates {
+		chain, key, err := fromTLSCertificate(cert)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %d: %w", i, err)
+		}
+		if err := ctx.AddKeyPair(chain, key); err != nil {
+			return nil, fmt.Errorf("certificate %d: %w", i, err)
+		}
+	}
+	if config.MinVersion != 0 &&
+		!ctx.SetMinProtoVersion(Version(config.MinVersion)) {
+		return nil, fmt.Errorf("unsupported min version %#x",
+			config.MinVersion)
+	}
+	if config.MaxVersion != 0 &&
+		!ctx.SetMaxProtoVersion(Version(config.MaxVersion)) {
+		return nil, fmt.Errorf("unsupported max version %#x",
+			config.MaxVersion)
+	}
+	if len(config.CipherSuites) > 0 {
+		names := make([]string, 0, len(config.CipherSuites))
+		for _, id := range config.CipherSuites {
+			// the TLS 1.3 suites aren't configurable, like in crypto/tls
+			if isTLS13CipherSuite(id) {
+				continue
+			}
+			name, ok := tlsCipherSuiteNames[id]
+			if !ok {
+				return nil, fmt.Errorf("unsupported cipher suite %#04x", id)
+			}
+			names = append(names, name)
+		}
+		if len(names) > 0 {
+			err := ctx.SetCipherList(strings.Join(names, ":"))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := ctx.SetNextProtos(config.NextProtos); err != nil {
+		return nil, err
+	}
+	if config.SessionTicketsDisabled {
+		ctx.SetOptions(NoTicket)
+	}
+	if config.PreferServerCipherSuites {
+		ctx.SetOptions(CipherServerPreference)
+	}
+	ctx.server_name = config.ServerName
+
+	client_mode := VerifyPeer
+	if config.InsecureSkipVerify {
+		client_mode = VerifyNone
+	}
+	var server_mode VerifyOptions
+	switch config.ClientAuth {
+	case tls.NoClientCert:
+		server_mode = VerifyNone
+	case tls.RequestClientCert, tls.VerifyClientCertIfGiven:
+		server_mode = VerifyPeer
+	case tls.RequireAnyClientCert, tls.RequireAndVerifyClientCert:
+		server_mode = VerifyPeer | VerifyFailIfNoPeerCert
+	default:
+		return nil, fmt.Errorf("unsupported client auth %d",
+			config.ClientAuth)
+	}
+	ctx.server_verify_mode = &server_mode
+	ctx.SetVerify(client_mode, (&tlsConfigVerifier{config}).verify)
+	return ctx, nil
+}
+
+func isTLS13CipherSuite(id uint16) bool {
+	switch id {
+	case tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384,
+		tls.TLS_CHACHA20_POLY1305_SHA256:
+		return true
+	}
+	return false
+}
+
+// fromTLSCertificate converts the chain and the key of cert.
+func fromTLSCertificate(cert tls.Certificate) ([]*Certificate, PrivateKey,
+	error) {
+	if len(cert.Certificate) == 0 {
+		return nil, nil, errors.New("empty certificate chain")
+	}
+	chain := make([]*Certificate, 0, len(cert.Certificate))
+	for _, der := range cert.Certificate {
+		c, err := LoadCertificateFromPEM(pem.EncodeToMemory(
+			&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, c)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := LoadPrivateKeyFromDER(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chain, key, nil
+}
+
+// tlsConfigVerifier verifies the peer certificates like crypto/tls does
+// with config.
+type tlsConfigVerifier struct {
+	config *tls.Config
+}
+
+func (v *tlsConfigVerifier) verify(ok bool, store *CertificateStoreCtx) bool {
+	// the connection is needed to know the side and the name to verify
+	if store.ssl == nil {
+		return false
+	}
+	// the callback reaches the leaf last, the whole chain is checked then
+	if store.Depth() != 0 {
+		return true
+	}
+	config := v.config
+	is_server := C.SSL_is_server(store.ssl.ssl) == 1
+	if !is_server && config.InsecureSkipVerify {
+		return true
+	}
+	certs, err := store.peerCertificates()
+	if err != nil {
+		return false
+	}
+	opts := x509.VerifyOptions{
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   timeOf(config),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	var chains [][]*x509.Certificate
+	switch {
+	case is_server && (config.ClientAuth == tls.RequestClientCert ||
+		config.ClientAuth == tls.RequireAnyClientCert):
+	case is_server:
+		opts.Roots = config.ClientCAs
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		chains, err = certs[0].Verify(opts)
+	default:
+		opts.Roots = config.RootCAs
+		opts.DNSName = config.ServerName
+		if opts.DNSName == "" {
+			opts.DNSName = store.ssl.GetServername()
+		}
+		if opts.DNSName == "" {
+			logger.Debugf("openssl: peer verification failed%s: no server "+
+				"name, ServerName or InsecureSkipVerify must be set",
+				store.ssl.correlationTag())
+			return false
+		}
+		chains, err = certs[0].Verify(opts)
+	}
+	if err != nil {
+		logger.Debugf("openssl: peer verification failed%s: %v",
+			store.ssl.correlationTag(), err)
+		return false
+	}
+	if config.VerifyPeerCertificate != nil {
+		raw := make([][]byte, 0, len(certs))
+		for _, cert := range certs {
+			raw = append(raw, cert.Raw)
+		}
+		if err := config.VerifyPeerCertificate(raw, chains); err != nil {
+			logger.Debugf("openssl: peer verification failed%s: %v",
+				store.ssl.correlationTag(), err)
+			return false
+		}
+	}
+	if chains != nil {
+		// the chain OpenSSL rejected is trusted, the connection reports so
+		store.SetError(Ok)
+	}
+	return true
+}
+
+func timeOf(config *tls.Config) (t time.Time) {
+	if config.Time != nil {
+		t = config.Time()
+	}
+	return t
+}
+
+// peerCertificates returns the leaf and the other certificates sent by the
+// peer.
+func (csc *CertificateStoreCtx) peerCertificates() ([]*x509.Certificate,
+	error) {
+	// the callback is at depth 0, so the current certificate is the leaf
+	leaf := C.X509_STORE_CTX_get_current_cert(csc.ctx)
+	if leaf == nil {
+		return nil, errors.New("no peer certificate")
+	}
+	certs := []*C.X509{leaf}
+	if sk := C.X_X509_STORE_CTX_get0_untrusted(csc.ctx); sk != nil {
+		for i := 0; i < int(C.X_sk_X509_num(sk)); i++ {
+			if x := C.X_sk_X509_value(sk, C.int(i)); x != leaf {
+				certs = append(certs, x)
+			}
+		}
+	}
+	rv := make([]*x509.Certificate, 0, len(certs))
+	for _, x := range certs {
+		der, err := marshalX509DER(x)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, cert)
+	}
+	return rv, nil
+}
+
+// marshalX509DER returns the DER encoding of x.
+func marshalX509DER(x *C.X509) ([]byte, error) {
+	size := C.i2d_X509(x, nil)
+	if size <= 0 {
+		return nil, errors.New("failed to encode certificate")
+	}
+	buf := (*C.uchar)(C.malloc(C.size_t(size)))
+	defer C.free(unsafe.Pointer(buf))
+	// i2d advances the pointer it is given
+	tmp := buf
+	if C.i2d_X509(x, &tmp) != size {
+		return nil, errors.New("failed to encode certificate")
+	}
+	return C.GoBytes(unsafe.Pointer(buf), size), nil
+}
@@ -0,0 +1,209 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+)
+
+func newTestTLSCertificate(t *testing.T, key PrivateKey,
+	chain ...*Certificate) tls.Certificate {
+	var certs []byte
+	for _, cert := range chain {
+		pem, err := cert.MarshalPEM()
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, pem...)
+	}
+	keyPEM, err := key.MarshalPKCS8PrivateKeyPEM("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certs, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// handshakeTLSConfigs connects the contexts of the configs and returns the
+// handshake errors of the server and the client.
+func handshakeTLSConfigs(t *testing.T, serverConfig,
+	clientConfig *tls.Config) (*Conn, *Conn, error, error) {
+	serverCtx, err := NewCtxFromTLSConfig(serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtxFromTLSConfig(clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := NetPipe(t)
+	server, err := Server(serverConn, serverCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		err := server.Handshake()
+		if err != nil {
+			serverConn.Close()
+		}
+		serverErr <- err
+	}()
+	clientErr := client.Handshake()
+	if clientErr != nil {
+		clientConn.Close()
+	}
+	return server, client, <-serverErr, clientErr
+}
+
+func TestNewCtxFromTLSConfig(t *testing.T) {
+	ca := newTestCertificate(t, "Test CA", true, nil)
+	intermediate := newTestCertificate(t, "Test Intermediate", true, ca)
+	leaf := newTestCertificate(t, "localhost", false, intermediate)
+	clientLeaf := newTestCertificate(t, "client", false, ca)
+
+	caPEM, err := ca.cert.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		t.Fatal("failed to add the CA")
+	}
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{newTestTLSCertificate(t, leaf.key,
+			leaf.cert, intermediate.cert)},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	clientConfig := &tls.Config{
+		Certificates: []tls.Certificate{newTestTLSCertificate(t,
+			clientLeaf.key, clientLeaf.cert)},
+		RootCAs:    pool,
+		ServerName: "localhost",
+		NextProtos: []string{"http/1.1"},
+	}
+
+	server, client, serverErr, clientErr := handshakeTLSConfigs(t,
+		serverConfig, clientConfig)
+	if serverErr != nil || clientErr != nil {
+		t.Fatalf("handshake failed: %v, %v", serverErr, clientErr)
+	}
+	go server.Write([]byte("x"))
+	if _, err := client.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if proto := client.NegotiatedParameters().ALPN; proto != "http/1.1" {
+		t.Fatalf("unexpected protocol %q", proto)
+	}
+	peer, err := server.PeerCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerPEM, err := peer.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPEM, err := clientLeaf.cert.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(peerPEM, clientPEM) {
+		t.Fatal("unexpected client certificate")
+	}
+	// OpenSSL doesn't know the CA, the chains are accepted by crypto/x509
+	if result := client.VerifyResult(); result != Ok {
+		t.Fatalf("client verify result %d: %s", result,
+			VerifyCertErrorString(result))
+	}
+	if result := server.VerifyResult(); result != Ok {
+		t.Fatalf("server verify result %d: %s", result,
+			VerifyCertErrorString(result))
+	}
+	close_both(server, client)
+
+	// the name of the server doesn't match
+	wrongName := clientConfig.Clone()
+	wrongName.ServerName = "example.com"
+	_, _, _, clientErr = handshakeTLSConfigs(t, serverConfig, wrongName)
+	if clientErr == nil {
+		t.Fatal("server with a wrong name is accepted")
+	}
+
+	// the client has no name to verify the server against
+	noName := clientConfig.Clone()
+	noName.ServerName = ""
+	_, _, _, clientErr = handshakeTLSConfigs(t, serverConfig, noName)
+	if clientErr == nil {
+		t.Fatal("server is accepted without a name to verify")
+	}
+
+	// the server requires a client certificate
+	noCert := clientConfig.Clone()
+	noCert.Certificates = nil
+	_, _, serverErr, _ = handshakeTLSConfigs(t, serverConfig, noCert)
+	if serverErr == nil {
+		t.Fatal("client without a certificate is accepted")
+	}
+
+	// the client skips the verification
+	insecure := wrongName.Clone()
+	insecure.InsecureSkipVerify = true
+	server, client, serverErr, clientErr = handshakeTLSConfigs(t,
+		serverConfig, insecure)
+	if serverErr != nil || clientErr != nil {
+		t.Fatalf("handshake failed: %v, %v", serverErr, clientErr)
+	}
+	close_both(server, client)
+}
+
+func TestNewCtxFromTLSConfigTLS13CipherSuites(t *testing.T) {
+	for _, suites := range [][]uint16{
+		{tls.TLS_AES_128_GCM_SHA256},
+		{tls.TLS_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	} {
+		if _, err := NewCtxFromTLSConfig(&tls.Config{
+			CipherSuites: suites}); err != nil {
+			t.Fatalf("cipher suites %x: %v", suites, err)
+		}
+	}
+}
+
+func TestNewCtxFromTLSConfigUnsupported(t *testing.T) {
+	for _, config := range []*tls.Config{
+		{CipherSuites: []uint16{0xffff}},
+		{GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate,
+			error) {
+			return nil, nil
+		}},
+	} {
+		if _, err := NewCtxFromTLSConfig(config); err == nil {
+			t.Fatalf("config %+v is accepted", config)
+		}
+	}
+}
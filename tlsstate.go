@@ -0,0 +1,154 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"unsafe"
+)
+
+// TLSConnectionState maps the state of the connection to the
+// crypto/tls.ConnectionState, for code written against crypto/tls, e.g.
+// middleware inspecting http.Request.TLS. The mapping is best effort: fields
+// which have no OpenSSL counterpart or can't be converted, such as
+// certificates crypto/x509 fails to parse, are left empty. net/http only
+// fills http.Request.TLS for crypto/tls connections, see TLSStateHandler for
+// servers using Conn.
+func (c *Conn) TLSConnectionState() tls.ConnectionState {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	rv := tls.ConnectionState{HandshakeComplete: !c.handshake_at.IsZero()}
+	if c.is_shutdown {
+		return rv
+	}
+
+	rv.Version = uint16(C.SSL_version(c.ssl))
+	if cipher := C.SSL_get_current_cipher(c.ssl); cipher != nil {
+		// the low bytes of the id are the IANA value of the suite
+		rv.CipherSuite = uint16(C.SSL_CIPHER_get_id(cipher) & 0xffff)
+	}
+	rv.DidResume = C.X_SSL_session_reused(c.ssl) == 1
+	rv.ServerName = C.GoString(
+		C.SSL_get_servername(c.ssl, C.TLSEXT_NAMETYPE_host_name))
+
+	var alpn *C.uchar
+	var alpnLen C.uint
+	C.SSL_get0_alpn_selected(c.ssl, &alpn, &alpnLen)
+	if alpnLen > 0 {
+		rv.NegotiatedProtocol = string(C.GoBytes(unsafe.Pointer(alpn),
+			C.int(alpnLen)))
+		rv.NegotiatedProtocolIsMutual = true
+	}
+
+	rv.PeerCertificates = c.peerX509Certificates()
+	if C.SSL_get_verify_result(c.ssl) == C.X509_V_OK {
+		if sk := C.X_SSL_get0_verified_chain(c.ssl); sk != nil {
+			if chain := x509Certificates(sk); len(chain) > 0 {
+				rv.VerifiedChains = [][]*x509.Certificate{chain}
+			}
+		}
+	}
+
+	var der *C.uchar
+	if n := C.X_SSL_get_tlsext_status_ocsp_resp(c.ssl, &der); n > 0 &&
+		der != nil {
+		rv.OCSPResponse = C.GoBytes(unsafe.Pointer(der), C.int(n))
+	}
+	rv.TLSUnique = c.tlsUnique(rv.Version, rv.DidResume)
+	return rv
+}
+
+// peerX509Certificates returns the certificates sent by the peer, leaf
+// first. It must be called with c.mtx held.
+func (c *Conn) peerX509Certificates() []*x509.Certificate {
+	var rv []*x509.Certificate
+	leaf := C.SSL_get_peer_certificate(c.ssl)
+	if leaf != nil {
+		defer C.X509_free(leaf)
+		if cert := x509Certificate(leaf); cert != nil {
+			rv = append(rv, cert)
+		}
+	}
+	sk := C.SSL_get_peer_cert_chain(c.ssl)
+	if sk == nil {
+		return rv
+	}
+	for i := 0; i < int(C.X_sk_X509_num(sk)); i++ {
+		x := C.X_sk_X509_value(sk, C.int(i))
+		// the client side chain already includes the leaf
+		if leaf != nil && C.X509_cmp(x, leaf) == 0 {
+			continue
+		}
+		if cert := x509Certificate(x); cert != nil {
+			rv = append(rv, cert)
+		}
+	}
+	return rv
+}
+
+// tlsUnique returns the tls-unique channel binding of RFC 5929, the first
+// Finished message of the handshake. It isn't defined for TLS 1.3.
+// tlsUnique must be called with c.mtx held.
+func (c *Conn) tlsUnique(version uint16, resumed bool) []byte {
+	if version >= tls.VersionTLS13 {
+		return nil
+	}
+	var buf [64]byte
+	var n C.size_t
+	// the client sends the first Finished message of full handshakes, the
+	// server of abbreviated ones
+	if (C.SSL_is_server(c.ssl) == 1) == resumed {
+		n = C.SSL_get_finished(c.ssl, unsafe.Pointer(&buf[0]),
+			C.size_t(len(buf)))
+	} else {
+		n = C.SSL_get_peer_finished(c.ssl, unsafe.Pointer(&buf[0]),
+			C.size_t(len(buf)))
+	}
+	if n == 0 || int(n) > len(buf) {
+		return nil
+	}
+	return append([]byte(nil), buf[:n]...)
+}
+
+// x509Certificates converts the certificates of sk, skipping the ones which
+// crypto/x509 fails to parse.
+func x509Certificates(sk *C.struct_stack_st_X509) []*x509.Certificate {
+	rv := make([]*x509.Certificate, 0, int(C.X_sk_X509_num(sk)))
+	for i := 0; i < cap(rv); i++ {
+		x := C.X_sk_X509_value(sk, C.int(i))
+		if cert := x509Certificate(x); cert != nil {
+			rv = append(rv, cert)
+		}
+	}
+	return rv
+}
+
+// x509Certificate converts x, returning nil if crypto/x509 fails to parse
+// it.
+func x509Certificate(x *C.X509) *x509.Certificate {
+	der, err := marshalX509DER(x)
+	if err != nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil
+	}
+	return cert
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+)
+
+func TestTLSConnectionState(t *testing.T) {
+	ca := newTestCertificate(t, "Test CA", true, nil)
+	intermediate := newTestCertificate(t, "Test Intermediate", true, ca)
+	leaf := newTestCertificate(t, "localhost", false, intermediate)
+
+	pool := x509.NewCertPool()
+	caPEM, err := ca.cert.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pool.AppendCertsFromPEM(caPEM) {
+		t.Fatal("failed to add the CA")
+	}
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{newTestTLSCertificate(t, leaf.key,
+			leaf.cert, intermediate.cert)},
+		MaxVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2"},
+	}
+	clientConfig := &tls.Config{
+		RootCAs:    pool,
+		ServerName: "localhost",
+		NextProtos: []string{"h2"},
+	}
+	server, client, serverErr, clientErr := handshakeTLSConfigs(t,
+		serverConfig, clientConfig)
+	if serverErr != nil || clientErr != nil {
+		t.Fatalf("handshake failed: %v, %v", serverErr, clientErr)
+	}
+	defer close_both(server, client)
+
+	state := client.TLSConnectionState()
+	if !state.HandshakeComplete || state.DidResume {
+		t.Fatalf("unexpected handshake state %+v", state)
+	}
+	if state.Version != tls.VersionTLS12 {
+		t.Fatalf("unexpected version %x", state.Version)
+	}
+	cipher, err := client.CurrentCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := tlsCipherSuiteNames[state.CipherSuite]; name != cipher {
+		t.Fatalf("cipher suite %x doesn't match %s", state.CipherSuite,
+			cipher)
+	}
+	if state.ServerName != "localhost" {
+		t.Fatalf("unexpected server name %q", state.ServerName)
+	}
+	if state.NegotiatedProtocol != "h2" {
+		t.Fatalf("unexpected protocol %q", state.NegotiatedProtocol)
+	}
+	if len(state.PeerCertificates) != 2 ||
+		state.PeerCertificates[0].Subject.CommonName != "localhost" ||
+		state.PeerCertificates[1].Subject.CommonName != "Test Intermediate" {
+		t.Fatalf("unexpected peer certificates %v", state.PeerCertificates)
+	}
+
+	serverState := server.TLSConnectionState()
+	if serverState.ServerName != "localhost" ||
+		serverState.NegotiatedProtocol != "h2" {
+		t.Fatalf("unexpected server state %+v", serverState)
+	}
+	if len(serverState.PeerCertificates) != 0 {
+		t.Fatal("unexpected client certificates")
+	}
+	if len(state.TLSUnique) == 0 ||
+		!bytes.Equal(state.TLSUnique, serverState.TLSUnique) {
+		t.Fatalf("tls-unique mismatch: %x, %x", state.TLSUnique,
+			serverState.TLSUnique)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// TPM2ProviderName is the name of the tpm2-openssl provider.
+	TPM2ProviderName = "tpm2"
+	// TPM2EngineID is the id of the tpm2-tss-engine.
+	TPM2EngineID = "tpm2tss"
+)
+
+// LoadTPMPrivateKey loads a private key bound to the platform TPM 2.0, so
+// that a TLS client key never leaves the TPM. The ref is a persistent
+// handle such as "handle:0x81000001" or the path of a TSS2 PEM key file.
+//
+// With OpenSSL 3.0+ the key is loaded through the tpm2 provider, which is
+// loaded if needed, with LoadFromURIWithPassphrase, calling passphrase for
+// the authorization value. Otherwise it is loaded through the tpm2tss
+// engine with LoadPrivateKeyFromEngine, which takes the authorization value
+// with the PIN engine command instead, so passphrase must be nil.
+func LoadTPMPrivateKey(ref string, passphrase PassphraseFunc) (PrivateKey,
+	error) {
+	if kdf_support {
+		if !ProviderAvailable(TPM2ProviderName) {
+			if _, err := LoadProvider(TPM2ProviderName); err != nil {
+				return nil, err
+			}
+		}
+		objects, err := LoadFromURIWithPassphrase(passphrase, ref)
+		if err != nil {
+			return nil, err
+		}
+		if len(objects.PrivateKeys) != 1 {
+			return nil, fmt.Errorf("found %d private keys for %s",
+				len(objects.PrivateKeys), ref)
+		}
+		return objects.PrivateKeys[0], nil
+	}
+	if passphrase != nil {
+		return nil, errors.New("passphrase callback requires OpenSSL 3.0+")
+	}
+	e, err := EngineById(TPM2EngineID)
+	if err != nil {
+		return nil, err
+	}
+	return LoadPrivateKeyFromEngine(e, ref)
+}
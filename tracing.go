@@ -0,0 +1,190 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// TraceAttribute is an attribute of a span. Value is a string, a bool or a
+// float64.
+type TraceAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is a span of a distributed trace, e.g. an OpenTelemetry
+// trace.Span behind a small adapter.
+type Span interface {
+	SetAttributes(attrs ...TraceAttribute)
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts spans, e.g. with an OpenTelemetry trace.Tracer. The context
+// is the one of the connection, see SSL.SetContext.
+type Tracer interface {
+	Start(ctx context.Context, name string) Span
+}
+
+// MultiStats returns Stats that report the events to all of stats, e.g. to
+// both export metrics and trace handshakes.
+func MultiStats(stats ...Stats) Stats {
+	return multiStats(stats)
+}
+
+type multiStats []Stats
+
+func (m multiStats) HandshakeStarted(ssl *SSL) {
+	for _, s := range m {
+		s.HandshakeStarted(ssl)
+	}
+}
+
+func (m multiStats) HandshakeCompleted(ssl *SSL, duration time.Duration) {
+	for _, s := range m {
+		s.HandshakeCompleted(ssl, duration)
+	}
+}
+
+func (m multiStats) HandshakeFailed(ssl *SSL, err error) {
+	for _, s := range m {
+		s.HandshakeFailed(ssl, err)
+	}
+}
+
+func (m multiStats) SessionResumed(ssl *SSL) {
+	for _, s := range m {
+		s.SessionResumed(ssl)
+	}
+}
+
+func (m multiStats) BytesRead(ssl *SSL, n int) {
+	for _, s := range m {
+		s.BytesRead(ssl, n)
+	}
+}
+
+func (m multiStats) BytesWritten(ssl *SSL, n int) {
+	for _, s := range m {
+		s.BytesWritten(ssl, n)
+	}
+}
+
+func (m multiStats) AlertReceived(ssl *SSL, alert Alert) {
+	for _, s := range m {
+		s.AlertReceived(ssl, alert)
+	}
+}
+
+// TracingStats returns Stats that trace every handshake with a
+// "tls.handshake" span. The span has the attributes of the negotiated
+// parameters and the peer certificate subject, named after the
+// OpenTelemetry semantic conventions, e.g. "tls.protocol.version",
+// "tls.cipher" and "tls.server.subject".
+func TracingStats(tracer Tracer) Stats {
+	return &tracingStats{tracer: tracer}
+}
+
+type tracingStats struct {
+	NopStats
+	tracer Tracer
+	spans  sync.Map // *SSL to Span
+}
+
+func (t *tracingStats) HandshakeStarted(ssl *SSL) {
+	t.spans.Store(ssl, t.tracer.Start(ssl.Context(), "tls.handshake"))
+}
+
+func (t *tracingStats) HandshakeCompleted(ssl *SSL, duration time.Duration) {
+	span, ok := t.spans.Load(ssl)
+	if !ok {
+		return
+	}
+	t.spans.Delete(ssl)
+	attrs := ssl.traceAttributes()
+	attrs = append(attrs, TraceAttribute{
+		Key: "tls.handshake.duration", Value: duration.Seconds()})
+	span.(Span).SetAttributes(attrs...)
+	span.(Span).End()
+}
+
+func (t *tracingStats) HandshakeFailed(ssl *SSL, err error) {
+	span, ok := t.spans.Load(ssl)
+	if !ok {
+		return
+	}
+	t.spans.Delete(ssl)
+	span.(Span).RecordError(err)
+	span.(Span).End()
+}
+
+// traceAttributes returns the attributes of the negotiated parameters.
+func (s *SSL) traceAttributes() []TraceAttribute {
+	version := C.GoString(C.SSL_get_version(s.ssl))
+	protocol := "tls"
+	if strings.HasPrefix(version, "DTLS") {
+		protocol = "dtls"
+	}
+	attrs := []TraceAttribute{
+		{Key: "tls.protocol.name", Value: protocol},
+		{Key: "tls.protocol.version", Value: version[strings.Index(version,
+			"v")+1:]},
+		{Key: "tls.resumed", Value: C.X_SSL_session_reused(s.ssl) == 1},
+	}
+	if p := C.X_SSL_get_cipher_name(s.ssl); p != nil {
+		attrs = append(attrs, TraceAttribute{
+			Key: "tls.cipher", Value: C.GoString(p)})
+	}
+	if nid := C.X_SSL_get_negotiated_group(s.ssl); nid != C.NID_undef {
+		if sn := C.OBJ_nid2sn(nid); sn != nil {
+			attrs = append(attrs, TraceAttribute{
+				Key: "tls.curve", Value: C.GoString(sn)})
+		}
+	}
+	if name := C.SSL_get_servername(s.ssl,
+		C.TLSEXT_NAMETYPE_host_name); name != nil {
+		attrs = append(attrs, TraceAttribute{
+			Key: "tls.client.server_name", Value: C.GoString(name)})
+	}
+	var alpn *C.uchar
+	var alpnLen C.uint
+	C.SSL_get0_alpn_selected(s.ssl, &alpn, &alpnLen)
+	if alpnLen > 0 {
+		attrs = append(attrs, TraceAttribute{Key: "tls.next_protocol",
+			Value: string(C.GoBytes(unsafe.Pointer(alpn), C.int(alpnLen)))})
+	}
+	if x := C.SSL_get_peer_certificate(s.ssl); x != nil {
+		key := "tls.server.subject"
+		if C.SSL_is_server(s.ssl) == 1 {
+			key = "tls.client.subject"
+		}
+		if p := C.X509_NAME_oneline(C.X509_get_subject_name(x), nil,
+			0); p != nil {
+			attrs = append(attrs, TraceAttribute{
+				Key: key, Value: C.GoString(p)})
+			C.X_OPENSSL_free(unsafe.Pointer(p))
+		}
+		C.X509_free(x)
+	}
+	return attrs
+}
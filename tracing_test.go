@@ -0,0 +1,106 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testSpan struct {
+	name  string
+	ctx   context.Context
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+func (s *testSpan) SetAttributes(attrs ...TraceAttribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error) { s.err = err }
+func (s *testSpan) End()                  { s.ended = true }
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &testSpan{name: name, ctx: ctx, attrs: map[string]interface{}{}}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+type ctxKey struct{}
+
+func TestTracingStats(t *testing.T) {
+	serverConn, clientConn := NetPipe(t)
+	ctx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := newDefaultServer(t, serverConn, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := &testTracer{}
+	stats := &recordingStats{}
+	clientCtx.SetStats(MultiStats(TracingStats(tracer), stats))
+	client, err := Client(clientConn, clientCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close_both(server, client)
+	if err := client.SetTlsExtHostName("localhost"); err != nil {
+		t.Fatal(err)
+	}
+	client.SetContext(context.WithValue(context.Background(), ctxKey{},
+		"trace"))
+	doHandshake(t, server, client)
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("unexpected spans %+v", tracer.spans)
+	}
+	span := tracer.spans[0]
+	if span.name != "tls.handshake" || !span.ended || span.err != nil ||
+		span.ctx.Value(ctxKey{}) != "trace" {
+		t.Fatalf("unexpected span %+v", span)
+	}
+	if span.attrs["tls.protocol.name"] != "tls" ||
+		span.attrs["tls.client.server_name"] != "localhost" ||
+		span.attrs["tls.resumed"] != false ||
+		span.attrs["tls.cipher"] == nil {
+		t.Fatalf("unexpected attributes %v", span.attrs)
+	}
+	if subject, _ := span.attrs["tls.server.subject"].(string); !strings.Contains(
+		subject, "O=Space Monkey") {
+		t.Fatalf("unexpected subject %q", subject)
+	}
+	if stats.completed != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
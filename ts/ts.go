@@ -0,0 +1,333 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ts implements the client side of the RFC 3161 time-stamp
+// protocol: it builds time-stamp requests, submits them to a time-stamping
+// authority (TSA) over HTTP, and verifies the responses and the tokens kept
+// from them against a trust store.
+//
+// A time-stamp proves that data, such as a signature, existed at the time.
+// The token of the response is kept along with the data and checked later
+// with VerifyToken.
+package ts
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tarantool/go-openssl"
+)
+
+const (
+	// RequestContentType and ResponseContentType are the media types of
+	// the HTTP transport of RFC 3161, section 3.4.
+	RequestContentType  = "application/timestamp-query"
+	ResponseContentType = "application/timestamp-reply"
+
+	// maxResponseSize limits the size of the responses read from a TSA.
+	maxResponseSize = 1 << 20
+)
+
+// Request is a TimeStampReq: the hash of the data to time-stamp.
+type Request struct {
+	// HashAlgorithm is the digest of HashedMessage, e.g.
+	// openssl.NID_sha256.
+	HashAlgorithm openssl.NID
+	HashedMessage []byte
+	// Policy is the dotted OID of the TSA policy to time-stamp under. If
+	// empty, the TSA uses its default policy.
+	Policy string
+	// Nonce is echoed by the TSA to tie the response to the request. It is
+	// omitted if nil.
+	Nonce *big.Int
+	// CertReq asks the TSA to include its certificate in the token, which
+	// the verification needs.
+	CertReq bool
+}
+
+// NewRequest returns a request for the data hashed with the digest, with a
+// random 64-bit nonce and CertReq set.
+func NewRequest(data []byte, digest openssl.NID) (*Request, error) {
+	hashed, err := hash(data, digest)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	return &Request{
+		HashAlgorithm: digest,
+		HashedMessage: hashed,
+		Nonce:         nonce,
+		CertReq:       true,
+	}, nil
+}
+
+func hash(data []byte, digest openssl.NID) ([]byte, error) {
+	d, err := openssl.GetDigestByNid(digest)
+	if err != nil {
+		return nil, err
+	}
+	h, err := openssl.NewHashWithDigest(d)
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+	if _, err := h.Write(data); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+// Marshal returns the DER encoding of the request.
+func (r *Request) Marshal() ([]byte, error) {
+	algorithm, err := parseOID(r.HashAlgorithm.OID())
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash algorithm: %w", err)
+	}
+	req := timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			// The parameters are NULL, as written by OpenSSL.
+			HashAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  algorithm,
+				Parameters: asn1.NullRawValue,
+			},
+			HashedMessage: r.HashedMessage,
+		},
+		Nonce:   r.Nonce,
+		CertReq: r.CertReq,
+	}
+	if r.Policy != "" {
+		if req.ReqPolicy, err = parseOID(r.Policy); err != nil {
+			return nil, fmt.Errorf("invalid policy: %w", err)
+		}
+	}
+	return asn1.Marshal(req)
+}
+
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	if s == "" {
+		return nil, errors.New("empty object identifier")
+	}
+	parts := strings.Split(s, ".")
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid object identifier '%s'", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+// Status is the PKIStatus of a response.
+type Status int
+
+const (
+	StatusGranted                Status = 0
+	StatusGrantedWithMods        Status = 1
+	StatusRejection              Status = 2
+	StatusWaiting                Status = 3
+	StatusRevocationWarning      Status = 4
+	StatusRevocationNotification Status = 5
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusGranted:
+		return "granted"
+	case StatusGrantedWithMods:
+		return "granted with modifications"
+	case StatusRejection:
+		return "rejection"
+	case StatusWaiting:
+		return "waiting"
+	case StatusRevocationWarning:
+		return "revocation warning"
+	case StatusRevocationNotification:
+		return "revocation notification"
+	}
+	return fmt.Sprintf("status %d", int(s))
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// Response is a TimeStampResp.
+type Response struct {
+	Status       Status
+	StatusString []string
+	// FailInfo holds the PKIFailureInfo bits of a rejection.
+	FailInfo asn1.BitString
+	// Token is the DER-encoded TimeStampToken of a granted response, to be
+	// kept along with the time-stamped data.
+	Token []byte
+
+	der []byte
+}
+
+// ParseResponse parses a DER-encoded TimeStampResp.
+func ParseResponse(der []byte) (*Response, error) {
+	var resp timeStampResp
+	rest, err := asn1.Unmarshal(der, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time-stamp response: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after time-stamp response")
+	}
+	return &Response{
+		Status:       Status(resp.Status.Status),
+		StatusString: resp.Status.StatusString,
+		FailInfo:     resp.Status.FailInfo,
+		Token:        resp.TimeStampToken.FullBytes,
+		der:          append([]byte(nil), der...),
+	}, nil
+}
+
+// Granted reports whether the TSA granted the request.
+func (r *Response) Granted() bool {
+	return r.Status == StatusGranted || r.Status == StatusGrantedWithMods
+}
+
+// Verify verifies the response against the request it answers and the
+// trust store, see openssl.VerifyTimestampResponse.
+func (r *Response) Verify(req *Request,
+	store *openssl.CertificateStore) (*openssl.TimestampInfo, error) {
+	der, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return openssl.VerifyTimestampResponse(r.der, der, store)
+}
+
+// VerifyToken verifies a token kept from Response.Token against the data it
+// time-stamps, hashed with the digest of the request, and the trust store.
+func VerifyToken(token, data []byte, digest openssl.NID,
+	store *openssl.CertificateStore) (*openssl.TimestampInfo, error) {
+	hashed, err := hash(data, digest)
+	if err != nil {
+		return nil, err
+	}
+	info, err := openssl.VerifyTimestampToken(token, hashed, store)
+	if err != nil {
+		return nil, err
+	}
+	if info.HashAlgorithm != digest {
+		return nil, fmt.Errorf("token hash algorithm %s, expected %s",
+			info.HashAlgorithm.ShortName(), digest.ShortName())
+	}
+	return info, nil
+}
+
+// Client submits requests to a TSA over HTTP.
+type Client struct {
+	// URL is the endpoint of the TSA.
+	URL string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Timestamp submits the request and returns the response of the TSA. It
+// fails if the TSA doesn't grant the request, and returns the response
+// along with the error. The response still has to be verified.
+func (c *Client) Timestamp(ctx context.Context, req *Request) (*Response,
+	error) {
+	der, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.URL,
+		bytes.NewReader(der))
+	if err != nil {
+		return nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", RequestContentType)
+	httpReq.Header.Set("Accept", ResponseContentType)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TSA responded with HTTP status %s",
+			httpResp.Status)
+	}
+	mediaType, _, err := mime.ParseMediaType(
+		httpResp.Header.Get("Content-Type"))
+	if err != nil || mediaType != ResponseContentType {
+		return nil, fmt.Errorf("unexpected TSA response content type '%s'",
+			httpResp.Header.Get("Content-Type"))
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(httpResp.Body,
+		maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxResponseSize {
+		return nil, errors.New("TSA response is too large")
+	}
+
+	resp, err := ParseResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Granted() {
+		return resp, fmt.Errorf("TSA %s: %s", resp.Status,
+			strings.Join(resp.StatusString, "; "))
+	}
+	return resp, nil
+}
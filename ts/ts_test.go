@@ -0,0 +1,260 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ts
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tarantool/go-openssl"
+	"github.com/tarantool/go-openssl/ca"
+)
+
+const testPolicy = "1.2.3.4.1"
+
+// newTestTSA starts a TSA backed by `openssl ts -reply` with a time-stamping
+// certificate issued by a new root, and returns its URL and the root.
+func newTestTSA(t *testing.T, dir string) (string, *openssl.Certificate) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("the openssl command is needed to run a TSA")
+	}
+	root, err := ca.NewRoot(ca.Subject{CommonName: "Test Root"}, ca.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := openssl.GenerateECKey(openssl.Prime256v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := openssl.NewCertificate(&openssl.CertificateInfo{
+		Expires:      time.Hour,
+		Country:      "US",
+		Organization: "Test",
+		CommonName:   "Test TSA",
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.SetVersion(openssl.X509_V3); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.SetIssuer(root.Certificate); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.AddExtensions(map[openssl.NID]string{
+		openssl.NID_basic_constraints: "critical,CA:FALSE",
+		openssl.NID_key_usage:         "critical,digitalSignature",
+		openssl.NID_ext_key_usage:     "critical,timeStamping",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Sign(root.Key, openssl.EVP_SHA256); err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := cert.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := key.MarshalPKCS8PrivateKeyPEM("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := "[tsa]\n" +
+		"default_tsa = tsa_config\n" +
+		"[tsa_config]\n" +
+		"serial = " + filepath.Join(dir, "serial") + "\n" +
+		"signer_cert = " + filepath.Join(dir, "tsa.pem") + "\n" +
+		"signer_key = " + filepath.Join(dir, "tsa.key") + "\n" +
+		"signer_digest = sha256\n" +
+		"default_policy = " + testPolicy + "\n" +
+		"digests = sha256, sha384, sha512\n" +
+		"ess_cert_id_alg = sha256\n"
+	for name, data := range map[string][]byte{
+		"tsa.pem":  certPEM,
+		"tsa.key":  keyPEM,
+		"serial":   []byte("01\n"),
+		"tsa.conf": []byte(config),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data,
+			0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Content-Type") != RequestContentType {
+				http.Error(w, "bad content type", http.StatusBadRequest)
+				return
+			}
+			query, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			queryFile := filepath.Join(dir, "query.tsq")
+			replyFile := filepath.Join(dir, "reply.tsr")
+			if err := ioutil.WriteFile(queryFile, query, 0600); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			out, err := exec.Command("openssl", "ts", "-reply",
+				"-config", filepath.Join(dir, "tsa.conf"),
+				"-queryfile", queryFile, "-out", replyFile).CombinedOutput()
+			if err != nil {
+				http.Error(w, string(out), http.StatusInternalServerError)
+				return
+			}
+			reply, err := ioutil.ReadFile(replyFile)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", ResponseContentType)
+			w.Write(reply)
+		}))
+	return server.URL, root.Certificate
+}
+
+func newStore(t *testing.T, certs ...*openssl.Certificate) *openssl.CertificateStore {
+	store, err := openssl.NewCertificateStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cert := range certs {
+		if err := store.AddCertificate(cert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestTimestamp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	url, root := newTestTSA(t, dir)
+	client := &Client{URL: url}
+	store := newStore(t, root)
+
+	data := []byte("signature to time-stamp")
+	req, err := NewRequest(data, openssl.NID_sha256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().Add(-time.Second)
+	resp, err := client.Timestamp(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := resp.Verify(req, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Time.Before(before) || info.Time.After(time.Now()) {
+		t.Fatalf("unexpected time %v", info.Time)
+	}
+	if info.Policy != testPolicy {
+		t.Fatalf("unexpected policy %s", info.Policy)
+	}
+	if info.HashAlgorithm != openssl.NID_sha256 {
+		t.Fatalf("unexpected hash algorithm %v", info.HashAlgorithm)
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(req.Nonce) != 0 {
+		t.Fatalf("unexpected nonce %v", info.Nonce)
+	}
+
+	// A response to another request is rejected.
+	other, err := NewRequest(data, openssl.NID_sha256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resp.Verify(other, store); err == nil {
+		t.Fatal("verified a response with a different nonce")
+	}
+	if _, err := resp.Verify(req, newStore(t)); err == nil {
+		t.Fatal("verified a response of an untrusted TSA")
+	}
+
+	// The kept token proves the time of the data alone.
+	token, err := VerifyToken(resp.Token, data, openssl.NID_sha256, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.SerialNumber.Cmp(info.SerialNumber) != 0 {
+		t.Fatal("token serial number mismatch")
+	}
+	if _, err := VerifyToken(resp.Token, []byte("other data"),
+		openssl.NID_sha256, store); err == nil {
+		t.Fatal("verified a token for other data")
+	}
+	if _, err := VerifyToken(resp.Token, data, openssl.NID_sha384,
+		store); err == nil {
+		t.Fatal("verified a token with another hash algorithm")
+	}
+}
+
+func TestTimestampRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	url, _ := newTestTSA(t, dir)
+	client := &Client{URL: url}
+
+	req, err := NewRequest([]byte("data"), openssl.NID_sha256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Policy = "1.2.3.4.2"
+	resp, err := client.Timestamp(context.Background(), req)
+	if err == nil {
+		t.Fatal("expected the TSA to reject an unknown policy")
+	}
+	if resp == nil || resp.Status != StatusRejection || resp.Token != nil {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+}
+
+func TestRequestMarshal(t *testing.T) {
+	req := &Request{
+		HashAlgorithm: openssl.NID_sha256,
+		HashedMessage: make([]byte, 32),
+	}
+	der, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SEQUENCE { INTEGER 1, SEQUENCE { SEQUENCE { OID sha256, NULL },
+	// OCTET STRING } }
+	if len(der) != 2+3+2+15+34 || der[0] != 0x30 {
+		t.Fatalf("unexpected encoding %x", der)
+	}
+	req.Policy = "not an oid"
+	if _, err := req.Marshal(); err == nil {
+		t.Fatal("expected an error for an invalid policy")
+	}
+}
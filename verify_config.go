@@ -0,0 +1,271 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// VerifyConfig describes the verification of certificate chains, like
+// crypto/x509.VerifyOptions, so that it can be set up without composing
+// store flags, verification parameters and callbacks. See
+// Ctx.SetVerifyConfig and Certificate.Verify.
+type VerifyConfig struct {
+	// Roots are the trusted certificates. Nil means the trust store of the
+	// context; Certificate.Verify requires them.
+	Roots *CertificateStore
+	// Intermediates are untrusted certificates that may complete the chain,
+	// in addition to the ones sent by the peer.
+	Intermediates []*Certificate
+	// DNSName, if not empty, is a name the leaf certificate must be valid
+	// for.
+	DNSName string
+	// Time is the time the validity periods are checked at. The zero time
+	// means the current time.
+	Time time.Time
+	// KeyUsages are the extended key usages of which the leaf certificate
+	// must allow one; x509.ExtKeyUsageAny allows any certificate. If empty,
+	// the default of OpenSSL applies: the usage of the role of the peer in
+	// handshakes and none in Certificate.Verify.
+	KeyUsages []x509.ExtKeyUsage
+	// SkipHostname ignores DNSName, e.g. to share a config between hosts.
+	SkipHostname bool
+	// SkipExpiry disables the validity period checks. It requires OpenSSL
+	// 1.1.0 or newer.
+	SkipExpiry bool
+}
+
+// verifyConfig is what the certificate verify callback of a context needs
+// from its VerifyConfig.
+type verifyConfig struct {
+	roots         *CertificateStore
+	intermediates []*Certificate
+	purposes      []C.int
+}
+
+// verifyPurposes maps extended key usages to OpenSSL purposes.
+func verifyPurposes(usages []x509.ExtKeyUsage) ([]C.int, error) {
+	purposes := make([]C.int, 0, len(usages))
+	for _, usage := range usages {
+		var purpose C.int = -1
+		switch usage {
+		case x509.ExtKeyUsageAny:
+			purpose = C.X509_PURPOSE_ANY
+		case x509.ExtKeyUsageServerAuth:
+			purpose = C.X509_PURPOSE_SSL_SERVER
+		case x509.ExtKeyUsageClientAuth:
+			purpose = C.X509_PURPOSE_SSL_CLIENT
+		case x509.ExtKeyUsageEmailProtection:
+			purpose = C.X509_PURPOSE_SMIME_SIGN
+		case x509.ExtKeyUsageTimeStamping:
+			purpose = C.X509_PURPOSE_TIMESTAMP_SIGN
+		case x509.ExtKeyUsageOCSPSigning:
+			purpose = C.X509_PURPOSE_OCSP_HELPER
+		case x509.ExtKeyUsageCodeSigning:
+			purpose = C.X509_PURPOSE_CODE_SIGN
+		}
+		if purpose < 0 {
+			return nil, fmt.Errorf("unsupported extended key usage %d",
+				usage)
+		}
+		purposes = append(purposes, purpose)
+	}
+	return purposes, nil
+}
+
+// apply sets the parameters of config on param. The key usages are checked
+// after the verification, so any purpose is accepted by it.
+func (config *VerifyConfig) apply(param *C.X509_VERIFY_PARAM,
+	purposes []C.int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var host *C.char
+	if config.DNSName != "" && !config.SkipHostname {
+		host = C.CString(config.DNSName)
+		defer C.free(unsafe.Pointer(host))
+	}
+	// a nil host clears the names set before
+	if C.X_X509_VERIFY_PARAM_set1_host(param, host, 0) != 1 {
+		return errorFromErrorQueue()
+	}
+	if config.SkipExpiry {
+		// a verification time would take precedence
+		setVerifyTime(param, time.Time{})
+		if C.X_X509_VERIFY_PARAM_set_no_check_time(param) != 1 {
+			return errors.New("skipping the expiry check is not supported")
+		}
+	} else {
+		setVerifyTime(param, config.Time)
+	}
+	if len(purposes) > 0 &&
+		C.X509_VERIFY_PARAM_set_purpose(param, C.X509_PURPOSE_ANY) != 1 {
+		return errorFromErrorQueue()
+	}
+	return nil
+}
+
+// SetVerifyConfig makes peer verification follow config. It doesn't enable
+// the verification, see SetVerifyMode, and it is meant to be called once,
+// before the context is used: the settings it doesn't change, such as the
+// key usages when there are none, are kept.
+func (c *Ctx) SetVerifyConfig(config VerifyConfig) error {
+	purposes, err := verifyPurposes(config.KeyUsages)
+	if err != nil {
+		return err
+	}
+	if err := config.apply(C.SSL_CTX_get0_param(c.ctx), purposes); err != nil {
+		return err
+	}
+	c.verify_time = config.Time
+	if config.Roots != nil &&
+		C.X_SSL_CTX_set1_verify_cert_store(c.ctx, config.Roots.store) != 1 {
+		return errors.New("failed to set the verification store")
+	}
+	c.verify_config = &verifyConfig{
+		roots:         config.Roots,
+		intermediates: append([]*Certificate(nil), config.Intermediates...),
+		purposes:      purposes,
+	}
+	c.verify_config_once.Do(func() {
+		C.X_SSL_CTX_enable_cert_verify_cb(c.ctx)
+	})
+	return nil
+}
+
+// verify runs X509_verify_cert with the intermediates added to the
+// untrusted certificates, then checks the key usages.
+func (config *verifyConfig) verify(store *C.X509_STORE_CTX) C.int {
+	if len(config.intermediates) > 0 {
+		untrusted := C.X_X509_STORE_CTX_get0_untrusted(store)
+		sk := C.X_sk_X509_new_null()
+		if sk == nil {
+			return 0
+		}
+		defer C.X_sk_X509_free(sk)
+		for i := 0; untrusted != nil &&
+			i < int(C.X_sk_X509_num(untrusted)); i++ {
+			x := C.X_sk_X509_value(untrusted, C.int(i))
+			if C.X_sk_X509_push(sk, x) <= 0 {
+				return 0
+			}
+		}
+		for _, cert := range config.intermediates {
+			if C.X_sk_X509_push(sk, cert.x) <= 0 {
+				return 0
+			}
+		}
+		C.X_X509_STORE_CTX_set0_untrusted(store, sk)
+		defer C.X_X509_STORE_CTX_set0_untrusted(store, untrusted)
+	}
+	rv := C.X509_verify_cert(store)
+	if rv == 1 && len(config.purposes) > 0 {
+		rv = C.X_X509_STORE_CTX_check_leaf_purposes(store,
+			&config.purposes[0], C.int(len(config.purposes)))
+	}
+	return rv
+}
+
+//export go_ssl_ctx_cert_verify_cb_thunk
+func go_ssl_ctx_cert_verify_cb_thunk(p unsafe.Pointer,
+	store *C.X509_STORE_CTX) C.int {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Critf("openssl: certificate verify callback panic'd: %v",
+				err)
+			os.Exit(1)
+		}
+	}()
+	c := pointers.Restore(p).(*Ctx)
+	if c.verify_host && !hostToVerify(store) {
+		C.X509_STORE_CTX_set_error(store, C.X509_V_ERR_HOSTNAME_MISMATCH)
+		return 0
+	}
+	if c.verify_config == nil {
+		return C.X509_verify_cert(store)
+	}
+	return c.verify_config.verify(store)
+}
+
+// hostToVerify reports whether the connection being verified has a host name
+// set with SSL.SetVerifyHostname or is dialed without checking it.
+func hostToVerify(store *C.X509_STORE_CTX) bool {
+	con := (*C.SSL)(C.X509_STORE_CTX_get_ex_data(store,
+		C.SSL_get_ex_data_X509_STORE_CTX_idx()))
+	if con == nil {
+		return false
+	}
+	sp := C.SSL_get_ex_data(con, get_ssl_idx())
+	if sp == nil {
+		return false
+	}
+	s := pointers.Restore(sp).(*SSL)
+	return s.verify_host != "" || s.skip_host
+}
+
+// Verify verifies the certificate against config, which must have roots,
+// and returns the chain, starting with the certificate and ending with the
+// trust anchor.
+func (c *Certificate) Verify(config VerifyConfig) ([]*Certificate, error) {
+	if config.Roots == nil {
+		return nil, errors.New("no roots provided")
+	}
+	purposes, err := verifyPurposes(config.KeyUsages)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := C.X509_STORE_CTX_new()
+	if ctx == nil {
+		return nil, errors.New("failed to allocate X509_STORE_CTX")
+	}
+	defer C.X509_STORE_CTX_free(ctx)
+	runtime.LockOSThread()
+	if C.X509_STORE_CTX_init(ctx, config.Roots.store, c.x, nil) != 1 {
+		runtime.UnlockOSThread()
+		return nil, errorFromErrorQueue()
+	}
+	runtime.UnlockOSThread()
+	if err := config.apply(C.X509_STORE_CTX_get0_param(ctx),
+		purposes); err != nil {
+		return nil, err
+	}
+
+	verifier := &verifyConfig{
+		intermediates: config.Intermediates,
+		purposes:      purposes,
+	}
+	if verifier.verify(ctx) != 1 {
+		code := C.X509_STORE_CTX_get_error(ctx)
+		return nil, fmt.Errorf("certificate verification failed: %s",
+			VerifyCertErrorString(VerifyResult(code)))
+	}
+	sk := C.X509_STORE_CTX_get1_chain(ctx)
+	if sk == nil {
+		return nil, errors.New("no verified certificate chain")
+	}
+	defer C.X_sk_X509_free(sk)
+	runtime.KeepAlive(config.Roots)
+	runtime.KeepAlive(config.Intermediates)
+	return certificatesFromChain(sk), nil
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestCertificateVerify(t *testing.T) {
+	ca := newTestCertificate(t, "Test CA", true, nil)
+	intermediate := newTestCertificate(t, "Test Intermediate", true, ca)
+	leaf := newTestCertificate(t, "localhost", false, intermediate)
+	roots, err := NewCertificateStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := roots.AddCertificate(ca.cert); err != nil {
+		t.Fatal(err)
+	}
+	base := VerifyConfig{
+		Roots:         roots,
+		Intermediates: []*Certificate{intermediate.cert},
+		DNSName:       "localhost",
+	}
+
+	chain, err := leaf.cert.Verify(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 3 {
+		t.Fatalf("unexpected chain length %d", len(chain))
+	}
+
+	for _, test := range []struct {
+		name   string
+		modify func(*VerifyConfig)
+		ok     bool
+	}{
+		{"no intermediates", func(c *VerifyConfig) {
+			c.Intermediates = nil
+		}, false},
+		{"wrong name", func(c *VerifyConfig) {
+			c.DNSName = "example.com"
+		}, false},
+		{"skipped name", func(c *VerifyConfig) {
+			c.DNSName = "example.com"
+			c.SkipHostname = true
+		}, true},
+		{"expired", func(c *VerifyConfig) {
+			c.Time = time.Now().Add(48 * time.Hour)
+		}, false},
+		{"skipped expiry", func(c *VerifyConfig) {
+			c.Time = time.Now().Add(48 * time.Hour)
+			c.SkipExpiry = true
+		}, true},
+		{"wrong usage", func(c *VerifyConfig) {
+			c.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}
+		}, false},
+		{"one of the usages", func(c *VerifyConfig) {
+			c.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping,
+				x509.ExtKeyUsageClientAuth}
+		}, true},
+	} {
+		config := base
+		test.modify(&config)
+		_, err := leaf.cert.Verify(config)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: verification succeeded", test.name)
+		}
+	}
+}
+
+func TestCtxSetVerifyConfig(t *testing.T) {
+	ca := newTestCertificate(t, "Test CA", true, nil)
+	intermediate := newTestCertificate(t, "Test Intermediate", true, ca)
+	leaf := newTestCertificate(t, "localhost", false, intermediate)
+	roots, err := NewCertificateStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := roots.AddCertificate(ca.cert); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server doesn't send the intermediate
+	serverCtx, err := NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UseCertificate(leaf.cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCtx.UsePrivateKey(leaf.key); err != nil {
+		t.Fatal(err)
+	}
+
+	handshake := func(config VerifyConfig) error {
+		clientCtx, err := NewCtx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientCtx.SetVerifyMode(VerifyPeer)
+		if err := clientCtx.SetVerifyConfig(config); err != nil {
+			t.Fatal(err)
+		}
+		serverConn, clientConn := NetPipe(t)
+		defer serverConn.Close()
+		defer clientConn.Close()
+		server, err := Server(serverConn, serverCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := Client(clientConn, clientCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			if server.Handshake() != nil {
+				serverConn.Close()
+			}
+		}()
+		return client.Handshake()
+	}
+
+	config := VerifyConfig{
+		Roots:         roots,
+		Intermediates: []*Certificate{intermediate.cert},
+		DNSName:       "localhost",
+	}
+	if err := handshake(config); err != nil {
+		t.Fatal(err)
+	}
+	wrongName := config
+	wrongName.DNSName = "example.com"
+	if handshake(wrongName) == nil {
+		t.Fatal("wrong name is accepted")
+	}
+	noIntermediates := config
+	noIntermediates.Intermediates = nil
+	if handshake(noIntermediates) == nil {
+		t.Fatal("incomplete chain is accepted")
+	}
+	wrongUsage := config
+	wrongUsage.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}
+	if handshake(wrongUsage) == nil {
+		t.Fatal("wrong key usage is accepted")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+// #include "shim.h"
+import "C"
+
+import (
+	"time"
+)
+
+// SetVerifyTime makes peer verification check the validity of certificates
+// at t instead of the current time, e.g. to validate a chain as of a past
+// date. The zero time restores the current time. It applies to connections
+// created afterwards. See
+// https://www.openssl.org/docs/crypto/X509_VERIFY_PARAM_set_time.html
+func (c *Ctx) SetVerifyTime(t time.Time) {
+	c.verify_time = t
+	setVerifyTime(C.SSL_CTX_get0_param(c.ctx), t)
+}
+
+// SetVerifyClockSkew makes peer verification accept certificates that are
+// not yet valid or have expired by less than skew, to tolerate clocks that
+// are off. It applies to the verification time set with SetVerifyTime, if
+// any. The tolerance is lost if a connection sets its own verify callback
+// with SSL.SetVerify.
+func (c *Ctx) SetVerifyClockSkew(skew time.Duration) {
+	c.verify_skew = skew
+	c.SetVerify(c.VerifyMode(), c.verify_cb)
+}
+
+// withinClockSkew reports whether the current certificate of ctx failed
+// verification only because of its validity period, and is valid within the
+// clock skew.
+func (c *Ctx) withinClockSkew(ctx *C.X509_STORE_CTX) bool {
+	switch C.X509_STORE_CTX_get_error(ctx) {
+	case C.X509_V_ERR_CERT_NOT_YET_VALID, C.X509_V_ERR_CERT_HAS_EXPIRED:
+	default:
+		return false
+	}
+	cert := C.X509_STORE_CTX_get_current_cert(ctx)
+	if cert == nil {
+		return false
+	}
+	now := c.verify_time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return C.X_X509_check_time_skew(cert, C.time_t(now.Unix()),
+		C.long(c.verify_skew/time.Second)) == 1
+}
+
+// SetVerifyTime makes verification with the store check the validity of
+// certificates at t instead of the current time. The zero time restores the
+// current time. Contexts use their own verification time, see
+// Ctx.SetVerifyTime.
+func (s *CertificateStore) SetVerifyTime(t time.Time) {
+	setVerifyTime(C.X_X509_STORE_get0_param(s.store), t)
+}
+
+func setVerifyTime(param *C.X509_VERIFY_PARAM, t time.Time) {
+	if t.IsZero() {
+		C.X_X509_VERIFY_PARAM_set_time(param, 0, 0)
+	} else {
+		C.X_X509_VERIFY_PARAM_set_time(param, C.time_t(t.Unix()), 1)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2017. See AUTHORS.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openssl
+
+import "sync"
+
+// writevPool holds the buffers in which Writev coalesces small buffers into
+// writes of the write buffer size of the connections.
+var writevPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, DefaultWriteBufferSize)
+		return &b
+	},
+}
+
+// Writev encrypts the contents of bufs as if they were concatenated and
+// writes them to the underlying stream, like Write. Small buffers, such as
+// a header followed by a body, are coalesced into writes of the write buffer
+// size of the context, see Ctx.SetBufferSizes, and the parts of large buffers
+// that fill whole writes are passed to OpenSSL directly, so the buffers don't
+// have to be concatenated first. net.Buffers
+// can be passed as is. It returns the number of bytes written.
+func (c *Conn) Writev(bufs [][]byte) (written int64, err error) {
+	c.statsHandshakeStarted()
+	c.write_mtx.Lock()
+	defer c.write_mtx.Unlock()
+
+	size := c.write_size
+	scratch := writevPool.Get().(*[]byte)
+	defer writevPool.Put(scratch)
+	if cap(*scratch) < size {
+		*scratch = make([]byte, size)
+	}
+	pending := (*scratch)[:0:size]
+	flush := func() error {
+		n, err := c.writeAll(pending)
+		written += int64(n)
+		pending = pending[:0]
+		return err
+	}
+
+	for _, b := range bufs {
+		for len(b) > 0 && err == nil {
+			if len(pending) == 0 && len(b) >= size {
+				direct := len(b) - len(b)%size
+				var n int
+				n, err = c.writeAll(b[:direct])
+				written += int64(n)
+				b = b[direct:]
+				continue
+			}
+			n := copy(pending[len(pending):cap(pending)], b)
+			pending = pending[:len(pending)+n]
+			b = b[n:]
+			if len(pending) == cap(pending) {
+				err = flush()
+			}
+		}
+	}
+	if err == nil && len(pending) > 0 {
+		err = flush()
+	}
+	c.statsWrite(int(written), err)
+	return written, c.annotateError(err)
+}